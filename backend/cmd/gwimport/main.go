@@ -0,0 +1,213 @@
+// Command gwimport loads CGWB / INGRES groundwater assessment CSV exports, observation
+// well water levels from CGWB / India-WRIS, or district rainfall from IMD / India-WRIS
+// into the database and prints a validation report for each file.
+//
+//	go run ./cmd/gwimport -source cgwb -year 2023 annexure-block-2023.csv
+//	go run ./cmd/gwimport -kind wells -source wris water-levels-punjab.csv
+//	go run ./cmd/gwimport -kind rainfall -source imd district-rainfall-normals.csv
+//
+// Files that were already imported are skipped, so it is safe to re-run over a folder.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/config"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/database"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/groundwater"
+	"github.com/sirupsen/logrus"
+)
+
+// sources are where each kind of file may come from.
+var sources = map[string][]string{
+	"assessments": {"cgwb", "ingres"},
+	"wells":       {"cgwb", "wris"},
+	"rainfall":    {"imd", "wris"},
+}
+
+func main() {
+	kind := flag.String("kind", "assessments", "what the files hold: assessments, wells for observation well water levels, or rainfall")
+	source := flag.String("source", "cgwb", "where the files come from: cgwb or ingres for assessments, cgwb or wris for wells, imd or wris for rainfall")
+	year := flag.Int("year", 0, "year for files without a year or date column")
+	dryRun := flag.Bool("dry-run", false, "validate and report without writing to the database")
+	force := flag.Bool("force", false, "import files again even if they were imported before")
+	reportPath := flag.String("report", "", "write the JSON reports to this file, or - for stdout")
+	maxIssues := flag.Int("max-issues", 20, "issues printed per file; the JSON report has them all")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: gwimport [flags] file.csv...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 || !validSource(*kind, *source) {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+
+	cfg := config.Load()
+	db, err := database.NewService(cfg, logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gwimport: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	service := groundwater.NewService(db, logger)
+	opts := groundwater.ImportOptions{Source: *source, Year: *year, DryRun: *dryRun, Force: *force}
+
+	failed := false
+	var reports []interface{}
+	for _, path := range flag.Args() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "gwimport: %v\n", err)
+			failed = true
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		switch *kind {
+		case "wells":
+			report, err := service.ImportWells(ctx, filepath.Base(path), data, opts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+				failed = true
+			}
+			if report != nil {
+				printWellSummary(path, report, *maxIssues)
+				reports = append(reports, report)
+			}
+		case "rainfall":
+			report, err := service.ImportRainfall(ctx, filepath.Base(path), data, opts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+				failed = true
+			}
+			if report != nil {
+				printRainfallSummary(path, report, *maxIssues)
+				reports = append(reports, report)
+			}
+		default:
+			report, err := service.Import(ctx, filepath.Base(path), data, opts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+				failed = true
+			}
+			if report != nil {
+				printSummary(path, report, *maxIssues)
+				reports = append(reports, report)
+			}
+		}
+		cancel()
+	}
+
+	if *reportPath != "" {
+		if err := writeReports(*reportPath, reports); err != nil {
+			fmt.Fprintf(os.Stderr, "gwimport: %v\n", err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func printSummary(path string, report *groundwater.ImportReport, maxIssues int) {
+	if report.AlreadyImported {
+		fmt.Fprintf(os.Stderr, "%s: already imported as dataset version %d (use -force to re-apply)\n",
+			path, report.DatasetVersion)
+		return
+	}
+
+	mode := fmt.Sprintf("dataset version %d", report.DatasetVersion)
+	if report.DryRun {
+		mode = "dry run"
+	}
+	fmt.Fprintf(os.Stderr, "%s (%s): %d rows, %d accepted, %d rejected; %d inserted, %d updated, %d unchanged, %d new units\n",
+		path, mode, report.Rows, report.Accepted, report.Rejected, report.Inserted, report.Updated,
+		report.Unchanged, report.UnitsCreated)
+	printIssues(report.Issues, maxIssues)
+}
+
+func printWellSummary(path string, report *groundwater.WellImportReport, maxIssues int) {
+	if report.AlreadyImported {
+		fmt.Fprintf(os.Stderr, "%s: already imported (use -force to re-apply)\n", path)
+		return
+	}
+
+	mode := "imported"
+	if report.DryRun {
+		mode = "dry run"
+	}
+	fmt.Fprintf(os.Stderr, "%s (%s): %d rows, %d accepted, %d rejected; %d inserted, %d updated, %d unchanged; %d new wells, %d without a unit, %d outliers\n",
+		path, mode, report.Rows, report.Accepted, report.Rejected, report.Inserted, report.Updated,
+		report.Unchanged, report.WellsCreated, report.WellsUnlocated, report.Outliers)
+	printIssues(report.Issues, maxIssues)
+}
+
+func printRainfallSummary(path string, report *groundwater.RainfallImportReport, maxIssues int) {
+	if report.AlreadyImported {
+		fmt.Fprintf(os.Stderr, "%s: already imported (use -force to re-apply)\n", path)
+		return
+	}
+
+	mode := "imported"
+	if report.DryRun {
+		mode = "dry run"
+	}
+	if report.Normals {
+		mode += ", normals"
+	}
+	fmt.Fprintf(os.Stderr, "%s (%s): %d rows, %d accepted, %d rejected; %d months inserted, %d updated, %d unchanged; %d districts not on record\n",
+		path, mode, report.Rows, report.Accepted, report.Rejected, report.Inserted, report.Updated,
+		report.Unchanged, report.DistrictsUnmatched)
+	printIssues(report.Issues, maxIssues)
+}
+
+func printIssues(issues []groundwater.Issue, maxIssues int) {
+	for i, issue := range issues {
+		if i == maxIssues {
+			fmt.Fprintf(os.Stderr, "  ... and %d more\n", len(issues)-maxIssues)
+			break
+		}
+		location := ""
+		if issue.Line > 0 {
+			location = fmt.Sprintf("line %d: ", issue.Line)
+		}
+		fmt.Fprintf(os.Stderr, "  %s %s%s\n", issue.Severity, location, issue.Message)
+	}
+}
+
+func validSource(kind, source string) bool {
+	for _, s := range sources[kind] {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
+
+func writeReports(path string, reports []interface{}) error {
+	out := os.Stdout
+	if path != "-" {
+		file, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(reports)
+}
@@ -0,0 +1,83 @@
+// Command passwordtune benchmarks argon2id on the current machine and prints the
+// PASSWORD_ARGON2_* settings that make one hash take about the target duration.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/auth"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/config"
+)
+
+const maxIterations = 10
+
+func main() {
+	target := flag.Duration("target", 500*time.Millisecond, "desired time per hash")
+	maxMemory := flag.Int("max-memory", 256*1024, "most memory per hash in KiB; keep concurrent logins in mind")
+	minMemory := flag.Int("min-memory", 19*1024, "least memory per hash in KiB")
+	parallelism := flag.Int("parallelism", min(runtime.NumCPU(), 4), "threads per hash")
+	samples := flag.Int("samples", 3, "hashes timed per candidate")
+	flag.Parse()
+
+	if *parallelism < 1 || *parallelism > 255 || *minMemory > *maxMemory || *samples < 1 {
+		fmt.Fprintln(os.Stderr, "passwordtune: invalid flags")
+		os.Exit(2)
+	}
+
+	params := config.PasswordConfig{
+		Algorithm:         "argon2id",
+		Argon2Parallelism: uint8(*parallelism),
+		Argon2SaltLength:  16,
+		Argon2KeyLength:   32,
+	}
+
+	// Memory is the stronger defence against GPUs, so spend the budget on memory first,
+	// halving it until a single pass fits, then add passes while they still fit
+	params.Argon2Memory = uint32(*maxMemory)
+	params.Argon2Iterations = 1
+	elapsed := measure(params, *samples)
+	for elapsed > *target && params.Argon2Memory/2 >= uint32(*minMemory) {
+		params.Argon2Memory /= 2
+		elapsed = measure(params, *samples)
+	}
+
+	for params.Argon2Iterations < maxIterations {
+		next := params
+		next.Argon2Iterations++
+		nextElapsed := measure(next, *samples)
+		if nextElapsed > *target {
+			break
+		}
+		params, elapsed = next, nextElapsed
+	}
+
+	if elapsed > *target {
+		fmt.Fprintf(os.Stderr, "passwordtune: even the minimum settings take %s on this machine\n", elapsed.Round(time.Millisecond))
+	}
+
+	fmt.Printf("# argon2id takes about %s per hash on %d CPUs\n", elapsed.Round(time.Millisecond), runtime.NumCPU())
+	fmt.Println("PASSWORD_HASH_ALGORITHM=argon2id")
+	fmt.Printf("PASSWORD_ARGON2_MEMORY=%d\n", params.Argon2Memory)
+	fmt.Printf("PASSWORD_ARGON2_ITERATIONS=%d\n", params.Argon2Iterations)
+	fmt.Printf("PASSWORD_ARGON2_PARALLELISM=%d\n", params.Argon2Parallelism)
+}
+
+// measure returns the fastest of several timed hashes, which is the least noisy estimate.
+func measure(params config.PasswordConfig, samples int) time.Duration {
+	best := time.Duration(-1)
+	for i := 0; i < samples; i++ {
+		start := time.Now()
+		if _, err := auth.HashPassword("passwordtune-benchmark", params); err != nil {
+			fmt.Fprintf(os.Stderr, "passwordtune: %v\n", err)
+			os.Exit(1)
+		}
+		if elapsed := time.Since(start); best < 0 || elapsed < best {
+			best = elapsed
+		}
+	}
+	return best
+}
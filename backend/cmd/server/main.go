@@ -25,7 +25,10 @@ func main() {
 
 	// Load configuration
 	cfg := config.Load()
-	logger.WithField("config", cfg).Info("Configuration loaded")
+	if err := cfg.Validate(); err != nil {
+		logger.WithError(err).Fatal("Invalid configuration")
+	}
+	logger.WithField("environment", cfg.Server.Environment).Info("Configuration loaded")
 
 	// Initialize database
 	db, err := database.NewService(cfg, logger)
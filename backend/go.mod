@@ -22,4 +22,5 @@ require (
 	github.com/99designs/gqlgen v0.17.42
 	github.com/vektah/gqlparser/v2 v2.5.10
 	github.com/graph-gophers/graphql-go v1.5.0
+	github.com/DATA-DOG/go-sqlmock v1.5.2
 )
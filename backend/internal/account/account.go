@@ -0,0 +1,41 @@
+// Package account implements what users can do with their account as a whole:
+// exporting their data and deleting it.
+package account
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/auth"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/config"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/database"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/mail"
+	"github.com/sirupsen/logrus"
+)
+
+// TombstoneUserID is the placeholder user that takes over messages and conversations of
+// anonymised accounts, so other participants keep their history.
+var TombstoneUserID = uuid.MustParse("00000000-0000-0000-0000-00000000dead")
+
+var ErrInvalidCancelToken = errors.New("invalid or expired cancellation link")
+
+type Service struct {
+	db     *database.Service
+	config config.AccountConfig
+	// publicURL is where the web app is served, for cancellation links
+	publicURL string
+	auth      *auth.Service
+	mailer    mail.Sender
+	logger    *logrus.Logger
+}
+
+func NewService(db *database.Service, cfg *config.Config, authService *auth.Service, mailer mail.Sender, logger *logrus.Logger) *Service {
+	return &Service{
+		db:        db,
+		config:    cfg.Account,
+		publicURL: cfg.Server.PublicURL,
+		auth:      authService,
+		mailer:    mailer,
+		logger:    logger,
+	}
+}
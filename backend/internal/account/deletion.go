@@ -0,0 +1,289 @@
+package account
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/auth"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/database"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/mail"
+)
+
+// Deletion happens in three steps:
+//
+//  1. RequestDeletion soft-deletes the account and signs it out everywhere. Until
+//     purge_after the user can cancel with the emailed link.
+//  2. After the grace period, anonymise hands messages and conversations to the tombstone
+//     user and scrubs everything that identifies the person.
+//  3. After the retention period the anonymised row is deleted outright.
+
+// RequestDeletion schedules the user's account for deletion and returns when it becomes final.
+func (s *Service) RequestDeletion(ctx context.Context, userID uuid.UUID, proof auth.Reauthentication, client auth.ClientInfo) (time.Time, error) {
+	if err := s.auth.ConfirmIdentity(ctx, userID, proof); err != nil {
+		return time.Time{}, err
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return time.Time{}, err
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	now := time.Now()
+	purgeAfter := now.Add(s.config.DeletionGracePeriod)
+	var email, username string
+	err := s.db.WithTransaction(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, `
+			UPDATE users SET deleted_at = $1, purge_after = $2, deletion_cancel_token = $3, updated_at = $1
+			WHERE id = $4 AND deleted_at IS NULL
+			RETURNING email, username`, now, purgeAfter, token, userID).Scan(&email, &username)
+		if err == sql.ErrNoRows {
+			return auth.ErrUserNotFound
+		} else if err != nil {
+			return err
+		}
+
+		return database.RecordAudit(ctx, tx, database.AuditEntry{
+			UserID:       userID.String(),
+			Action:       "account.deletion_requested",
+			ResourceType: "user",
+			ResourceID:   userID.String(),
+			NewValues:    map[string]interface{}{"purge_after": purgeAfter},
+			IPAddress:    client.IPAddress,
+			UserAgent:    client.UserAgent,
+		})
+	})
+	if err == auth.ErrUserNotFound {
+		return time.Time{}, err
+	} else if err != nil {
+		return time.Time{}, fmt.Errorf("account deletion error: %w", err)
+	}
+
+	if _, err := s.auth.RevokeAllSessions(ctx, userID); err != nil {
+		return time.Time{}, fmt.Errorf("session revocation error: %w", err)
+	}
+	if err := s.auth.InvalidateUserTokens(ctx, userID); err != nil {
+		return time.Time{}, fmt.Errorf("token invalidation error: %w", err)
+	}
+
+	if err := s.mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Your Ground Sense account will be deleted",
+		Body: fmt.Sprintf("Hi %s,\n\nYour Ground Sense account has been closed and will be permanently "+
+			"deleted on %s UTC. Your messages will stay in their conversations without your name.\n\n"+
+			"Changed your mind? Restore your account before then:\n%s/cancel-deletion?token=%s",
+			username, purgeAfter.UTC().Format("2 January 2006 15:04"), s.publicURL, token),
+	}); err != nil {
+		// The deletion stands; the user just can't cancel it by link
+		s.logger.WithError(err).WithField("user_id", userID).Error("Failed to send account deletion notice")
+	}
+
+	return purgeAfter, nil
+}
+
+// CancelDeletion restores an account whose grace period hasn't ended. The user signs in again afterwards.
+func (s *Service) CancelDeletion(ctx context.Context, token string, client auth.ClientInfo) error {
+	return s.db.WithTransaction(ctx, func(tx *sql.Tx) error {
+		var userID uuid.UUID
+		err := tx.QueryRowContext(ctx, `
+			UPDATE users SET deleted_at = NULL, purge_after = NULL, deletion_cancel_token = NULL, updated_at = $1
+			WHERE deletion_cancel_token = $2 AND anonymized_at IS NULL AND purge_after > $1
+			RETURNING id`, time.Now(), token).Scan(&userID)
+		if err == sql.ErrNoRows {
+			return ErrInvalidCancelToken
+		} else if err != nil {
+			return fmt.Errorf("account restore error: %w", err)
+		}
+
+		return database.RecordAudit(ctx, tx, database.AuditEntry{
+			UserID:       userID.String(),
+			Action:       "account.deletion_cancelled",
+			ResourceType: "user",
+			ResourceID:   userID.String(),
+			IPAddress:    client.IPAddress,
+			UserAgent:    client.UserAgent,
+		})
+	})
+}
+
+// Run purges due accounts every interval until ctx is cancelled.
+func (s *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		anonymised, purged, err := s.Purge(ctx)
+		if err != nil {
+			s.logger.WithError(err).Error("Account purge failed")
+		} else if anonymised > 0 || purged > 0 {
+			s.logger.WithField("anonymised", anonymised).WithField("purged", purged).Info("Purged deleted accounts")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge anonymises accounts whose grace period is over and deletes anonymised accounts
+// past retention. Each account is handled in its own transaction.
+func (s *Service) Purge(ctx context.Context) (anonymised, purged int, err error) {
+	now := time.Now()
+
+	due, err := s.accountIDs(ctx, `
+		SELECT id FROM users WHERE purge_after <= $1 AND anonymized_at IS NULL AND id <> $2`,
+		now, TombstoneUserID)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, userID := range due {
+		done, err := s.anonymise(ctx, userID, now)
+		if err != nil {
+			return anonymised, purged, fmt.Errorf("anonymising %s: %w", userID, err)
+		}
+		if done {
+			anonymised++
+		}
+	}
+
+	expired, err := s.accountIDs(ctx, `
+		SELECT id FROM users WHERE anonymized_at IS NOT NULL AND deleted_at <= $1 AND id <> $2`,
+		now.Add(-s.config.DeletedRetention), TombstoneUserID)
+	if err != nil {
+		return anonymised, 0, err
+	}
+	for _, userID := range expired {
+		if err := s.purge(ctx, userID); err != nil {
+			return anonymised, purged, fmt.Errorf("purging %s: %w", userID, err)
+		}
+		purged++
+	}
+
+	return anonymised, purged, nil
+}
+
+func (s *Service) accountIDs(ctx context.Context, query string, args ...interface{}) ([]uuid.UUID, error) {
+	rows, err := s.db.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// anonymise reassigns the user's content to the tombstone user and removes their
+// personal data, leaving a row that only links the audit trail.
+// It reports false if the deletion was cancelled in the meantime.
+func (s *Service) anonymise(ctx context.Context, userID uuid.UUID, now time.Time) (bool, error) {
+	done := false
+	err := s.db.WithTransaction(ctx, func(tx *sql.Tx) error {
+		var email string
+		err := tx.QueryRowContext(ctx, `
+			SELECT email FROM users WHERE id = $1 AND purge_after <= $2 AND anonymized_at IS NULL
+			FOR UPDATE`, userID, now).Scan(&email)
+		if err == sql.ErrNoRows {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		for _, query := range []string{
+			"UPDATE messages SET sender_id = $2 WHERE sender_id = $1",
+			"UPDATE conversations SET created_by = $2 WHERE created_by = $1",
+		} {
+			if _, err := tx.ExecContext(ctx, query, userID, TombstoneUserID); err != nil {
+				return err
+			}
+		}
+		for _, query := range []string{
+			"DELETE FROM message_reactions WHERE user_id = $1",
+			"DELETE FROM conversation_participants WHERE user_id = $1",
+			"DELETE FROM refresh_tokens WHERE user_id = $1",
+			"DELETE FROM user_sessions WHERE user_id = $1",
+			"DELETE FROM user_identities WHERE user_id = $1",
+			"DELETE FROM api_keys WHERE user_id = $1",
+			"DELETE FROM password_history WHERE user_id = $1",
+			"DELETE FROM phone_otps WHERE user_id = $1",
+			"DELETE FROM login_challenges WHERE user_id = $1",
+			"DELETE FROM email_change_requests WHERE user_id = $1",
+			"DELETE FROM reauth_codes WHERE user_id = $1",
+			"DELETE FROM oidc_login_codes WHERE user_id = $1",
+			"DELETE FROM groundwater_watchlist WHERE user_id = $1",
+			"DELETE FROM groundwater_alert_preferences WHERE user_id = $1",
+			"DELETE FROM groundwater_alerts WHERE user_id = $1",
+			"UPDATE audit_logs SET ip_address = NULL, user_agent = NULL WHERE user_id = $1",
+		} {
+			if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+				return err
+			}
+		}
+		for _, query := range []string{
+			"DELETE FROM login_tokens WHERE email = $1",
+			"DELETE FROM password_reset_tokens WHERE email = $1",
+			"DELETE FROM account_unlock_tokens WHERE email = $1",
+			"DELETE FROM login_throttles WHERE key = 'account:' || LOWER($1)",
+		} {
+			if _, err := tx.ExecContext(ctx, query, email); err != nil {
+				return err
+			}
+		}
+
+		// Usernames and emails are unique, so the placeholders are derived from the ID
+		_, err = tx.ExecContext(ctx, `
+			UPDATE users SET username = 'deleted-' || LEFT(REPLACE(id::text, '-', ''), 12),
+			                 email = 'deleted-' || id::text || '@deleted.invalid',
+			                 password_hash = '!', first_name = NULL, last_name = NULL, phone = NULL,
+			                 avatar_url = NULL, email_verified = false, phone_verified = false,
+			                 status = 'inactive', deletion_cancel_token = NULL, anonymized_at = $2, updated_at = $2
+			WHERE id = $1`, userID, now)
+		if err != nil {
+			return err
+		}
+
+		done = true
+		return database.RecordAudit(ctx, tx, database.AuditEntry{
+			UserID:       userID.String(),
+			Action:       "account.anonymized",
+			ResourceType: "user",
+			ResourceID:   userID.String(),
+		})
+	})
+	return done, err
+}
+
+// purge deletes an anonymised account. Audit entries outlive it without the link to the row.
+func (s *Service) purge(ctx context.Context, userID uuid.UUID) error {
+	return s.db.WithTransaction(ctx, func(tx *sql.Tx) error {
+		for _, query := range []string{
+			"UPDATE audit_logs SET user_id = NULL WHERE user_id = $1",
+			"UPDATE audit_logs SET actor_id = NULL WHERE actor_id = $1",
+			"DELETE FROM users WHERE id = $1",
+		} {
+			if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+				return err
+			}
+		}
+
+		return database.RecordAudit(ctx, tx, database.AuditEntry{
+			Action:       "account.purged",
+			ResourceType: "user",
+			ResourceID:   userID.String(),
+		})
+	})
+}
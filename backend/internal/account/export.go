@@ -0,0 +1,288 @@
+package account
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/auth"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/database"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+)
+
+type exportedIdentity struct {
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"subject"`
+	Email       *string    `json:"email,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+type exportedProfile struct {
+	models.User
+	Identities []exportedIdentity `json:"identities"`
+}
+
+type exportedConversation struct {
+	ID          uuid.UUID `json:"id"`
+	Type        string    `json:"type"`
+	Name        *string   `json:"name,omitempty"`
+	Description *string   `json:"description,omitempty"`
+	CreatedByMe bool      `json:"created_by_me"`
+	Role        string    `json:"role"`
+	JoinedAt    time.Time `json:"joined_at"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type exportedMessage struct {
+	ID             uuid.UUID        `json:"id"`
+	ConversationID uuid.UUID        `json:"conversation_id"`
+	Content        string           `json:"content"`
+	MessageType    string           `json:"message_type"`
+	Status         string           `json:"status"`
+	ReplyToID      *uuid.UUID       `json:"reply_to_id,omitempty"`
+	Metadata       *json.RawMessage `json:"metadata,omitempty"`
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+	DeletedAt      *time.Time       `json:"deleted_at,omitempty"`
+}
+
+type exportedAttachment struct {
+	ID           uuid.UUID `json:"id"`
+	MessageID    uuid.UUID `json:"message_id"`
+	FileName     string    `json:"file_name"`
+	FileSize     int64     `json:"file_size"`
+	MimeType     string    `json:"mime_type"`
+	URL          string    `json:"url"`
+	ThumbnailURL *string   `json:"thumbnail_url,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type exportedWatch struct {
+	UnitID    uuid.UUID `json:"unit_id"`
+	Level     string    `json:"level"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// exportedEmailChange is an email change request, without its confirmation tokens.
+type exportedEmailChange struct {
+	OldEmail       string     `json:"old_email"`
+	NewEmail       string     `json:"new_email"`
+	OldConfirmedAt *time.Time `json:"old_confirmed_at,omitempty"`
+	NewConfirmedAt *time.Time `json:"new_confirmed_at,omitempty"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// exportFile is one JSON array in the archive, streamed from a query.
+type exportFile struct {
+	name  string
+	query string
+	scan  func(*sql.Rows) (interface{}, error)
+}
+
+var exportFiles = []exportFile{
+	{
+		name: "conversations.json",
+		query: `
+			SELECT c.id, c.type, c.name, c.description, c.created_by = $1, p.role, p.joined_at, c.created_at
+			FROM conversations c JOIN conversation_participants p ON p.conversation_id = c.id
+			WHERE p.user_id = $1 ORDER BY c.created_at`,
+		scan: func(rows *sql.Rows) (interface{}, error) {
+			var c exportedConversation
+			err := rows.Scan(&c.ID, &c.Type, &c.Name, &c.Description, &c.CreatedByMe, &c.Role, &c.JoinedAt, &c.CreatedAt)
+			return c, err
+		},
+	},
+	{
+		name: "messages.json",
+		query: `
+			SELECT id, conversation_id, content, message_type, status, reply_to_id, metadata,
+			       created_at, updated_at, deleted_at
+			FROM messages WHERE sender_id = $1 ORDER BY created_at`,
+		scan: func(rows *sql.Rows) (interface{}, error) {
+			var m exportedMessage
+			err := rows.Scan(&m.ID, &m.ConversationID, &m.Content, &m.MessageType, &m.Status, &m.ReplyToID,
+				&m.Metadata, &m.CreatedAt, &m.UpdatedAt, &m.DeletedAt)
+			return m, err
+		},
+	},
+	{
+		name: "attachments.json",
+		query: `
+			SELECT a.id, a.message_id, a.file_name, a.file_size, a.mime_type, a.url, a.thumbnail_url, a.created_at
+			FROM message_attachments a JOIN messages m ON m.id = a.message_id
+			WHERE m.sender_id = $1 ORDER BY a.created_at`,
+		scan: func(rows *sql.Rows) (interface{}, error) {
+			var a exportedAttachment
+			err := rows.Scan(&a.ID, &a.MessageID, &a.FileName, &a.FileSize, &a.MimeType, &a.URL,
+				&a.ThumbnailURL, &a.CreatedAt)
+			return a, err
+		},
+	},
+	{
+		name: "watchlist.json",
+		query: `
+			SELECT u.id, u.level, u.name, w.created_at
+			FROM groundwater_watchlist w JOIN groundwater_units u ON u.id = w.unit_id
+			WHERE w.user_id = $1 ORDER BY w.created_at`,
+		scan: func(rows *sql.Rows) (interface{}, error) {
+			var item exportedWatch
+			err := rows.Scan(&item.UnitID, &item.Level, &item.Name, &item.CreatedAt)
+			return item, err
+		},
+	},
+	{
+		name: "email_changes.json",
+		query: `
+			SELECT old_email, new_email, old_confirmed_at, new_confirmed_at, expires_at, completed_at, created_at
+			FROM email_change_requests WHERE user_id = $1 ORDER BY created_at`,
+		scan: func(rows *sql.Rows) (interface{}, error) {
+			var c exportedEmailChange
+			err := rows.Scan(&c.OldEmail, &c.NewEmail, &c.OldConfirmedAt, &c.NewConfirmedAt, &c.ExpiresAt,
+				&c.CompletedAt, &c.CreatedAt)
+			return c, err
+		},
+	},
+	{
+		name: "audit_logs.json",
+		query: `
+			SELECT id, user_id, actor_id, action, resource_type, resource_id, old_values, new_values,
+			       HOST(ip_address), user_agent, created_at
+			FROM audit_logs WHERE user_id = $1 ORDER BY created_at`,
+		scan: func(rows *sql.Rows) (interface{}, error) {
+			var entry models.AuditLog
+			err := rows.Scan(&entry.ID, &entry.UserID, &entry.ActorID, &entry.Action, &entry.ResourceType,
+				&entry.ResourceID, &entry.OldValues, &entry.NewValues, &entry.IPAddress, &entry.UserAgent,
+				&entry.CreatedAt)
+			return entry, err
+		},
+	},
+}
+
+// Export writes a ZIP archive of everything stored about the user: their profile,
+// conversations, the messages they sent, attachment metadata, their watchlist, their email changes
+// and their audit trail.
+// Nothing is buffered, so a failure part-way leaves a truncated archive.
+func (s *Service) Export(ctx context.Context, userID uuid.UUID, w io.Writer, client auth.ClientInfo) error {
+	profile, err := s.exportProfile(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	if err := writeJSONFile(zw, "profile.json", profile); err != nil {
+		return err
+	}
+	for _, file := range exportFiles {
+		if err := s.writeExportFile(ctx, zw, file, userID); err != nil {
+			return fmt.Errorf("%s: %w", file.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	return database.RecordAudit(ctx, s.db.DB, database.AuditEntry{
+		UserID:       userID.String(),
+		Action:       "account.exported",
+		ResourceType: "user",
+		ResourceID:   userID.String(),
+		IPAddress:    client.IPAddress,
+		UserAgent:    client.UserAgent,
+	})
+}
+
+func (s *Service) exportProfile(ctx context.Context, userID uuid.UUID) (*exportedProfile, error) {
+	profile := &exportedProfile{Identities: []exportedIdentity{}}
+	u := &profile.User
+	var accountType models.AccountType
+	err := s.db.DB.QueryRowContext(ctx, `
+		SELECT id, username, email, COALESCE(first_name, ''), COALESCE(last_name, ''), COALESCE(phone, ''),
+		       COALESCE(avatar_url, ''), role, status, email_verified, phone_verified, last_login_at,
+		       created_at, updated_at, account_type
+		FROM users WHERE id = $1 AND deleted_at IS NULL`, userID).Scan(
+		&u.ID, &u.Username, &u.Email, &u.FirstName, &u.LastName, &u.Phone, &u.AvatarURL, &u.Role, &u.Status,
+		&u.EmailVerified, &u.PhoneVerified, &u.LastLoginAt, &u.CreatedAt, &u.UpdatedAt, &accountType)
+	if err == sql.ErrNoRows {
+		return nil, auth.ErrUserNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("user lookup error: %w", err)
+	}
+	u.SetAccountType(accountType)
+
+	rows, err := s.db.DB.QueryContext(ctx, `
+		SELECT provider, subject, email, created_at, last_login_at
+		FROM user_identities WHERE user_id = $1 ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("identity lookup error: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var identity exportedIdentity
+		if err := rows.Scan(&identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt,
+			&identity.LastLoginAt); err != nil {
+			return nil, err
+		}
+		profile.Identities = append(profile.Identities, identity)
+	}
+	return profile, rows.Err()
+}
+
+func (s *Service) writeExportFile(ctx context.Context, zw *zip.Writer, file exportFile, userID uuid.UUID) error {
+	rows, err := s.db.DB.QueryContext(ctx, file.query, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	out, err := zw.Create(file.name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(out, "["); err != nil {
+		return err
+	}
+	for first := true; rows.Next(); first = false {
+		item, err := file.scan(rows)
+		if err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(item, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		separator := ",\n  "
+		if first {
+			separator = "\n  "
+		}
+		if _, err := io.WriteString(out, separator); err != nil {
+			return err
+		}
+		if _, err := out.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err = io.WriteString(out, "\n]\n")
+	return err
+}
+
+func writeJSONFile(zw *zip.Writer, name string, value interface{}) error {
+	out, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
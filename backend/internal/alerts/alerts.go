@@ -0,0 +1,218 @@
+// Package alerts tells users when the groundwater units on their watchlist change
+// category or stage of extraction from one assessment year to the next, as system
+// messages in the app and by email, straight away or in a weekly digest.
+package alerts
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/config"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/database"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/groundwater"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/mail"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+// AlertsUserID is the user alert messages are sent by.
+var AlertsUserID = database.SystemUserID
+
+// MaxWatchedUnits bounds one user's watchlist.
+const MaxWatchedUnits = 100
+
+var (
+	ErrNotWatching   = errors.New("unit is not on your watchlist")
+	ErrWatchlistFull = fmt.Errorf("a watchlist can hold at most %d units", MaxWatchedUnits)
+)
+
+type Service struct {
+	db     *database.Service
+	config config.AlertConfig
+	// publicURL is where the web app is served, for links in emails
+	publicURL string
+	mailer    mail.Sender
+	logger    *logrus.Logger
+}
+
+func NewService(db *database.Service, cfg *config.Config, mailer mail.Sender, logger *logrus.Logger) *Service {
+	return &Service{
+		db:        db,
+		config:    cfg.Alerts,
+		publicURL: cfg.Server.PublicURL,
+		mailer:    mailer,
+		logger:    logger,
+	}
+}
+
+// Watchlist returns the units the user watches, in hierarchy order.
+func (s *Service) Watchlist(ctx context.Context, userID uuid.UUID) ([]models.WatchedUnit, error) {
+	rows, err := s.db.DB.QueryContext(ctx, `
+		SELECT u.id, u.parent_id, u.level, u.name, u.path, u.code, u.created_at, w.created_at
+		FROM groundwater_watchlist w JOIN groundwater_units u ON u.id = w.unit_id
+		WHERE w.user_id = $1 ORDER BY u.path`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("watchlist lookup error: %w", err)
+	}
+	defer rows.Close()
+
+	watched := []models.WatchedUnit{}
+	for rows.Next() {
+		var item models.WatchedUnit
+		if err := rows.Scan(&item.Unit.ID, &item.Unit.ParentID, &item.Unit.Level, &item.Unit.Name, &item.Unit.Path,
+			&item.Unit.Code, &item.Unit.CreatedAt, &item.CreatedAt); err != nil {
+			return nil, err
+		}
+		watched = append(watched, item)
+	}
+	return watched, rows.Err()
+}
+
+// Watch adds a unit to the user's watchlist. Watching a unit twice is not an error.
+func (s *Service) Watch(ctx context.Context, userID, unitID uuid.UUID) error {
+	return s.db.WithTransaction(ctx, func(tx *sql.Tx) error {
+		var exists bool
+		if err := tx.QueryRowContext(ctx,
+			"SELECT EXISTS (SELECT 1 FROM groundwater_units WHERE id = $1)", unitID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return groundwater.ErrUnitNotFound
+		}
+
+		// Lock the user's row so concurrent requests can't both slip under the limit
+		if _, err := tx.ExecContext(ctx, "SELECT 1 FROM users WHERE id = $1 FOR UPDATE", userID); err != nil {
+			return err
+		}
+		var count int
+		if err := tx.QueryRowContext(ctx,
+			"SELECT COUNT(*) FROM groundwater_watchlist WHERE user_id = $1 AND unit_id <> $2", userID, unitID).
+			Scan(&count); err != nil {
+			return err
+		}
+		if count >= MaxWatchedUnits {
+			return ErrWatchlistFull
+		}
+
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO groundwater_watchlist (user_id, unit_id) VALUES ($1, $2)
+			ON CONFLICT (user_id, unit_id) DO NOTHING`, userID, unitID)
+		return err
+	})
+}
+
+// Unwatch removes a unit from the user's watchlist.
+func (s *Service) Unwatch(ctx context.Context, userID, unitID uuid.UUID) error {
+	result, err := s.db.DB.ExecContext(ctx,
+		"DELETE FROM groundwater_watchlist WHERE user_id = $1 AND unit_id = $2", userID, unitID)
+	if err != nil {
+		return fmt.Errorf("watchlist update error: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotWatching
+	}
+	return nil
+}
+
+// Preferences returns the user's alert preferences, or the defaults: immediate delivery
+// with email.
+func (s *Service) Preferences(ctx context.Context, userID uuid.UUID) (*models.AlertPreferences, error) {
+	prefs := &models.AlertPreferences{Delivery: models.AlertDeliveryImmediate, EmailEnabled: true}
+	err := s.db.DB.QueryRowContext(ctx, `
+		SELECT delivery, email_enabled, stage_threshold, last_digest_at
+		FROM groundwater_alert_preferences WHERE user_id = $1`, userID).
+		Scan(&prefs.Delivery, &prefs.EmailEnabled, &prefs.StageThreshold, &prefs.LastDigestAt)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("alert preferences lookup error: %w", err)
+	}
+	return prefs, nil
+}
+
+// SetPreferences stores the user's alert preferences. The first weekly digest goes out a
+// week after choosing weekly delivery.
+func (s *Service) SetPreferences(ctx context.Context, userID uuid.UUID, prefs models.AlertPreferences) (*models.AlertPreferences, error) {
+	_, err := s.db.DB.ExecContext(ctx, `
+		INSERT INTO groundwater_alert_preferences (user_id, delivery, email_enabled, stage_threshold, last_digest_at, updated_at)
+		VALUES ($1, $2, $3, $4, CASE WHEN $5 THEN NOW() END, NOW())
+		ON CONFLICT (user_id) DO UPDATE SET delivery = EXCLUDED.delivery, email_enabled = EXCLUDED.email_enabled,
+			stage_threshold = EXCLUDED.stage_threshold,
+			last_digest_at = CASE WHEN EXCLUDED.delivery = 'weekly'
+				THEN COALESCE(groundwater_alert_preferences.last_digest_at, NOW()) END,
+			updated_at = EXCLUDED.updated_at`,
+		userID, prefs.Delivery, prefs.EmailEnabled, prefs.StageThreshold, prefs.Delivery == models.AlertDeliveryWeekly)
+	if err != nil {
+		return nil, fmt.Errorf("alert preferences update error: %w", err)
+	}
+	return s.Preferences(ctx, userID)
+}
+
+const alertColumns = `a.id, u.id, u.parent_id, u.level, u.name, u.path, u.code, u.created_at,
+	COALESCE((SELECT s.name FROM groundwater_units s WHERE s.path = split_part(u.path, '/', 1)), ''),
+	a.year, a.previous_year, a.category, a.previous_category, a.stage_of_extraction, a.previous_stage,
+	a.created_at, a.delivered_at`
+
+func scanAlert(rows *sql.Rows) (models.GroundwaterAlert, error) {
+	var a models.GroundwaterAlert
+	err := rows.Scan(&a.ID, &a.Unit.ID, &a.Unit.ParentID, &a.Unit.Level, &a.Unit.Name, &a.Unit.Path, &a.Unit.Code,
+		&a.Unit.CreatedAt, &a.State, &a.Year, &a.PreviousYear, &a.Category, &a.PreviousCategory,
+		&a.StageOfExtraction, &a.PreviousStage, &a.CreatedAt, &a.DeliveredAt)
+	return a, err
+}
+
+// Alerts returns the user's alerts, newest first, including those still waiting for
+// the next digest.
+func (s *Service) Alerts(ctx context.Context, userID uuid.UUID, limit, offset int) ([]models.GroundwaterAlert, int, error) {
+	var total int
+	if err := s.db.DB.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM groundwater_alerts WHERE user_id = $1", userID).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("alert count error: %w", err)
+	}
+
+	rows, err := s.db.DB.QueryContext(ctx, `
+		SELECT `+alertColumns+`
+		FROM groundwater_alerts a JOIN groundwater_units u ON u.id = a.unit_id
+		WHERE a.user_id = $1 ORDER BY a.created_at DESC, u.path LIMIT $2 OFFSET $3`, userID, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("alert lookup error: %w", err)
+	}
+	defer rows.Close()
+
+	alerts := []models.GroundwaterAlert{}
+	for rows.Next() {
+		a, err := scanAlert(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, total, rows.Err()
+}
+
+// Run diffs new datasets and delivers alerts every interval until ctx is cancelled.
+func (s *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if created, err := s.Diff(ctx); err != nil {
+			s.logger.WithError(err).Error("Groundwater alert diff failed")
+		} else if created > 0 {
+			s.logger.WithField("alerts", created).Info("Created groundwater alerts")
+		}
+		if delivered, err := s.Deliver(ctx, time.Now()); err != nil {
+			s.logger.WithError(err).Error("Groundwater alert delivery failed")
+		} else if delivered > 0 {
+			s.logger.WithField("users", delivered).Info("Delivered groundwater alerts")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
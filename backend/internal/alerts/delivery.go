@@ -0,0 +1,231 @@
+package alerts
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/chat"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/groundwater"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/mail"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+	"github.com/lib/pq"
+)
+
+// recipient is a user with alerts to deliver now.
+type recipient struct {
+	userID       uuid.UUID
+	email        string
+	digest       bool
+	emailEnabled bool
+}
+
+// Deliver sends pending alerts to users who want them immediately and to weekly users
+// whose digest is due, one message per user. It returns how many users were sent one.
+func (s *Service) Deliver(ctx context.Context, now time.Time) (int, error) {
+	rows, err := s.db.DB.QueryContext(ctx, `
+		SELECT DISTINCT a.user_id, u.email, COALESCE(p.delivery, 'immediate') = 'weekly', COALESCE(p.email_enabled, TRUE)
+		FROM groundwater_alerts a
+		JOIN users u ON u.id = a.user_id AND u.deleted_at IS NULL
+		LEFT JOIN groundwater_alert_preferences p ON p.user_id = a.user_id
+		WHERE a.delivered_at IS NULL
+		  AND (COALESCE(p.delivery, 'immediate') = 'immediate' OR p.last_digest_at IS NULL OR p.last_digest_at <= $1)`,
+		now.Add(-s.config.DigestInterval))
+	if err != nil {
+		return 0, fmt.Errorf("alert recipient lookup error: %w", err)
+	}
+	var recipients []recipient
+	for rows.Next() {
+		var r recipient
+		if err := rows.Scan(&r.userID, &r.email, &r.digest, &r.emailEnabled); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		recipients = append(recipients, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for _, r := range recipients {
+		sent, err := s.deliverTo(ctx, r, now)
+		if err != nil {
+			return delivered, fmt.Errorf("delivering alerts to %s: %w", r.userID, err)
+		}
+		if sent {
+			delivered++
+		}
+	}
+	return delivered, nil
+}
+
+// deliverTo posts the user's pending alerts to their alerts conversation, then pushes the
+// message to their open sockets and emails it.
+func (s *Service) deliverTo(ctx context.Context, r recipient, now time.Time) (bool, error) {
+	var message *models.Message
+	var alerts []models.GroundwaterAlert
+	err := s.db.WithTransaction(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `
+			SELECT `+alertColumns+`
+			FROM groundwater_alerts a JOIN groundwater_units u ON u.id = a.unit_id
+			WHERE a.user_id = $1 AND a.delivered_at IS NULL
+			ORDER BY u.path
+			FOR UPDATE OF a SKIP LOCKED`, r.userID)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			a, err := scanAlert(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			alerts = append(alerts, a)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(alerts) == 0 {
+			return nil
+		}
+
+		conversationID, err := alertsConversation(ctx, tx, r.userID)
+		if err != nil {
+			return err
+		}
+		message = &models.Message{
+			ID:             uuid.New(),
+			ConversationID: conversationID,
+			SenderID:       AlertsUserID,
+			Content:        alertText(alerts, r.digest),
+			MessageType:    models.MessageTypeSystem,
+			Status:         models.MessageStatusSent,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO messages (id, conversation_id, sender_id, content, message_type, status, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $7)`,
+			message.ID, message.ConversationID, message.SenderID, message.Content, message.MessageType,
+			message.Status, now); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE conversations SET last_activity_at = $2, updated_at = $2 WHERE id = $1", conversationID, now); err != nil {
+			return err
+		}
+
+		ids := make([]uuid.UUID, len(alerts))
+		for i, a := range alerts {
+			ids[i] = a.ID
+		}
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE groundwater_alerts SET delivered_at = $2, message_id = $3 WHERE id = ANY($1)",
+			pq.Array(ids), now, message.ID); err != nil {
+			return err
+		}
+		if r.digest {
+			_, err = tx.ExecContext(ctx,
+				"UPDATE groundwater_alert_preferences SET last_digest_at = $2 WHERE user_id = $1", r.userID, now)
+		}
+		return err
+	})
+	if err != nil || message == nil {
+		return false, err
+	}
+
+	chat.GetHub().SendToUser(r.userID.String(), *message)
+	if r.emailEnabled {
+		msg := mail.Message{
+			To:      r.email,
+			Subject: alertSubject(alerts, r.digest),
+			Body:    fmt.Sprintf("%s\n\nManage your watchlist and alert settings in GroundSense: %s\n", message.Content, s.publicURL),
+		}
+		// The alerts are in the app either way, so a failed email isn't retried
+		if err := s.mailer.Send(ctx, msg); err != nil {
+			s.logger.WithError(err).WithField("user_id", r.userID).Warn("Failed to email groundwater alerts")
+		}
+	}
+	return true, nil
+}
+
+// alertsConversation returns the user's alerts conversation, starting it on first use.
+func alertsConversation(ctx context.Context, tx *sql.Tx, userID uuid.UUID) (uuid.UUID, error) {
+	var id uuid.UUID
+	err := tx.QueryRowContext(ctx, `
+		SELECT c.id FROM conversations c JOIN conversation_participants p ON p.conversation_id = c.id
+		WHERE c.type = 'alerts' AND p.user_id = $1 LIMIT 1`, userID).Scan(&id)
+	if err != sql.ErrNoRows {
+		return id, err
+	}
+
+	id = uuid.New()
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO conversations (id, type, name, description, created_by)
+		VALUES ($1, 'alerts', 'Groundwater alerts', 'Changes to the areas on your watchlist', $2)`,
+		id, AlertsUserID); err != nil {
+		return uuid.Nil, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO conversation_participants (conversation_id, user_id, role)
+		VALUES ($1, $2, 'member'), ($1, $3, 'owner')`, id, userID, AlertsUserID)
+	return id, err
+}
+
+func alertSubject(alerts []models.GroundwaterAlert, digest bool) string {
+	switch {
+	case digest:
+		return "Your weekly groundwater digest"
+	case len(alerts) == 1 && alerts[0].Category != alerts[0].PreviousCategory:
+		return fmt.Sprintf("Groundwater alert: %s is now %s", alerts[0].Unit.Name, groundwater.CategoryLabel(alerts[0].Category))
+	case len(alerts) == 1:
+		return fmt.Sprintf("Groundwater alert: %s changed", alerts[0].Unit.Name)
+	default:
+		return fmt.Sprintf("Groundwater alerts: %d watched areas changed", len(alerts))
+	}
+}
+
+// alertText is one line per alert under a heading.
+func alertText(alerts []models.GroundwaterAlert, digest bool) string {
+	var b strings.Builder
+	switch {
+	case digest:
+		fmt.Fprintf(&b, "Your weekly groundwater digest: %d change(s) in the areas you watch.\n", len(alerts))
+	case len(alerts) > 1:
+		fmt.Fprintf(&b, "%d areas you watch changed in the latest assessment.\n", len(alerts))
+	}
+	for _, a := range alerts {
+		if len(alerts) > 1 || digest {
+			b.WriteString("\n• ")
+		}
+		b.WriteString(describeAlert(a))
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func describeAlert(a models.GroundwaterAlert) string {
+	place := fmt.Sprintf("%s (%s", a.Unit.Name, a.Unit.Level)
+	if a.State != "" && a.Unit.Level != models.LevelState {
+		place += ", " + a.State
+	}
+	place += ")"
+
+	stage := fmt.Sprintf("stage of extraction %.0f%% in %d, %.0f%% in %d", a.PreviousStage, a.PreviousYear,
+		a.StageOfExtraction, a.Year)
+	if a.Category != a.PreviousCategory {
+		return fmt.Sprintf("%s moved from %s to %s: %s.", place, groundwater.CategoryLabel(a.PreviousCategory),
+			groundwater.CategoryLabel(a.Category), stage)
+	}
+	direction := "rose"
+	if a.StageOfExtraction < a.PreviousStage {
+		direction = "fell"
+	}
+	return fmt.Sprintf("%s is still %s but extraction %s: %s.", place, groundwater.CategoryLabel(a.Category),
+		direction, stage)
+}
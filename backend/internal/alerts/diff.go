@@ -0,0 +1,183 @@
+package alerts
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+)
+
+// change is a unit's newest assessment compared with the one before it.
+type change struct {
+	unitID           uuid.UUID
+	path             string
+	year             int
+	previousYear     int
+	category         models.GroundwaterCategory
+	previousCategory models.GroundwaterCategory
+	stage            float64
+	previousStage    float64
+}
+
+// watch is a watchlist entry with the user's threshold.
+type watch struct {
+	userID    uuid.UUID
+	path      string
+	threshold float64
+}
+
+// covers reports whether watching the unit at w.path includes the unit at path.
+func (w watch) covers(path string) bool {
+	return path == w.path || strings.HasPrefix(path, w.path+"/")
+}
+
+func (c change) alerts(threshold float64) bool {
+	return c.category != c.previousCategory || math.Abs(c.stage-c.previousStage) >= threshold
+}
+
+// Diff compares every dataset imported since the last run with the year before it and
+// records an alert for each watcher of a unit that changed. Datasets are diffed once
+// each, oldest first, and each in its own transaction.
+func (s *Service) Diff(ctx context.Context) (int, error) {
+	created := 0
+	for {
+		n, found, err := s.diffNextDataset(ctx)
+		if err != nil {
+			return created, err
+		}
+		if !found {
+			return created, nil
+		}
+		created += n
+	}
+}
+
+func (s *Service) diffNextDataset(ctx context.Context) (created int, found bool, err error) {
+	err = s.db.WithTransaction(ctx, func(tx *sql.Tx) error {
+		var datasetID uuid.UUID
+		var importedAt time.Time
+		err := tx.QueryRowContext(ctx, `
+			SELECT id, imported_at FROM groundwater_datasets WHERE alerts_checked_at IS NULL
+			ORDER BY version LIMIT 1 FOR UPDATE SKIP LOCKED`).Scan(&datasetID, &importedAt)
+		if err == sql.ErrNoRows {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		found = true
+
+		// Only watches that existed when the data arrived, so a new watch doesn't replay
+		// years of history
+		watches, err := s.watches(ctx, tx, importedAt)
+		if err != nil {
+			return err
+		}
+		if len(watches) > 0 {
+			changes, err := datasetChanges(ctx, tx, datasetID)
+			if err != nil {
+				return err
+			}
+			if created, err = insertAlerts(ctx, tx, datasetID, changes, watches); err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE groundwater_datasets SET alerts_checked_at = NOW() WHERE id = $1", datasetID)
+		return err
+	})
+	if err != nil {
+		return 0, false, fmt.Errorf("alert diff error: %w", err)
+	}
+	return created, found, nil
+}
+
+func (s *Service) watches(ctx context.Context, tx *sql.Tx, before time.Time) ([]watch, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT w.user_id, u.path, COALESCE(p.stage_threshold, $2)
+		FROM groundwater_watchlist w
+		JOIN groundwater_units u ON u.id = w.unit_id
+		JOIN users usr ON usr.id = w.user_id AND usr.deleted_at IS NULL
+		LEFT JOIN groundwater_alert_preferences p ON p.user_id = w.user_id
+		WHERE w.created_at <= $1`, before, s.config.StageThreshold)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var watches []watch
+	for rows.Next() {
+		var w watch
+		if err := rows.Scan(&w.userID, &w.path, &w.threshold); err != nil {
+			return nil, err
+		}
+		watches = append(watches, w)
+	}
+	return watches, rows.Err()
+}
+
+// datasetChanges returns the units whose newest assessment came with the dataset, each
+// with the unit's assessment before it. Corrections to older years don't count: they
+// aren't news about where a unit is heading.
+func datasetChanges(ctx context.Context, tx *sql.Tx, datasetID uuid.UUID) ([]change, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT a.unit_id, u.path, a.year, p.year, a.category, p.category, a.stage_of_extraction, p.stage_of_extraction
+		FROM groundwater_assessments a
+		JOIN groundwater_units u ON u.id = a.unit_id
+		JOIN LATERAL (
+			SELECT year, category, stage_of_extraction FROM groundwater_assessments
+			WHERE unit_id = a.unit_id AND year < a.year ORDER BY year DESC LIMIT 1
+		) p ON TRUE
+		WHERE a.dataset_id = $1
+		  AND NOT EXISTS (SELECT 1 FROM groundwater_assessments l WHERE l.unit_id = a.unit_id AND l.year > a.year)`,
+		datasetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []change
+	for rows.Next() {
+		var c change
+		if err := rows.Scan(&c.unitID, &c.path, &c.year, &c.previousYear, &c.category, &c.previousCategory,
+			&c.stage, &c.previousStage); err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+// insertAlerts records one alert per user and unit; a user watching both a district and
+// a block in it still gets one.
+func insertAlerts(ctx context.Context, tx *sql.Tx, datasetID uuid.UUID, changes []change, watches []watch) (int, error) {
+	created := 0
+	for _, c := range changes {
+		alerted := map[uuid.UUID]bool{}
+		for _, w := range watches {
+			if alerted[w.userID] || !w.covers(c.path) || !c.alerts(w.threshold) {
+				continue
+			}
+			alerted[w.userID] = true
+
+			result, err := tx.ExecContext(ctx, `
+				INSERT INTO groundwater_alerts (user_id, unit_id, year, previous_year, category, previous_category,
+					stage_of_extraction, previous_stage, dataset_id)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+				ON CONFLICT (user_id, unit_id, year) DO NOTHING`,
+				w.userID, c.unitID, c.year, c.previousYear, c.category, c.previousCategory, c.stage, c.previousStage,
+				datasetID)
+			if err != nil {
+				return created, err
+			}
+			if n, _ := result.RowsAffected(); n > 0 {
+				created++
+			}
+		}
+	}
+	return created, nil
+}
@@ -0,0 +1,147 @@
+// Package analytics has the trend tests, forecasts and correlations run on groundwater
+// series: the Mann-Kendall test, Sen's slope, seasonal-naive and linear forecasts with
+// prediction intervals, and Pearson's and Spearman's coefficients. It's plain arithmetic
+// on slices, so results are the same on every run and machine.
+package analytics
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// MinTrendPoints is the shortest series a trend is tested or a correlation computed on.
+const MinTrendPoints = 4
+
+var (
+	ErrTooFewPoints      = errors.New("not enough points")
+	ErrLengthMismatch    = errors.New("times and values differ in length")
+	ErrInvalidConfidence = errors.New("confidence must be between 0.5 and 0.999")
+	ErrInvalidPeriod     = errors.New("period and horizon must be positive")
+	ErrNoVariation       = errors.New("values don't vary")
+)
+
+// CheckConfidence returns ErrInvalidConfidence unless confidence is a usable level.
+func CheckConfidence(confidence float64) error {
+	if confidence < 0.5 || confidence > 0.999 || math.IsNaN(confidence) {
+		return ErrInvalidConfidence
+	}
+	return nil
+}
+
+// NormalCDF is the standard normal distribution function.
+func NormalCDF(z float64) float64 {
+	return 0.5 * math.Erfc(-z/math.Sqrt2)
+}
+
+// NormalQuantile is the inverse of NormalCDF, after Acklam, with one Newton step; it's
+// accurate to about 1e-15.
+func NormalQuantile(p float64) float64 {
+	switch {
+	case p <= 0:
+		return math.Inf(-1)
+	case p >= 1:
+		return math.Inf(1)
+	}
+
+	a := []float64{-3.969683028665376e+01, 2.209460984245205e+02, -2.759285104469687e+02,
+		1.383577518672690e+02, -3.066479806614716e+01, 2.506628277459239e+00}
+	b := []float64{-5.447609879822406e+01, 1.615858368580409e+02, -1.556989798598866e+02,
+		6.680131188771972e+01, -1.328068155288572e+01}
+	c := []float64{-7.784894002430293e-03, -3.223964580411365e-01, -2.400758277161838e+00,
+		-2.549732539343734e+00, 4.374664141464968e+00, 2.938163982698783e+00}
+	d := []float64{7.784695709041462e-03, 3.224671290700398e-01, 2.445134137142996e+00, 3.754408661907416e+00}
+
+	const low = 0.02425
+	var x float64
+	switch {
+	case p < low:
+		q := math.Sqrt(-2 * math.Log(p))
+		x = (((((c[0]*q+c[1])*q+c[2])*q+c[3])*q+c[4])*q + c[5]) / ((((d[0]*q+d[1])*q+d[2])*q+d[3])*q + 1)
+	case p <= 1-low:
+		q := p - 0.5
+		r := q * q
+		x = (((((a[0]*r+a[1])*r+a[2])*r+a[3])*r+a[4])*r + a[5]) * q /
+			(((((b[0]*r+b[1])*r+b[2])*r+b[3])*r+b[4])*r + 1)
+	default:
+		q := math.Sqrt(-2 * math.Log(1-p))
+		x = -(((((c[0]*q+c[1])*q+c[2])*q+c[3])*q+c[4])*q + c[5]) / ((((d[0]*q+d[1])*q+d[2])*q+d[3])*q + 1)
+	}
+
+	e := NormalCDF(x) - p
+	u := e * math.Sqrt(2*math.Pi) * math.Exp(x*x/2)
+	return x - u/(1+x*u/2)
+}
+
+// StudentCDF is the distribution function of Student's t with df degrees of freedom,
+// from the closed forms for whole degrees of freedom.
+func StudentCDF(t float64, df int) float64 {
+	if df < 1 || math.IsNaN(t) {
+		return math.NaN()
+	}
+	theta := math.Atan(t / math.Sqrt(float64(df)))
+	sin, cos := math.Sin(theta), math.Cos(theta)
+	cos2 := cos * cos
+
+	// a is the probability of |T| below |t|, signed like t
+	var a float64
+	if df%2 == 1 {
+		var sum, term float64
+		if df > 1 {
+			sum, term = 1, 1
+			for k := 3; k <= df-2; k += 2 {
+				term *= float64(k-1) / float64(k) * cos2
+				sum += term
+			}
+		}
+		a = 2 / math.Pi * (theta + sin*cos*sum)
+	} else {
+		sum, term := 1.0, 1.0
+		for k := 2; k <= df-2; k += 2 {
+			term *= float64(k-1) / float64(k) * cos2
+			sum += term
+		}
+		a = sin * sum
+	}
+	return 0.5 + a/2
+}
+
+// StudentQuantile is the inverse of StudentCDF, found by bisection.
+func StudentQuantile(p float64, df int) float64 {
+	switch {
+	case df < 1 || math.IsNaN(p):
+		return math.NaN()
+	case p <= 0:
+		return math.Inf(-1)
+	case p >= 1:
+		return math.Inf(1)
+	case p < 0.5:
+		return -StudentQuantile(1-p, df)
+	}
+
+	low, high := 0.0, 1.0
+	for StudentCDF(high, df) < p {
+		low, high = high, high*2
+	}
+	for i := 0; i < 100 && high-low > 1e-12; i++ {
+		mid := (low + high) / 2
+		if StudentCDF(mid, df) < p {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	return (low + high) / 2
+}
+
+// Median is the middle of the values, or the mean of the two middle ones. There must be
+// at least one value.
+func Median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
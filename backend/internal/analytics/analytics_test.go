@@ -0,0 +1,88 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+)
+
+func near(got, want, tolerance float64) bool {
+	return math.Abs(got-want) <= tolerance
+}
+
+func TestNormalQuantile(t *testing.T) {
+	// Standard normal quantiles to full double precision
+	tests := []struct {
+		p, want float64
+	}{
+		{0.5, 0},
+		{0.95, 1.6448536269514722},
+		{0.975, 1.959963984540054},
+		{0.995, 2.5758293035489004},
+		{0.999, 3.090232306167813},
+		{0.01, -2.3263478740408408},
+		{0.001, -3.090232306167813},
+		{0.8413447460685429, 1},
+	}
+	for _, tt := range tests {
+		if got := NormalQuantile(tt.p); !near(got, tt.want, 1e-12) {
+			t.Errorf("NormalQuantile(%g) = %.15g, want %.15g", tt.p, got, tt.want)
+		}
+		if got := NormalCDF(tt.want); !near(got, tt.p, 1e-15) {
+			t.Errorf("NormalCDF(%g) = %.15g, want %.15g", tt.want, got, tt.p)
+		}
+	}
+	if !math.IsInf(NormalQuantile(0), -1) || !math.IsInf(NormalQuantile(1), 1) {
+		t.Error("NormalQuantile(0) and NormalQuantile(1) should be infinite")
+	}
+}
+
+func TestStudentQuantile(t *testing.T) {
+	tests := []struct {
+		p         float64
+		df        int
+		want      float64
+		tolerance float64
+	}{
+		// Closed forms: tan(π(p-½)) for one degree of freedom, (2p-1)/√(2p(1-p)) for two
+		{0.975, 1, 12.706204736174696, 1e-9},
+		{0.95, 1, 6.313751514675041, 1e-9},
+		{0.975, 2, 4.302652729749464, 1e-9},
+		{0.9, 2, 1.8856180831641267, 1e-9},
+		// Printed t tables, to three decimals
+		{0.975, 3, 3.182, 5e-4},
+		{0.975, 5, 2.571, 5e-4},
+		{0.975, 9, 2.262, 5e-4},
+		{0.975, 10, 2.228, 5e-4},
+		{0.975, 18, 2.101, 5e-4},
+		{0.975, 30, 2.042, 5e-4},
+		{0.99, 4, 3.747, 5e-4},
+		{0.995, 8, 3.355, 5e-4},
+		{0.9, 20, 1.325, 5e-4},
+		{0.025, 5, -2.571, 5e-4},
+	}
+	for _, tt := range tests {
+		got := StudentQuantile(tt.p, tt.df)
+		if !near(got, tt.want, tt.tolerance) {
+			t.Errorf("StudentQuantile(%g, %d) = %.10g, want %.10g", tt.p, tt.df, got, tt.want)
+		}
+		if p := StudentCDF(got, tt.df); !near(p, tt.p, 1e-9) {
+			t.Errorf("StudentCDF(StudentQuantile(%g, %d)) = %.12g", tt.p, tt.df, p)
+		}
+	}
+	if !math.IsNaN(StudentQuantile(0.975, 0)) {
+		t.Error("StudentQuantile with no degrees of freedom should be NaN")
+	}
+}
+
+func TestCheckConfidence(t *testing.T) {
+	for _, confidence := range []float64{0.5, 0.8, 0.95, 0.999} {
+		if err := CheckConfidence(confidence); err != nil {
+			t.Errorf("CheckConfidence(%g) = %v", confidence, err)
+		}
+	}
+	for _, confidence := range []float64{0, 0.49, 1, 95, math.NaN()} {
+		if err := CheckConfidence(confidence); err != ErrInvalidConfidence {
+			t.Errorf("CheckConfidence(%g) = %v, want ErrInvalidConfidence", confidence, err)
+		}
+	}
+}
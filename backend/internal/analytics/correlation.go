@@ -0,0 +1,95 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+)
+
+// Correlation relates two paired series. PValue is two-sided, for Pearson's r being
+// zero; the line is the least squares fit of y on x.
+type Correlation struct {
+	N         int
+	Pearson   float64
+	Spearman  float64
+	PValue    float64
+	Slope     float64
+	Intercept float64
+}
+
+// Correlate computes Pearson's and Spearman's coefficients of x and y.
+func Correlate(x, y []float64) (Correlation, error) {
+	if len(x) != len(y) {
+		return Correlation{}, ErrLengthMismatch
+	}
+	n := len(x)
+	if n < MinTrendPoints {
+		return Correlation{}, ErrTooFewPoints
+	}
+
+	r, ok := pearson(x, y)
+	if !ok {
+		return Correlation{}, ErrNoVariation
+	}
+	rho, _ := pearson(ranks(x), ranks(y))
+	fit, err := FitLinear(x, y)
+	if err != nil {
+		return Correlation{}, err
+	}
+
+	result := Correlation{N: n, Pearson: r, Spearman: rho, Slope: fit.Slope, Intercept: fit.Intercept}
+	df := n - 2
+	if math.Abs(r) >= 1 {
+		result.PValue = 0
+	} else {
+		t := r * math.Sqrt(float64(df)/(1-r*r))
+		result.PValue = 2 * (1 - StudentCDF(math.Abs(t), df))
+	}
+	return result, nil
+}
+
+// pearson is Pearson's r, or false when either series is constant.
+func pearson(x, y []float64) (float64, bool) {
+	n := float64(len(x))
+	var meanX, meanY float64
+	for i := range x {
+		meanX += x[i]
+		meanY += y[i]
+	}
+	meanX /= n
+	meanY /= n
+
+	var sxx, syy, sxy float64
+	for i := range x {
+		dx, dy := x[i]-meanX, y[i]-meanY
+		sxx += dx * dx
+		syy += dy * dy
+		sxy += dx * dy
+	}
+	if sxx == 0 || syy == 0 {
+		return 0, false
+	}
+	return math.Max(-1, math.Min(1, sxy/math.Sqrt(sxx*syy))), true
+}
+
+// ranks are the values' ranks from one, tied values sharing their average rank.
+func ranks(values []float64) []float64 {
+	order := make([]int, len(values))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return values[order[a]] < values[order[b]] })
+
+	result := make([]float64, len(values))
+	for i := 0; i < len(order); {
+		j := i + 1
+		for j < len(order) && values[order[j]] == values[order[i]] {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			result[order[k]] = rank
+		}
+		i = j
+	}
+	return result
+}
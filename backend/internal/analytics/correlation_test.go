@@ -0,0 +1,53 @@
+package analytics
+
+import "testing"
+
+func TestCorrelate(t *testing.T) {
+	tests := []struct {
+		name              string
+		x, y              []float64
+		pearson, spearman float64
+		pValue            float64
+		slope, intercept  float64
+	}{
+		{
+			// Anscombe's first set: r = 0.8164, p = 0.00217 (t = 4.241 on 9 degrees of
+			// freedom) and no ties, so ρ = 1 - 6Σd²/(n(n²-1)) = 1 - 6·40/1320
+			name: "anscombe", x: anscombeX, y: anscombeY,
+			pearson: 0.8164205, spearman: 1 - 240.0/1320, pValue: 0.0021696, slope: 0.5000909, intercept: 3.0000909,
+		},
+		{
+			// Ties share their average rank
+			name: "ties", x: []float64{1, 2, 3, 4, 5}, y: []float64{2, 4, 5, 4, 5},
+			pearson: 0.7745967, spearman: 0.7378648, pValue: 0.1240270, slope: 0.6, intercept: 2.2,
+		},
+		{
+			name: "perfect", x: []float64{1, 2, 3, 4}, y: []float64{8, 6, 4, 2},
+			pearson: -1, spearman: -1, pValue: 0, slope: -2, intercept: 10,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Correlate(tt.x, tt.y)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.N != len(tt.x) || !near(got.Pearson, tt.pearson, 1e-7) || !near(got.Spearman, tt.spearman, 1e-7) ||
+				!near(got.PValue, tt.pValue, 1e-4) || !near(got.Slope, tt.slope, 1e-7) ||
+				!near(got.Intercept, tt.intercept, 1e-7) {
+				t.Errorf("Correlate = %+v, want r %g, ρ %g, p %g, line %g + %gx", got, tt.pearson, tt.spearman,
+					tt.pValue, tt.intercept, tt.slope)
+			}
+		})
+	}
+
+	if _, err := Correlate([]float64{1, 2, 3, 4}, []float64{5, 5, 5, 5}); err != ErrNoVariation {
+		t.Errorf("constant y: err = %v, want ErrNoVariation", err)
+	}
+	if _, err := Correlate([]float64{1, 2, 3}, []float64{1, 2, 3}); err != ErrTooFewPoints {
+		t.Errorf("three points: err = %v, want ErrTooFewPoints", err)
+	}
+	if _, err := Correlate([]float64{1, 2, 3, 4}, []float64{1, 2, 3}); err != ErrLengthMismatch {
+		t.Errorf("mismatched lengths: err = %v, want ErrLengthMismatch", err)
+	}
+}
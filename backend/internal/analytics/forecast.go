@@ -0,0 +1,144 @@
+package analytics
+
+import "math"
+
+// Forecast is a predicted value with its prediction interval. Step counts from one, the
+// first period after the data.
+type Forecast struct {
+	Step  int
+	Value float64
+	Lower float64
+	Upper float64
+}
+
+// SeasonalNaive forecasts each of the next horizon periods as the last value seen in the
+// same season. values are evenly spaced with period of them a cycle; NaN marks a gap.
+// The interval widens with every cycle the forecast reaches past its source value, with
+// the spread of the year-on-year differences in the data.
+func SeasonalNaive(values []float64, period, horizon int, confidence float64) ([]Forecast, error) {
+	if period < 1 || horizon < 1 {
+		return nil, ErrInvalidPeriod
+	}
+	if err := CheckConfidence(confidence); err != nil {
+		return nil, err
+	}
+
+	var sumSquares float64
+	differences := 0
+	for i := period; i < len(values); i++ {
+		if !math.IsNaN(values[i]) && !math.IsNaN(values[i-period]) {
+			d := values[i] - values[i-period]
+			sumSquares += d * d
+			differences++
+		}
+	}
+	if differences < 2 {
+		return nil, ErrTooFewPoints
+	}
+	sigma := math.Sqrt(sumSquares / float64(differences))
+	z := NormalQuantile(1 - (1-confidence)/2)
+
+	n := len(values)
+	forecasts := make([]Forecast, 0, horizon)
+	for step := 1; step <= horizon; step++ {
+		target := n - 1 + step
+		source := target - period
+		for source >= n {
+			source -= period
+		}
+		for source >= 0 && math.IsNaN(values[source]) {
+			source -= period
+		}
+		if source < 0 {
+			return nil, ErrTooFewPoints
+		}
+
+		cycles := float64((target - source) / period)
+		margin := z * sigma * math.Sqrt(cycles)
+		forecasts = append(forecasts, Forecast{
+			Step:  step,
+			Value: values[source],
+			Lower: values[source] - margin,
+			Upper: values[source] + margin,
+		})
+	}
+	return forecasts, nil
+}
+
+// LinearFit is an ordinary least squares line. StdErr is the residual standard error.
+type LinearFit struct {
+	Slope     float64
+	Intercept float64
+	RSquared  float64
+	StdErr    float64
+	N         int
+
+	meanTime float64
+	sxx      float64
+}
+
+// FitLinear fits values over times by least squares.
+func FitLinear(times, values []float64) (LinearFit, error) {
+	if len(times) != len(values) {
+		return LinearFit{}, ErrLengthMismatch
+	}
+	n := len(values)
+	if n < 3 {
+		return LinearFit{}, ErrTooFewPoints
+	}
+
+	var meanTime, meanValue float64
+	for i := range values {
+		meanTime += times[i]
+		meanValue += values[i]
+	}
+	meanTime /= float64(n)
+	meanValue /= float64(n)
+
+	var sxx, sxy, syy float64
+	for i := range values {
+		dt, dv := times[i]-meanTime, values[i]-meanValue
+		sxx += dt * dt
+		sxy += dt * dv
+		syy += dv * dv
+	}
+	if sxx == 0 {
+		return LinearFit{}, ErrTooFewPoints
+	}
+
+	fit := LinearFit{Slope: sxy / sxx, N: n, meanTime: meanTime, sxx: sxx}
+	fit.Intercept = meanValue - fit.Slope*meanTime
+	var sse float64
+	for i := range values {
+		r := values[i] - fit.At(times[i])
+		sse += r * r
+	}
+	fit.StdErr = math.Sqrt(sse / float64(n-2))
+	if syy > 0 {
+		fit.RSquared = 1 - sse/syy
+	}
+	return fit, nil
+}
+
+// At is the fitted value at a time.
+func (f LinearFit) At(time float64) float64 {
+	return f.Intercept + f.Slope*time
+}
+
+// Forecast predicts the value at each time with a prediction interval, which widens the
+// further a time is from the middle of the data.
+func (f LinearFit) Forecast(times []float64, confidence float64) ([]Forecast, error) {
+	if err := CheckConfidence(confidence); err != nil {
+		return nil, err
+	}
+	t := StudentQuantile(1-(1-confidence)/2, f.N-2)
+
+	forecasts := make([]Forecast, len(times))
+	for i, time := range times {
+		d := time - f.meanTime
+		margin := t * f.StdErr * math.Sqrt(1+1/float64(f.N)+d*d/f.sxx)
+		value := f.At(time)
+		forecasts[i] = Forecast{Step: i + 1, Value: value, Lower: value - margin, Upper: value + margin}
+	}
+	return forecasts, nil
+}
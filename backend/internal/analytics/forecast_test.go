@@ -0,0 +1,133 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+)
+
+// anscombe is the first of Anscombe's (1973) four data sets, whose least squares line is
+// y = 3.0001 + 0.5001x with a residual standard error of 1.237 on 9 degrees of freedom
+// and R² = 0.6665.
+var anscombeX = []float64{10, 8, 13, 9, 11, 14, 6, 4, 12, 7, 5}
+var anscombeY = []float64{8.04, 6.95, 7.58, 8.81, 8.33, 9.96, 7.24, 4.26, 10.84, 4.82, 5.68}
+
+func TestSeasonalNaive(t *testing.T) {
+	nan := math.NaN()
+	z95 := 1.959963984540054
+
+	tests := []struct {
+		name   string
+		series []float64
+		period int
+		// sigma is the root mean square of the year-on-year differences
+		sigma float64
+		// values are the forecasts; cycles how many cycles each is past its source value
+		values []float64
+		cycles []float64
+	}{
+		{
+			// Only 2-1 and 4-2 pair up; each step repeats the same season's last value,
+			// a cycle further out from the third step
+			name:   "gap inside",
+			series: []float64{1, 10, 2, nan, 4, 13},
+			period: 2,
+			sigma:  math.Sqrt(2.5),
+			values: []float64{4, 13, 4, 13},
+			cycles: []float64{1, 1, 2, 2},
+		},
+		{
+			// The last slot is missing, so that season comes from a cycle earlier and its
+			// interval starts two cycles wide
+			name:   "gap at the end",
+			series: []float64{1, 10, 2, 11, 4, nan},
+			period: 2,
+			sigma:  math.Sqrt(2),
+			values: []float64{4, 11, 4, 11},
+			cycles: []float64{1, 2, 2, 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SeasonalNaive(tt.series, tt.period, len(tt.values), 0.95)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.values) {
+				t.Fatalf("got %d forecasts, want %d", len(got), len(tt.values))
+			}
+			for i, f := range got {
+				value, margin := tt.values[i], z95*tt.sigma*math.Sqrt(tt.cycles[i])
+				if f.Step != i+1 || f.Value != value || !near(f.Lower, value-margin, 1e-12) ||
+					!near(f.Upper, value+margin, 1e-12) {
+					t.Errorf("forecast %d = %+v, want %g ± %g", i+1, f, value, margin)
+				}
+			}
+		})
+	}
+
+	if _, err := SeasonalNaive([]float64{1, 2, 3}, 2, 1, 0.95); err != ErrTooFewPoints {
+		t.Errorf("one difference: err = %v, want ErrTooFewPoints", err)
+	}
+	if _, err := SeasonalNaive([]float64{1, 2, 3, 4, 5}, 0, 1, 0.95); err != ErrInvalidPeriod {
+		t.Errorf("period 0: err = %v, want ErrInvalidPeriod", err)
+	}
+}
+
+func TestFitLinear(t *testing.T) {
+	fit, err := FitLinear(anscombeX, anscombeY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fit.N != 11 || !near(fit.Slope, 0.5000909, 1e-7) || !near(fit.Intercept, 3.0000909, 1e-7) ||
+		!near(fit.StdErr, 1.236603, 1e-6) || !near(fit.RSquared, 0.6665425, 1e-7) {
+		t.Errorf("fit = %+v", fit)
+	}
+
+	if _, err := FitLinear([]float64{1, 1, 1}, []float64{1, 2, 3}); err != ErrTooFewPoints {
+		t.Errorf("one time: err = %v, want ErrTooFewPoints", err)
+	}
+	if _, err := FitLinear([]float64{1, 2}, []float64{1, 2}); err != ErrTooFewPoints {
+		t.Errorf("two points: err = %v, want ErrTooFewPoints", err)
+	}
+}
+
+func TestLinearFitForecast(t *testing.T) {
+	fit, err := FitLinear(anscombeX, anscombeY)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The 95% prediction interval is ŷ ± t(0.975, 9)·s·√(1 + 1/n + (x - x̄)²/Sxx), with
+	// t(0.975, 9) = 2.262157, x̄ = 9 and Sxx = 110
+	tests := []struct {
+		x                   float64
+		value, lower, upper float64
+	}{
+		{9, 7.500909, 4.579129, 10.422689},
+		{15, 10.501455, 7.170113, 13.832796},
+		{20, 13.001909, 8.861289, 17.142529},
+	}
+	var times []float64
+	for _, tt := range tests {
+		times = append(times, tt.x)
+	}
+	forecasts, err := fit.Forecast(times, 0.95)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tt := range tests {
+		f := forecasts[i]
+		if f.Step != i+1 || !near(f.Value, tt.value, 1e-6) || !near(f.Lower, tt.lower, 1e-6) || !near(f.Upper, tt.upper, 1e-6) {
+			t.Errorf("forecast at %g = %+v, want %g [%g, %g]", tt.x, f, tt.value, tt.lower, tt.upper)
+		}
+	}
+
+	// A wider confidence widens the interval
+	wide, _ := fit.Forecast(times[:1], 0.99)
+	if wide[0].Upper-wide[0].Lower <= forecasts[0].Upper-forecasts[0].Lower {
+		t.Errorf("99%% interval %+v is no wider than the 95%% one %+v", wide[0], forecasts[0])
+	}
+	if _, err := fit.Forecast(times, 0.2); err != ErrInvalidConfidence {
+		t.Errorf("confidence 0.2: err = %v, want ErrInvalidConfidence", err)
+	}
+}
@@ -0,0 +1,136 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+)
+
+// MannKendall is the result of the Mann-Kendall test for a monotonic trend. A positive
+// S or Z means the values rise over time.
+type MannKendall struct {
+	N        int
+	S        float64
+	Variance float64
+	Z        float64
+	// PValue is two-sided
+	PValue float64
+	// Tau is Kendall's rank correlation with time
+	Tau float64
+}
+
+// Significant reports whether the trend is significant at level alpha.
+func (m MannKendall) Significant(alpha float64) bool {
+	return m.S != 0 && m.PValue < alpha
+}
+
+// MannKendallTest runs the test on values in time order, correcting the variance for
+// tied values.
+func MannKendallTest(values []float64) (MannKendall, error) {
+	n := len(values)
+	if n < MinTrendPoints {
+		return MannKendall{}, ErrTooFewPoints
+	}
+
+	var s float64
+	for i := 0; i < n-1; i++ {
+		for j := i + 1; j < n; j++ {
+			switch {
+			case values[j] > values[i]:
+				s++
+			case values[j] < values[i]:
+				s--
+			}
+		}
+	}
+
+	result := MannKendall{N: n, S: s, Variance: mannKendallVariance(values), PValue: 1}
+	result.Tau = s / (float64(n*(n-1)) / 2)
+	if result.Variance > 0 {
+		switch {
+		case s > 0:
+			result.Z = (s - 1) / math.Sqrt(result.Variance)
+		case s < 0:
+			result.Z = (s + 1) / math.Sqrt(result.Variance)
+		}
+		result.PValue = math.Min(1, 2*(1-NormalCDF(math.Abs(result.Z))))
+	}
+	return result, nil
+}
+
+// mannKendallVariance is the variance of S with the correction for groups of ties.
+func mannKendallVariance(values []float64) float64 {
+	n := float64(len(values))
+	variance := n * (n - 1) * (2*n + 5)
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	for i := 0; i < len(sorted); {
+		j := i + 1
+		for j < len(sorted) && sorted[j] == sorted[i] {
+			j++
+		}
+		if t := float64(j - i); t > 1 {
+			variance -= t * (t - 1) * (2*t + 5)
+		}
+		i = j
+	}
+	return variance / 18
+}
+
+// SenSlope is the median of the slopes between every pair of points, with a confidence
+// interval after Gilbert (1987). Intercept puts the line through the medians.
+type SenSlope struct {
+	Slope     float64
+	Intercept float64
+	Lower     float64
+	Upper     float64
+}
+
+// SensSlope estimates the slope of values over times, which needn't be evenly spaced.
+func SensSlope(times, values []float64, confidence float64) (SenSlope, error) {
+	if len(times) != len(values) {
+		return SenSlope{}, ErrLengthMismatch
+	}
+	if err := CheckConfidence(confidence); err != nil {
+		return SenSlope{}, err
+	}
+	n := len(values)
+	if n < MinTrendPoints {
+		return SenSlope{}, ErrTooFewPoints
+	}
+
+	var slopes []float64
+	for i := 0; i < n-1; i++ {
+		for j := i + 1; j < n; j++ {
+			if dt := times[j] - times[i]; dt != 0 {
+				slopes = append(slopes, (values[j]-values[i])/dt)
+			}
+		}
+	}
+	if len(slopes) == 0 {
+		return SenSlope{}, ErrTooFewPoints
+	}
+	sort.Float64s(slopes)
+
+	result := SenSlope{Slope: Median(slopes)}
+	result.Intercept = Median(values) - result.Slope*Median(times)
+
+	// The interval's ends are ranks into the sorted slopes, from S's variance
+	c := NormalQuantile(1-(1-confidence)/2) * math.Sqrt(mannKendallVariance(values))
+	count := float64(len(slopes))
+	lower := int(math.Round((count-c)/2)) - 1
+	upper := int(math.Round((count + c) / 2))
+	result.Lower = slopes[clamp(lower, 0, len(slopes)-1)]
+	result.Upper = slopes[clamp(upper, 0, len(slopes)-1)]
+	return result, nil
+}
+
+func clamp(value, min, max int) int {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
@@ -0,0 +1,115 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+)
+
+// rising is ten years of depths with a clear upward trend and no ties: 39 of its 45
+// pairs rise. Without ties Var(S) = n(n-1)(2n+5)/18 = 125.
+var rising = []float64{5.1, 4.8, 5.6, 6.0, 5.9, 6.4, 7.1, 6.8, 7.5, 7.9}
+
+func TestMannKendallTest(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   []float64
+		s        float64
+		variance float64
+		z        float64
+		pValue   float64
+		tau      float64
+	}{
+		{
+			name: "rising", values: rising,
+			s: 39, variance: 125, z: 38 / math.Sqrt(125), pValue: 0.000676764, tau: 39.0 / 45,
+		},
+		{
+			// One pair and one triple of ties: 4 tied pairs, the other 24 rise, and
+			// Var(S) = (8·7·21 - 2·1·9 - 3·2·11)/18 = 1092/18
+			name:   "ties",
+			values: []float64{10.2, 10.5, 10.5, 10.9, 11.4, 11.4, 11.4, 12.0},
+			s:      24, variance: 1092.0 / 18, z: 23 / math.Sqrt(1092.0/18), pValue: 0.00314776, tau: 24.0 / 28,
+		},
+		{
+			name:   "falling",
+			values: []float64{4, 3, 2, 1},
+			s:      -6, variance: 4 * 3 * 13 / 18.0, z: -5 / math.Sqrt(4*3*13/18.0), pValue: 0.0894294, tau: -1,
+		},
+		{
+			// Two tied pairs; 9 pairs rise and 4 fall, too few to be significant
+			name:   "weak",
+			values: []float64{1, 3, 2, 4, 2, 3},
+			s:      5, variance: (6*5*17 - 2*1*9 - 2*1*9) / 18.0, z: 4 / math.Sqrt(474.0/18), pValue: 0.435695, tau: 1.0 / 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MannKendallTest(tt.values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.N != len(tt.values) || got.S != tt.s || !near(got.Variance, tt.variance, 1e-9) {
+				t.Errorf("N, S, Var(S) = %d, %g, %g; want %d, %g, %g", got.N, got.S, got.Variance,
+					len(tt.values), tt.s, tt.variance)
+			}
+			if !near(got.Z, tt.z, 1e-9) || !near(got.PValue, tt.pValue, 1e-6) || !near(got.Tau, tt.tau, 1e-12) {
+				t.Errorf("Z, p, tau = %.9g, %.9g, %.9g; want %.9g, %.9g, %.9g", got.Z, got.PValue, got.Tau,
+					tt.z, tt.pValue, tt.tau)
+			}
+		})
+	}
+
+	if _, err := MannKendallTest([]float64{1, 2, 3}); err != ErrTooFewPoints {
+		t.Errorf("three points: err = %v, want ErrTooFewPoints", err)
+	}
+	constant, err := MannKendallTest([]float64{2, 2, 2, 2})
+	if err != nil || constant.S != 0 || constant.PValue != 1 || constant.Significant(0.05) {
+		t.Errorf("constant series = %+v, %v; want no trend", constant, err)
+	}
+}
+
+func TestSensSlope(t *testing.T) {
+	years := []float64{2011, 2012, 2013, 2014, 2015, 2016, 2017, 2018, 2019, 2020}
+
+	// Gilbert (1987): with N' slopes and C = z·√Var(S), the bounds are the M1-th and
+	// (M2+1)-th smallest slopes, M1 = (N'-C)/2 and M2 = (N'+C)/2. Here N' = 45 and
+	// Var(S) = 125, so at 95% C = 21.91, M1 = 11.54 and M2 = 33.46: the 12th and 34th
+	// slopes. At 90% C = 18.39 and they are the 13th and 33rd.
+	tests := []struct {
+		confidence          float64
+		slope, lower, upper float64
+	}{
+		{0.95, 2.3 / 7, 0.25, 0.4},
+		{0.90, 2.3 / 7, 0.26, 0.4},
+	}
+	for _, tt := range tests {
+		got, err := SensSlope(years, rising, tt.confidence)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !near(got.Slope, tt.slope, 1e-12) || !near(got.Lower, tt.lower, 1e-12) || !near(got.Upper, tt.upper, 1e-12) {
+			t.Errorf("at %g: slope %g [%g, %g], want %g [%g, %g]", tt.confidence, got.Slope, got.Lower, got.Upper,
+				tt.slope, tt.lower, tt.upper)
+		}
+		// The line passes through the median year and median depth
+		if want := 6.2 - tt.slope*2015.5; !near(got.Intercept, want, 1e-9) {
+			t.Errorf("intercept %g, want %g", got.Intercept, want)
+		}
+	}
+
+	// Slopes between points at the same time are skipped rather than dividing by zero
+	got, err := SensSlope([]float64{1, 1, 2, 3}, []float64{0, 5, 2, 4}, 0.95)
+	if err != nil || got.Slope != 2 {
+		t.Errorf("repeated time: slope %g, %v; want 2", got.Slope, err)
+	}
+
+	if _, err := SensSlope(years[:3], rising[:3], 0.95); err != ErrTooFewPoints {
+		t.Errorf("three points: err = %v, want ErrTooFewPoints", err)
+	}
+	if _, err := SensSlope(years, rising[:9], 0.95); err != ErrLengthMismatch {
+		t.Errorf("mismatched lengths: err = %v, want ErrLengthMismatch", err)
+	}
+	if _, err := SensSlope(years, rising, 1.5); err != ErrInvalidConfidence {
+		t.Errorf("confidence 1.5: err = %v, want ErrInvalidConfidence", err)
+	}
+}
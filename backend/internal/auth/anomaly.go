@@ -0,0 +1,288 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/database"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/mail"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+)
+
+// anomalyHistoryLimit caps how many earlier sessions a sign-in is compared with.
+const anomalyHistoryLimit = 200
+
+// loginAssessment is how unfamiliar a sign-in looks next to the user's earlier sessions.
+type loginAssessment struct {
+	NewDevice      bool
+	NewNetwork     bool
+	NewWideNetwork bool
+	Score          int
+	Device         models.DeviceInfo
+	Network        string
+}
+
+func (a *loginAssessment) signals() map[string]interface{} {
+	return map[string]interface{}{
+		"new_device":       a.NewDevice,
+		"new_network":      a.NewNetwork,
+		"new_wide_network": a.NewWideNetwork,
+		"score":            a.Score,
+		"device":           a.Device,
+		"network":          a.Network,
+	}
+}
+
+// StepUpRequiredError is returned by Login when the sign-in looks unusual enough that
+// the user must also enter a code emailed to them, see VerifyLoginChallenge.
+type StepUpRequiredError struct {
+	ChallengeID uuid.UUID
+	ExpiresAt   time.Time
+}
+
+func (e *StepUpRequiredError) Error() string {
+	return "a verification code has been emailed to confirm this sign-in"
+}
+
+// deviceKey identifies a device by what its User-Agent says rather than the exact
+// string, so browser updates don't make a familiar device look new.
+func deviceKey(userAgent string) string {
+	device := describeDevice(userAgent)
+	return device.Type + "|" + device.OS + "|" + device.Browser
+}
+
+// deviceFingerprint is stored on each session: the device and the network it came from.
+func deviceFingerprint(client ClientInfo) string {
+	sum := sha256.Sum256([]byte(deviceKey(client.UserAgent) + "|" + describeLocation(client.IPAddress).Network))
+	return hex.EncodeToString(sum[:])
+}
+
+// wideNetwork masks an address to its /16 (IPv4) or /32 (IPv6), roughly a provider and region.
+func wideNetwork(ipAddress string) string {
+	ip := net.ParseIP(ipAddress)
+	if ip == nil {
+		return ""
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(16, 32)), Mask: net.CIDRMask(16, 32)}).String()
+	}
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(32, 128)), Mask: net.CIDRMask(32, 128)}).String()
+}
+
+// assessLogin compares a sign-in with the user's sessions within the lookback period.
+// A user with no earlier sessions has nothing to compare with and scores 0.
+func (s *Service) assessLogin(ctx context.Context, userID uuid.UUID, client ClientInfo) (*loginAssessment, error) {
+	assessment := &loginAssessment{
+		Device:  describeDevice(client.UserAgent),
+		Network: describeLocation(client.IPAddress).Network,
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT COALESCE(HOST(ip_address), ''), COALESCE(user_agent, '')
+		FROM user_sessions WHERE user_id = $1 AND created_at > $2
+		ORDER BY created_at DESC LIMIT $3`,
+		userID, time.Now().Add(-s.config.LoginAnomaly.Lookback), anomalyHistoryLimit)
+	if err != nil {
+		return nil, fmt.Errorf("session history error: %w", err)
+	}
+	defer rows.Close()
+
+	device, wide := deviceKey(client.UserAgent), wideNetwork(client.IPAddress)
+	seen, seenDevice, seenNetwork, seenWide := false, false, false, false
+	for rows.Next() {
+		var ipAddress, userAgent string
+		if err := rows.Scan(&ipAddress, &userAgent); err != nil {
+			return nil, err
+		}
+		seen = true
+		seenDevice = seenDevice || deviceKey(userAgent) == device
+		seenNetwork = seenNetwork || describeLocation(ipAddress).Network == assessment.Network
+		seenWide = seenWide || wideNetwork(ipAddress) == wide
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if !seen {
+		return assessment, nil
+	}
+
+	assessment.NewDevice = !seenDevice
+	// An address that can't be parsed says nothing about where the sign-in came from
+	assessment.NewNetwork = assessment.Network != "" && !seenNetwork
+	assessment.NewWideNetwork = wide != "" && !seenWide
+	for _, signal := range []bool{assessment.NewDevice, assessment.NewNetwork, assessment.NewWideNetwork} {
+		if signal {
+			assessment.Score++
+		}
+	}
+	return assessment, nil
+}
+
+// reportLoginAnomaly emails the user about an unfamiliar sign-in and audits it. A failed
+// email doesn't stop the sign-in; the audit entry records whether it went out.
+func (s *Service) reportLoginAnomaly(ctx context.Context, user *models.User, client ClientInfo, assessment *loginAssessment) error {
+	network := assessment.Network
+	if network == "" {
+		network = "an unknown network"
+	}
+	mailErr := s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "New sign-in to your Ground Sense account",
+		Body: fmt.Sprintf("Hi %s,\n\nYour account was just signed in to from %s on %s (%s) at %s UTC.\n\n"+
+			"If this was you, there's nothing to do. If not, reset your password now and sign out "+
+			"your other sessions:\n%s/forgot-password",
+			user.Username, assessment.Device.Browser, assessment.Device.OS, network,
+			time.Now().UTC().Format("2006-01-02 15:04"), s.config.Server.PublicURL),
+	})
+
+	values := assessment.signals()
+	values["notified"] = mailErr == nil
+	return database.RecordAudit(ctx, s.db, database.AuditEntry{
+		UserID:       user.ID.String(),
+		Action:       "auth.login_anomaly",
+		ResourceType: "user",
+		ResourceID:   user.ID.String(),
+		NewValues:    values,
+		IPAddress:    client.IPAddress,
+		UserAgent:    client.UserAgent,
+	})
+}
+
+// startLoginChallenge emails a one-time code the user must enter to finish signing in.
+// Only the newest challenge for a user is valid, and like other emailed codes only a
+// few are sent per user and per address in a window.
+func (s *Service) startLoginChallenge(ctx context.Context, user *models.User, client ClientInfo, assessment *loginAssessment) error {
+	now := time.Now()
+	var byUser, byIP int
+	var oldest sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FILTER (WHERE user_id = $1), COUNT(*) FILTER (WHERE ip_address = $2), MIN(created_at)
+		FROM login_challenges WHERE created_at > $3 AND (user_id = $1 OR ip_address = $2)`,
+		user.ID, inetOrNull(client.IPAddress), now.Add(-passwordlessRequestWindow)).Scan(&byUser, &byIP, &oldest)
+	if err != nil {
+		return fmt.Errorf("login challenge error: %w", err)
+	}
+	if byUser >= passwordlessMaxRequests || byIP >= passwordlessMaxRequests {
+		return &ThrottleError{RetryAfter: oldest.Time.Add(passwordlessRequestWindow).Sub(now)}
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	challenge := &StepUpRequiredError{ExpiresAt: time.Now().Add(loginCodeTTL)}
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE login_challenges SET used = true WHERE user_id = $1 AND used = false", user.ID); err != nil {
+			return err
+		}
+		if err := tx.QueryRowContext(ctx, `
+			INSERT INTO login_challenges (user_id, code, ip_address, user_agent, expires_at)
+			VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+			user.ID, code, inetOrNull(client.IPAddress), client.UserAgent, challenge.ExpiresAt).Scan(
+			&challenge.ChallengeID); err != nil {
+			return err
+		}
+
+		return database.RecordAudit(ctx, tx, database.AuditEntry{
+			UserID:       user.ID.String(),
+			Action:       "auth.step_up_required",
+			ResourceType: "user",
+			ResourceID:   user.ID.String(),
+			NewValues:    assessment.signals(),
+			IPAddress:    client.IPAddress,
+			UserAgent:    client.UserAgent,
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("login challenge error: %w", err)
+	}
+
+	if err := s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Confirm your Ground Sense sign-in",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone signed in to your account with your password from %s on %s. "+
+			"To finish signing in, enter this code: %s\n\nIt expires in %d minutes. If this wasn't you, "+
+			"your password is known to someone else; reset it now:\n%s/forgot-password",
+			user.Username, assessment.Device.Browser, assessment.Device.OS, code, int(loginCodeTTL.Minutes()),
+			s.config.Server.PublicURL),
+	}); err != nil {
+		return fmt.Errorf("login challenge email error: %w", err)
+	}
+
+	return challenge
+}
+
+// VerifyLoginChallenge checks the emailed step-up code and finishes the sign-in. Like
+// login codes, every guess uses up an attempt before it is compared, and a wrong code
+// counts as a failed sign-in towards the account's lockout.
+func (s *Service) VerifyLoginChallenge(ctx context.Context, challengeID uuid.UUID, code string, client ClientInfo) (*models.AuthResponse, error) {
+	var userID uuid.UUID
+	var email, expected string
+	var expiresAt time.Time
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE login_challenges c SET attempts = c.attempts + 1, used = c.attempts + 1 >= $2
+		FROM users u
+		WHERE c.id = $1 AND c.used = false AND c.attempts < $2 AND u.id = c.user_id
+		RETURNING c.user_id, u.email, c.code, c.expires_at`, challengeID, loginCodeMaxAttempts).Scan(
+		&userID, &email, &expected, &expiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidToken
+	} else if err != nil {
+		return nil, fmt.Errorf("login challenge lookup error: %w", err)
+	}
+
+	throttleKeys := []string{accountThrottleKey(email)}
+	if client.IPAddress != "" {
+		throttleKeys = append(throttleKeys, ipThrottleKey(client.IPAddress))
+	}
+	if err := s.checkLoginThrottle(ctx, throttleKeys...); err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(code), []byte(expected)) != 1 {
+		if err := s.registerLoginFailure(ctx, email, userID, client); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidToken
+	}
+	if time.Now().After(expiresAt) {
+		return nil, ErrTokenExpired
+	}
+	if _, err := s.db.ExecContext(ctx, "UPDATE login_challenges SET used = true WHERE id = $1", challengeID); err != nil {
+		return nil, err
+	}
+
+	user, err := s.getUser(ctx, userID)
+	if err == ErrUserNotFound {
+		return nil, ErrInvalidToken
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := database.RecordAudit(ctx, s.db, database.AuditEntry{
+		UserID:       userID.String(),
+		Action:       "auth.step_up_verified",
+		ResourceType: "user",
+		ResourceID:   userID.String(),
+		IPAddress:    client.IPAddress,
+		UserAgent:    client.UserAgent,
+	}); err != nil {
+		return nil, fmt.Errorf("audit log error: %w", err)
+	}
+
+	if err := s.clearLoginThrottle(ctx, accountThrottleKey(email)); err != nil {
+		return nil, fmt.Errorf("login throttle reset error: %w", err)
+	}
+	return s.completeLogin(ctx, user, client)
+}
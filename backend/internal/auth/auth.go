@@ -7,13 +7,15 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/hxrshxz/ground-sense-bot/backend/internal/config"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/mail"
 	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/sms"
 )
 
 var (
@@ -23,11 +25,26 @@ var (
 	ErrInvalidToken      = errors.New("invalid token")
 	ErrTokenExpired      = errors.New("token expired")
 	ErrInvalidPassword   = errors.New("invalid password")
+	ErrSessionNotFound   = errors.New("session not found")
+	ErrTokenRevoked      = errors.New("token revoked")
+	ErrAccountInactive   = errors.New("account is not active")
 )
 
 type Service struct {
-	db     *sql.DB
-	config *config.Config
+	db          *sql.DB
+	config      *config.Config
+	mailer      mail.Sender
+	sms         sms.Sender
+	keys        *KeySet
+	revocations RevocationStore
+	// dummyPasswordHash is compared against when an email is unknown, so a failed login
+	// takes as long whether or not the account exists.
+	dummyPasswordHash string
+	// breached is the offline breached-password corpus, or nil when none is configured.
+	breached *BreachedPasswords
+	rolePermissions rolePermissionCache
+	// oidcProviders are the external identity providers users can sign in with, by name.
+	oidcProviders map[string]*OIDCProvider
 }
 
 type JWTClaims struct {
@@ -35,29 +52,81 @@ type JWTClaims struct {
 	Username string    `json:"username"`
 	Email    string    `json:"email"`
 	Role     string    `json:"role"`
+	// SessionID ties the access token to the user_sessions row created at login.
+	SessionID uuid.UUID `json:"sid,omitempty"`
+	// Actor is set when an administrator is acting as this user, see Impersonate.
+	Actor *ActorClaim `json:"act,omitempty"`
+	// Permissions narrows a service account's role to the scope it asked for; nil means
+	// the role's permissions apply unrestricted.
+	Permissions []string `json:"permissions,omitempty"`
+	// APIKeyID is set when the request authenticated with an API key rather than a token.
+	APIKeyID uuid.UUID `json:"-"`
 	jwt.RegisteredClaims
 }
 
 type RefreshToken struct {
 	ID        uuid.UUID `json:"id"`
 	UserID    uuid.UUID `json:"user_id"`
+	SessionID uuid.UUID `json:"session_id"`
 	Token     string    `json:"token"`
 	ExpiresAt time.Time `json:"expires_at"`
 	CreatedAt time.Time `json:"created_at"`
 	Revoked   bool      `json:"revoked"`
 }
 
-func NewService(db *sql.DB, cfg *config.Config) *Service {
-	return &Service{
-		db:     db,
-		config: cfg,
+func NewService(db *sql.DB, cfg *config.Config, mailer mail.Sender, smsSender sms.Sender) (*Service, error) {
+	keys, err := LoadKeySet(cfg.JWT)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load JWT keys: %w", err)
+	}
+
+	var revocations RevocationStore
+	switch cfg.JWT.RevocationStore {
+	case "postgres":
+		revocations = NewPostgresRevocationStore(db)
+	default:
+		revocations = NewMemoryRevocationStore(cfg.JWT.ExpiryHour)
+	}
+
+	dummyPasswordHash, err := HashPassword("ground-sense-timing-dummy", cfg.Password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash timing dummy password: %w", err)
+	}
+
+	var breached *BreachedPasswords
+	if cfg.PasswordPolicy.BreachedPasswordsFile != "" {
+		if breached, err = NewBreachedPasswords(cfg.PasswordPolicy.BreachedPasswordsFile); err != nil {
+			return nil, fmt.Errorf("failed to open breached password file: %w", err)
+		}
+	}
+
+	oidcProviders := make(map[string]*OIDCProvider, len(cfg.OIDC))
+	for _, providerConfig := range cfg.OIDC {
+		provider := NewOIDCProvider(providerConfig, nil)
+		oidcProviders[provider.Name()] = provider
 	}
+
+	return &Service{
+		db:                db,
+		config:            cfg,
+		mailer:            mailer,
+		sms:               smsSender,
+		keys:              keys,
+		revocations:       revocations,
+		dummyPasswordHash: dummyPasswordHash,
+		breached:          breached,
+		oidcProviders:     oidcProviders,
+	}, nil
 }
 
-func (s *Service) Register(ctx context.Context, req models.RegisterRequest) (*models.AuthResponse, error) {
+func (s *Service) Register(ctx context.Context, req models.RegisterRequest, client ClientInfo) (*models.AuthResponse, error) {
+	if err := s.checkUsername(ctx, s.db, req.Username, uuid.Nil); err != nil && err != ErrUsernameTaken {
+		return nil, err
+	}
+
 	// Check if user already exists
 	var existingID uuid.UUID
-	err := s.db.QueryRowContext(ctx, "SELECT id FROM users WHERE email = $1 OR username = $2",
+	err := s.db.QueryRowContext(ctx, "SELECT id FROM users WHERE LOWER(email) = LOWER($1) OR LOWER(username) = LOWER($2)",
 		req.Email, req.Username).Scan(&existingID)
 	if err == nil {
 		return nil, ErrUserExists
@@ -65,6 +134,18 @@ func (s *Service) Register(ctx context.Context, req models.RegisterRequest) (*mo
 		return nil, fmt.Errorf("database error: %w", err)
 	}
 
+	// Phones are stored in E.164 so they can be matched for verification and login
+	phone := req.Phone
+	if phone != "" {
+		if phone, err = NormalizePhone(phone); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.checkPasswordPolicy(ctx, req.Password, passwordOwner{username: req.Username, email: req.Email}); err != nil {
+		return nil, err
+	}
+
 	// Hash password
 	hashedPassword, err := s.hashPassword(req.Password)
 	if err != nil {
@@ -82,7 +163,7 @@ func (s *Service) Register(ctx context.Context, req models.RegisterRequest) (*mo
 		Password:      hashedPassword,
 		FirstName:     req.FirstName,
 		LastName:      req.LastName,
-		Phone:         req.Phone,
+		Phone:         phone,
 		Role:          models.RoleUser,
 		Status:        models.StatusActive,
 		EmailVerified: false,
@@ -102,15 +183,14 @@ func (s *Service) Register(ctx context.Context, req models.RegisterRequest) (*mo
 		return nil, fmt.Errorf("user creation error: %w", err)
 	}
 
-	// Generate tokens
-	accessToken, refreshToken, err := s.generateTokens(user)
-	if err != nil {
-		return nil, fmt.Errorf("token generation error: %w", err)
+	if err := s.recordPasswordHistory(ctx, s.db, user.ID, user.Password); err != nil {
+		return nil, err
 	}
 
-	// Store refresh token
-	if err := s.storeRefreshToken(ctx, user.ID, refreshToken); err != nil {
-		return nil, fmt.Errorf("refresh token storage error: %w", err)
+	// Start a session and issue its first token pair
+	accessToken, refreshToken, err := s.startSession(ctx, user, client)
+	if err != nil {
+		return nil, err
 	}
 
 	userProfile := models.UserProfile{
@@ -121,17 +201,28 @@ func (s *Service) Register(ctx context.Context, req models.RegisterRequest) (*mo
 	}
 
 	return &models.AuthResponse{
-		User:  userProfile,
-		Token: accessToken,
+		User:         userProfile,
+		Token:        accessToken,
+		RefreshToken: refreshToken,
 	}, nil
 }
 
-func (s *Service) Login(ctx context.Context, req models.LoginRequest) (*models.AuthResponse, error) {
+func (s *Service) Login(ctx context.Context, req models.LoginRequest, client ClientInfo) (*models.AuthResponse, error) {
+	// Refuse early while the account or address is backing off or locked
+	throttleKeys := []string{accountThrottleKey(req.Email)}
+	if client.IPAddress != "" {
+		throttleKeys = append(throttleKeys, ipThrottleKey(client.IPAddress))
+	}
+	if err := s.checkLoginThrottle(ctx, throttleKeys...); err != nil {
+		return nil, err
+	}
+
 	// Get user by email
 	var user models.User
 	var passwordHash string
 	err := s.db.QueryRowContext(ctx, `
-		SELECT id, username, email, password_hash, first_name, last_name, phone, role, status,
+		SELECT id, username, email, password_hash, COALESCE(first_name, ''), COALESCE(last_name, ''),
+		       COALESCE(phone, ''), role, status,
 		       email_verified, phone_verified, last_login_at, created_at, updated_at
 		FROM users WHERE email = $1 AND deleted_at IS NULL`, req.Email).Scan(
 		&user.ID, &user.Username, &user.Email, &passwordHash, &user.FirstName, &user.LastName,
@@ -139,6 +230,10 @@ func (s *Service) Login(ctx context.Context, req models.LoginRequest) (*models.A
 		&user.LastLoginAt, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
+			s.checkPassword(req.Password, s.dummyPasswordHash)
+			if err := s.registerLoginFailure(ctx, req.Email, uuid.Nil, client); err != nil {
+				return nil, err
+			}
 			return nil, ErrInvalidCredentials
 		}
 		return nil, fmt.Errorf("database error: %w", err)
@@ -146,47 +241,35 @@ func (s *Service) Login(ctx context.Context, req models.LoginRequest) (*models.A
 
 	// Check password
 	if !s.checkPassword(req.Password, passwordHash) {
+		if err := s.registerLoginFailure(ctx, req.Email, user.ID, client); err != nil {
+			return nil, err
+		}
 		return nil, ErrInvalidCredentials
 	}
 
-	// Check if user is active
-	if user.Status != models.StatusActive {
-		return nil, errors.New("account is not active")
-	}
-
-	// Update last login
-	now := time.Now()
-	_, err = s.db.ExecContext(ctx, "UPDATE users SET last_login_at = $1, updated_at = $2 WHERE id = $3",
-		now, now, user.ID)
-	if err != nil {
-		return nil, fmt.Errorf("last login update error: %w", err)
-	}
-
-	user.LastLoginAt = &now
-	user.UpdatedAt = now
-
-	// Generate tokens
-	accessToken, refreshToken, err := s.generateTokens(&user)
-	if err != nil {
-		return nil, fmt.Errorf("token generation error: %w", err)
+	// The plaintext is only available now, so this is when old hashes get upgraded
+	if NeedsRehash(passwordHash, s.config.Password) {
+		if err := s.rehashPassword(ctx, user.ID, passwordHash, req.Password); err != nil {
+			return nil, fmt.Errorf("password rehash error: %w", err)
+		}
 	}
 
-	// Store refresh token
-	if err := s.storeRefreshToken(ctx, user.ID, refreshToken); err != nil {
-		return nil, fmt.Errorf("refresh token storage error: %w", err)
+	// A password alone isn't enough from somewhere this unfamiliar
+	if threshold := s.config.LoginAnomaly.StepUpScore; threshold > 0 && user.Status == models.StatusActive {
+		assessment, err := s.assessLogin(ctx, user.ID, client)
+		if err != nil {
+			return nil, err
+		}
+		if assessment.Score >= threshold {
+			return nil, s.startLoginChallenge(ctx, &user, client, assessment)
+		}
 	}
 
-	userProfile := models.UserProfile{
-		User:           user,
-		PostsCount:     0, // TODO: Get actual counts
-		FollowersCount: 0,
-		FollowingCount: 0,
+	// Failures keep counting until the sign-in is complete, step-up included
+	if err := s.clearLoginThrottle(ctx, accountThrottleKey(req.Email)); err != nil {
+		return nil, fmt.Errorf("login throttle reset error: %w", err)
 	}
-
-	return &models.AuthResponse{
-		User:  userProfile,
-		Token: accessToken,
-	}, nil
+	return s.completeLogin(ctx, &user, client)
 }
 
 func (s *Service) RefreshToken(ctx context.Context, refreshTokenStr string) (*models.AuthResponse, error) {
@@ -199,7 +282,8 @@ func (s *Service) RefreshToken(ctx context.Context, refreshTokenStr string) (*mo
 	// Get user
 	var user models.User
 	err = s.db.QueryRowContext(ctx, `
-		SELECT id, username, email, first_name, last_name, phone, role, status
+		SELECT id, username, email, COALESCE(first_name, ''), COALESCE(last_name, ''),
+		       COALESCE(phone, ''), role, status
 		FROM users WHERE id = $1 AND deleted_at IS NULL`, token.UserID).Scan(
 		&user.ID, &user.Username, &user.Email, &user.FirstName, &user.LastName,
 		&user.Phone, &user.Role, &user.Status)
@@ -207,8 +291,12 @@ func (s *Service) RefreshToken(ctx context.Context, refreshTokenStr string) (*mo
 		return nil, fmt.Errorf("user lookup error: %w", err)
 	}
 
-	// Generate new tokens
-	accessToken, newRefreshToken, err := s.generateTokens(&user)
+	if user.Status != models.StatusActive {
+		return nil, ErrAccountInactive
+	}
+
+	// Generate new tokens within the same session
+	accessToken, newRefreshToken, err := s.generateTokens(ctx, &user, token.SessionID)
 	if err != nil {
 		return nil, fmt.Errorf("token generation error: %w", err)
 	}
@@ -218,11 +306,15 @@ func (s *Service) RefreshToken(ctx context.Context, refreshTokenStr string) (*mo
 		return nil, fmt.Errorf("token revocation error: %w", err)
 	}
 
-	// Store new refresh token
-	if err := s.storeRefreshToken(ctx, user.ID, newRefreshToken); err != nil {
+	// Store new refresh token in the session's family
+	if err := s.storeRefreshToken(ctx, user.ID, token.SessionID, newRefreshToken); err != nil {
 		return nil, fmt.Errorf("refresh token storage error: %w", err)
 	}
 
+	if err := s.touchSession(ctx, token.SessionID); err != nil {
+		return nil, fmt.Errorf("session update error: %w", err)
+	}
+
 	userProfile := models.UserProfile{
 		User:           user,
 		PostsCount:     0,
@@ -231,18 +323,15 @@ func (s *Service) RefreshToken(ctx context.Context, refreshTokenStr string) (*mo
 	}
 
 	return &models.AuthResponse{
-		User:  userProfile,
-		Token: accessToken,
+		User:         userProfile,
+		Token:        accessToken,
+		RefreshToken: newRefreshToken,
 	}, nil
 }
 
-func (s *Service) ValidateToken(tokenStr string) (*JWTClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenStr, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(s.config.JWT.Secret), nil
-	})
+func (s *Service) ValidateToken(ctx context.Context, tokenStr string) (*JWTClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenStr, &JWTClaims{}, s.keys.Keyfunc,
+		jwt.WithValidMethods(s.keys.Algorithms()))
 
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
@@ -251,44 +340,47 @@ func (s *Service) ValidateToken(tokenStr string) (*JWTClaims, error) {
 		return nil, ErrInvalidToken
 	}
 
-	if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid {
-		return claims, nil
+	claims, ok := token.Claims.(*JWTClaims)
+	if !ok || !token.Valid || claims.ID == "" {
+		// Tokens issued without a jti predate revocation support and can't be checked
+		return nil, ErrInvalidToken
 	}
 
-	return nil, ErrInvalidToken
-}
+	if err := s.checkRevocation(ctx, claims); err != nil {
+		if err == ErrTokenRevoked {
+			return nil, err
+		}
+		return nil, fmt.Errorf("revocation check error: %w", err)
+	}
 
-func (s *Service) Logout(ctx context.Context, refreshTokenStr string) error {
-	return s.revokeRefreshToken(ctx, refreshTokenStr)
+	return claims, nil
 }
 
-func (s *Service) hashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(bytes), err
+// JWKS returns the public keys other services can use to verify our access tokens.
+func (s *Service) JWKS() JWKSet {
+	return s.keys.JWKS()
 }
 
-func (s *Service) checkPassword(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
-}
+func (s *Service) Logout(ctx context.Context, refreshTokenStr string) error {
+	var userID, sessionID uuid.UUID
+	err := s.db.QueryRowContext(ctx, "SELECT user_id, session_id FROM refresh_tokens WHERE token = $1",
+		refreshTokenStr).Scan(&userID, &sessionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrInvalidToken
+		}
+		return err
+	}
 
-func (s *Service) generateTokens(user *models.User) (accessToken, refreshToken string, err error) {
-	// Generate access token
-	accessClaims := JWTClaims{
-		UserID:   user.ID,
-		Username: user.Username,
-		Email:    user.Email,
-		Role:     string(user.Role),
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.config.JWT.ExpiryHour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    "ground-sense-bot",
-			Subject:   user.ID.String(),
-		},
+	err = s.RevokeSession(ctx, userID, sessionID)
+	if err == ErrSessionNotFound {
+		return nil
 	}
+	return err
+}
 
-	accessToken, err = jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims).SignedString([]byte(s.config.JWT.Secret))
+func (s *Service) generateTokens(ctx context.Context, user *models.User, sessionID uuid.UUID) (accessToken, refreshToken string, err error) {
+	accessToken, err = s.generateAccessToken(ctx, user, sessionID)
 	if err != nil {
 		return "", "", err
 	}
@@ -303,23 +395,53 @@ func (s *Service) generateTokens(user *models.User) (accessToken, refreshToken s
 	return accessToken, refreshToken, nil
 }
 
-func (s *Service) storeRefreshToken(ctx context.Context, userID uuid.UUID, token string) error {
+func (s *Service) generateAccessToken(ctx context.Context, user *models.User, sessionID uuid.UUID) (string, error) {
+	// Tokens issued in the second the user's tokens were invalidated would be rejected
+	// with them, so they're dated from the watermark instead
+	now := time.Now()
+	issuedAt := now
+	if notBefore, err := s.revocations.NotBefore(ctx, user.ID); err != nil {
+		return "", err
+	} else if notBefore.After(now) {
+		issuedAt = notBefore
+	}
+
+	accessClaims := JWTClaims{
+		UserID:    user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		Role:      string(user.Role),
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.config.JWT.ExpiryHour)),
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    "ground-sense-bot",
+			Subject:   user.ID.String(),
+			ID:        uuid.New().String(),
+		},
+	}
+
+	return s.keys.Sign(accessClaims)
+}
+
+func (s *Service) storeRefreshToken(ctx context.Context, userID, sessionID uuid.UUID, token string) error {
 	tokenID := uuid.New()
-	expiresAt := time.Now().Add(7 * 24 * time.Hour) // 7 days
+	expiresAt := time.Now().Add(refreshTokenTTL)
 
 	_, err := s.db.ExecContext(ctx, `
-		INSERT INTO refresh_tokens (id, user_id, token, expires_at, created_at)
-		VALUES ($1, $2, $3, $4, $5)`,
-		tokenID, userID, token, expiresAt, time.Now())
+		INSERT INTO refresh_tokens (id, user_id, session_id, token, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		tokenID, userID, sessionID, token, expiresAt, time.Now())
 	return err
 }
 
 func (s *Service) verifyRefreshToken(ctx context.Context, token string) (*RefreshToken, error) {
 	var rt RefreshToken
 	err := s.db.QueryRowContext(ctx, `
-		SELECT id, user_id, token, expires_at, created_at, revoked
+		SELECT id, user_id, session_id, token, expires_at, created_at, revoked
 		FROM refresh_tokens WHERE token = $1`, token).Scan(
-		&rt.ID, &rt.UserID, &rt.Token, &rt.ExpiresAt, &rt.CreatedAt, &rt.Revoked)
+		&rt.ID, &rt.UserID, &rt.SessionID, &rt.Token, &rt.ExpiresAt, &rt.CreatedAt, &rt.Revoked)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrInvalidToken
@@ -327,7 +449,21 @@ func (s *Service) verifyRefreshToken(ctx context.Context, token string) (*Refres
 		return nil, err
 	}
 
-	if rt.Revoked || time.Now().After(rt.ExpiresAt) {
+	if rt.Revoked {
+		// A rotated token being replayed means the family has leaked; end the session.
+		if err := s.RevokeSession(ctx, rt.UserID, rt.SessionID); err != nil && err != ErrSessionNotFound {
+			return nil, err
+		}
+		return nil, ErrInvalidToken
+	}
+
+	if time.Now().After(rt.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+
+	if active, err := s.sessionActive(ctx, rt.SessionID); err != nil {
+		return nil, err
+	} else if !active {
 		return nil, ErrInvalidToken
 	}
 
@@ -339,10 +475,14 @@ func (s *Service) revokeRefreshToken(ctx context.Context, token string) error {
 	return err
 }
 
-func (s *Service) ChangePassword(ctx context.Context, userID uuid.UUID, req models.ChangePasswordRequest) error {
+// ChangePassword keeps the caller's current session but signs out every other device
+// and invalidates all access tokens issued before the change.
+func (s *Service) ChangePassword(ctx context.Context, userID, currentSessionID uuid.UUID, req models.ChangePasswordRequest) error {
 	// Get current password hash
 	var currentHash string
-	err := s.db.QueryRowContext(ctx, "SELECT password_hash FROM users WHERE id = $1", userID).Scan(&currentHash)
+	owner := passwordOwner{userID: userID}
+	err := s.db.QueryRowContext(ctx, "SELECT password_hash, username, email FROM users WHERE id = $1",
+		userID).Scan(&currentHash, &owner.username, &owner.email)
 	if err != nil {
 		return fmt.Errorf("user lookup error: %w", err)
 	}
@@ -352,6 +492,10 @@ func (s *Service) ChangePassword(ctx context.Context, userID uuid.UUID, req mode
 		return ErrInvalidPassword
 	}
 
+	if err := s.checkPasswordPolicy(ctx, req.NewPassword, owner); err != nil {
+		return err
+	}
+
 	// Hash new password
 	newHash, err := s.hashPassword(req.NewPassword)
 	if err != nil {
@@ -359,12 +503,43 @@ func (s *Service) ChangePassword(ctx context.Context, userID uuid.UUID, req mode
 	}
 
 	// Update password
-	_, err = s.db.ExecContext(ctx, "UPDATE users SET password_hash = $1, updated_at = $2 WHERE id = $3",
-		newHash, time.Now(), userID)
-	return err
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "UPDATE users SET password_hash = $1, updated_at = $2 WHERE id = $3",
+			newHash, time.Now(), userID)
+		if err != nil {
+			return err
+		}
+		return s.recordPasswordHistory(ctx, tx, userID, newHash)
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.RevokeOtherSessions(ctx, userID, currentSessionID); err != nil {
+		return err
+	}
+
+	return s.InvalidateUserTokens(ctx, userID)
 }
 
-func (s *Service) RequestPasswordReset(ctx context.Context, email string) error {
+// RequestPasswordReset emails a reset link to the owner of a registered address, within
+// the passwordless send limit. Callers should respond identically whatever happens here.
+func (s *Service) RequestPasswordReset(ctx context.Context, email string, client ClientInfo) error {
+	email = strings.TrimSpace(email)
+
+	var userID uuid.UUID
+	err := s.db.QueryRowContext(ctx, "SELECT id FROM users WHERE email = $1 AND deleted_at IS NULL",
+		email).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if allowed, err := s.emailSendAllowed(ctx, "password_reset_tokens", email, client.IPAddress); err != nil || !allowed {
+		return err
+	}
+
 	// Generate reset token
 	tokenBytes := make([]byte, 32)
 	if _, err := rand.Read(tokenBytes); err != nil {
@@ -374,17 +549,19 @@ func (s *Service) RequestPasswordReset(ctx context.Context, email string) error
 	expiresAt := time.Now().Add(1 * time.Hour)
 
 	// Store reset token
-	_, err := s.db.ExecContext(ctx, `
-		INSERT INTO password_reset_tokens (email, token, expires_at, created_at)
-		VALUES ($1, $2, $3, $4)`, email, token, expiresAt, time.Now())
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO password_reset_tokens (email, token, expires_at, created_at, ip_address)
+		VALUES ($1, $2, $3, $4, $5)`, email, token, expiresAt, time.Now(), client.IPAddress)
 	if err != nil {
 		return err
 	}
 
-	// TODO: Send email with reset link
-	// For now, just log the token
-	fmt.Printf("Password reset token for %s: %s\n", email, token)
-	return nil
+	return s.mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Reset your Ground Sense password",
+		Body: fmt.Sprintf("Use this link within the next hour to choose a new password:\n%s/reset-password?token=%s\n\n"+
+			"If you didn't ask for this, you can ignore this email.", s.config.Server.PublicURL, token),
+	})
 }
 
 func (s *Service) ResetPassword(ctx context.Context, req models.PasswordResetConfirm) error {
@@ -402,6 +579,21 @@ func (s *Service) ResetPassword(ctx context.Context, req models.PasswordResetCon
 		return ErrTokenExpired
 	}
 
+	owner := passwordOwner{email: email}
+	err = s.db.QueryRowContext(ctx, "SELECT id, username FROM users WHERE email = $1 AND deleted_at IS NULL",
+		email).Scan(&owner.userID, &owner.username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	// The token stays valid until a password that meets the policy is chosen
+	if err := s.checkPasswordPolicy(ctx, req.Password, owner); err != nil {
+		return err
+	}
+
 	// Hash new password
 	hash, err := s.hashPassword(req.Password)
 	if err != nil {
@@ -409,13 +601,29 @@ func (s *Service) ResetPassword(ctx context.Context, req models.PasswordResetCon
 	}
 
 	// Update password
-	_, err = s.db.ExecContext(ctx, "UPDATE users SET password_hash = $1, updated_at = $2 WHERE email = $3",
-		hash, time.Now(), email)
+	userID := owner.userID
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "UPDATE users SET password_hash = $1, updated_at = $2 WHERE id = $3",
+			hash, time.Now(), userID)
+		if err != nil {
+			return err
+		}
+		return s.recordPasswordHistory(ctx, tx, userID, hash)
+	})
 	if err != nil {
 		return err
 	}
 
 	// Mark token as used
 	_, err = s.db.ExecContext(ctx, "UPDATE password_reset_tokens SET used = true WHERE token = $1", req.Token)
-	return err
+	if err != nil {
+		return err
+	}
+
+	// Whoever knew the old password is signed out everywhere
+	if _, err := s.RevokeAllSessions(ctx, userID); err != nil {
+		return err
+	}
+
+	return s.InvalidateUserTokens(ctx, userID)
 }
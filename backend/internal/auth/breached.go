@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// BreachedPasswords looks passwords up in an offline copy of a breached-password corpus
+// such as Have I Been Pwned's SHA-1 list. Only the 5-character hash prefix selects what
+// is read, as with the online k-anonymity range API, and two layouts are supported:
+//
+//   - a directory of range files named by prefix (e.g. 5BAA6 or 5BAA6.txt), each line
+//     "SUFFIX:COUNT" for the remaining 35 hex characters;
+//   - a single file of "HASH:COUNT" lines sorted by hash, searched without loading it.
+type BreachedPasswords struct {
+	path string
+	dir  bool
+	size int64
+}
+
+const breachedPrefixLength = 5
+
+func NewBreachedPasswords(path string) (*BreachedPasswords, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &BreachedPasswords{path: path, dir: info.IsDir(), size: info.Size()}, nil
+}
+
+// Count returns how many times the password appears in the corpus.
+func (b *BreachedPasswords) Count(password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:breachedPrefixLength], hash[breachedPrefixLength:]
+
+	if b.dir {
+		return b.countInRangeFile(prefix, suffix)
+	}
+	return b.countInSortedFile(prefix, suffix)
+}
+
+func (b *BreachedPasswords) countInRangeFile(prefix, suffix string) (int, error) {
+	f, err := os.Open(filepath.Join(b.path, prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		f, err = os.Open(filepath.Join(b.path, prefix+".txt"))
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if count, ok := matchBreachedLine(scanner.Text(), suffix); ok {
+			return count, nil
+		}
+	}
+	return 0, scanner.Err()
+}
+
+// countInSortedFile binary searches byte offsets for the first line of the prefix's range,
+// then scans that range.
+func (b *BreachedPasswords) countInSortedFile(prefix, suffix string) (int, error) {
+	f, err := os.Open(b.path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	lo, hi := int64(0), b.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		line, err := lineAfter(f, mid)
+		if err != nil {
+			return 0, err
+		}
+		if line == "" || strings.ToUpper(line[:min(len(line), breachedPrefixLength)]) >= prefix {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(f, lo, b.size-lo))
+	if lo > 0 {
+		// lo sits inside the line before the range; skip to the start of the next one
+		if _, err := reader.ReadString('\n'); err != nil {
+			return 0, nil
+		}
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if len(line) >= breachedPrefixLength {
+			linePrefix := strings.ToUpper(line[:breachedPrefixLength])
+			if linePrefix > prefix {
+				return 0, nil
+			}
+			if linePrefix == prefix {
+				if count, ok := matchBreachedLine(line[breachedPrefixLength:], suffix); ok {
+					return count, nil
+				}
+			}
+		}
+		if err == io.EOF {
+			return 0, nil
+		} else if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// lineAfter returns the first complete line starting after offset, or "" at end of file.
+func lineAfter(r io.ReaderAt, offset int64) (string, error) {
+	buf := make([]byte, 256)
+	n, err := r.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	buf = buf[:n]
+
+	start := 0
+	if offset > 0 {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			return "", nil
+		}
+		start = i + 1
+	}
+	rest := buf[start:]
+	if end := bytes.IndexByte(rest, '\n'); end >= 0 {
+		rest = rest[:end]
+	}
+	return strings.TrimSpace(string(rest)), nil
+}
+
+func matchBreachedLine(line, suffix string) (int, bool) {
+	hashPart, countPart, _ := strings.Cut(strings.TrimSpace(line), ":")
+	if !strings.EqualFold(hashPart, suffix) {
+		return 0, false
+	}
+	count, err := strconv.Atoi(countPart)
+	if err != nil {
+		// Some corpora omit counts; an entry still means the password is breached
+		count = 1
+	}
+	return count, true
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"net"
+	"strings"
+
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+)
+
+// describeDevice derives a coarse device description from a User-Agent header.
+// It is only a hint for humans reviewing their sessions, not an identity signal.
+func describeDevice(userAgent string) models.DeviceInfo {
+	ua := strings.ToLower(userAgent)
+	device := models.DeviceInfo{Type: "desktop", OS: "Unknown", Browser: "Unknown"}
+
+	switch {
+	case ua == "":
+		device.Type = "unknown"
+	case strings.Contains(ua, "bot") || strings.Contains(ua, "curl") || strings.Contains(ua, "okhttp"):
+		device.Type = "bot"
+	case strings.Contains(ua, "ipad") || strings.Contains(ua, "tablet"):
+		device.Type = "tablet"
+	case strings.Contains(ua, "mobi") || strings.Contains(ua, "iphone") || strings.Contains(ua, "android"):
+		device.Type = "mobile"
+	}
+
+	switch {
+	case strings.Contains(ua, "android"):
+		device.OS = "Android"
+	case strings.Contains(ua, "iphone") || strings.Contains(ua, "ipad"):
+		device.OS = "iOS"
+	case strings.Contains(ua, "windows"):
+		device.OS = "Windows"
+	case strings.Contains(ua, "mac os") || strings.Contains(ua, "macintosh"):
+		device.OS = "macOS"
+	case strings.Contains(ua, "cros"):
+		device.OS = "ChromeOS"
+	case strings.Contains(ua, "linux"):
+		device.OS = "Linux"
+	}
+
+	// Order matters: Edge and Opera also advertise Chrome, and Chrome advertises Safari.
+	switch {
+	case strings.Contains(ua, "edg/"):
+		device.Browser = "Edge"
+	case strings.Contains(ua, "opr/") || strings.Contains(ua, "opera"):
+		device.Browser = "Opera"
+	case strings.Contains(ua, "samsungbrowser"):
+		device.Browser = "Samsung Internet"
+	case strings.Contains(ua, "chrome") || strings.Contains(ua, "crios"):
+		device.Browser = "Chrome"
+	case strings.Contains(ua, "firefox") || strings.Contains(ua, "fxios"):
+		device.Browser = "Firefox"
+	case strings.Contains(ua, "safari"):
+		device.Browser = "Safari"
+	}
+
+	return device
+}
+
+// describeLocation gives a privacy-preserving hint of where a session came from.
+// Without a GeoIP database we report the network prefix rather than a city.
+func describeLocation(ipAddress string) models.LocationHint {
+	ip := net.ParseIP(ipAddress)
+	if ip == nil {
+		return models.LocationHint{Scope: "unknown"}
+	}
+
+	hint := models.LocationHint{Network: ipPrefix(ip), Scope: "public"}
+	switch {
+	case ip.IsLoopback():
+		hint.Scope = "loopback"
+	case ip.IsPrivate():
+		hint.Scope = "private"
+	}
+	return hint
+}
+
+// ipPrefix masks an address to its /24 (IPv4) or /48 (IPv6) network.
+func ipPrefix(ip net.IP) string {
+	if v4 := ip.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
+
+// inetOrNull returns a value suitable for an INET column, or NULL when the address can't be parsed.
+func inetOrNull(ipAddress string) interface{} {
+	if net.ParseIP(ipAddress) == nil {
+		return nil
+	}
+	return ipAddress
+}
@@ -0,0 +1,384 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+)
+
+// unusablePasswordHash marks accounts that have no password (e.g. provisioned from an IdP).
+// It never matches any password.
+const unusablePasswordHash = "!"
+
+var usernameCleaner = regexp.MustCompile(`[^a-z0-9_.-]+`)
+
+// rolePrecedence orders roles so the most privileged mapped group wins.
+var rolePrecedence = map[models.UserRole]int{
+	models.RoleGuest:     0,
+	models.RoleUser:      1,
+	models.RoleModerator: 2,
+	models.RoleAdmin:     3,
+}
+
+// RegisterOIDCProvider adds or replaces an identity provider.
+func (s *Service) RegisterOIDCProvider(provider *OIDCProvider) {
+	s.oidcProviders[provider.Name()] = provider
+}
+
+// OIDCProviders lists the configured identity provider names.
+func (s *Service) OIDCProviders() []string {
+	names := make([]string, 0, len(s.oidcProviders))
+	for name := range s.oidcProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OIDCAuthorizationURL starts a login with the named provider. The state, nonce and PKCE
+// verifier are kept server-side and consumed by OIDCCallback. The returned binding, a
+// hash of the state, goes in the OIDCStateCookie so only the browser that started the
+// login can finish it.
+func (s *Service) OIDCAuthorizationURL(ctx context.Context, providerName string) (authURL, binding string, err error) {
+	provider, ok := s.oidcProviders[providerName]
+	if !ok {
+		return "", "", ErrOIDCProviderNotFound
+	}
+
+	state, err := randomURLToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomURLToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomURLToken(48)
+	if err != nil {
+		return "", "", err
+	}
+
+	authURL, err = provider.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Abandoned logins are cleared here rather than by a separate job
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM oidc_login_states WHERE expires_at < $1", time.Now()); err != nil {
+		return "", "", fmt.Errorf("login state cleanup error: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO oidc_login_states (state, provider, nonce, code_verifier, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		state, provider.Name(), nonce, verifier, time.Now().Add(oidcStateTTL), time.Now())
+	if err != nil {
+		return "", "", fmt.Errorf("login state storage error: %w", err)
+	}
+
+	return authURL, hashSecret(state), nil
+}
+
+// OIDCStateCookie carries a login's binding from OIDCAuthorizationURL to its callback.
+// An empty binding gives a cookie that clears it.
+func (s *Service) OIDCStateCookie(binding string) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     OIDCStateCookieName,
+		Value:    binding,
+		Path:     "/api/v1/auth/oidc/",
+		MaxAge:   int(oidcStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(s.config.Server.PublicURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	}
+	if binding == "" {
+		cookie.MaxAge = -1
+	}
+	return cookie
+}
+
+// OIDCCallback completes a provider login for the browser holding the state's binding.
+// Rather than tokens it returns a frontend URL carrying a one-time code, which
+// ExchangeOIDCLoginCode trades for our own tokens, so none end up in the browser history.
+func (s *Service) OIDCCallback(ctx context.Context, providerName, code, state, binding string) (string, error) {
+	provider, ok := s.oidcProviders[providerName]
+	if !ok {
+		return "", ErrOIDCProviderNotFound
+	}
+	if subtle.ConstantTimeCompare([]byte(binding), []byte(hashSecret(state))) != 1 {
+		return "", ErrOIDCStateInvalid
+	}
+
+	// States are single use: delete first so a replayed callback finds nothing
+	var nonce, verifier string
+	var expiresAt time.Time
+	err := s.db.QueryRowContext(ctx, `
+		DELETE FROM oidc_login_states WHERE state = $1 AND provider = $2
+		RETURNING nonce, code_verifier, expires_at`, state, provider.Name()).Scan(&nonce, &verifier, &expiresAt)
+	if err != nil || time.Now().After(expiresAt) {
+		return "", ErrOIDCStateInvalid
+	}
+
+	identity, err := provider.Exchange(ctx, code, verifier, nonce)
+	if err != nil {
+		return "", err
+	}
+
+	user, err := s.resolveOIDCUser(ctx, provider, identity)
+	if err != nil {
+		return "", err
+	}
+
+	loginCode, err := randomURLToken(32)
+	if err != nil {
+		return "", err
+	}
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM oidc_login_codes WHERE expires_at < $1", time.Now()); err != nil {
+		return "", fmt.Errorf("login code cleanup error: %w", err)
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO oidc_login_codes (code_hash, user_id, expires_at, created_at) VALUES ($1, $2, $3, $4)`,
+		hashSecret(loginCode), user.ID, time.Now().Add(oidcLoginCodeTTL), time.Now())
+	if err != nil {
+		return "", fmt.Errorf("login code storage error: %w", err)
+	}
+
+	return s.config.Server.PublicURL + "/oidc/callback?code=" + url.QueryEscape(loginCode), nil
+}
+
+// ExchangeOIDCLoginCode trades the one-time code from OIDCCallback for our own tokens.
+func (s *Service) ExchangeOIDCLoginCode(ctx context.Context, code string, client ClientInfo) (*models.AuthResponse, error) {
+	var userID uuid.UUID
+	var expiresAt time.Time
+	err := s.db.QueryRowContext(ctx, `
+		DELETE FROM oidc_login_codes WHERE code_hash = $1 RETURNING user_id, expires_at`,
+		hashSecret(code)).Scan(&userID, &expiresAt)
+	if err == sql.ErrNoRows || (err == nil && time.Now().After(expiresAt)) {
+		return nil, ErrInvalidToken
+	} else if err != nil {
+		return nil, fmt.Errorf("login code lookup error: %w", err)
+	}
+
+	user, err := s.getUser(ctx, userID)
+	if err == ErrUserNotFound {
+		return nil, ErrInvalidToken
+	} else if err != nil {
+		return nil, err
+	}
+
+	return s.completeLogin(ctx, user, client)
+}
+
+// resolveOIDCUser finds the user linked to an external identity, linking by verified email
+// or provisioning a new user when the provider allows it.
+func (s *Service) resolveOIDCUser(ctx context.Context, provider *OIDCProvider, identity *OIDCIdentity) (*models.User, error) {
+	var userID uuid.UUID
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE user_identities SET email = $1, last_login_at = $2
+		WHERE provider = $3 AND subject = $4
+		RETURNING user_id`, identity.Email, time.Now(), identity.Provider, identity.Subject).Scan(&userID)
+
+	switch {
+	case err == nil:
+	case err != sql.ErrNoRows:
+		return nil, fmt.Errorf("identity lookup error: %w", err)
+	case provider.config.LinkByEmail && identity.EmailVerified && identity.Email != "":
+		err = s.db.QueryRowContext(ctx, "SELECT id FROM users WHERE email = $1 AND deleted_at IS NULL",
+			identity.Email).Scan(&userID)
+		if err == sql.ErrNoRows {
+			if userID, err = s.provisionOIDCUser(ctx, provider, identity); err != nil {
+				return nil, err
+			}
+		} else if err != nil {
+			return nil, fmt.Errorf("user lookup error: %w", err)
+		} else if err := s.linkIdentity(ctx, userID, identity); err != nil {
+			return nil, err
+		}
+	default:
+		if userID, err = s.provisionOIDCUser(ctx, provider, identity); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.syncOIDCRole(ctx, provider, userID, identity.Groups); err != nil {
+		return nil, err
+	}
+
+	return s.getUser(ctx, userID)
+}
+
+// syncOIDCRole applies the provider's role map to a returning user. Without RoleSync a
+// matching group only raises the role, so roles granted locally survive; with it the
+// IdP decides, and a user in no mapped group drops back to user.
+func (s *Service) syncOIDCRole(ctx context.Context, provider *OIDCProvider, userID uuid.UUID, groups []string) error {
+	if len(provider.config.RoleMap) == 0 {
+		return nil
+	}
+	role, matched := mapGroupsToRole(provider.config.RoleMap, groups)
+	if !matched && !provider.config.RoleSync {
+		return nil
+	}
+
+	var current models.UserRole
+	if err := s.db.QueryRowContext(ctx, "SELECT role FROM users WHERE id = $1", userID).Scan(&current); err != nil {
+		return fmt.Errorf("role lookup error: %w", err)
+	}
+	if current == role || (!provider.config.RoleSync && rolePrecedence[role] <= rolePrecedence[current]) {
+		return nil
+	}
+
+	if _, err := s.db.ExecContext(ctx, "UPDATE users SET role = $1, updated_at = $2 WHERE id = $3",
+		role, time.Now(), userID); err != nil {
+		return fmt.Errorf("role sync error: %w", err)
+	}
+	return nil
+}
+
+func (s *Service) provisionOIDCUser(ctx context.Context, provider *OIDCProvider, identity *OIDCIdentity) (uuid.UUID, error) {
+	if !provider.config.AllowSignup {
+		return uuid.Nil, ErrOIDCSignupDisabled
+	}
+	if identity.Email == "" {
+		return uuid.Nil, fmt.Errorf("identity provider %s did not return an email", provider.Name())
+	}
+
+	var exists bool
+	if err := s.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE email = $1)",
+		identity.Email).Scan(&exists); err != nil {
+		return uuid.Nil, fmt.Errorf("database error: %w", err)
+	} else if exists {
+		// Someone already owns this email; they must link the identity themselves
+		return uuid.Nil, ErrUserExists
+	}
+
+	username, err := s.uniqueUsername(ctx, identity)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	role, _ := mapGroupsToRole(provider.config.RoleMap, identity.Groups)
+
+	userID := uuid.New()
+	now := time.Now()
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO users (id, username, email, password_hash, first_name, last_name, role, status,
+			                   email_verified, phone_verified, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, false, $10, $10)`,
+			userID, username, identity.Email, unusablePasswordHash, identity.GivenName, identity.FamilyName,
+			role, models.StatusActive, identity.EmailVerified, now)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO user_identities (user_id, provider, subject, email, created_at, last_login_at)
+			VALUES ($1, $2, $3, $4, $5, $5)`,
+			userID, identity.Provider, identity.Subject, identity.Email, now)
+		return err
+	})
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("user provisioning error: %w", err)
+	}
+
+	return userID, nil
+}
+
+func (s *Service) linkIdentity(ctx context.Context, userID uuid.UUID, identity *OIDCIdentity) error {
+	now := time.Now()
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO user_identities (user_id, provider, subject, email, created_at, last_login_at)
+		VALUES ($1, $2, $3, $4, $5, $5)`,
+		userID, identity.Provider, identity.Subject, identity.Email, now)
+	if err != nil {
+		return fmt.Errorf("identity link error: %w", err)
+	}
+	return nil
+}
+
+// uniqueUsername derives a username from the identity, adding a suffix until it is free.
+func (s *Service) uniqueUsername(ctx context.Context, identity *OIDCIdentity) (string, error) {
+	base := identity.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+	base = strings.Trim(usernameCleaner.ReplaceAllString(strings.ToLower(base), "_"), "_.-")
+	if len(base) > 40 {
+		base = base[:40]
+	}
+	for len(base) < 3 {
+		base += "_"
+	}
+
+	candidate := base
+	for attempt := 0; attempt < 5; attempt++ {
+		var taken bool
+		if err := s.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE LOWER(username) = LOWER($1))",
+			candidate).Scan(&taken); err != nil {
+			return "", fmt.Errorf("database error: %w", err)
+		}
+		taken = taken || s.usernameReserved(candidate)
+		if !taken {
+			return candidate, nil
+		}
+
+		suffix, err := randomHex(2)
+		if err != nil {
+			return "", err
+		}
+		candidate = base + "_" + suffix
+	}
+
+	return "", fmt.Errorf("could not find a free username for %s", identity.Email)
+}
+
+// mapGroupsToRole returns the most privileged role any of the groups maps to, and
+// whether any did; with no match the role is user.
+func mapGroupsToRole(roleMap map[string]string, groups []string) (models.UserRole, bool) {
+	role := models.RoleUser
+	matched := false
+	for _, group := range groups {
+		mapped, ok := roleMap[group]
+		if !ok {
+			continue
+		}
+		candidate := models.UserRole(mapped)
+		if _, known := rolePrecedence[candidate]; !known {
+			continue
+		}
+		if !matched || rolePrecedence[candidate] > rolePrecedence[role] {
+			role = candidate
+			matched = true
+		}
+	}
+	return role, matched
+}
+
+func (s *Service) getUser(ctx context.Context, userID uuid.UUID) (*models.User, error) {
+	var user models.User
+	var accountType models.AccountType
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, username, email, COALESCE(first_name, ''), COALESCE(last_name, ''), COALESCE(phone, ''),
+		       COALESCE(avatar_url, ''), role, status, email_verified, phone_verified, last_login_at,
+		       created_at, updated_at, account_type
+		FROM users WHERE id = $1 AND deleted_at IS NULL`, userID).Scan(
+		&user.ID, &user.Username, &user.Email, &user.FirstName, &user.LastName, &user.Phone,
+		&user.AvatarURL, &user.Role, &user.Status, &user.EmailVerified, &user.PhoneVerified,
+		&user.LastLoginAt, &user.CreatedAt, &user.UpdatedAt, &accountType)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("user lookup error: %w", err)
+	}
+	user.SetAccountType(accountType)
+	return &user, nil
+}
@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/database"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/mail"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+)
+
+// impersonationTTL bounds how long an administrator can act as a user; there is no
+// refresh token, so a longer investigation needs a fresh, separately audited token.
+const impersonationTTL = 15 * time.Minute
+
+var (
+	// ErrImpersonationForbidden is returned for actions an impersonation token may not take.
+	ErrImpersonationForbidden = errors.New("not allowed while impersonating another user")
+	ErrCannotImpersonate      = errors.New("this user cannot be impersonated")
+)
+
+// ActorClaim is the RFC 8693 "act" claim: who is really behind a token issued for
+// someone else.
+type ActorClaim struct {
+	UserID   uuid.UUID `json:"sub"`
+	Username string    `json:"username"`
+}
+
+// Impersonated reports whether the token was issued to an administrator acting as the user.
+func (c *JWTClaims) Impersonated() bool {
+	return c.Actor != nil
+}
+
+// ImpersonationResponse is the short-lived token an administrator uses to act as a user.
+type ImpersonationResponse struct {
+	User      models.UserProfile `json:"user"`
+	Token     string             `json:"token"`
+	ExpiresAt time.Time          `json:"expires_at"`
+	Actor     ActorClaim         `json:"actor"`
+}
+
+// Impersonate issues an access token for targetID carrying the administrator as its actor.
+// The token shares the administrator's session, so signing out or revoking that session
+// ends the impersonation too. The user is emailed before the token is handed out.
+func (s *Service) Impersonate(ctx context.Context, admin *JWTClaims, targetID uuid.UUID, reason string, client ClientInfo) (*ImpersonationResponse, error) {
+	if admin.Impersonated() {
+		return nil, ErrImpersonationForbidden
+	}
+	if targetID == admin.UserID {
+		return nil, ErrCannotImpersonate
+	}
+
+	user, err := s.getUser(ctx, targetID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Status != models.StatusActive {
+		return nil, ErrAccountInactive
+	}
+
+	// Acting as someone who could impersonate in turn would be a way around their audit trail
+	roles, err := s.RolePermissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if HasPermission(roles[string(user.Role)], PermUsersImpersonate) {
+		return nil, ErrCannotImpersonate
+	}
+
+	now := time.Now()
+	actor := ActorClaim{UserID: admin.UserID, Username: admin.Username}
+	claims := JWTClaims{
+		UserID:    user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		Role:      string(user.Role),
+		SessionID: admin.SessionID,
+		Actor:     &actor,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(impersonationTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    "ground-sense-bot",
+			Subject:   user.ID.String(),
+			ID:        uuid.New().String(),
+		},
+	}
+	token, err := s.keys.Sign(claims)
+	if err != nil {
+		return nil, fmt.Errorf("token generation error: %w", err)
+	}
+
+	if err := database.RecordAudit(ctx, s.db, database.AuditEntry{
+		UserID:       user.ID.String(),
+		ActorID:      admin.UserID.String(),
+		Action:       "auth.impersonation_started",
+		ResourceType: "user",
+		ResourceID:   user.ID.String(),
+		NewValues: map[string]interface{}{
+			"reason":     reason,
+			"token_id":   claims.ID,
+			"expires_at": claims.ExpiresAt.Time,
+		},
+		IPAddress: client.IPAddress,
+		UserAgent: client.UserAgent,
+	}); err != nil {
+		return nil, fmt.Errorf("audit log error: %w", err)
+	}
+
+	if err := s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "An administrator is accessing your Ground Sense account",
+		Body: fmt.Sprintf("Hi %s,\n\nA Ground Sense administrator (%s) has started acting as you to help "+
+			"with your account. Their access ends by %s UTC and cannot change your password, sign-in "+
+			"details or delete your account.\n\nReason given: %s\n\n"+
+			"If you didn't expect this, please contact support.",
+			user.Username, admin.Username, claims.ExpiresAt.Time.UTC().Format("2006-01-02 15:04"), reason),
+	}); err != nil {
+		return nil, fmt.Errorf("impersonation notice error: %w", err)
+	}
+
+	return &ImpersonationResponse{
+		User:      models.UserProfile{User: *user},
+		Token:     token,
+		ExpiresAt: claims.ExpiresAt.Time,
+		Actor:     actor,
+	}, nil
+}
+
+// RecordImpersonatedRequest stamps a request made with an impersonation token in the
+// audit log under both the user and the administrator behind it.
+func (s *Service) RecordImpersonatedRequest(ctx context.Context, claims *JWTClaims, method, path string, status int, client ClientInfo) error {
+	if !claims.Impersonated() {
+		return nil
+	}
+	return database.RecordAudit(ctx, s.db, database.AuditEntry{
+		UserID:       claims.UserID.String(),
+		ActorID:      claims.Actor.UserID.String(),
+		Action:       "auth.impersonated_request",
+		ResourceType: "request",
+		NewValues: map[string]interface{}{
+			"method":   method,
+			"path":     path,
+			"status":   status,
+			"token_id": claims.ID,
+		},
+		IPAddress: client.IPAddress,
+		UserAgent: client.UserAgent,
+	})
+}
@@ -0,0 +1,302 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/config"
+)
+
+// KeySet holds the key used to sign new tokens and every key still accepted for
+// verification. Rotating keys means signing with a new key while the previous
+// public key stays in the verification set until its tokens have expired.
+type KeySet struct {
+	method       jwt.SigningMethod
+	signingKey   interface{}
+	signingKeyID string
+	verification map[string]verificationKey
+}
+
+type verificationKey struct {
+	method jwt.SigningMethod
+	key    interface{}
+}
+
+// JWK is a public key in RFC 7517 form.
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// LoadKeySet builds the key set described by the JWT configuration.
+func LoadKeySet(cfg config.JWTConfig) (*KeySet, error) {
+	if cfg.Algorithm == "HS256" || cfg.Algorithm == "" {
+		// Symmetric keys are never published, so no kid is needed
+		return &KeySet{
+			method:     jwt.SigningMethodHS256,
+			signingKey: []byte(cfg.Secret),
+			verification: map[string]verificationKey{
+				"": {method: jwt.SigningMethodHS256, key: []byte(cfg.Secret)},
+			},
+		}, nil
+	}
+
+	privateKey, err := readPrivateKey(cfg.SigningKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("signing key: %w", err)
+	}
+
+	method, publicKey, err := methodForKey(privateKey.Public())
+	if err != nil {
+		return nil, fmt.Errorf("signing key: %w", err)
+	}
+	if method.Alg() != cfg.Algorithm {
+		return nil, fmt.Errorf("signing key is %s but JWT_ALGORITHM is %s", method.Alg(), cfg.Algorithm)
+	}
+
+	keyID := cfg.SigningKeyID
+	if keyID == "" {
+		if keyID, err = thumbprint(publicKey); err != nil {
+			return nil, err
+		}
+	}
+
+	keys := &KeySet{
+		method:       method,
+		signingKey:   privateKey,
+		signingKeyID: keyID,
+		verification: map[string]verificationKey{
+			keyID: {method: method, key: publicKey},
+		},
+	}
+
+	for _, entry := range cfg.VerificationKeyFiles {
+		// A retired key signed with a configured kid is listed as path=kid so its tokens
+		// still resolve; it's also accepted under its thumbprint
+		file, kids := entry, []string(nil)
+		if i := strings.LastIndex(entry, "="); i >= 0 {
+			file = entry[:i]
+			if kid := entry[i+1:]; kid != "" {
+				kids = append(kids, kid)
+			}
+		}
+		publicKey, err := readPublicKey(file)
+		if err != nil {
+			return nil, fmt.Errorf("verification key %s: %w", file, err)
+		}
+		method, publicKey, err := methodForKey(publicKey)
+		if err != nil {
+			return nil, fmt.Errorf("verification key %s: %w", file, err)
+		}
+		thumb, err := thumbprint(publicKey)
+		if err != nil {
+			return nil, err
+		}
+		for _, kid := range append(kids, thumb) {
+			existing, exists := keys.verification[kid]
+			if !exists {
+				keys.verification[kid] = verificationKey{method: method, key: publicKey}
+			} else if !sameKey(existing.key, publicKey) {
+				return nil, fmt.Errorf("verification key %s: kid %q is already used by another key", file, kid)
+			}
+		}
+	}
+
+	return keys, nil
+}
+
+// Sign signs claims with the active signing key, stamping its kid header.
+func (k *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.method, claims)
+	if k.signingKeyID != "" {
+		token.Header["kid"] = k.signingKeyID
+	}
+	return token.SignedString(k.signingKey)
+}
+
+// Keyfunc resolves the verification key for a parsed token by its kid header.
+func (k *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := k.verification[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.key, nil
+}
+
+// Algorithms lists every algorithm accepted for verification.
+func (k *KeySet) Algorithms() []string {
+	seen := map[string]bool{}
+	var algs []string
+	for _, key := range k.verification {
+		if alg := key.method.Alg(); !seen[alg] {
+			seen[alg] = true
+			algs = append(algs, alg)
+		}
+	}
+	return algs
+}
+
+// JWKS returns the public verification keys. It is empty for HS256.
+func (k *KeySet) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for kid, key := range k.verification {
+		jwk, err := toJWK(key.key)
+		if err != nil {
+			continue
+		}
+		jwk.Kid = kid
+		jwk.Alg = key.method.Alg()
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
+
+// sameKey reports whether two public keys are equal.
+func sameKey(a, b crypto.PublicKey) bool {
+	key, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(b)
+}
+
+func methodForKey(publicKey crypto.PublicKey) (jwt.SigningMethod, crypto.PublicKey, error) {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < 2048 {
+			return nil, nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		return jwt.SigningMethodRS256, key, nil
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, key, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported key type %T", publicKey)
+	}
+}
+
+func readPrivateKey(path string) (crypto.Signer, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("expected a PKCS#8 or PKCS#1 private key")
+}
+
+func readPublicKey(path string) (crypto.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+		return cert.PublicKey, nil
+	}
+	return nil, errors.New("expected a PKIX public key, PKCS#1 public key or certificate")
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	return block, nil
+}
+
+func toJWK(publicKey interface{}) (JWK, error) {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}, nil
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Use: "sig",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(key),
+		}, nil
+	default:
+		return JWK{}, fmt.Errorf("unsupported key type %T", publicKey)
+	}
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint, used as the default kid.
+func thumbprint(publicKey crypto.PublicKey) (string, error) {
+	jwk, err := toJWK(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	// Required members only, in lexicographic order
+	var members interface{}
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
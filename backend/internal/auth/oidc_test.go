@@ -0,0 +1,486 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/config"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+)
+
+const testClientID = "ground-sense"
+
+// testIdP is an OpenID provider serving discovery, a JWKS and a token endpoint. Codes
+// come from authorize, which remembers the PKCE challenge and nonce of the request.
+type testIdP struct {
+	t      *testing.T
+	server *httptest.Server
+	key    ed25519.PrivateKey
+	kid    string
+
+	mu     sync.Mutex
+	grants map[string]testGrant
+}
+
+type testGrant struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &testIdP{t: t, key: key, kid: "idp-key-1", grants: map[string]testGrant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                idp.server.URL,
+			AuthorizationEndpoint: idp.server.URL + "/authorize",
+			TokenEndpoint:         idp.server.URL + "/token",
+			JWKSURI:               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		jwk, err := toJWK(key.Public())
+		if err != nil {
+			t.Error(err)
+		}
+		jwk.Kid, jwk.Alg = idp.kid, "EdDSA"
+		json.NewEncoder(w).Encode(JWKSet{Keys: []JWK{jwk}})
+	})
+	mux.HandleFunc("/token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *testIdP) provider(cfg config.OIDCProviderConfig) *OIDCProvider {
+	cfg.Name = "test"
+	cfg.Issuer = idp.server.URL
+	cfg.ClientID = testClientID
+	cfg.RedirectURL = "https://app.example/api/v1/auth/oidc/test/callback"
+	cfg.GroupsClaim = "groups"
+	return NewOIDCProvider(cfg, idp.server.Client())
+}
+
+// authorize plays the user signing in at the provider: it checks the authorization
+// request and returns a code whose ID token carries claims plus the request's nonce.
+func (idp *testIdP) authorize(authURL string, claims jwt.MapClaims) string {
+	idp.t.Helper()
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		idp.t.Fatalf("authorization request without an S256 PKCE challenge: %s", authURL)
+	}
+	if query.Get("client_id") != testClientID || query.Get("response_type") != "code" {
+		idp.t.Fatalf("unexpected authorization request: %s", authURL)
+	}
+
+	full := jwt.MapClaims{
+		"iss":   idp.server.URL,
+		"aud":   testClientID,
+		"sub":   "subject-1",
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": query.Get("nonce"),
+	}
+	for name, value := range claims {
+		if value == nil {
+			delete(full, name)
+		} else {
+			full[name] = value
+		}
+	}
+
+	code := uuid.NewString()
+	idp.mu.Lock()
+	idp.grants[code] = testGrant{challenge: query.Get("code_challenge"), claims: full}
+	idp.mu.Unlock()
+	return code
+}
+
+func (idp *testIdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	idp.mu.Lock()
+	grant, ok := idp.grants[r.PostForm.Get("code")]
+	delete(idp.grants, r.PostForm.Get("code"))
+	idp.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case !ok || r.PostForm.Get("grant_type") != "authorization_code":
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	case base64.RawURLEncoding.EncodeToString(verifier[:]) != grant.challenge:
+		http.Error(w, `{"error":"invalid_grant","error_description":"PKCE verification failed"}`, http.StatusBadRequest)
+		return
+	}
+
+	json.NewEncoder(w).Encode(oidcTokenResponse{IDToken: idp.sign(grant.claims, idp.key), TokenType: "Bearer"})
+}
+
+func (idp *testIdP) sign(claims jwt.MapClaims, key ed25519.PrivateKey) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = idp.kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	return signed
+}
+
+// capture is a sqlmock argument that remembers what it was given.
+type capture struct{ value *string }
+
+func (c capture) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	*c.value = s
+	return ok
+}
+
+func newOIDCTestService(t *testing.T, provider *OIDCProvider) (*Service, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	cfg := &config.Config{Server: config.ServerConfig{PublicURL: "https://app.example"}}
+	return &Service{db: db, config: cfg, oidcProviders: map[string]*OIDCProvider{provider.Name(): provider}}, mock
+}
+
+// startLogin runs OIDCAuthorizationURL and returns the authorization URL, the cookie
+// binding and the stored state row.
+func startLogin(t *testing.T, s *Service, mock sqlmock.Sqlmock) (authURL, binding string, row *sqlmock.Rows) {
+	t.Helper()
+	var state, nonce, verifier string
+	mock.ExpectExec("DELETE FROM oidc_login_states WHERE expires_at").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO oidc_login_states").
+		WithArgs(capture{&state}, "test", capture{&nonce}, capture{&verifier}, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	authURL, binding, err := s.OIDCAuthorizationURL(context.Background(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mustQuery(t, authURL).Get("state"); got != state {
+		t.Fatalf("authorization URL state %q, stored %q", got, state)
+	}
+	if binding != hashSecret(state) || binding == state {
+		t.Fatalf("binding %q is not a hash of the state", binding)
+	}
+	return authURL, binding, sqlmock.NewRows([]string{"nonce", "code_verifier", "expires_at"}).
+		AddRow(nonce, verifier, time.Now().Add(oidcStateTTL))
+}
+
+func mustQuery(t *testing.T, rawURL string) url.Values {
+	t.Helper()
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Query()
+}
+
+var userColumns = []string{"id", "username", "email", "first_name", "last_name", "phone", "avatar_url", "role",
+	"status", "email_verified", "phone_verified", "last_login_at", "created_at", "updated_at", "account_type"}
+
+func userRow(id uuid.UUID, email string, role models.UserRole) *sqlmock.Rows {
+	return sqlmock.NewRows(userColumns).AddRow(id.String(), "asha", email, "", "", "", "", string(role),
+		string(models.StatusActive), true, false, nil, time.Now(), time.Now(), "human")
+}
+
+func expectLoginCode(mock sqlmock.Sqlmock, userID uuid.UUID) {
+	mock.ExpectExec("DELETE FROM oidc_login_codes WHERE expires_at").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO oidc_login_codes").
+		WithArgs(sqlmock.AnyArg(), userID, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func TestOIDCExchangeValidatesPKCEAndIDToken(t *testing.T) {
+	idp := newTestIdP(t)
+	_, wrongKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		claims   jwt.MapClaims
+		verifier string
+		forge    bool
+		wantErr  string
+	}{
+		{name: "valid", claims: jwt.MapClaims{"email": "Asha@Example.org", "email_verified": true, "groups": []string{"gw-admins"}}},
+		{name: "wrong PKCE verifier", verifier: "not-the-verifier", wantErr: "PKCE verification failed"},
+		{name: "nonce mismatch", claims: jwt.MapClaims{"nonce": "someone-elses-nonce"}, wantErr: "nonce mismatch"},
+		{name: "missing nonce", claims: jwt.MapClaims{"nonce": nil}, wantErr: "nonce mismatch"},
+		{name: "wrong audience", claims: jwt.MapClaims{"aud": "another-client"}, wantErr: "invalid id_token"},
+		{name: "wrong issuer", claims: jwt.MapClaims{"iss": "https://evil.example"}, wantErr: "invalid id_token"},
+		{name: "expired", claims: jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}, wantErr: "invalid id_token"},
+		{name: "no expiry", claims: jwt.MapClaims{"exp": nil}, wantErr: "invalid id_token"},
+		{name: "several audiences without azp", claims: jwt.MapClaims{"aud": []string{testClientID, "other"}}, wantErr: "authorized party mismatch"},
+		{name: "several audiences with our azp", claims: jwt.MapClaims{"aud": []string{testClientID, "other"}, "azp": testClientID}},
+		{name: "missing subject", claims: jwt.MapClaims{"sub": nil}, wantErr: "missing subject"},
+		{name: "signed with another key", forge: true, wantErr: "invalid id_token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := idp.provider(config.OIDCProviderConfig{})
+			nonce, verifier := "nonce-"+tt.name, "verifier-that-is-long-enough-"+tt.name
+			authURL, err := provider.AuthCodeURL(context.Background(), "state", nonce, verifier)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := mustQuery(t, authURL).Get("nonce"); got != nonce {
+				t.Fatalf("authorization request nonce %q, want %q", got, nonce)
+			}
+			code := idp.authorize(authURL, tt.claims)
+
+			var identity *OIDCIdentity
+			if tt.forge {
+				idp.mu.Lock()
+				grant := idp.grants[code]
+				idp.mu.Unlock()
+				identity, err = provider.verifyIDToken(context.Background(), idp.sign(grant.claims, wrongKey), nonce)
+			} else {
+				if tt.verifier != "" {
+					verifier = tt.verifier
+				}
+				identity, err = provider.Exchange(context.Background(), code, verifier, nonce)
+			}
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if identity.Subject != "subject-1" || identity.Provider != "test" {
+				t.Errorf("identity = %+v", identity)
+			}
+			if tt.name == "valid" {
+				if identity.Email != "asha@example.org" || !identity.EmailVerified {
+					t.Errorf("email = %q verified %v, want lower-cased and verified", identity.Email, identity.EmailVerified)
+				}
+				if len(identity.Groups) != 1 || identity.Groups[0] != "gw-admins" {
+					t.Errorf("groups = %v", identity.Groups)
+				}
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackStateIsBoundAndSingleUse(t *testing.T) {
+	idp := newTestIdP(t)
+	s, mock := newOIDCTestService(t, idp.provider(config.OIDCProviderConfig{AllowSignup: true}))
+	ctx := context.Background()
+	userID := uuid.New()
+
+	authURL, binding, stateRow := startLogin(t, s, mock)
+	state := mustQuery(t, authURL).Get("state")
+	code := idp.authorize(authURL, jwt.MapClaims{"email": "asha@example.org", "email_verified": true})
+
+	mock.ExpectQuery("DELETE FROM oidc_login_states").WithArgs(state, "test").WillReturnRows(stateRow)
+	mock.ExpectQuery("UPDATE user_identities SET email").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(userID.String()))
+	mock.ExpectQuery("SELECT id, username, email").WithArgs(userID).
+		WillReturnRows(userRow(userID, "asha@example.org", models.RoleUser))
+	expectLoginCode(mock, userID)
+
+	// A callback from a browser without the cookie must not use up the state; if it
+	// reached the database the real callback below would find its rows taken
+	if _, err := s.OIDCCallback(ctx, "test", code, state, ""); err != ErrOIDCStateInvalid {
+		t.Fatalf("callback without binding: err = %v, want ErrOIDCStateInvalid", err)
+	}
+	if _, err := s.OIDCCallback(ctx, "test", code, state, hashSecret("another state")); err != ErrOIDCStateInvalid {
+		t.Fatalf("callback with another login's binding: err = %v, want ErrOIDCStateInvalid", err)
+	}
+
+	redirect, err := s.OIDCCallback(ctx, "test", code, state, binding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(redirect, "https://app.example/oidc/callback?code=") || mustQuery(t, redirect).Get("code") == "" {
+		t.Fatalf("redirect = %q, want the frontend callback with a one-time code", redirect)
+	}
+
+	// The state row is gone, so replaying the callback fails
+	mock.ExpectQuery("DELETE FROM oidc_login_states").WithArgs(state, "test").
+		WillReturnRows(sqlmock.NewRows([]string{"nonce", "code_verifier", "expires_at"}))
+	if _, err := s.OIDCCallback(ctx, "test", code, state, binding); err != ErrOIDCStateInvalid {
+		t.Fatalf("replayed callback: err = %v, want ErrOIDCStateInvalid", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOIDCCallbackLinksByVerifiedEmail(t *testing.T) {
+	tests := []struct {
+		name          string
+		linkByEmail   bool
+		emailVerified bool
+		wantErr       error
+	}{
+		{name: "verified email links", linkByEmail: true, emailVerified: true},
+		// Without linking the existing account's email blocks provisioning
+		{name: "unverified email does not link", linkByEmail: true, emailVerified: false, wantErr: ErrUserExists},
+		{name: "linking off", linkByEmail: false, emailVerified: true, wantErr: ErrUserExists},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newTestIdP(t)
+			s, mock := newOIDCTestService(t, idp.provider(config.OIDCProviderConfig{
+				AllowSignup: true, LinkByEmail: tt.linkByEmail,
+			}))
+			userID := uuid.New()
+
+			authURL, binding, stateRow := startLogin(t, s, mock)
+			code := idp.authorize(authURL, jwt.MapClaims{"email": "asha@example.org", "email_verified": tt.emailVerified})
+
+			mock.ExpectQuery("DELETE FROM oidc_login_states").WillReturnRows(stateRow)
+			mock.ExpectQuery("UPDATE user_identities SET email").WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+			if tt.wantErr == nil {
+				mock.ExpectQuery("SELECT id FROM users WHERE email").WithArgs("asha@example.org").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(userID.String()))
+				mock.ExpectExec("INSERT INTO user_identities").
+					WithArgs(userID, "test", "subject-1", "asha@example.org", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("SELECT id, username, email").
+					WillReturnRows(userRow(userID, "asha@example.org", models.RoleUser))
+				expectLoginCode(mock, userID)
+			} else {
+				mock.ExpectQuery("SELECT EXISTS\\(SELECT 1 FROM users WHERE email").WithArgs("asha@example.org").
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+			}
+
+			_, err := s.OIDCCallback(context.Background(), "test", code, mustQuery(t, authURL).Get("state"), binding)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackSignupDisabled(t *testing.T) {
+	idp := newTestIdP(t)
+	s, mock := newOIDCTestService(t, idp.provider(config.OIDCProviderConfig{AllowSignup: false}))
+
+	authURL, binding, stateRow := startLogin(t, s, mock)
+	code := idp.authorize(authURL, jwt.MapClaims{"email": "new@example.org", "email_verified": true})
+
+	mock.ExpectQuery("DELETE FROM oidc_login_states").WillReturnRows(stateRow)
+	mock.ExpectQuery("UPDATE user_identities SET email").WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+
+	_, err := s.OIDCCallback(context.Background(), "test", code, mustQuery(t, authURL).Get("state"), binding)
+	if err != ErrOIDCSignupDisabled {
+		t.Fatalf("err = %v, want ErrOIDCSignupDisabled", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMapGroupsToRole(t *testing.T) {
+	roleMap := map[string]string{"gw-admins": "admin", "gw-analysts": "moderator", "gw-odd": "superuser"}
+	tests := []struct {
+		groups      []string
+		wantRole    models.UserRole
+		wantMatched bool
+	}{
+		{nil, models.RoleUser, false},
+		{[]string{"staff"}, models.RoleUser, false},
+		{[]string{"gw-analysts"}, models.RoleModerator, true},
+		{[]string{"gw-analysts", "gw-admins"}, models.RoleAdmin, true},
+		{[]string{"gw-admins", "gw-analysts"}, models.RoleAdmin, true},
+		// Unknown roles in the map are ignored
+		{[]string{"gw-odd"}, models.RoleUser, false},
+	}
+	for _, tt := range tests {
+		role, matched := mapGroupsToRole(roleMap, tt.groups)
+		if role != tt.wantRole || matched != tt.wantMatched {
+			t.Errorf("mapGroupsToRole(%v) = %s, %v; want %s, %v", tt.groups, role, matched, tt.wantRole, tt.wantMatched)
+		}
+	}
+}
+
+func TestSyncOIDCRole(t *testing.T) {
+	roleMap := map[string]string{"gw-admins": "admin", "gw-analysts": "moderator"}
+	tests := []struct {
+		name     string
+		roleSync bool
+		groups   []string
+		current  models.UserRole
+		// wantRole is the role written, or empty for no change
+		wantRole models.UserRole
+	}{
+		{name: "mapped group raises", groups: []string{"gw-admins"}, current: models.RoleUser, wantRole: models.RoleAdmin},
+		{name: "no mapped group keeps role", groups: []string{"staff"}, current: models.RoleModerator},
+		{name: "lower mapped role keeps local role", groups: []string{"gw-analysts"}, current: models.RoleAdmin},
+		{name: "same role is not rewritten", groups: []string{"gw-analysts"}, current: models.RoleModerator},
+		{name: "sync lowers to mapped role", roleSync: true, groups: []string{"gw-analysts"}, current: models.RoleAdmin, wantRole: models.RoleModerator},
+		{name: "sync without a mapped group lowers to user", roleSync: true, groups: []string{"staff"}, current: models.RoleAdmin, wantRole: models.RoleUser},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := NewOIDCProvider(config.OIDCProviderConfig{Name: "test", RoleMap: roleMap, RoleSync: tt.roleSync}, nil)
+			s, mock := newOIDCTestService(t, provider)
+			userID := uuid.New()
+
+			_, matched := mapGroupsToRole(roleMap, tt.groups)
+			if matched || tt.roleSync {
+				mock.ExpectQuery("SELECT role FROM users").WithArgs(userID).
+					WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow(string(tt.current)))
+			}
+			if tt.wantRole != "" {
+				mock.ExpectExec("UPDATE users SET role").WithArgs(tt.wantRole, sqlmock.AnyArg(), userID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			if err := s.syncOIDCRole(context.Background(), provider, userID, tt.groups); err != nil {
+				t.Fatal(err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
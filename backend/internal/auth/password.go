@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashes are self-describing: argon2id hashes use the PHC string format
+// ($argon2id$v=19$m=...,t=...,p=...$salt$hash) and anything starting $2 is bcrypt.
+// Hashes in either format verify, whichever algorithm is configured for new ones.
+
+var errUnknownHashFormat = errors.New("unknown password hash format")
+
+type argon2Hash struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+// HashPassword hashes a password with the configured algorithm.
+func HashPassword(password string, cfg config.PasswordConfig) (string, error) {
+	if cfg.Algorithm == "bcrypt" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), cfg.BcryptCost)
+		return string(hash), err
+	}
+
+	salt := make([]byte, cfg.Argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, cfg.Argon2Iterations, cfg.Argon2Memory, cfg.Argon2Parallelism, cfg.Argon2KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, cfg.Argon2Memory, cfg.Argon2Iterations, cfg.Argon2Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// VerifyPassword reports whether password matches an encoded hash of any supported format.
+func VerifyPassword(password, encoded string) (bool, error) {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		hash, err := parseArgon2Hash(encoded)
+		if err != nil {
+			return false, err
+		}
+		key := argon2.IDKey([]byte(password), hash.salt, hash.iterations, hash.memory, hash.parallelism, uint32(len(hash.key)))
+		return subtle.ConstantTimeCompare(key, hash.key) == 1, nil
+	case strings.HasPrefix(encoded, "$2"):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, nil
+		}
+		return err == nil, err
+	default:
+		return false, errUnknownHashFormat
+	}
+}
+
+// NeedsRehash reports whether an encoded hash uses a different algorithm or weaker
+// parameters than the configuration asks for.
+func NeedsRehash(encoded string, cfg config.PasswordConfig) bool {
+	if cfg.Algorithm == "bcrypt" {
+		cost, err := bcrypt.Cost([]byte(encoded))
+		return err != nil || cost < cfg.BcryptCost
+	}
+
+	hash, err := parseArgon2Hash(encoded)
+	if err != nil {
+		return true
+	}
+	return hash.memory < cfg.Argon2Memory ||
+		hash.iterations < cfg.Argon2Iterations ||
+		hash.parallelism != cfg.Argon2Parallelism ||
+		uint32(len(hash.salt)) < cfg.Argon2SaltLength ||
+		uint32(len(hash.key)) < cfg.Argon2KeyLength
+}
+
+func parseArgon2Hash(encoded string) (*argon2Hash, error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, errUnknownHashFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+
+	hash := &argon2Hash{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &hash.memory, &hash.iterations, &hash.parallelism); err != nil {
+		return nil, fmt.Errorf("invalid argon2 parameters: %w", err)
+	}
+	if hash.iterations == 0 || hash.parallelism == 0 {
+		return nil, errors.New("invalid argon2 parameters")
+	}
+
+	var err error
+	if hash.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("invalid argon2 salt: %w", err)
+	}
+	if hash.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(hash.key) == 0 {
+		return nil, errors.New("invalid argon2 key")
+	}
+	return hash, nil
+}
+
+func (s *Service) hashPassword(password string) (string, error) {
+	return HashPassword(password, s.config.Password)
+}
+
+func (s *Service) checkPassword(password, hash string) bool {
+	ok, err := VerifyPassword(password, hash)
+	return err == nil && ok
+}
+
+// rehashPassword replaces a user's hash with one using the current configuration. A
+// password changed since oldHash was read is left alone.
+func (s *Service) rehashPassword(ctx context.Context, userID uuid.UUID, oldHash, password string) error {
+	newHash, err := s.hashPassword(password)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, "UPDATE users SET password_hash = $1 WHERE id = $2 AND password_hash = $3",
+		newHash, userID, oldHash)
+	return err
+}
+
+// ConfirmPassword re-checks a signed-in user's password before an irreversible action.
+// Accounts that only sign in through an identity provider have no password to confirm
+// and get ErrNoPassword; ConfirmIdentity offers them other proof.
+func (s *Service) ConfirmPassword(ctx context.Context, userID uuid.UUID, password string) error {
+	var hash string
+	err := s.db.QueryRowContext(ctx, "SELECT password_hash FROM users WHERE id = $1 AND deleted_at IS NULL",
+		userID).Scan(&hash)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	} else if err != nil {
+		return fmt.Errorf("user lookup error: %w", err)
+	}
+
+	if hash == unusablePasswordHash {
+		return ErrNoPassword
+	}
+	if !s.checkPassword(password, hash) {
+		return ErrInvalidPassword
+	}
+	return nil
+}
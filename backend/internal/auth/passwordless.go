@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/mail"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+)
+
+const (
+	magicLinkTTL = 15 * time.Minute
+	loginCodeTTL = 10 * time.Minute
+	// loginCodeMaxAttempts wrong guesses burn a code; with a 6-digit code that leaves
+	// a 1 in 200,000 chance per code sent.
+	loginCodeMaxAttempts = 5
+	// At most passwordlessMaxRequests emails go to one address, or are asked for from one
+	// client IP, per passwordlessRequestWindow. Password resets share the limit.
+	passwordlessMaxRequests   = 3
+	passwordlessRequestWindow = 15 * time.Minute
+)
+
+const (
+	PasswordlessMethodLink = "link"
+	PasswordlessMethodCode = "code"
+)
+
+// RequestPasswordlessLogin emails a single-use magic link or a 6-digit code to a registered address.
+// Callers should respond identically whatever happens here.
+func (s *Service) RequestPasswordlessLogin(ctx context.Context, email, method string, client ClientInfo) error {
+	email = strings.TrimSpace(email)
+
+	var status models.UserStatus
+	err := s.db.QueryRowContext(ctx,
+		"SELECT status FROM users WHERE email = $1 AND deleted_at IS NULL", email).Scan(&status)
+	if err == sql.ErrNoRows || (err == nil && status != models.StatusActive) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if allowed, err := s.emailSendAllowed(ctx, "login_tokens", email, client.IPAddress); err != nil || !allowed {
+		return err
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return err
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	var code sql.NullString
+	ttl := magicLinkTTL
+	if method == PasswordlessMethodCode {
+		n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+		if err != nil {
+			return err
+		}
+		code = sql.NullString{String: fmt.Sprintf("%06d", n.Int64()), Valid: true}
+		ttl = loginCodeTTL
+	}
+
+	// Only the newest link or code is ever valid, so guesses can't be spread over several codes
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE login_tokens SET used = true WHERE email = $1 AND used = false", email); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO login_tokens (email, token, code, expires_at, created_at, ip_address)
+			VALUES ($1, $2, $3, $4, $5, $6)`, email, token, code, time.Now().Add(ttl), time.Now(), client.IPAddress)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if code.Valid {
+		return s.mailer.Send(ctx, mail.Message{
+			To:      email,
+			Subject: "Your Ground Sense sign-in code",
+			Body: fmt.Sprintf("Your sign-in code is %s\n\nIt expires in %d minutes. "+
+				"If you didn't ask for this, you can ignore this email.", code.String, int(loginCodeTTL.Minutes())),
+		})
+	}
+
+	return s.mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Sign in to Ground Sense",
+		Body: fmt.Sprintf("Use this link within the next %d minutes to sign in:\n%s/magic-login?token=%s\n\n"+
+			"If you didn't ask for this, you can ignore this email.",
+			int(magicLinkTTL.Minutes()), s.config.Server.PublicURL, token),
+	})
+}
+
+// emailSendAllowed reports whether another email may go out for a request recorded in
+// table, which has email, ip_address and created_at columns.
+func (s *Service) emailSendAllowed(ctx context.Context, table, email, ip string) (bool, error) {
+	var byEmail, byIP int
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf(`
+		SELECT COUNT(*) FILTER (WHERE email = $1), COUNT(*) FILTER (WHERE ip_address = $2)
+		FROM %s WHERE created_at > $3 AND (email = $1 OR ip_address = $2)`, table),
+		email, ip, time.Now().Add(-passwordlessRequestWindow)).Scan(&byEmail, &byIP)
+	if err != nil {
+		return false, err
+	}
+	return byEmail < passwordlessMaxRequests && byIP < passwordlessMaxRequests, nil
+}
+
+// LoginWithMagicLink consumes a magic-link token and signs its owner in.
+func (s *Service) LoginWithMagicLink(ctx context.Context, token string, client ClientInfo) (*models.AuthResponse, error) {
+	var email string
+	var expiresAt time.Time
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE login_tokens SET used = true
+		WHERE token = $1 AND code IS NULL AND used = false
+		RETURNING email, expires_at`, token).Scan(&email, &expiresAt)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if time.Now().After(expiresAt) {
+		return nil, ErrTokenExpired
+	}
+
+	return s.completePasswordlessLogin(ctx, email, client)
+}
+
+// LoginWithCode checks an emailed code and signs its owner in. Every guess uses up one
+// of the code's attempts before it is compared.
+func (s *Service) LoginWithCode(ctx context.Context, email, code string, client ClientInfo) (*models.AuthResponse, error) {
+	email = strings.TrimSpace(email)
+
+	// A locked account stays locked whichever way someone tries to sign in
+	if err := s.checkLoginThrottle(ctx, accountThrottleKey(email)); err != nil {
+		return nil, err
+	}
+
+	var id uuid.UUID
+	var expected string
+	var expiresAt time.Time
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE login_tokens SET attempts = attempts + 1, used = attempts + 1 >= $2
+		WHERE id = (
+			SELECT id FROM login_tokens
+			WHERE email = $1 AND code IS NOT NULL AND used = false
+			ORDER BY created_at DESC LIMIT 1
+		) AND attempts < $2
+		RETURNING id, code, expires_at`, email, loginCodeMaxAttempts).Scan(&id, &expected, &expiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidToken
+	} else if err != nil {
+		return nil, fmt.Errorf("login code lookup error: %w", err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(code), []byte(expected)) != 1 {
+		return nil, ErrInvalidToken
+	}
+
+	if time.Now().After(expiresAt) {
+		return nil, ErrTokenExpired
+	}
+
+	if _, err := s.db.ExecContext(ctx, "UPDATE login_tokens SET used = true WHERE id = $1", id); err != nil {
+		return nil, err
+	}
+
+	return s.completePasswordlessLogin(ctx, email, client)
+}
+
+// completePasswordlessLogin signs in the owner of a proven email address. Receiving the
+// email also verifies the address.
+func (s *Service) completePasswordlessLogin(ctx context.Context, email string, client ClientInfo) (*models.AuthResponse, error) {
+	var user models.User
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE users SET email_verified = true WHERE email = $1 AND deleted_at IS NULL
+		RETURNING id, username, email, COALESCE(first_name, ''), COALESCE(last_name, ''),
+		          COALESCE(phone, ''), role, status,
+		          email_verified, phone_verified, last_login_at, created_at, updated_at`, email).Scan(
+		&user.ID, &user.Username, &user.Email, &user.FirstName, &user.LastName,
+		&user.Phone, &user.Role, &user.Status, &user.EmailVerified, &user.PhoneVerified,
+		&user.LastLoginAt, &user.CreatedAt, &user.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidToken
+	} else if err != nil {
+		return nil, fmt.Errorf("user lookup error: %w", err)
+	}
+
+	if err := s.clearLoginThrottle(ctx, accountThrottleKey(email)); err != nil {
+		return nil, fmt.Errorf("login throttle reset error: %w", err)
+	}
+
+	return s.completeLogin(ctx, &user, client)
+}
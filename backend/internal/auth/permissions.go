@@ -0,0 +1,241 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/database"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+)
+
+// Permissions are "resource:action" strings shared by roles and API keys. A grant of
+// "resource:*" covers every action on the resource and "*" covers everything.
+const (
+	PermUsersRead             = "users:read"
+	PermUsersBan              = "users:ban"
+	PermUsersUnlock           = "users:unlock"
+	PermUsersImpersonate      = "users:impersonate"
+	PermAuditRead             = "audit:read"
+	PermStatsRead             = "stats:read"
+	PermRolesManage           = "roles:manage"
+	PermDatasetsRead          = "datasets:read"
+	PermDatasetsPublish       = "datasets:publish"
+	PermChatModerate          = "chat:moderate"
+	PermServiceAccountsManage = "service_accounts:manage"
+)
+
+// PermissionCatalog describes every permission that can be granted.
+var PermissionCatalog = map[string]string{
+	PermUsersRead:             "List and view user accounts",
+	PermUsersBan:              "Suspend, ban or reactivate users",
+	PermUsersUnlock:           "Clear login lockouts",
+	PermUsersImpersonate:      "Act as another user to troubleshoot their account",
+	PermAuditRead:             "Read the audit log",
+	PermStatsRead:             "View system statistics",
+	PermRolesManage:           "Change which permissions each role has",
+	PermDatasetsRead:          "Read groundwater datasets",
+	PermDatasetsPublish:       "Import and publish groundwater datasets",
+	PermChatModerate:          "Moderate conversations and messages",
+	PermServiceAccountsManage: "Create service accounts and manage their API keys and secrets",
+}
+
+var (
+	ErrUnknownPermission = errors.New("unknown permission")
+	ErrUnknownRole       = errors.New("unknown role")
+	// ErrAdminLockout stops the admin role from losing the permission needed to restore it.
+	ErrAdminLockout = errors.New("the admin role must keep roles:manage")
+	// ErrPermissionEscalation stops users handing out, or acting against, permissions they
+	// don't hold themselves.
+	ErrPermissionEscalation = errors.New("the role has permissions you don't have")
+)
+
+const rolePermissionsTTL = time.Minute
+
+// rolePermissionCache keeps the role mapping in memory; other instances pick up
+// changes within rolePermissionsTTL.
+type rolePermissionCache struct {
+	mu       sync.RWMutex
+	roles    map[string][]string
+	loadedAt time.Time
+}
+
+// HasPermission reports whether any of the granted permissions covers the wanted one.
+func HasPermission(granted []string, want string) bool {
+	resource, _, _ := strings.Cut(want, ":")
+	for _, g := range granted {
+		if g == "*" || g == want || g == resource+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+// CoversPermissions reports whether the granted permissions cover every one of perms.
+func CoversPermissions(granted, perms []string) bool {
+	for _, p := range perms {
+		if !HasPermission(granted, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidatePermissions rejects grants that aren't in the catalog or a wildcard over it.
+func ValidatePermissions(perms []string) error {
+	for _, p := range perms {
+		if p == "*" || PermissionCatalog[p] != "" {
+			continue
+		}
+		if resource, action, ok := strings.Cut(p, ":"); ok && action == "*" && knownResource(resource) {
+			continue
+		}
+		return fmt.Errorf("%w: %s", ErrUnknownPermission, p)
+	}
+	return nil
+}
+
+func knownResource(resource string) bool {
+	for p := range PermissionCatalog {
+		if strings.HasPrefix(p, resource+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize reports whether the token's role grants the permission, and for API keys and
+// scoped service tokens whether the key or scope allows it too.
+func (s *Service) Authorize(ctx context.Context, claims *JWTClaims, permission string) (bool, error) {
+	roles, err := s.RolePermissions(ctx)
+	if err != nil {
+		return false, err
+	}
+	if claims.Permissions != nil && !HasPermission(claims.Permissions, permission) {
+		return false, nil
+	}
+	return HasPermission(roles[claims.Role], permission), nil
+}
+
+// RoleWithin reports whether the token holds every permission of the role, so that
+// granting the role or acting against its holders gives nothing the token lacks.
+func (s *Service) RoleWithin(ctx context.Context, claims *JWTClaims, role string) (bool, error) {
+	roles, err := s.RolePermissions(ctx)
+	if err != nil {
+		return false, err
+	}
+	perms := roles[role]
+	if claims.Permissions != nil && !CoversPermissions(claims.Permissions, perms) {
+		return false, nil
+	}
+	return CoversPermissions(roles[claims.Role], perms), nil
+}
+
+// RolePermissions returns every role's permissions.
+func (s *Service) RolePermissions(ctx context.Context) (map[string][]string, error) {
+	cache := &s.rolePermissions
+	cache.mu.RLock()
+	if cache.roles != nil && time.Since(cache.loadedAt) < rolePermissionsTTL {
+		roles := cache.roles
+		cache.mu.RUnlock()
+		return roles, nil
+	}
+	cache.mu.RUnlock()
+
+	rows, err := s.db.QueryContext(ctx, "SELECT role, permission FROM role_permissions ORDER BY role, permission")
+	if err != nil {
+		return nil, fmt.Errorf("role permissions lookup error: %w", err)
+	}
+	defer rows.Close()
+
+	roles := map[string][]string{}
+	for _, role := range []models.UserRole{
+		models.RoleAdmin, models.RoleModerator, models.RoleUser, models.RoleGuest, models.RoleService,
+	} {
+		roles[string(role)] = []string{}
+	}
+	for rows.Next() {
+		var role, permission string
+		if err := rows.Scan(&role, &permission); err != nil {
+			return nil, err
+		}
+		roles[role] = append(roles[role], permission)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	cache.mu.Lock()
+	cache.roles = roles
+	cache.loadedAt = time.Now()
+	cache.mu.Unlock()
+	return roles, nil
+}
+
+// SetRolePermissions replaces a role's permissions on behalf of an administrator.
+func (s *Service) SetRolePermissions(ctx context.Context, adminID uuid.UUID, role string, perms []string, client ClientInfo) error {
+	roles, err := s.RolePermissions(ctx)
+	if err != nil {
+		return err
+	}
+	old, ok := roles[role]
+	if !ok {
+		return ErrUnknownRole
+	}
+	if err := ValidatePermissions(perms); err != nil {
+		return err
+	}
+	if role == string(models.RoleAdmin) && !HasPermission(perms, PermRolesManage) {
+		return ErrAdminLockout
+	}
+
+	perms = dedupe(perms)
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM role_permissions WHERE role = $1", role); err != nil {
+			return err
+		}
+		for _, p := range perms {
+			if _, err := tx.ExecContext(ctx,
+				"INSERT INTO role_permissions (role, permission) VALUES ($1, $2)", role, p); err != nil {
+				return err
+			}
+		}
+		return database.RecordAudit(ctx, tx, database.AuditEntry{
+			UserID:       adminID.String(),
+			Action:       "rbac.role_permissions_updated",
+			ResourceType: "role",
+			ResourceID:   role,
+			OldValues:    map[string]interface{}{"permissions": old},
+			NewValues:    map[string]interface{}{"permissions": perms},
+			IPAddress:    client.IPAddress,
+			UserAgent:    client.UserAgent,
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("role permissions update error: %w", err)
+	}
+
+	s.rolePermissions.mu.Lock()
+	s.rolePermissions.roles = nil
+	s.rolePermissions.mu.Unlock()
+	return nil
+}
+
+func dedupe(values []string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHasPermission(t *testing.T) {
+	tests := []struct {
+		name    string
+		granted []string
+		want    string
+		allowed bool
+	}{
+		{name: "exact", granted: []string{PermUsersRead, PermAuditRead}, want: PermAuditRead, allowed: true},
+		{name: "missing", granted: []string{PermUsersRead}, want: PermUsersBan, allowed: false},
+		{name: "everything", granted: []string{"*"}, want: PermRolesManage, allowed: true},
+		{name: "resource wildcard", granted: []string{"users:*"}, want: PermUsersImpersonate, allowed: true},
+		{name: "other resource's wildcard", granted: []string{"users:*"}, want: PermAuditRead, allowed: false},
+		// "users" is a prefix of the resource but not the resource itself
+		{name: "resource prefix", granted: []string{"users:*"}, want: "users_archive:read", allowed: false},
+		// One action doesn't cover a grant of every action
+		{name: "action for wildcard", granted: []string{PermUsersRead}, want: "users:*", allowed: false},
+		{name: "wildcard for wildcard", granted: []string{"users:*"}, want: "users:*", allowed: true},
+		{name: "nothing granted", want: PermUsersRead, allowed: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HasPermission(tt.granted, tt.want); got != tt.allowed {
+				t.Errorf("HasPermission(%q, %q) = %v, want %v", tt.granted, tt.want, got, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestValidatePermissions(t *testing.T) {
+	tests := []struct {
+		name  string
+		perms []string
+		err   error
+	}{
+		{name: "none"},
+		{name: "catalog", perms: []string{PermUsersRead, PermDatasetsPublish, PermServiceAccountsManage}},
+		{name: "everything", perms: []string{"*"}},
+		{name: "resource wildcard", perms: []string{"users:*", "service_accounts:*"}},
+		{name: "unknown action", perms: []string{PermUsersRead, "users:delete"}, err: ErrUnknownPermission},
+		{name: "unknown resource wildcard", perms: []string{"billing:*"}, err: ErrUnknownPermission},
+		{name: "resource alone", perms: []string{"users"}, err: ErrUnknownPermission},
+		{name: "wildcard resource", perms: []string{"*:read"}, err: ErrUnknownPermission},
+		{name: "wildcard after an action", perms: []string{"users:read:*"}, err: ErrUnknownPermission},
+		{name: "empty", perms: []string{""}, err: ErrUnknownPermission},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidatePermissions(tt.perms); !errors.Is(err, tt.err) {
+				t.Errorf("ValidatePermissions(%q) = %v, want %v", tt.perms, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCoversPermissions(t *testing.T) {
+	tests := []struct {
+		name    string
+		granted []string
+		perms   []string
+		covered bool
+	}{
+		{name: "subset", granted: []string{PermUsersRead, PermUsersBan, PermAuditRead}, perms: []string{PermUsersRead, PermAuditRead}, covered: true},
+		{name: "one missing", granted: []string{PermUsersRead}, perms: []string{PermUsersRead, PermUsersBan}, covered: false},
+		{name: "through a wildcard", granted: []string{"users:*"}, perms: []string{PermUsersRead, PermUsersBan}, covered: true},
+		{name: "everything", granted: []string{"*"}, perms: []string{"*"}, covered: true},
+		// Every listed action still isn't a grant of "*"
+		{name: "admin from the catalog", granted: []string{PermUsersRead, PermRolesManage}, perms: []string{"*"}, covered: false},
+		{name: "nothing asked", covered: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CoversPermissions(tt.granted, tt.perms); got != tt.covered {
+				t.Errorf("CoversPermissions(%q, %q) = %v, want %v", tt.granted, tt.perms, got, tt.covered)
+			}
+		})
+	}
+}
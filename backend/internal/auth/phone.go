@@ -0,0 +1,281 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/sms"
+)
+
+var (
+	ErrInvalidPhone = errors.New("invalid phone number")
+	ErrPhoneInUse   = errors.New("phone number is already verified on another account")
+)
+
+const (
+	phoneOTPTTL         = 10 * time.Minute
+	phoneOTPMaxAttempts = 5
+	// Codes to one number are limited to phoneOTPMaxSends per phoneOTPSendWindow, at
+	// least phoneOTPResendDelay apart.
+	phoneOTPMaxSends    = 3
+	phoneOTPSendWindow  = 15 * time.Minute
+	phoneOTPResendDelay = time.Minute
+
+	phoneOTPPurposeVerify = "verify"
+	phoneOTPPurposeLogin  = "login"
+)
+
+// NormalizePhone converts a phone number to E.164. Numbers without a country code are
+// read as Indian: a 10-digit mobile, optionally after a 0 trunk prefix or 91. Indian
+// numbers must be mobiles (starting 6-9), since landlines can't receive codes.
+func NormalizePhone(raw string) (string, error) {
+	var digits strings.Builder
+	international := false
+	for i, r := range strings.TrimSpace(raw) {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '+' && i == 0:
+			international = true
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return "", ErrInvalidPhone
+		}
+	}
+
+	number := digits.String()
+	if !international && strings.HasPrefix(number, "00") {
+		international = true
+		number = number[2:]
+	}
+
+	if !international {
+		switch {
+		case len(number) == 10:
+		case len(number) == 11 && number[0] == '0':
+			number = number[1:]
+		case len(number) == 12 && strings.HasPrefix(number, "91"):
+			number = number[2:]
+		default:
+			return "", ErrInvalidPhone
+		}
+		number = "91" + number
+	}
+
+	if strings.HasPrefix(number, "91") {
+		national := number[2:]
+		if len(national) != 10 || national[0] < '6' {
+			return "", ErrInvalidPhone
+		}
+	} else if len(number) < 8 || len(number) > 15 || number[0] == '0' {
+		return "", ErrInvalidPhone
+	}
+
+	return "+" + number, nil
+}
+
+// SendPhoneVerification texts a code that proves userID owns phone.
+func (s *Service) SendPhoneVerification(ctx context.Context, userID uuid.UUID, phone string) error {
+	phone, err := NormalizePhone(phone)
+	if err != nil {
+		return err
+	}
+
+	var inUse bool
+	err = s.db.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM users
+		              WHERE phone = $1 AND phone_verified AND id <> $2 AND deleted_at IS NULL)`,
+		phone, userID).Scan(&inUse)
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	if inUse {
+		return ErrPhoneInUse
+	}
+
+	return s.sendPhoneOTP(ctx, userID, phone, phoneOTPPurposeVerify)
+}
+
+// VerifyPhone checks a verification code and marks its number as the user's verified phone.
+func (s *Service) VerifyPhone(ctx context.Context, userID uuid.UUID, code string) (string, error) {
+	phone, err := s.consumePhoneOTP(ctx, "user_id = $1", userID, phoneOTPPurposeVerify, code)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE users SET phone = $1, phone_verified = true, updated_at = $2
+		WHERE id = $3 AND deleted_at IS NULL`, phone, time.Now(), userID)
+	if isUniqueViolation(err) {
+		return "", ErrPhoneInUse
+	} else if err != nil {
+		return "", fmt.Errorf("phone update error: %w", err)
+	}
+
+	return phone, nil
+}
+
+// RequestPhoneLogin texts a sign-in code if the number is verified on an active account.
+// Callers should respond identically whatever happens here.
+func (s *Service) RequestPhoneLogin(ctx context.Context, phone string) error {
+	phone, err := NormalizePhone(phone)
+	if err != nil {
+		return err
+	}
+
+	var userID uuid.UUID
+	err = s.db.QueryRowContext(ctx, `
+		SELECT id FROM users
+		WHERE phone = $1 AND phone_verified AND status = $2 AND deleted_at IS NULL`,
+		phone, models.StatusActive).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	err = s.sendPhoneOTP(ctx, userID, phone, phoneOTPPurposeLogin)
+	var throttled *ThrottleError
+	if errors.As(err, &throttled) {
+		// Reporting the limit would reveal that the number is registered
+		return nil
+	}
+	return err
+}
+
+// LoginWithPhone signs in the owner of a verified phone number with a texted code.
+func (s *Service) LoginWithPhone(ctx context.Context, phone, code string, client ClientInfo) (*models.AuthResponse, error) {
+	phone, err := NormalizePhone(phone)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var user models.User
+	err = s.db.QueryRowContext(ctx, `
+		SELECT id, username, email, COALESCE(first_name, ''), COALESCE(last_name, ''),
+		       COALESCE(phone, ''), role, status,
+		       email_verified, phone_verified, last_login_at, created_at, updated_at
+		FROM users WHERE phone = $1 AND phone_verified AND deleted_at IS NULL`, phone).Scan(
+		&user.ID, &user.Username, &user.Email, &user.FirstName, &user.LastName,
+		&user.Phone, &user.Role, &user.Status, &user.EmailVerified, &user.PhoneVerified,
+		&user.LastLoginAt, &user.CreatedAt, &user.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidToken
+	} else if err != nil {
+		return nil, fmt.Errorf("user lookup error: %w", err)
+	}
+
+	// A locked account stays locked whichever way someone tries to sign in
+	if err := s.checkLoginThrottle(ctx, accountThrottleKey(user.Email)); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.consumePhoneOTP(ctx, "phone = $1", phone, phoneOTPPurposeLogin, code); err != nil {
+		return nil, err
+	}
+
+	if err := s.clearLoginThrottle(ctx, accountThrottleKey(user.Email)); err != nil {
+		return nil, fmt.Errorf("login throttle reset error: %w", err)
+	}
+
+	return s.completeLogin(ctx, &user, client)
+}
+
+// sendPhoneOTP enforces the send limits, replaces any outstanding code for the same
+// purpose and texts a new one.
+func (s *Service) sendPhoneOTP(ctx context.Context, userID uuid.UUID, phone, purpose string) error {
+	now := time.Now()
+
+	var sends int
+	var lastSent sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*), MAX(created_at) FROM phone_otps WHERE phone = $1 AND created_at > $2`,
+		phone, now.Add(-phoneOTPSendWindow)).Scan(&sends, &lastSent)
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	if lastSent.Valid && now.Sub(lastSent.Time) < phoneOTPResendDelay {
+		return &ThrottleError{RetryAfter: phoneOTPResendDelay - now.Sub(lastSent.Time)}
+	}
+	if sends >= phoneOTPMaxSends {
+		var oldest time.Time
+		err := s.db.QueryRowContext(ctx, `
+			SELECT MIN(created_at) FROM phone_otps WHERE phone = $1 AND created_at > $2`,
+			phone, now.Add(-phoneOTPSendWindow)).Scan(&oldest)
+		if err != nil {
+			return fmt.Errorf("database error: %w", err)
+		}
+		return &ThrottleError{RetryAfter: oldest.Add(phoneOTPSendWindow).Sub(now)}
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE phone_otps SET used = true WHERE user_id = $1 AND purpose = $2 AND used = false`,
+			userID, purpose); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO phone_otps (user_id, phone, purpose, code, expires_at, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6)`, userID, phone, purpose, code, now.Add(phoneOTPTTL), now)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("phone code storage error: %w", err)
+	}
+
+	return s.sms.Send(ctx, sms.Message{
+		To: phone,
+		Body: fmt.Sprintf("%s is your Ground Sense code. It expires in %d minutes. Do not share it with anyone.",
+			code, int(phoneOTPTTL.Minutes())),
+	})
+}
+
+// consumePhoneOTP checks code against the newest outstanding code matching the condition,
+// using up one attempt first, and returns the phone number it was sent to.
+func (s *Service) consumePhoneOTP(ctx context.Context, condition string, arg interface{}, purpose, code string) (string, error) {
+	var id uuid.UUID
+	var phone, expected string
+	var expiresAt time.Time
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE phone_otps SET attempts = attempts + 1, used = attempts + 1 >= $3
+		WHERE id = (
+			SELECT id FROM phone_otps
+			WHERE `+condition+` AND purpose = $2 AND used = false
+			ORDER BY created_at DESC LIMIT 1
+		) AND attempts < $3
+		RETURNING id, phone, code, expires_at`, arg, purpose, phoneOTPMaxAttempts).Scan(&id, &phone, &expected, &expiresAt)
+	if err == sql.ErrNoRows {
+		return "", ErrInvalidToken
+	} else if err != nil {
+		return "", fmt.Errorf("phone code lookup error: %w", err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(code), []byte(expected)) != 1 {
+		return "", ErrInvalidToken
+	}
+
+	if time.Now().After(expiresAt) {
+		return "", ErrTokenExpired
+	}
+
+	if _, err := s.db.ExecContext(ctx, "UPDATE phone_otps SET used = true WHERE id = $1", id); err != nil {
+		return "", err
+	}
+
+	return phone, nil
+}
@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/database"
+)
+
+// PolicyViolation is one reason a password was rejected.
+type PolicyViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError lists every way a new password breaks the password policy.
+type PasswordPolicyError struct {
+	Violations []PolicyViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "password does not meet the password policy"
+}
+
+// passwordOwner is whatever is known about the account a password is being set for.
+type passwordOwner struct {
+	userID   uuid.UUID
+	username string
+	email    string
+}
+
+// checkPasswordPolicy returns a PasswordPolicyError if password may not be used by owner.
+// The cheap checks run first; history and breach lookups only run on otherwise valid passwords.
+func (s *Service) checkPasswordPolicy(ctx context.Context, password string, owner passwordOwner) error {
+	policy := s.config.PasswordPolicy
+	var violations []PolicyViolation
+
+	length := utf8.RuneCountInString(password)
+	if length < policy.MinLength {
+		violations = append(violations, PolicyViolation{
+			Code:    "too_short",
+			Message: fmt.Sprintf("Password must be at least %d characters", policy.MinLength),
+		})
+	}
+	if policy.MaxLength > 0 && length > policy.MaxLength {
+		violations = append(violations, PolicyViolation{
+			Code:    "too_long",
+			Message: fmt.Sprintf("Password must be at most %d characters", policy.MaxLength),
+		})
+	}
+
+	lower := strings.ToLower(password)
+	if len(owner.username) >= 3 && strings.Contains(lower, strings.ToLower(owner.username)) {
+		violations = append(violations, PolicyViolation{
+			Code:    "contains_username",
+			Message: "Password must not contain your username",
+		})
+	}
+	if local, _, _ := strings.Cut(strings.ToLower(owner.email), "@"); len(local) >= 3 && strings.Contains(lower, local) {
+		violations = append(violations, PolicyViolation{
+			Code:    "contains_email",
+			Message: "Password must not contain your email address",
+		})
+	}
+	for _, word := range policy.BannedWords {
+		if word != "" && strings.Contains(lower, strings.ToLower(word)) {
+			violations = append(violations, PolicyViolation{
+				Code:    "banned_word",
+				Message: fmt.Sprintf("Password must not contain %q", word),
+			})
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+
+	if owner.userID != uuid.Nil && policy.HistorySize > 0 {
+		reused, err := s.passwordReused(ctx, owner.userID, password)
+		if err != nil {
+			return err
+		}
+		if reused {
+			violations = append(violations, PolicyViolation{
+				Code:    "reused",
+				Message: fmt.Sprintf("Password must differ from your last %d passwords", policy.HistorySize),
+			})
+		}
+	}
+
+	if s.breached != nil {
+		count, err := s.breached.Count(password)
+		if err != nil {
+			return fmt.Errorf("breached password lookup error: %w", err)
+		}
+		if count >= policy.BreachedMinCount {
+			violations = append(violations, PolicyViolation{
+				Code:    "breached",
+				Message: "Password has appeared in a data breach; choose a different one",
+			})
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// passwordReused reports whether password matches the current or any recent password.
+func (s *Service) passwordReused(ctx context.Context, userID uuid.UUID, password string) (bool, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		(SELECT password_hash FROM users WHERE id = $1)
+		UNION
+		(SELECT password_hash FROM password_history WHERE user_id = $1 ORDER BY created_at DESC LIMIT $2)`,
+		userID, s.config.PasswordPolicy.HistorySize)
+	if err != nil {
+		return false, fmt.Errorf("password history lookup error: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return false, err
+		}
+		if s.checkPassword(password, hash) {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// recordPasswordHistory remembers a newly set password hash and forgets those beyond the
+// history size.
+func (s *Service) recordPasswordHistory(ctx context.Context, db database.Execer, userID uuid.UUID, hash string) error {
+	size := s.config.PasswordPolicy.HistorySize
+	if size <= 0 {
+		return nil
+	}
+
+	if _, err := db.ExecContext(ctx, `
+		INSERT INTO password_history (user_id, password_hash) VALUES ($1, $2)`, userID, hash); err != nil {
+		return fmt.Errorf("password history error: %w", err)
+	}
+
+	_, err := db.ExecContext(ctx, `
+		DELETE FROM password_history WHERE user_id = $1 AND id NOT IN (
+			SELECT id FROM password_history WHERE user_id = $1 ORDER BY created_at DESC LIMIT $2
+		)`, userID, size)
+	if err != nil {
+		return fmt.Errorf("password history error: %w", err)
+	}
+	return nil
+}
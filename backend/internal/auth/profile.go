@@ -0,0 +1,329 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/database"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/mail"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+)
+
+const emailChangeTTL = 24 * time.Hour
+
+var (
+	ErrUsernameInvalid  = errors.New("usernames are 3-50 letters, digits, '.', '_' or '-' and start with a letter or digit")
+	ErrUsernameReserved = errors.New("this username is reserved")
+	ErrUsernameTaken    = errors.New("this username is taken")
+	ErrEmailInUse       = errors.New("this email address is already in use")
+	ErrEmailUnchanged   = errors.New("this is already your email address")
+	ErrEmailChangeToken = errors.New("invalid or expired email change link")
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{2,49}$`)
+
+// UsernameCooldownError is returned when the username was changed too recently.
+type UsernameCooldownError struct {
+	Until time.Time
+}
+
+func (e *UsernameCooldownError) Error() string {
+	return "username was changed recently; it can be changed again after " + e.Until.UTC().Format("2 January 2006")
+}
+
+// EmailChangeStatus reports which addresses have confirmed a pending email change.
+type EmailChangeStatus struct {
+	OldConfirmed bool `json:"old_confirmed"`
+	NewConfirmed bool `json:"new_confirmed"`
+	Completed    bool `json:"completed"`
+}
+
+// usernameReserved compares ignoring case and separators, so "Ad.Min" is as reserved as "admin".
+func (s *Service) usernameReserved(username string) bool {
+	normalise := strings.NewReplacer(".", "", "_", "", "-", "")
+	name := normalise.Replace(strings.ToLower(username))
+	for _, reserved := range s.config.Account.ReservedUsernames {
+		if name == normalise.Replace(strings.ToLower(reserved)) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkUsername rejects badly formed, reserved and taken usernames. Usernames differing
+// only in case count as taken so people can't be impersonated by look-alikes.
+func (s *Service) checkUsername(ctx context.Context, db database.Querier, username string, userID uuid.UUID) error {
+	if !usernamePattern.MatchString(username) {
+		return ErrUsernameInvalid
+	}
+	if s.usernameReserved(username) {
+		return ErrUsernameReserved
+	}
+
+	var taken bool
+	err := db.QueryRowContext(ctx,
+		"SELECT EXISTS(SELECT 1 FROM users WHERE LOWER(username) = LOWER($1) AND id <> $2)",
+		username, userID).Scan(&taken)
+	if err != nil {
+		return fmt.Errorf("username lookup error: %w", err)
+	}
+	if taken {
+		return ErrUsernameTaken
+	}
+	return nil
+}
+
+// ChangeUsername renames the user and returns a fresh access token for the current
+// session. Tokens elsewhere carry the old name, so they're invalidated and refreshed.
+func (s *Service) ChangeUsername(ctx context.Context, userID, sessionID uuid.UUID, username string, client ClientInfo) (*models.AuthResponse, error) {
+	var oldUsername string
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		var changedAt sql.NullTime
+		err := tx.QueryRowContext(ctx, `
+			SELECT username, username_changed_at FROM users WHERE id = $1 AND deleted_at IS NULL
+			FOR UPDATE`, userID).Scan(&oldUsername, &changedAt)
+		if err == sql.ErrNoRows {
+			return ErrUserNotFound
+		} else if err != nil {
+			return err
+		}
+
+		if changedAt.Valid {
+			if until := changedAt.Time.Add(s.config.Account.UsernameChangeCooldown); time.Now().Before(until) {
+				return &UsernameCooldownError{Until: until}
+			}
+		}
+		if err := s.checkUsername(ctx, tx, username, userID); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE users SET username = $1, username_changed_at = $2, updated_at = $2 WHERE id = $3`,
+			username, now, userID); err != nil {
+			if isUniqueViolation(err) {
+				return ErrUsernameTaken
+			}
+			return err
+		}
+
+		return database.RecordAudit(ctx, tx, database.AuditEntry{
+			UserID:       userID.String(),
+			Action:       "user.username_changed",
+			ResourceType: "user",
+			ResourceID:   userID.String(),
+			OldValues:    map[string]interface{}{"username": oldUsername},
+			NewValues:    map[string]interface{}{"username": username},
+			IPAddress:    client.IPAddress,
+			UserAgent:    client.UserAgent,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.reissueAccessToken(ctx, userID, sessionID)
+}
+
+// RequestEmailChange starts moving the account to newEmail. Nothing changes until the
+// links sent to both the current and the new address have been followed.
+func (s *Service) RequestEmailChange(ctx context.Context, userID uuid.UUID, newEmail string, proof Reauthentication, client ClientInfo) error {
+	if err := s.ConfirmIdentity(ctx, userID, proof); err != nil {
+		return err
+	}
+
+	newEmail = strings.TrimSpace(newEmail)
+	var oldEmail, username string
+	err := s.db.QueryRowContext(ctx, "SELECT email, username FROM users WHERE id = $1", userID).Scan(&oldEmail, &username)
+	if err != nil {
+		return fmt.Errorf("user lookup error: %w", err)
+	}
+	if strings.EqualFold(oldEmail, newEmail) {
+		return ErrEmailUnchanged
+	}
+	if err := s.checkEmailAvailable(ctx, s.db, newEmail, userID); err != nil {
+		return err
+	}
+
+	oldToken, err := randomHex(32)
+	if err != nil {
+		return err
+	}
+	newToken, err := randomHex(32)
+	if err != nil {
+		return err
+	}
+
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		// Only the latest request can complete
+		if _, err := tx.ExecContext(ctx,
+			"DELETE FROM email_change_requests WHERE user_id = $1 AND completed_at IS NULL", userID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO email_change_requests (user_id, old_email, new_email, old_token, new_token, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			userID, oldEmail, newEmail, oldToken, newToken, time.Now().Add(emailChangeTTL)); err != nil {
+			return err
+		}
+		return database.RecordAudit(ctx, tx, database.AuditEntry{
+			UserID:       userID.String(),
+			Action:       "user.email_change_requested",
+			ResourceType: "user",
+			ResourceID:   userID.String(),
+			OldValues:    map[string]interface{}{"email": oldEmail},
+			NewValues:    map[string]interface{}{"email": newEmail},
+			IPAddress:    client.IPAddress,
+			UserAgent:    client.UserAgent,
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("email change request error: %w", err)
+	}
+
+	link := s.config.Server.PublicURL + "/confirm-email-change?token="
+	if err := s.mailer.Send(ctx, mail.Message{
+		To:      oldEmail,
+		Subject: "Confirm your Ground Sense email change",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to change your Ground Sense email address to %s. "+
+			"To approve it, follow this link within 24 hours:\n%s%s\n\n"+
+			"If this wasn't you, ignore this email and change your password.",
+			username, newEmail, link, oldToken),
+	}); err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, mail.Message{
+		To:      newEmail,
+		Subject: "Confirm your new Ground Sense email address",
+		Body: fmt.Sprintf("Hi %s,\n\nTo use this address for your Ground Sense account, follow this link "+
+			"within 24 hours:\n%s%s\n\nThe change also needs approval from your current address.",
+			username, link, newToken),
+	})
+}
+
+// ConfirmEmailChange records a confirmation from one of the two addresses and switches
+// the email once both have confirmed.
+func (s *Service) ConfirmEmailChange(ctx context.Context, token string, client ClientInfo) (*EmailChangeStatus, error) {
+	var userID uuid.UUID
+	var oldEmail, newEmail string
+	status := &EmailChangeStatus{}
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		now := time.Now()
+		err := tx.QueryRowContext(ctx, `
+			UPDATE email_change_requests
+			SET old_confirmed_at = CASE WHEN old_token = $1 THEN COALESCE(old_confirmed_at, $2) ELSE old_confirmed_at END,
+			    new_confirmed_at = CASE WHEN new_token = $1 THEN COALESCE(new_confirmed_at, $2) ELSE new_confirmed_at END
+			WHERE (old_token = $1 OR new_token = $1) AND completed_at IS NULL AND expires_at > $2
+			RETURNING user_id, old_email, new_email, old_confirmed_at IS NOT NULL, new_confirmed_at IS NOT NULL`,
+			token, now).Scan(&userID, &oldEmail, &newEmail, &status.OldConfirmed, &status.NewConfirmed)
+		if err == sql.ErrNoRows {
+			return ErrEmailChangeToken
+		} else if err != nil {
+			return err
+		}
+		if !status.OldConfirmed || !status.NewConfirmed {
+			return nil
+		}
+
+		// The address may have been taken while waiting for confirmations
+		if err := s.checkEmailAvailable(ctx, tx, newEmail, userID); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, `
+			UPDATE users SET email = $1, email_verified = true, updated_at = $2
+			WHERE id = $3 AND email = $4 AND deleted_at IS NULL`, newEmail, now, userID, oldEmail)
+		if isUniqueViolation(err) {
+			return ErrEmailInUse
+		} else if err != nil {
+			return err
+		}
+		// The account was deleted or its email changed some other way since the request
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrEmailChangeToken
+		}
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE email_change_requests SET completed_at = $1 WHERE user_id = $2 AND completed_at IS NULL",
+			now, userID); err != nil {
+			return err
+		}
+		// Sign-in links sent to the old address must stop working
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE login_tokens SET used = true WHERE email = $1 AND NOT used", oldEmail); err != nil {
+			return err
+		}
+
+		status.Completed = true
+		return database.RecordAudit(ctx, tx, database.AuditEntry{
+			UserID:       userID.String(),
+			Action:       "user.email_changed",
+			ResourceType: "user",
+			ResourceID:   userID.String(),
+			OldValues:    map[string]interface{}{"email": oldEmail},
+			NewValues:    map[string]interface{}{"email": newEmail},
+			IPAddress:    client.IPAddress,
+			UserAgent:    client.UserAgent,
+		})
+	})
+	if err == ErrEmailChangeToken || err == ErrEmailInUse {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("email change error: %w", err)
+	}
+	if !status.Completed {
+		return status, nil
+	}
+
+	// Access tokens carry the email; clients pick up the new one on refresh
+	if err := s.InvalidateUserTokens(ctx, userID); err != nil {
+		return nil, fmt.Errorf("token invalidation error: %w", err)
+	}
+	if err := s.mailer.Send(ctx, mail.Message{
+		To:      oldEmail,
+		Subject: "Your Ground Sense email address was changed",
+		Body: fmt.Sprintf("Your Ground Sense account now uses %s. You'll no longer receive account email here.\n\n"+
+			"If you didn't make this change, contact support immediately.", newEmail),
+	}); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+func (s *Service) checkEmailAvailable(ctx context.Context, db database.Querier, email string, userID uuid.UUID) error {
+	var taken bool
+	err := db.QueryRowContext(ctx,
+		"SELECT EXISTS(SELECT 1 FROM users WHERE LOWER(email) = LOWER($1) AND id <> $2)",
+		email, userID).Scan(&taken)
+	if err != nil {
+		return fmt.Errorf("email lookup error: %w", err)
+	}
+	if taken {
+		return ErrEmailInUse
+	}
+	return nil
+}
+
+// reissueAccessToken signs a new access token for an existing session after the
+// user's claims changed.
+func (s *Service) reissueAccessToken(ctx context.Context, userID, sessionID uuid.UUID) (*models.AuthResponse, error) {
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.InvalidateUserTokens(ctx, userID); err != nil {
+		return nil, fmt.Errorf("token invalidation error: %w", err)
+	}
+	token, err := s.generateAccessToken(ctx, user, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("token generation error: %w", err)
+	}
+	return &models.AuthResponse{User: models.UserProfile{User: *user}, Token: token}, nil
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/mail"
+)
+
+var (
+	// ErrNoPassword is returned by ConfirmPassword for accounts that only sign in through
+	// an identity provider or passwordless email
+	ErrNoPassword = errors.New("account has no password")
+	// ErrReauthRequired asks an account without a password to prove it is still its owner
+	ErrReauthRequired = errors.New("confirm with an emailed code or sign in again first")
+)
+
+// reauthLoginWindow is how recently the current session must have started with an
+// identity provider sign-in to stand in for a password.
+const reauthLoginWindow = 5 * time.Minute
+
+// Reauthentication is what a signed-in user offers before an irreversible action.
+type Reauthentication struct {
+	SessionID uuid.UUID
+	Password  string
+	// Code is an emailed code from RequestReauthCode, for accounts without a password
+	Code string
+}
+
+// ConfirmIdentity re-checks a signed-in user before an irreversible action. Accounts with
+// a password must give it; accounts without one give a code from RequestReauthCode, or
+// act from a session that began with an identity provider sign-in in the last
+// reauthLoginWindow.
+func (s *Service) ConfirmIdentity(ctx context.Context, userID uuid.UUID, proof Reauthentication) error {
+	err := s.ConfirmPassword(ctx, userID, proof.Password)
+	if err != ErrNoPassword {
+		return err
+	}
+
+	if proof.Code != "" {
+		return s.consumeReauthCode(ctx, userID, proof.Code)
+	}
+
+	var fresh bool
+	err = s.db.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM user_sessions us JOIN user_identities ui ON ui.user_id = us.user_id
+			WHERE us.id = $1 AND us.user_id = $2 AND us.revoked_at IS NULL
+			  AND us.created_at > $3 AND ui.last_login_at > $3)`,
+		proof.SessionID, userID, time.Now().Add(-reauthLoginWindow)).Scan(&fresh)
+	if err != nil {
+		return fmt.Errorf("session lookup error: %w", err)
+	}
+	if !fresh {
+		return ErrReauthRequired
+	}
+	return nil
+}
+
+// RequestReauthCode emails a code that confirms an irreversible action on an account
+// without a password. Only the newest code is valid.
+func (s *Service) RequestReauthCode(ctx context.Context, userID uuid.UUID) error {
+	var email, username string
+	err := s.db.QueryRowContext(ctx, "SELECT email, username FROM users WHERE id = $1 AND deleted_at IS NULL",
+		userID).Scan(&email, &username)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	} else if err != nil {
+		return fmt.Errorf("user lookup error: %w", err)
+	}
+
+	now := time.Now()
+	var sends int
+	var oldest sql.NullTime
+	err = s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*), MIN(created_at) FROM reauth_codes WHERE user_id = $1 AND created_at > $2`,
+		userID, now.Add(-passwordlessRequestWindow)).Scan(&sends, &oldest)
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	if sends >= passwordlessMaxRequests {
+		return &ThrottleError{RetryAfter: oldest.Time.Add(passwordlessRequestWindow).Sub(now)}
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE reauth_codes SET used = true WHERE user_id = $1 AND used = false", userID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO reauth_codes (user_id, code, expires_at, created_at) VALUES ($1, $2, $3, $4)`,
+			userID, code, now.Add(loginCodeTTL), now)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("reauth code storage error: %w", err)
+	}
+
+	return s.mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Your Ground Sense confirmation code",
+		Body: fmt.Sprintf("Hi %s,\n\nEnter this code to confirm a change to your account: %s\n\n"+
+			"It expires in %d minutes. If you didn't ask for this, sign out of your other sessions.",
+			username, code, int(loginCodeTTL.Minutes())),
+	})
+}
+
+// consumeReauthCode checks code against the user's newest outstanding code. Every guess
+// uses up an attempt before it is compared.
+func (s *Service) consumeReauthCode(ctx context.Context, userID uuid.UUID, code string) error {
+	var id uuid.UUID
+	var expected string
+	var expiresAt time.Time
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE reauth_codes SET attempts = attempts + 1, used = attempts + 1 >= $2
+		WHERE id = (
+			SELECT id FROM reauth_codes WHERE user_id = $1 AND used = false
+			ORDER BY created_at DESC LIMIT 1
+		) AND attempts < $2
+		RETURNING id, code, expires_at`, userID, loginCodeMaxAttempts).Scan(&id, &expected, &expiresAt)
+	if err == sql.ErrNoRows {
+		return ErrInvalidToken
+	} else if err != nil {
+		return fmt.Errorf("reauth code lookup error: %w", err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(code), []byte(expected)) != 1 {
+		return ErrInvalidToken
+	}
+	if time.Now().After(expiresAt) {
+		return ErrTokenExpired
+	}
+	_, err = s.db.ExecContext(ctx, "UPDATE reauth_codes SET used = true WHERE id = $1", id)
+	return err
+}
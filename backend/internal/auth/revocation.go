@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RevocationStore remembers access tokens that must be rejected before they expire.
+// Entries are keyed by token ID (the jti claim) or by session (see sessionRevocationKey),
+// and a per-user watermark rejects every token issued before it.
+type RevocationStore interface {
+	Revoke(ctx context.Context, id string, until time.Time) error
+	IsRevoked(ctx context.Context, id string) (bool, error)
+	SetNotBefore(ctx context.Context, userID uuid.UUID, at time.Time) error
+	NotBefore(ctx context.Context, userID uuid.UUID) (time.Time, error)
+}
+
+func sessionRevocationKey(sessionID uuid.UUID) string {
+	return "sid:" + sessionID.String()
+}
+
+const revocationPurgeInterval = 10 * time.Minute
+
+// MemoryRevocationStore keeps revocations in process memory. It is only suitable
+// for a single server instance; revocations are lost on restart.
+type MemoryRevocationStore struct {
+	mu          sync.Mutex
+	revoked     map[string]time.Time
+	notBefore   map[uuid.UUID]time.Time
+	maxTokenAge time.Duration
+	lastPurge   time.Time
+}
+
+// NewMemoryRevocationStore creates an in-memory store. Watermarks are forgotten once
+// maxTokenAge has passed, since every token they could reject has expired by then.
+func NewMemoryRevocationStore(maxTokenAge time.Duration) *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		revoked:     make(map[string]time.Time),
+		notBefore:   make(map[uuid.UUID]time.Time),
+		maxTokenAge: maxTokenAge,
+		lastPurge:   time.Now(),
+	}
+}
+
+func (m *MemoryRevocationStore) Revoke(ctx context.Context, id string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if current, ok := m.revoked[id]; !ok || until.After(current) {
+		m.revoked[id] = until
+	}
+	m.purgeLocked(time.Now())
+	return nil
+}
+
+func (m *MemoryRevocationStore) IsRevoked(ctx context.Context, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	until, ok := m.revoked[id]
+	return ok && time.Now().Before(until), nil
+}
+
+func (m *MemoryRevocationStore) SetNotBefore(ctx context.Context, userID uuid.UUID, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if current, ok := m.notBefore[userID]; !ok || at.After(current) {
+		m.notBefore[userID] = at
+	}
+	m.purgeLocked(time.Now())
+	return nil
+}
+
+func (m *MemoryRevocationStore) NotBefore(ctx context.Context, userID uuid.UUID) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.notBefore[userID], nil
+}
+
+func (m *MemoryRevocationStore) purgeLocked(now time.Time) {
+	if now.Sub(m.lastPurge) < revocationPurgeInterval {
+		return
+	}
+	m.lastPurge = now
+
+	for id, until := range m.revoked {
+		if now.After(until) {
+			delete(m.revoked, id)
+		}
+	}
+	for userID, at := range m.notBefore {
+		if now.Sub(at) > m.maxTokenAge {
+			delete(m.notBefore, userID)
+		}
+	}
+}
+
+// PostgresRevocationStore persists revocations in revoked_tokens and the watermark in
+// users.tokens_valid_after, so they survive restarts and are shared between instances.
+type PostgresRevocationStore struct {
+	db *sql.DB
+
+	mu        sync.Mutex
+	lastPurge time.Time
+}
+
+func NewPostgresRevocationStore(db *sql.DB) *PostgresRevocationStore {
+	return &PostgresRevocationStore{db: db, lastPurge: time.Now()}
+}
+
+func (p *PostgresRevocationStore) Revoke(ctx context.Context, id string, until time.Time) error {
+	_, err := p.db.ExecContext(ctx, `
+		INSERT INTO revoked_tokens (id, expires_at, revoked_at) VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO UPDATE SET expires_at = GREATEST(revoked_tokens.expires_at, EXCLUDED.expires_at)`,
+		id, until, time.Now())
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	purge := time.Since(p.lastPurge) >= revocationPurgeInterval
+	if purge {
+		p.lastPurge = time.Now()
+	}
+	p.mu.Unlock()
+
+	if purge {
+		_, err = p.db.ExecContext(ctx, "DELETE FROM revoked_tokens WHERE expires_at < $1", time.Now())
+	}
+	return err
+}
+
+func (p *PostgresRevocationStore) IsRevoked(ctx context.Context, id string) (bool, error) {
+	var revoked bool
+	err := p.db.QueryRowContext(ctx,
+		"SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE id = $1 AND expires_at > $2)",
+		id, time.Now()).Scan(&revoked)
+	return revoked, err
+}
+
+func (p *PostgresRevocationStore) SetNotBefore(ctx context.Context, userID uuid.UUID, at time.Time) error {
+	_, err := p.db.ExecContext(ctx, `
+		UPDATE users SET tokens_valid_after = GREATEST(COALESCE(tokens_valid_after, $1), $1)
+		WHERE id = $2`, at, userID)
+	return err
+}
+
+func (p *PostgresRevocationStore) NotBefore(ctx context.Context, userID uuid.UUID) (time.Time, error) {
+	var at sql.NullTime
+	err := p.db.QueryRowContext(ctx, "SELECT tokens_valid_after FROM users WHERE id = $1", userID).Scan(&at)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return at.Time, err
+}
+
+// RevokeAccessToken denylists a single access token until it would have expired anyway.
+func (s *Service) RevokeAccessToken(ctx context.Context, claims *JWTClaims) error {
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+	return s.revocations.Revoke(ctx, claims.ID, claims.ExpiresAt.Time)
+}
+
+// InvalidateUserTokens rejects every access token the user holds that was issued before now.
+// Tokens carry second-precision iat, so the watermark is the start of the next second,
+// rejecting every token issued in this one too; tokens issued after it are dated from
+// the watermark.
+func (s *Service) InvalidateUserTokens(ctx context.Context, userID uuid.UUID) error {
+	return s.revocations.SetNotBefore(ctx, userID, time.Now().Truncate(time.Second).Add(time.Second))
+}
+
+func (s *Service) revokeSessionTokens(ctx context.Context, sessionIDs ...uuid.UUID) error {
+	until := time.Now().Add(s.config.JWT.ExpiryHour)
+	for _, sessionID := range sessionIDs {
+		if err := s.revocations.Revoke(ctx, sessionRevocationKey(sessionID), until); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Service) checkRevocation(ctx context.Context, claims *JWTClaims) error {
+	if revoked, err := s.revocations.IsRevoked(ctx, claims.ID); err != nil {
+		return err
+	} else if revoked {
+		return ErrTokenRevoked
+	}
+
+	if claims.SessionID != uuid.Nil {
+		if revoked, err := s.revocations.IsRevoked(ctx, sessionRevocationKey(claims.SessionID)); err != nil {
+			return err
+		} else if revoked {
+			return ErrTokenRevoked
+		}
+	}
+
+	// An impersonation token also dies when the administrator's own tokens are invalidated
+	userIDs := []uuid.UUID{claims.UserID}
+	if claims.Actor != nil {
+		userIDs = append(userIDs, claims.Actor.UserID)
+	}
+	for _, userID := range userIDs {
+		notBefore, err := s.revocations.NotBefore(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if !notBefore.IsZero() && (claims.IssuedAt == nil || claims.IssuedAt.Time.Before(notBefore)) {
+			return ErrTokenRevoked
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,467 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/database"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+)
+
+// Service accounts are users that bots and integrations act as. They have no usable
+// password and never get an interactive session; instead they present an API key on
+// every request or trade a client secret for a short-lived access token.
+
+const (
+	apiKeyPrefix       = "gsk_"
+	clientSecretPrefix = "gss_"
+	serviceTokenTTL    = time.Hour
+	// apiKeyTouchInterval throttles last_used_at writes for busy keys
+	apiKeyTouchInterval = time.Minute
+)
+
+var (
+	ErrInvalidAPIKey  = errors.New("invalid or expired API key")
+	ErrInvalidClient  = errors.New("invalid client credentials")
+	ErrInvalidScope   = errors.New("requested scope exceeds the account's permissions")
+	ErrAPIKeyNotFound = errors.New("API key not found")
+)
+
+// CreateServiceAccount adds a service account with the given role, "service" by default.
+// The role may not grant anything the creator lacks.
+func (s *Service) CreateServiceAccount(ctx context.Context, admin *JWTClaims, req models.CreateServiceAccountRequest, client ClientInfo) (*models.User, error) {
+	role := models.RoleService
+	if req.Role != "" {
+		role = models.UserRole(req.Role)
+	}
+	roles, err := s.RolePermissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := roles[string(role)]; !ok {
+		return nil, ErrUnknownRole
+	}
+	// An API key with "*" scope would otherwise carry more than its creator holds
+	if within, err := s.RoleWithin(ctx, admin, string(role)); err != nil {
+		return nil, err
+	} else if !within {
+		return nil, ErrPermissionEscalation
+	}
+
+	now := time.Now()
+	user := &models.User{
+		ID:        uuid.New(),
+		Username:  req.Username,
+		Email:     strings.ToLower(req.Username) + "@service.invalid",
+		FirstName: req.DisplayName,
+		Role:      role,
+		Status:    models.StatusActive,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	user.SetAccountType(models.AccountTypeService)
+
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		if err := s.checkUsername(ctx, tx, user.Username, uuid.Nil); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO users (id, username, email, password_hash, first_name, role, status, account_type,
+			                   created_at, updated_at)
+			VALUES ($1, $2, $3, '!', $4, $5, $6, $7, $8, $8)`,
+			user.ID, user.Username, user.Email, user.FirstName, user.Role, user.Status, user.AccountType,
+			now); err != nil {
+			if isUniqueViolation(err) {
+				return ErrUsernameTaken
+			}
+			return err
+		}
+
+		return database.RecordAudit(ctx, tx, database.AuditEntry{
+			UserID:       admin.UserID.String(),
+			Action:       "service_account.created",
+			ResourceType: "user",
+			ResourceID:   user.ID.String(),
+			NewValues:    map[string]interface{}{"username": user.Username, "role": user.Role},
+			IPAddress:    client.IPAddress,
+			UserAgent:    client.UserAgent,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ListServiceAccounts returns every service account, disabled ones included.
+func (s *Service) ListServiceAccounts(ctx context.Context) ([]models.User, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, username, email, COALESCE(first_name, ''), role, status, last_login_at, created_at, updated_at
+		FROM users WHERE account_type = 'service' AND deleted_at IS NULL
+		ORDER BY username`)
+	if err != nil {
+		return nil, fmt.Errorf("service account lookup error: %w", err)
+	}
+	defer rows.Close()
+
+	accounts := []models.User{}
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.FirstName, &user.Role, &user.Status,
+			&user.LastLoginAt, &user.CreatedAt, &user.UpdatedAt); err != nil {
+			return nil, err
+		}
+		user.SetAccountType(models.AccountTypeService)
+		accounts = append(accounts, user)
+	}
+	return accounts, rows.Err()
+}
+
+// DisableServiceAccount deactivates the account, revokes its keys and secrets and
+// rejects any access tokens already issued to it.
+func (s *Service) DisableServiceAccount(ctx context.Context, admin *JWTClaims, accountID uuid.UUID, client ClientInfo) error {
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `
+			UPDATE users SET status = $1, updated_at = $2
+			WHERE id = $3 AND account_type = 'service' AND deleted_at IS NULL`,
+			models.StatusInactive, time.Now(), accountID)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrUserNotFound
+		}
+
+		for _, query := range []string{
+			"UPDATE api_keys SET revoked = true WHERE user_id = $1",
+			"UPDATE service_account_secrets SET revoked = true WHERE user_id = $1",
+		} {
+			if _, err := tx.ExecContext(ctx, query, accountID); err != nil {
+				return err
+			}
+		}
+
+		return database.RecordAudit(ctx, tx, database.AuditEntry{
+			UserID:       admin.UserID.String(),
+			Action:       "service_account.disabled",
+			ResourceType: "user",
+			ResourceID:   accountID.String(),
+			IPAddress:    client.IPAddress,
+			UserAgent:    client.UserAgent,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.InvalidateUserTokens(ctx, accountID)
+}
+
+// CreateAPIKey issues a key for the service account. The key is returned only here; the
+// database keeps its SHA-256 hash and a short prefix to tell keys apart.
+func (s *Service) CreateAPIKey(ctx context.Context, admin *JWTClaims, accountID uuid.UUID, req models.CreateAPIKeyRequest, client ClientInfo) (*models.CreatedAPIKey, error) {
+	if err := ValidatePermissions(req.Permissions); err != nil {
+		return nil, err
+	}
+	if _, err := s.serviceAccount(ctx, accountID); err != nil {
+		return nil, err
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+	key := apiKeyPrefix + secret
+	permissions, err := json.Marshal(req.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	created := &models.CreatedAPIKey{
+		APIKey: models.APIKey{
+			ID:          uuid.New(),
+			UserID:      accountID,
+			Name:        req.Name,
+			Prefix:      key[:len(apiKeyPrefix)+8],
+			Permissions: req.Permissions,
+			CreatedAt:   time.Now(),
+		},
+		Key: key,
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := created.CreatedAt.AddDate(0, 0, req.ExpiresInDays)
+		created.ExpiresAt = &expiresAt
+	}
+
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO api_keys (id, user_id, name, key_hash, key_prefix, permissions, expires_at, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			created.ID, accountID, created.Name, hashSecret(key), created.Prefix, permissions,
+			created.ExpiresAt, created.CreatedAt); err != nil {
+			return err
+		}
+
+		return database.RecordAudit(ctx, tx, database.AuditEntry{
+			UserID:       admin.UserID.String(),
+			Action:       "service_account.api_key_created",
+			ResourceType: "api_key",
+			ResourceID:   created.ID.String(),
+			NewValues: map[string]interface{}{
+				"service_account_id": accountID,
+				"name":               created.Name,
+				"prefix":             created.Prefix,
+				"permissions":        created.Permissions,
+				"expires_at":         created.ExpiresAt,
+			},
+			IPAddress: client.IPAddress,
+			UserAgent: client.UserAgent,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("API key creation error: %w", err)
+	}
+	return created, nil
+}
+
+// ListAPIKeys returns the service account's keys, newest first.
+func (s *Service) ListAPIKeys(ctx context.Context, accountID uuid.UUID) ([]models.APIKey, error) {
+	if _, err := s.serviceAccount(ctx, accountID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, user_id, name, COALESCE(key_prefix, ''), permissions, last_used_at, expires_at, created_at, revoked
+		FROM api_keys WHERE user_id = $1 ORDER BY created_at DESC`, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("API key lookup error: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var key models.APIKey
+		var permissions []byte
+		if err := rows.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &permissions, &key.LastUsedAt,
+			&key.ExpiresAt, &key.CreatedAt, &key.Revoked); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(permissions, &key.Permissions); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey stops a key from authenticating. Requests already in flight finish.
+func (s *Service) RevokeAPIKey(ctx context.Context, admin *JWTClaims, accountID, keyID uuid.UUID, client ClientInfo) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx,
+			"UPDATE api_keys SET revoked = true WHERE id = $1 AND user_id = $2 AND NOT revoked",
+			keyID, accountID)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrAPIKeyNotFound
+		}
+
+		return database.RecordAudit(ctx, tx, database.AuditEntry{
+			UserID:       admin.UserID.String(),
+			Action:       "service_account.api_key_revoked",
+			ResourceType: "api_key",
+			ResourceID:   keyID.String(),
+			OldValues:    map[string]interface{}{"service_account_id": accountID},
+			IPAddress:    client.IPAddress,
+			UserAgent:    client.UserAgent,
+		})
+	})
+}
+
+// RotateClientSecret replaces the account's client secret. The old secret stops working
+// immediately, but tokens already issued with it last until they expire.
+func (s *Service) RotateClientSecret(ctx context.Context, admin *JWTClaims, accountID uuid.UUID, client ClientInfo) (*models.ClientSecretResponse, error) {
+	if _, err := s.serviceAccount(ctx, accountID); err != nil {
+		return nil, err
+	}
+
+	random, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+	secret := clientSecretPrefix + random
+
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE service_account_secrets SET revoked = true WHERE user_id = $1", accountID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO service_account_secrets (user_id, secret_hash) VALUES ($1, $2)",
+			accountID, hashSecret(secret)); err != nil {
+			return err
+		}
+
+		return database.RecordAudit(ctx, tx, database.AuditEntry{
+			UserID:       admin.UserID.String(),
+			Action:       "service_account.client_secret_rotated",
+			ResourceType: "user",
+			ResourceID:   accountID.String(),
+			IPAddress:    client.IPAddress,
+			UserAgent:    client.UserAgent,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("client secret rotation error: %w", err)
+	}
+	return &models.ClientSecretResponse{ClientID: accountID, ClientSecret: secret}, nil
+}
+
+// AuthenticateAPIKey resolves an API key to claims for its service account. The claims
+// carry the key's permissions so Authorize limits the request to them.
+func (s *Service) AuthenticateAPIKey(ctx context.Context, key string) (*JWTClaims, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var claims JWTClaims
+	var status models.UserStatus
+	var permissions []byte
+	var lastUsedAt sql.NullTime
+	now := time.Now()
+	err := s.db.QueryRowContext(ctx, `
+		SELECT k.id, k.permissions, k.last_used_at, u.id, u.username, u.email, u.role, u.status
+		FROM api_keys k JOIN users u ON u.id = k.user_id
+		WHERE k.key_hash = $1 AND NOT k.revoked AND (k.expires_at IS NULL OR k.expires_at > $2)
+		  AND u.account_type = 'service' AND u.deleted_at IS NULL`, hashSecret(key), now).Scan(
+		&claims.APIKeyID, &permissions, &lastUsedAt, &claims.UserID, &claims.Username, &claims.Email,
+		&claims.Role, &status)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidAPIKey
+	} else if err != nil {
+		return nil, fmt.Errorf("API key lookup error: %w", err)
+	}
+	if status != models.StatusActive {
+		return nil, ErrAccountInactive
+	}
+
+	claims.Permissions = []string{}
+	if err := json.Unmarshal(permissions, &claims.Permissions); err != nil {
+		return nil, fmt.Errorf("API key permissions error: %w", err)
+	}
+
+	if !lastUsedAt.Valid || now.Sub(lastUsedAt.Time) > apiKeyTouchInterval {
+		if _, err := s.db.ExecContext(ctx, "UPDATE api_keys SET last_used_at = $1 WHERE id = $2",
+			now, claims.APIKeyID); err != nil {
+			return nil, fmt.Errorf("API key update error: %w", err)
+		}
+	}
+
+	claims.Subject = claims.UserID.String()
+	claims.ID = "key:" + claims.APIKeyID.String()
+	return &claims, nil
+}
+
+// ClientCredentialsToken implements the OAuth 2.0 client_credentials grant. The client ID
+// is the service account's ID. A requested scope narrows the token to those permissions,
+// all of which the account's role must already grant.
+func (s *Service) ClientCredentialsToken(ctx context.Context, clientID, clientSecret, scope string) (*models.ClientCredentialsResponse, error) {
+	accountID, err := uuid.Parse(clientID)
+	if err != nil || !strings.HasPrefix(clientSecret, clientSecretPrefix) {
+		return nil, ErrInvalidClient
+	}
+
+	var user models.User
+	err = s.db.QueryRowContext(ctx, `
+		SELECT u.id, u.username, u.email, u.role, u.status
+		FROM service_account_secrets cs JOIN users u ON u.id = cs.user_id
+		WHERE cs.user_id = $1 AND cs.secret_hash = $2 AND NOT cs.revoked
+		  AND (cs.expires_at IS NULL OR cs.expires_at > $3)
+		  AND u.account_type = 'service' AND u.deleted_at IS NULL`,
+		accountID, hashSecret(clientSecret), time.Now()).Scan(
+		&user.ID, &user.Username, &user.Email, &user.Role, &user.Status)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidClient
+	} else if err != nil {
+		return nil, fmt.Errorf("client lookup error: %w", err)
+	}
+	if user.Status != models.StatusActive {
+		return nil, ErrAccountInactive
+	}
+
+	var permissions []string
+	if scopes := strings.Fields(scope); len(scopes) > 0 {
+		if err := ValidatePermissions(scopes); err != nil {
+			return nil, ErrInvalidScope
+		}
+		roles, err := s.RolePermissions(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, permission := range scopes {
+			if !HasPermission(roles[string(user.Role)], permission) {
+				return nil, ErrInvalidScope
+			}
+		}
+		permissions = scopes
+	}
+
+	now := time.Now()
+	claims := JWTClaims{
+		UserID:      user.ID,
+		Username:    user.Username,
+		Email:       user.Email,
+		Role:        string(user.Role),
+		Permissions: permissions,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(serviceTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    "ground-sense-bot",
+			Subject:   user.ID.String(),
+			ID:        uuid.New().String(),
+		},
+	}
+	token, err := s.keys.Sign(claims)
+	if err != nil {
+		return nil, fmt.Errorf("token generation error: %w", err)
+	}
+
+	return &models.ClientCredentialsResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(serviceTokenTTL.Seconds()),
+		Scope:       strings.Join(permissions, " "),
+	}, nil
+}
+
+func (s *Service) serviceAccount(ctx context.Context, accountID uuid.UUID) (*models.User, error) {
+	user, err := s.getUser(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if user.AccountType != models.AccountTypeService {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+// hashSecret hashes high-entropy generated secrets; unlike passwords they need no slow KDF.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,252 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+	"github.com/lib/pq"
+)
+
+const refreshTokenTTL = 7 * 24 * time.Hour // 7 days
+
+// ClientInfo describes the device a request came from.
+type ClientInfo struct {
+	IPAddress string
+	UserAgent string
+}
+
+// completeLogin finishes any successful sign-in: it rejects inactive accounts, stamps
+// last_login_at, reports unfamiliar devices and networks, and starts a session.
+func (s *Service) completeLogin(ctx context.Context, user *models.User, client ClientInfo) (*models.AuthResponse, error) {
+	if user.Status != models.StatusActive {
+		return nil, ErrAccountInactive
+	}
+
+	// Service accounts never get an interactive session, whichever way they got here
+	now := time.Now()
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE users SET last_login_at = $1, updated_at = $2 WHERE id = $3 AND account_type = 'human'`,
+		now, now, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("last login update error: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return nil, fmt.Errorf("last login update error: %w", err)
+	} else if n == 0 {
+		return nil, ErrInvalidCredentials
+	}
+
+	user.LastLoginAt = &now
+	user.UpdatedAt = now
+
+	// Compare with earlier sessions before this one joins them
+	assessment, err := s.assessLogin(ctx, user.ID, client)
+	if err != nil {
+		return nil, err
+	}
+	if assessment.Score >= s.config.LoginAnomaly.NotifyScore {
+		if err := s.reportLoginAnomaly(ctx, user, client, assessment); err != nil {
+			return nil, err
+		}
+	}
+
+	accessToken, refreshToken, err := s.startSession(ctx, user, client)
+	if err != nil {
+		return nil, err
+	}
+
+	userProfile := models.UserProfile{
+		User:           *user,
+		PostsCount:     0, // TODO: Get actual counts
+		FollowersCount: 0,
+		FollowingCount: 0,
+	}
+
+	return &models.AuthResponse{
+		User:         userProfile,
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// startSession records a new user_sessions row and issues the first token pair of its refresh-token family.
+func (s *Service) startSession(ctx context.Context, user *models.User, client ClientInfo) (accessToken, refreshToken string, err error) {
+	sessionID := uuid.New()
+
+	accessToken, refreshToken, err = s.generateTokens(ctx, user, sessionID)
+	if err != nil {
+		return "", "", fmt.Errorf("token generation error: %w", err)
+	}
+
+	sessionTokenBytes := make([]byte, 32)
+	if _, err := rand.Read(sessionTokenBytes); err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO user_sessions (id, user_id, session_token, ip_address, user_agent, device_fingerprint,
+		                           expires_at, created_at, last_activity_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		sessionID, user.ID, hex.EncodeToString(sessionTokenBytes), inetOrNull(client.IPAddress),
+		client.UserAgent, deviceFingerprint(client), now.Add(refreshTokenTTL), now, now)
+	if err != nil {
+		return "", "", fmt.Errorf("session creation error: %w", err)
+	}
+
+	if err := s.storeRefreshToken(ctx, user.ID, sessionID, refreshToken); err != nil {
+		return "", "", fmt.Errorf("refresh token storage error: %w", err)
+	}
+
+	return accessToken, refreshToken, nil
+}
+
+// touchSession marks activity on a session and extends it to the lifetime of the newest refresh token.
+func (s *Service) touchSession(ctx context.Context, sessionID uuid.UUID) error {
+	now := time.Now()
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE user_sessions SET last_activity_at = $1, expires_at = $2
+		WHERE id = $3 AND revoked_at IS NULL`,
+		now, now.Add(refreshTokenTTL), sessionID)
+	return err
+}
+
+func (s *Service) sessionActive(ctx context.Context, sessionID uuid.UUID) (bool, error) {
+	var active bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT revoked_at IS NULL AND expires_at > NOW()
+		FROM user_sessions WHERE id = $1`, sessionID).Scan(&active)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return active, err
+}
+
+// ListSessions returns the user's active sessions, most recently used first.
+func (s *Service) ListSessions(ctx context.Context, userID, currentSessionID uuid.UUID) ([]models.Session, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, COALESCE(HOST(ip_address), ''), COALESCE(user_agent, ''), expires_at,
+		       created_at, last_activity_at
+		FROM user_sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_activity_at DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("session lookup error: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		if err := rows.Scan(&session.ID, &session.IPAddress, &session.UserAgent, &session.ExpiresAt,
+			&session.CreatedAt, &session.LastActivityAt); err != nil {
+			return nil, fmt.Errorf("session scan error: %w", err)
+		}
+		session.Device = describeDevice(session.UserAgent)
+		session.Location = describeLocation(session.IPAddress)
+		session.Current = session.ID == currentSessionID
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// RevokeSession ends one of the user's sessions and its whole refresh-token family.
+func (s *Service) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE user_sessions SET revoked_at = $1
+		WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL`,
+		time.Now(), sessionID, userID)
+	if err != nil {
+		return fmt.Errorf("session revocation error: %w", err)
+	}
+
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return ErrSessionNotFound
+	}
+
+	_, err = s.db.ExecContext(ctx, "UPDATE refresh_tokens SET revoked = true WHERE session_id = $1", sessionID)
+	if err != nil {
+		return err
+	}
+
+	return s.revokeSessionTokens(ctx, sessionID)
+}
+
+// RevokeOtherSessions signs the user out everywhere except the given session.
+func (s *Service) RevokeOtherSessions(ctx context.Context, userID, keepSessionID uuid.UUID) (int64, error) {
+	return s.revokeSessionsExcept(ctx, userID, keepSessionID)
+}
+
+// RevokeAllSessions signs the user out of every device.
+func (s *Service) RevokeAllSessions(ctx context.Context, userID uuid.UUID) (int64, error) {
+	return s.revokeSessionsExcept(ctx, userID, uuid.Nil)
+}
+
+func (s *Service) revokeSessionsExcept(ctx context.Context, userID, keepSessionID uuid.UUID) (int64, error) {
+	var revoked []uuid.UUID
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `
+			UPDATE user_sessions SET revoked_at = $1
+			WHERE user_id = $2 AND id <> $3 AND revoked_at IS NULL
+			RETURNING id`,
+			time.Now(), userID, keepSessionID)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var sessionID uuid.UUID
+			if err := rows.Scan(&sessionID); err != nil {
+				rows.Close()
+				return err
+			}
+			revoked = append(revoked, sessionID)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE refresh_tokens SET revoked = true
+			WHERE user_id = $1 AND revoked = false AND (session_id IS NULL OR session_id <> $2)`,
+			userID, keepSessionID)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("session revocation error: %w", err)
+	}
+
+	if err := s.revokeSessionTokens(ctx, revoked...); err != nil {
+		return 0, fmt.Errorf("session revocation error: %w", err)
+	}
+
+	return int64(len(revoked)), nil
+}
+
+func (s *Service) withTx(ctx context.Context, fn func(*sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// isUniqueViolation reports whether err is a Postgres unique constraint violation.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
@@ -0,0 +1,267 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/database"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/mail"
+)
+
+// ThrottleError is returned while an account or address must wait before trying again.
+type ThrottleError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *ThrottleError) Error() string {
+	if e.Locked {
+		return "account temporarily locked"
+	}
+	return "too many login attempts"
+}
+
+// Throttles are keyed by the submitted email rather than the user row, so unknown
+// emails are throttled and locked exactly like real ones and reveal nothing.
+func accountThrottleKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// checkLoginThrottle returns a ThrottleError if any of the keys is still blocked.
+func (s *Service) checkLoginThrottle(ctx context.Context, keys ...string) error {
+	now := time.Now()
+	for _, key := range keys {
+		var blockedUntil sql.NullTime
+		var locked bool
+		err := s.db.QueryRowContext(ctx,
+			"SELECT blocked_until, locked FROM login_throttles WHERE key = $1", key).Scan(&blockedUntil, &locked)
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("login throttle lookup error: %w", err)
+		}
+
+		if blockedUntil.Valid && now.Before(blockedUntil.Time) {
+			return &ThrottleError{RetryAfter: blockedUntil.Time.Sub(now), Locked: locked}
+		}
+	}
+	return nil
+}
+
+// recordLoginFailure bumps the failure counter for a key and works out how long it must wait.
+// It reports whether this failure locked the key.
+func (s *Service) recordLoginFailure(ctx context.Context, key string, freeAttempts int, canLock bool) (bool, error) {
+	cfg := s.config.Lockout
+	now := time.Now()
+
+	var failures int
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO login_throttles (key, failures, last_failure_at) VALUES ($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_throttles.last_failure_at < $3 THEN 1 ELSE login_throttles.failures + 1 END,
+			locked = CASE WHEN login_throttles.last_failure_at < $3 THEN FALSE ELSE login_throttles.locked END,
+			last_failure_at = $2
+		RETURNING failures`, key, now, now.Add(-cfg.FailureWindow)).Scan(&failures)
+	if err != nil {
+		return false, fmt.Errorf("login throttle update error: %w", err)
+	}
+
+	if failures <= freeAttempts {
+		return false, nil
+	}
+
+	locked := canLock && cfg.Threshold > 0 && failures >= cfg.Threshold
+	wait := cfg.Duration
+	if !locked {
+		wait = backoff(cfg.BackoffBase, cfg.BackoffMax, failures-freeAttempts)
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		"UPDATE login_throttles SET blocked_until = $1, locked = $2 WHERE key = $3",
+		now.Add(wait), locked, key)
+	if err != nil {
+		return false, fmt.Errorf("login throttle update error: %w", err)
+	}
+
+	// Only the failure that crosses the threshold reports a new lockout
+	return locked && failures == cfg.Threshold, nil
+}
+
+// backoff doubles from base for each attempt past the free ones, capped at max.
+func backoff(base, max time.Duration, step int) time.Duration {
+	wait := base
+	for i := 1; i < step && wait < max; i++ {
+		wait *= 2
+	}
+	if wait > max {
+		wait = max
+	}
+	return wait
+}
+
+func (s *Service) clearLoginThrottle(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM login_throttles WHERE key = $1", key)
+	return err
+}
+
+// registerLoginFailure records a failed attempt against the account and the client address,
+// writing an audit entry when the account becomes locked.
+func (s *Service) registerLoginFailure(ctx context.Context, email string, userID uuid.UUID, client ClientInfo) error {
+	locked, err := s.recordLoginFailure(ctx, accountThrottleKey(email), s.config.Lockout.FreeAttempts, true)
+	if err != nil {
+		return err
+	}
+
+	if client.IPAddress != "" {
+		if _, err := s.recordLoginFailure(ctx, ipThrottleKey(client.IPAddress), s.config.Lockout.IPFreeAttempts, false); err != nil {
+			return err
+		}
+	}
+
+	if !locked {
+		return nil
+	}
+
+	entry := database.AuditEntry{
+		Action:       "auth.account_locked",
+		ResourceType: "user",
+		NewValues: map[string]interface{}{
+			"email":        email,
+			"locked_until": time.Now().Add(s.config.Lockout.Duration),
+		},
+		IPAddress: client.IPAddress,
+		UserAgent: client.UserAgent,
+	}
+	if userID != uuid.Nil {
+		entry.UserID = userID.String()
+		entry.ResourceID = userID.String()
+	}
+	return database.RecordAudit(ctx, s.db, entry)
+}
+
+// RequestAccountUnlock emails a single-use unlock link if the email belongs to a locked account,
+// within the same per-address and per-IP limits as other emailed links.
+// Callers should respond identically whatever happens here.
+func (s *Service) RequestAccountUnlock(ctx context.Context, email string, client ClientInfo) error {
+	var locked bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT locked AND blocked_until > NOW() FROM login_throttles WHERE key = $1`,
+		accountThrottleKey(email)).Scan(&locked)
+	if err == sql.ErrNoRows || (err == nil && !locked) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// The throttle key is lowercased, so the account is found the same way
+	err = s.db.QueryRowContext(ctx,
+		"SELECT email FROM users WHERE LOWER(email) = LOWER($1) AND deleted_at IS NULL", email).Scan(&email)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if allowed, err := s.emailSendAllowed(ctx, "account_unlock_tokens", email, client.IPAddress); err != nil || !allowed {
+		return err
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return err
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO account_unlock_tokens (email, token, ip_address, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)`, email, token, client.IPAddress, time.Now().Add(1*time.Hour), time.Now())
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Unlock your Ground Sense account",
+		Body: fmt.Sprintf("Your account was locked after repeated failed sign-in attempts.\n\n"+
+			"If this was you, unlock it here within the next hour:\n%s/unlock-account?token=%s\n\n"+
+			"If it wasn't, consider changing your password after unlocking.",
+			s.config.Server.PublicURL, token),
+	})
+}
+
+// UnlockAccount consumes an unlock token and clears the account's lockout.
+func (s *Service) UnlockAccount(ctx context.Context, token string, client ClientInfo) error {
+	var email string
+	var expiresAt time.Time
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE account_unlock_tokens SET used = true
+		WHERE token = $1 AND used = false
+		RETURNING email, expires_at`, token).Scan(&email, &expiresAt)
+	if err == sql.ErrNoRows {
+		return ErrInvalidToken
+	} else if err != nil {
+		return err
+	}
+
+	if time.Now().After(expiresAt) {
+		return ErrTokenExpired
+	}
+
+	// The account may have been deleted since the link was sent
+	var userID string
+	err = s.db.QueryRowContext(ctx,
+		"SELECT id FROM users WHERE email = $1 AND deleted_at IS NULL", email).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return ErrInvalidToken
+	} else if err != nil {
+		return err
+	}
+
+	if err := s.clearLoginThrottle(ctx, accountThrottleKey(email)); err != nil {
+		return err
+	}
+
+	return database.RecordAudit(ctx, s.db, database.AuditEntry{
+		UserID:       userID,
+		Action:       "auth.account_unlocked",
+		ResourceType: "user",
+		ResourceID:   userID,
+		NewValues:    map[string]interface{}{"method": "email"},
+		IPAddress:    client.IPAddress,
+		UserAgent:    client.UserAgent,
+	})
+}
+
+// AdminUnlockAccount clears a user's lockout on behalf of an administrator.
+func (s *Service) AdminUnlockAccount(ctx context.Context, adminID, userID uuid.UUID, client ClientInfo) error {
+	var email string
+	err := s.db.QueryRowContext(ctx, "SELECT email FROM users WHERE id = $1 AND deleted_at IS NULL", userID).Scan(&email)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if err := s.clearLoginThrottle(ctx, accountThrottleKey(email)); err != nil {
+		return err
+	}
+
+	return database.RecordAudit(ctx, s.db, database.AuditEntry{
+		UserID:       adminID.String(),
+		Action:       "auth.account_unlocked",
+		ResourceType: "user",
+		ResourceID:   userID.String(),
+		NewValues:    map[string]interface{}{"method": "admin"},
+		IPAddress:    client.IPAddress,
+		UserAgent:    client.UserAgent,
+	})
+}
@@ -1,18 +1,28 @@
 package chat
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"slices"
 	"sync"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
 )
 
 type Client struct {
 	Conn     *websocket.Conn
+	UserID   string
 	Username string
 	Send     chan models.Message
+
+	// locationSlot holds a token while a location reply is being prepared, and
+	// locationReplies the times of the replies within the last minute
+	locationSlot    chan struct{}
+	locationReplies []time.Time
 }
 
 type Hub struct {
@@ -21,8 +31,28 @@ type Hub struct {
 	Register   chan *Client
 	Unregister chan *Client
 	mutex      sync.Mutex
+
+	locationResponder LocationResponder
+	participants      ParticipantLister
+	saveMessage       MessageSaver
 }
 
+// LocationResponder answers a shared location with a message about the place.
+type LocationResponder func(ctx context.Context, location models.GeoPoint) (string, error)
+
+// ParticipantLister lists the user IDs taking part in a conversation.
+type ParticipantLister func(ctx context.Context, conversationID string) ([]string, error)
+
+// MessageSaver stores a system message, setting its sender.
+type MessageSaver func(ctx context.Context, message *models.Message) error
+
+const (
+	// locationReplyTimeout bounds how long a location reply may take.
+	locationReplyTimeout = 10 * time.Second
+	// locationRepliesPerMinute is how many shared locations a client gets answered a minute
+	locationRepliesPerMinute = 5
+)
+
 var hub = Hub{
 	Clients:    make(map[*Client]bool),
 	Broadcast:  make(chan models.Message),
@@ -88,6 +118,42 @@ func ServeWs(w http.ResponseWriter, r *http.Request) {
 	go client.readPump()
 }
 
+func ServeWsWithUser(w http.ResponseWriter, r *http.Request, userID string) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	client := &Client{
+		Conn:         conn,
+		UserID:       userID,
+		Username:     userID,
+		Send:         make(chan models.Message, 256),
+		locationSlot: make(chan struct{}, 1),
+	}
+	hub.Register <- client
+
+	go client.writePump()
+	go client.readPump()
+}
+
+// DisconnectUser closes every socket belonging to the user. The read pumps then
+// unregister the clients through the normal path.
+func (h *Hub) DisconnectUser(userID string) int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	disconnected := 0
+	for client := range h.Clients {
+		if client.UserID == userID {
+			client.Conn.Close()
+			disconnected++
+		}
+	}
+	return disconnected
+}
+
 func (c *Client) readPump() {
 	defer func() {
 		hub.Unregister <- c
@@ -101,6 +167,117 @@ func (c *Client) readPump() {
 		}
 		msg.Username = c.Username
 		hub.Broadcast <- msg
+		if msg.MessageType == models.MessageTypeLocation && msg.Metadata.Location != nil && c.reserveLocationReply() {
+			go func() {
+				defer func() { <-c.locationSlot }()
+				hub.replyToLocation(c.UserID, msg)
+			}()
+		}
+	}
+}
+
+// reserveLocationReply takes the client's location reply slot, reporting false when
+// a reply is already in flight, the client has had its replies for the minute or
+// isn't signed in.
+func (c *Client) reserveLocationReply() bool {
+	if c.UserID == "" {
+		return false
+	}
+	now := time.Now()
+	recent := c.locationReplies[:0]
+	for _, at := range c.locationReplies {
+		if now.Sub(at) < time.Minute {
+			recent = append(recent, at)
+		}
+	}
+	c.locationReplies = recent
+	if len(recent) >= locationRepliesPerMinute {
+		return false
+	}
+
+	select {
+	case c.locationSlot <- struct{}{}:
+	default:
+		return false
+	}
+	c.locationReplies = append(c.locationReplies, now)
+	return true
+}
+
+// SendToUser delivers a message to every socket the user has open. Users who aren't
+// connected see it the next time they load the conversation.
+func (h *Hub) SendToUser(userID string, message models.Message) int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	sent := 0
+	for client := range h.Clients {
+		if client.UserID != userID {
+			continue
+		}
+		select {
+		case client.Send <- message:
+			sent++
+		default:
+		}
+	}
+	return sent
+}
+
+// SetLocationResponder makes the hub answer location messages with a system message,
+// saved to the conversation and sent to its participants.
+func (h *Hub) SetLocationResponder(responder LocationResponder, participants ParticipantLister, save MessageSaver) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.locationResponder = responder
+	h.participants = participants
+	h.saveMessage = save
+}
+
+// replyToLocation answers a location the user shared in a conversation they take part in.
+func (h *Hub) replyToLocation(userID string, msg models.Message) {
+	h.mutex.Lock()
+	responder, participants, save := h.locationResponder, h.participants, h.saveMessage
+	h.mutex.Unlock()
+	if responder == nil || participants == nil || save == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), locationReplyTimeout)
+	defer cancel()
+	members, err := participants(ctx, msg.ConversationID.String())
+	if err != nil {
+		log.Printf("Location reply failed: %v", err)
+		return
+	}
+	// The client names the conversation, so only one they take part in is answered
+	if !slices.Contains(members, userID) {
+		return
+	}
+	content, err := responder(ctx, *msg.Metadata.Location)
+	if err != nil {
+		log.Printf("Location reply failed: %v", err)
+		return
+	}
+
+	replyTo, now := msg.ID, time.Now()
+	reply := models.Message{
+		ID:             uuid.New(),
+		ConversationID: msg.ConversationID,
+		Content:        content,
+		MessageType:    models.MessageTypeSystem,
+		Status:         models.MessageStatusSent,
+		ReplyToID:      &replyTo,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	// Saved first, so the reply is in the conversation for participants who aren't connected
+	if err := save(ctx, &reply); err != nil {
+		log.Printf("Location reply failed: %v", err)
+		return
+	}
+	for _, id := range members {
+		h.SendToUser(id, reply)
 	}
 }
 
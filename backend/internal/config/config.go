@@ -1,9 +1,13 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"net"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -15,16 +19,32 @@ type Config struct {
 	JWT      JWTConfig
 	Redis    RedisConfig
 	Email    EmailConfig
+	SMS      SMSConfig
 	Storage  StorageConfig
 	RateLimit RateLimitConfig
+	Lockout   LockoutConfig
+	Password  PasswordConfig
+	PasswordPolicy PasswordPolicyConfig
+	Account   AccountConfig
+	LoginAnomaly LoginAnomalyConfig
+	OIDC      []OIDCProviderConfig
+	Map       MapConfig
+	Alerts    AlertConfig
 }
 
 type ServerConfig struct {
+	// Environment is "development" for local work; anything else is treated as production
+	Environment string
+	// PublicURL is where the web app is served; links in emails point here
+	PublicURL    string
 	Host         string
 	Port         string
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
 	IdleTimeout  time.Duration
+	// TrustedProxies are the IPs and CIDR ranges of reverse proxies whose
+	// X-Forwarded-For and X-Real-IP headers are believed
+	TrustedProxies []string
 }
 
 type DatabaseConfig struct {
@@ -39,6 +59,17 @@ type DatabaseConfig struct {
 type JWTConfig struct {
 	Secret     string
 	ExpiryHour time.Duration
+	// RevocationStore selects where revoked tokens are kept: "memory" or "postgres"
+	RevocationStore string
+	// Algorithm is HS256 (shared Secret), RS256 or EdDSA (SigningKeyFile)
+	Algorithm string
+	// SigningKeyFile is a PEM private key used to sign new tokens
+	SigningKeyFile string
+	// SigningKeyID overrides the kid header; defaults to the key's RFC 7638 thumbprint
+	SigningKeyID string
+	// VerificationKeyFiles are PEM public keys of retired signing keys still accepted during rotation,
+	// each as path or path=kid when the key signed with a JWT_SIGNING_KEY_ID
+	VerificationKeyFiles []string
 }
 
 type RedisConfig struct {
@@ -57,6 +88,16 @@ type EmailConfig struct {
 	FromName     string
 }
 
+// SMSConfig selects the text-message backend: "log" (default, development only), "file"
+// or "http".
+type SMSConfig struct {
+	Provider   string
+	FilePath   string
+	GatewayURL string
+	APIKey     string
+	SenderID   string
+}
+
 type StorageConfig struct {
 	Endpoint        string
 	AccessKeyID     string
@@ -70,6 +111,112 @@ type RateLimitConfig struct {
 	BurstSize       int
 }
 
+// LockoutConfig controls per-account and per-IP login throttling. Failures beyond the
+// free attempts back off exponentially; enough account failures lock it temporarily.
+type LockoutConfig struct {
+	FreeAttempts   int
+	IPFreeAttempts int
+	BackoffBase    time.Duration
+	BackoffMax     time.Duration
+	FailureWindow  time.Duration
+	Threshold      int
+	Duration       time.Duration
+}
+
+// PasswordConfig chooses how new password hashes are made. Existing hashes in any
+// supported format still verify and are upgraded on the next successful login.
+type PasswordConfig struct {
+	// Algorithm is "argon2id" or "bcrypt"
+	Algorithm  string
+	BcryptCost int
+	// Argon2Memory is in KiB
+	Argon2Memory      uint32
+	Argon2Iterations  uint32
+	Argon2Parallelism uint8
+	Argon2SaltLength  uint32
+	Argon2KeyLength   uint32
+}
+
+// PasswordPolicyConfig decides which new passwords are acceptable.
+type PasswordPolicyConfig struct {
+	MinLength int
+	MaxLength int
+	// BannedWords may not appear anywhere in a password, case-insensitively
+	BannedWords []string
+	// HistorySize is how many previous passwords may not be reused; 0 disables the check
+	HistorySize int
+	// BreachedPasswordsFile is an offline SHA-1 breach corpus: a sorted HASH:COUNT file
+	// or a directory of prefix range files. Empty disables the check.
+	BreachedPasswordsFile string
+	// BreachedMinCount is how many breach sightings reject a password
+	BreachedMinCount int
+}
+
+// AccountConfig controls what happens after a user deletes their account. Until the
+// grace period ends the deletion can be cancelled; then personal data is anonymised, and
+// the anonymised row itself is purged once the retention period has passed.
+type AccountConfig struct {
+	DeletionGracePeriod time.Duration
+	DeletedRetention    time.Duration
+	PurgeInterval       time.Duration
+	// UsernameChangeCooldown is how long after one username change the next is allowed
+	UsernameChangeCooldown time.Duration
+	// ReservedUsernames can't be registered or changed to, ignoring case and . _ -
+	ReservedUsernames []string
+}
+
+// LoginAnomalyConfig scores each sign-in against the user's earlier sessions: one point
+// each for an unseen device, an unseen /24 (IPv6 /48) network and an unseen wider /16
+// (IPv6 /32) network. Scores at or above NotifyScore email the user; at or above
+// StepUpScore a password login must also enter a code sent by email.
+type LoginAnomalyConfig struct {
+	// Lookback is how far back earlier sessions count as known
+	Lookback    time.Duration
+	NotifyScore int
+	// StepUpScore of 0 disables step-up verification
+	StepUpScore int
+}
+
+// MapConfig styles the groundwater choropleth maps.
+type MapConfig struct {
+	// Breakpoints are the ascending class boundaries of each metric, from
+	// MAP_BREAKPOINTS_<METRIC>=a,b,c. A value belongs to the first class whose upper
+	// boundary it doesn't exceed. Metrics without any are split into quintiles.
+	Breakpoints map[string][]float64
+}
+
+// AlertConfig schedules the watchlist alerts. Each run diffs newly imported datasets,
+// sends immediate alerts and the weekly digests that are due.
+type AlertConfig struct {
+	Interval time.Duration
+	// StageThreshold is the change in stage of extraction, in percentage points, that
+	// alerts users who haven't chosen their own; category changes always alert
+	StageThreshold float64
+	DigestInterval time.Duration
+}
+
+// OIDCProviderConfig describes one OpenID Connect identity provider.
+type OIDCProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// GroupsClaim names the ID token claim listing the user's groups
+	GroupsClaim string
+	// RoleMap maps IdP group names to user roles. A matching group only ever raises a
+	// user's role unless RoleSync is set.
+	RoleMap map[string]string
+	// RoleSync makes the IdP authoritative: each login sets the mapped role, or user when
+	// no group maps, even if that lowers a role assigned locally
+	RoleSync bool
+	// AllowSignup provisions a user on first login; otherwise only linked users may sign in
+	AllowSignup bool
+	// LinkByEmail links a first login to an existing user with the same verified email
+	LinkByEmail bool
+}
+
 func Load() *Config {
 	// Load .env file if it exists
 	if err := godotenv.Load(); err != nil {
@@ -78,11 +225,14 @@ func Load() *Config {
 
 	return &Config{
 		Server: ServerConfig{
+			Environment:  getEnv("APP_ENV", "production"),
+			PublicURL:    getEnv("APP_PUBLIC_URL", "http://localhost:5173"),
 			Host:         getEnv("SERVER_HOST", "localhost"),
 			Port:         getEnv("SERVER_PORT", "8080"),
 			ReadTimeout:  getEnvAsDuration("SERVER_READ_TIMEOUT", 15*time.Second),
 			WriteTimeout: getEnvAsDuration("SERVER_WRITE_TIMEOUT", 15*time.Second),
 			IdleTimeout:  getEnvAsDuration("SERVER_IDLE_TIMEOUT", 60*time.Second),
+			TrustedProxies: getEnvAsList("SERVER_TRUSTED_PROXIES", nil),
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -93,8 +243,13 @@ func Load() *Config {
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
 		},
 		JWT: JWTConfig{
-			Secret:     getEnv("JWT_SECRET", "your-secret-key"),
-			ExpiryHour: getEnvAsDuration("JWT_EXPIRY_HOUR", 24*time.Hour),
+			Secret:               getEnv("JWT_SECRET", defaultJWTSecret),
+			ExpiryHour:           getEnvAsDuration("JWT_EXPIRY_HOUR", 24*time.Hour),
+			RevocationStore:      getEnv("JWT_REVOCATION_STORE", "memory"),
+			Algorithm:            getEnv("JWT_ALGORITHM", "HS256"),
+			SigningKeyFile:       getEnv("JWT_SIGNING_KEY_FILE", ""),
+			SigningKeyID:         getEnv("JWT_SIGNING_KEY_ID", ""),
+			VerificationKeyFiles: getEnvAsList("JWT_VERIFICATION_KEY_FILES", nil),
 		},
 		Redis: RedisConfig{
 			Host:     getEnv("REDIS_HOST", "localhost"),
@@ -110,6 +265,13 @@ func Load() *Config {
 			FromEmail: getEnv("FROM_EMAIL", ""),
 			FromName:  getEnv("FROM_NAME", "Ground Sense Bot"),
 		},
+		SMS: SMSConfig{
+			Provider:   getEnv("SMS_PROVIDER", "log"),
+			FilePath:   getEnv("SMS_FILE_PATH", "sms.log"),
+			GatewayURL: getEnv("SMS_GATEWAY_URL", ""),
+			APIKey:     getEnv("SMS_API_KEY", ""),
+			SenderID:   getEnv("SMS_SENDER_ID", "GRDSNS"),
+		},
 		Storage: StorageConfig{
 			Endpoint:        getEnv("STORAGE_ENDPOINT", "localhost:9000"),
 			AccessKeyID:     getEnv("STORAGE_ACCESS_KEY", ""),
@@ -121,7 +283,217 @@ func Load() *Config {
 			RequestsPerHour: getEnvAsInt("RATE_LIMIT_REQUESTS", 1000),
 			BurstSize:       getEnvAsInt("RATE_LIMIT_BURST", 100),
 		},
+		Lockout: LockoutConfig{
+			FreeAttempts:   getEnvAsInt("LOGIN_FREE_ATTEMPTS", 3),
+			IPFreeAttempts: getEnvAsInt("LOGIN_IP_FREE_ATTEMPTS", 20),
+			BackoffBase:    getEnvAsDuration("LOGIN_BACKOFF_BASE", time.Second),
+			BackoffMax:     getEnvAsDuration("LOGIN_BACKOFF_MAX", 5*time.Minute),
+			FailureWindow:  getEnvAsDuration("LOGIN_FAILURE_WINDOW", time.Hour),
+			Threshold:      getEnvAsInt("LOGIN_LOCKOUT_THRESHOLD", 10),
+			Duration:       getEnvAsDuration("LOGIN_LOCKOUT_DURATION", 30*time.Minute),
+		},
+		Password: PasswordConfig{
+			Algorithm:         getEnv("PASSWORD_HASH_ALGORITHM", "argon2id"),
+			BcryptCost:        getEnvAsInt("PASSWORD_BCRYPT_COST", 12),
+			Argon2Memory:      uint32(getEnvAsInt("PASSWORD_ARGON2_MEMORY", 64*1024)),
+			Argon2Iterations:  uint32(getEnvAsInt("PASSWORD_ARGON2_ITERATIONS", 3)),
+			Argon2Parallelism: uint8(getEnvAsInt("PASSWORD_ARGON2_PARALLELISM", 2)),
+			Argon2SaltLength:  uint32(getEnvAsInt("PASSWORD_ARGON2_SALT_LENGTH", 16)),
+			Argon2KeyLength:   uint32(getEnvAsInt("PASSWORD_ARGON2_KEY_LENGTH", 32)),
+		},
+		PasswordPolicy: PasswordPolicyConfig{
+			MinLength:             getEnvAsInt("PASSWORD_MIN_LENGTH", 10),
+			MaxLength:             getEnvAsInt("PASSWORD_MAX_LENGTH", 128),
+			BannedWords:           getEnvAsList("PASSWORD_BANNED_WORDS", []string{"groundwater", "groundsense", "password"}),
+			HistorySize:           getEnvAsInt("PASSWORD_HISTORY_SIZE", 5),
+			BreachedPasswordsFile: getEnv("PASSWORD_BREACHED_FILE", ""),
+			BreachedMinCount:      getEnvAsInt("PASSWORD_BREACHED_MIN_COUNT", 1),
+		},
+		Account: AccountConfig{
+			DeletionGracePeriod:    getEnvAsDuration("ACCOUNT_DELETION_GRACE_PERIOD", 14*24*time.Hour),
+			DeletedRetention:       getEnvAsDuration("ACCOUNT_DELETED_RETENTION", 30*24*time.Hour),
+			PurgeInterval:          getEnvAsDuration("ACCOUNT_PURGE_INTERVAL", time.Hour),
+			UsernameChangeCooldown: getEnvAsDuration("ACCOUNT_USERNAME_CHANGE_COOLDOWN", 30*24*time.Hour),
+			ReservedUsernames: getEnvAsList("ACCOUNT_RESERVED_USERNAMES", []string{
+				"admin", "administrator", "root", "system", "support", "help", "security", "moderator",
+				"api", "www", "mail", "bot", "groundsense", "deleteduser", "me", "settings", "null", "undefined",
+			}),
+		},
+		LoginAnomaly: LoginAnomalyConfig{
+			Lookback:    getEnvAsDuration("LOGIN_ANOMALY_LOOKBACK", 90*24*time.Hour),
+			NotifyScore: getEnvAsInt("LOGIN_ANOMALY_NOTIFY_SCORE", 1),
+			StepUpScore: getEnvAsInt("LOGIN_ANOMALY_STEP_UP_SCORE", 0),
+		},
+		OIDC: loadOIDCProviders(),
+		Map: MapConfig{
+			Breakpoints: loadMapBreakpoints(map[string][]float64{
+				// The CGWB safe / semi-critical / critical / over-exploited thresholds
+				"stage_of_extraction": {70, 90, 100},
+			}),
+		},
+		Alerts: AlertConfig{
+			Interval:       getEnvAsDuration("ALERTS_INTERVAL", time.Hour),
+			StageThreshold: getEnvAsFloat("ALERTS_STAGE_THRESHOLD", 10),
+			DigestInterval: getEnvAsDuration("ALERTS_DIGEST_INTERVAL", 7*24*time.Hour),
+		},
+	}
+}
+
+const defaultJWTSecret = "your-secret-key"
+
+// placeholderJWTSecrets are secrets shipped in this repository's defaults and examples.
+var placeholderJWTSecrets = map[string]bool{
+	defaultJWTSecret: true,
+	"your-super-secret-jwt-key-change-this-in-production": true,
+}
+
+// IsDevelopment reports whether the server runs in local development mode.
+func (c *Config) IsDevelopment() bool {
+	return c.Server.Environment == "development"
+}
+
+// Validate rejects configurations that are unsafe to run outside development.
+func (c *Config) Validate() error {
+	switch c.JWT.Algorithm {
+	case "HS256":
+		if c.JWT.Secret == "" {
+			return errors.New("JWT_SECRET must be set")
+		}
+		if placeholderJWTSecrets[c.JWT.Secret] && !c.IsDevelopment() {
+			return errors.New("JWT_SECRET is a placeholder value; set a real secret or APP_ENV=development")
+		}
+	case "RS256", "EdDSA":
+		if c.JWT.SigningKeyFile == "" {
+			return fmt.Errorf("JWT_SIGNING_KEY_FILE is required for %s", c.JWT.Algorithm)
+		}
+	default:
+		return fmt.Errorf("unsupported JWT_ALGORITHM %q", c.JWT.Algorithm)
+	}
+
+	switch c.Password.Algorithm {
+	case "argon2id":
+		p := c.Password
+		if p.Argon2Iterations < 1 || p.Argon2Parallelism < 1 || p.Argon2Memory < 8*uint32(p.Argon2Parallelism) {
+			return errors.New("argon2id needs at least 1 iteration, 1 thread and 8 KiB of memory per thread")
+		}
+		if p.Argon2SaltLength < 8 || p.Argon2KeyLength < 16 {
+			return errors.New("argon2id salt must be at least 8 bytes and key at least 16 bytes")
+		}
+	case "bcrypt":
+		if c.Password.BcryptCost < 10 || c.Password.BcryptCost > 31 {
+			return errors.New("PASSWORD_BCRYPT_COST must be between 10 and 31")
+		}
+	default:
+		return fmt.Errorf("unsupported PASSWORD_HASH_ALGORITHM %q", c.Password.Algorithm)
+	}
+
+	if c.PasswordPolicy.MinLength < 8 {
+		return errors.New("PASSWORD_MIN_LENGTH must be at least 8")
+	}
+
+	if c.Account.DeletedRetention < c.Account.DeletionGracePeriod || c.Account.PurgeInterval <= 0 {
+		return errors.New("ACCOUNT_DELETED_RETENTION must be at least the grace period and ACCOUNT_PURGE_INTERVAL positive")
+	}
+
+	if a := c.LoginAnomaly; a.NotifyScore < 1 || a.StepUpScore < 0 || a.StepUpScore > 3 || a.Lookback <= 0 {
+		return errors.New("LOGIN_ANOMALY_NOTIFY_SCORE must be at least 1, LOGIN_ANOMALY_STEP_UP_SCORE 0-3 and LOGIN_ANOMALY_LOOKBACK positive")
+	}
+
+	if (c.Email.Username == "" || c.Email.FromEmail == "") && !c.IsDevelopment() {
+		return errors.New("SMTP_USERNAME and FROM_EMAIL are required outside development")
+	}
+
+	switch c.SMS.Provider {
+	case "http":
+		if c.SMS.GatewayURL == "" {
+			return errors.New("SMS_GATEWAY_URL is required when SMS_PROVIDER is http")
+		}
+	case "log", "file":
+		// Neither delivers anything, and file keeps codes in plain text
+		if !c.IsDevelopment() {
+			return fmt.Errorf("SMS_PROVIDER=%s doesn't deliver messages and is allowed in development only; set it to http",
+				c.SMS.Provider)
+		}
+	default:
+		return fmt.Errorf("SMS_PROVIDER %q must be log, file or http", c.SMS.Provider)
 	}
+
+	if a := c.Alerts; a.Interval <= 0 || a.DigestInterval < a.Interval || a.StageThreshold <= 0 {
+		return errors.New("ALERTS_INTERVAL and ALERTS_STAGE_THRESHOLD must be positive and ALERTS_DIGEST_INTERVAL at least the interval")
+	}
+
+	for metric, breaks := range c.Map.Breakpoints {
+		for i := 1; i < len(breaks); i++ {
+			if breaks[i] <= breaks[i-1] {
+				return fmt.Errorf("MAP_BREAKPOINTS_%s must be ascending", strings.ToUpper(metric))
+			}
+		}
+	}
+
+	for _, proxy := range c.Server.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return fmt.Errorf("SERVER_TRUSTED_PROXIES entry %q is not an IP or CIDR range", proxy)
+		}
+	}
+
+	for _, provider := range c.OIDC {
+		if provider.Issuer == "" || provider.ClientID == "" || provider.RedirectURL == "" {
+			return fmt.Errorf("OIDC provider %q needs an issuer, client ID and redirect URL", provider.Name)
+		}
+	}
+
+	return nil
+}
+
+// loadOIDCProviders reads OIDC_PROVIDERS=a,b and the OIDC_<NAME>_* settings for each.
+func loadOIDCProviders() []OIDCProviderConfig {
+	var providers []OIDCProviderConfig
+	for _, name := range getEnvAsList("OIDC_PROVIDERS", nil) {
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+
+		roleMap := map[string]string{}
+		for _, pair := range getEnvAsList(prefix+"ROLE_MAP", nil) {
+			if group, role, ok := strings.Cut(pair, ":"); ok {
+				roleMap[strings.TrimSpace(group)] = strings.TrimSpace(role)
+			}
+		}
+
+		providers = append(providers, OIDCProviderConfig{
+			Name:         strings.ToLower(name),
+			Issuer:       getEnv(prefix+"ISSUER", ""),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  getEnv(prefix+"REDIRECT_URL", ""),
+			Scopes:       getEnvAsList(prefix+"SCOPES", []string{"openid", "email", "profile"}),
+			GroupsClaim:  getEnv(prefix+"GROUPS_CLAIM", "groups"),
+			RoleMap:      roleMap,
+			RoleSync:     getEnvAsBool(prefix+"ROLE_SYNC", false),
+			AllowSignup:  getEnvAsBool(prefix+"ALLOW_SIGNUP", true),
+			LinkByEmail:  getEnvAsBool(prefix+"LINK_BY_EMAIL", false),
+		})
+	}
+	return providers
+}
+
+// loadMapBreakpoints overrides the defaults with every MAP_BREAKPOINTS_<METRIC> setting.
+func loadMapBreakpoints(defaults map[string][]float64) map[string][]float64 {
+	const prefix = "MAP_BREAKPOINTS_"
+	breakpoints := defaults
+	for _, entry := range os.Environ() {
+		key, value, _ := strings.Cut(entry, "=")
+		if !strings.HasPrefix(key, prefix) || value == "" {
+			continue
+		}
+
+		var breaks []float64
+		for _, item := range getEnvAsList(key, nil) {
+			if b, err := strconv.ParseFloat(item, 64); err == nil {
+				breaks = append(breaks, b)
+			}
+		}
+		breakpoints[strings.ToLower(strings.TrimPrefix(key, prefix))] = breaks
+	}
+	return breakpoints
 }
 
 func getEnv(key, defaultValue string) string {
@@ -140,6 +512,15 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
 func getEnvAsBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if boolValue, err := strconv.ParseBool(value); err == nil {
@@ -157,3 +538,18 @@ func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
 	}
 	return defaultValue
 }
+
+func getEnvAsList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
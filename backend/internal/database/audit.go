@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net"
+)
+
+// AuditEntry is a row destined for audit_logs. Old/New values are marshalled to JSONB.
+type AuditEntry struct {
+	UserID string
+	// ActorID is the administrator acting as UserID while impersonating them. When empty
+	// it is taken from the context, see WithActor.
+	ActorID      string
+	Action       string
+	ResourceType string
+	ResourceID   string
+	OldValues    interface{}
+	NewValues    interface{}
+	IPAddress    string
+	UserAgent    string
+}
+
+type actorContextKey struct{}
+
+// WithActor marks everything done with ctx as performed by actorID on someone else's
+// behalf, so audit entries recorded with it name both identities.
+func WithActor(ctx context.Context, actorID string) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actorID)
+}
+
+// ActorFromContext returns the impersonating administrator set by WithActor.
+func ActorFromContext(ctx context.Context) (string, bool) {
+	actorID, ok := ctx.Value(actorContextKey{}).(string)
+	return actorID, ok && actorID != ""
+}
+
+// Execer is satisfied by both *sql.DB and *sql.Tx.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Querier is satisfied by both *sql.DB and *sql.Tx.
+type Querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func (s *Service) RecordAudit(ctx context.Context, entry AuditEntry) error {
+	return RecordAudit(ctx, s.DB, entry)
+}
+
+// RecordAudit inserts an audit log entry. Services that only hold a *sql.DB use this directly.
+func RecordAudit(ctx context.Context, db Execer, entry AuditEntry) error {
+	oldValues, err := marshalNullable(entry.OldValues)
+	if err != nil {
+		return err
+	}
+	newValues, err := marshalNullable(entry.NewValues)
+	if err != nil {
+		return err
+	}
+
+	if entry.ActorID == "" {
+		entry.ActorID, _ = ActorFromContext(ctx)
+	}
+
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO audit_logs (user_id, actor_id, action, resource_type, resource_id, old_values, new_values,
+		                        ip_address, user_agent)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		nullString(entry.UserID), nullString(entry.ActorID), entry.Action, entry.ResourceType,
+		nullString(entry.ResourceID), oldValues, newValues, nullIP(entry.IPAddress), nullString(entry.UserAgent))
+	return err
+}
+
+func marshalNullable(value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func nullString(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+func nullIP(value string) interface{} {
+	if net.ParseIP(value) == nil {
+		return nil
+	}
+	return value
+}
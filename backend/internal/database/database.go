@@ -6,11 +6,17 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/hxrshxz/ground-sense-bot/backend/internal/config"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
 	_ "github.com/lib/pq"
 	"github.com/sirupsen/logrus"
 )
 
+// SystemUserID is the user system messages, such as alerts and replies to shared
+// locations, are sent by.
+var SystemUserID = uuid.MustParse("00000000-0000-0000-0000-000000000a1e")
+
 type Service struct {
 	DB     *sql.DB
 	config *config.Config
@@ -214,6 +220,363 @@ func (s *Service) runMigrations(ctx context.Context) error {
 			user_agent TEXT,
 			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 		)`,
+
+		// Sessions own a refresh-token family
+		`ALTER TABLE user_sessions ADD COLUMN IF NOT EXISTS revoked_at TIMESTAMP`,
+		`ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS session_id UUID REFERENCES user_sessions(id) ON DELETE CASCADE`,
+
+		// Access-token revocation: denylisted token/session IDs and a per-user issued-before watermark
+		`CREATE TABLE IF NOT EXISTS revoked_tokens (
+			id VARCHAR(100) PRIMARY KEY,
+			expires_at TIMESTAMP NOT NULL,
+			revoked_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS tokens_valid_after TIMESTAMP`,
+
+		// Login throttling, keyed by "account:<email>" or "ip:<address>"
+		`CREATE TABLE IF NOT EXISTS login_throttles (
+			key VARCHAR(320) PRIMARY KEY,
+			failures INT NOT NULL DEFAULT 0,
+			last_failure_at TIMESTAMP NOT NULL,
+			blocked_until TIMESTAMP,
+			locked BOOLEAN NOT NULL DEFAULT FALSE
+		)`,
+
+		// Account unlock tokens table
+		`CREATE TABLE IF NOT EXISTS account_unlock_tokens (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			email VARCHAR(255) NOT NULL,
+			token VARCHAR(255) UNIQUE NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			used BOOLEAN NOT NULL DEFAULT FALSE
+		)`,
+
+		// Pending OpenID Connect logins, consumed by the callback
+		`CREATE TABLE IF NOT EXISTS oidc_login_states (
+			state VARCHAR(100) PRIMARY KEY,
+			provider VARCHAR(50) NOT NULL,
+			nonce VARCHAR(100) NOT NULL,
+			code_verifier VARCHAR(100) NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// One-time codes the frontend trades for tokens after a provider login
+		`CREATE TABLE IF NOT EXISTS oidc_login_codes (
+			code_hash VARCHAR(64) PRIMARY KEY,
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			expires_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// External identities linked to local users
+		`CREATE TABLE IF NOT EXISTS user_identities (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			provider VARCHAR(50) NOT NULL,
+			subject VARCHAR(255) NOT NULL,
+			email VARCHAR(255),
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_login_at TIMESTAMP,
+			UNIQUE(provider, subject)
+		)`,
+
+		// Passwordless login tokens: a magic link, or a 6-digit code when code is set
+		`CREATE TABLE IF NOT EXISTS login_tokens (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			email VARCHAR(255) NOT NULL,
+			token VARCHAR(255) UNIQUE NOT NULL,
+			code VARCHAR(6),
+			attempts INT NOT NULL DEFAULT 0,
+			expires_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			used BOOLEAN NOT NULL DEFAULT FALSE
+		)`,
+
+		// Texted one-time codes for phone verification ("verify") and sign-in ("login")
+		`CREATE TABLE IF NOT EXISTS phone_otps (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			phone VARCHAR(20) NOT NULL,
+			purpose VARCHAR(20) NOT NULL,
+			code VARCHAR(6) NOT NULL,
+			attempts INT NOT NULL DEFAULT 0,
+			expires_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			used BOOLEAN NOT NULL DEFAULT FALSE
+		)`,
+		// A verified phone is a login identity, so it can belong to one account only
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_users_verified_phone ON users(phone)
+			WHERE phone_verified AND deleted_at IS NULL`,
+
+		// Recent password hashes, so old passwords can't be reused
+		`CREATE TABLE IF NOT EXISTS password_history (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			password_hash VARCHAR(255) NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Role to permission mapping, editable by admins; seeded only while empty
+		`CREATE TABLE IF NOT EXISTS role_permissions (
+			role VARCHAR(20) NOT NULL,
+			permission VARCHAR(100) NOT NULL,
+			PRIMARY KEY (role, permission)
+		)`,
+		`INSERT INTO role_permissions (role, permission)
+			SELECT * FROM (VALUES
+				('admin', '*'),
+				('moderator', 'users:read'),
+				('moderator', 'users:ban'),
+				('moderator', 'audit:read'),
+				('moderator', 'chat:moderate'),
+				('moderator', 'datasets:read'),
+				('user', 'datasets:read'),
+				('guest', 'datasets:read')
+			) AS defaults(role, permission)
+			WHERE NOT EXISTS (SELECT 1 FROM role_permissions)`,
+
+		// Administrators acting as another user are recorded alongside them
+		`ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS actor_id UUID REFERENCES users(id)`,
+
+		// Self-service account deletion: cancellable until purge_after, then anonymised
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS deletion_cancel_token VARCHAR(255)`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS purge_after TIMESTAMP`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS anonymized_at TIMESTAMP`,
+		// The tombstone user takes over messages and conversations of anonymised accounts
+		`INSERT INTO users (id, username, email, password_hash, first_name, last_name, role, status, deleted_at)
+			VALUES ('00000000-0000-0000-0000-00000000dead', 'deleted-user', 'deleted-user@deleted.invalid', '!',
+			        'Deleted', 'user', 'guest', 'inactive', CURRENT_TIMESTAMP)
+			ON CONFLICT (id) DO NOTHING`,
+
+		// Username changes are rate limited; email changes wait for both addresses to confirm
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS username_changed_at TIMESTAMP`,
+		`CREATE TABLE IF NOT EXISTS email_change_requests (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			old_email VARCHAR(255) NOT NULL,
+			new_email VARCHAR(255) NOT NULL,
+			old_token VARCHAR(255) UNIQUE NOT NULL,
+			new_token VARCHAR(255) UNIQUE NOT NULL,
+			old_confirmed_at TIMESTAMP,
+			new_confirmed_at TIMESTAMP,
+			expires_at TIMESTAMP NOT NULL,
+			completed_at TIMESTAMP,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Service accounts for bots and integrations authenticate with API keys or client credentials
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS account_type VARCHAR(20) NOT NULL DEFAULT 'human'`,
+		`ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS key_prefix VARCHAR(20)`,
+		`CREATE TABLE IF NOT EXISTS service_account_secrets (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			secret_hash VARCHAR(255) UNIQUE NOT NULL,
+			expires_at TIMESTAMP,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			revoked BOOLEAN NOT NULL DEFAULT FALSE
+		)`,
+		`INSERT INTO role_permissions (role, permission)
+			SELECT 'service', 'datasets:read'
+			WHERE NOT EXISTS (SELECT 1 FROM role_permissions WHERE role = 'service')`,
+
+		// Sign-ins from unfamiliar devices or networks can require an emailed code first
+		`ALTER TABLE user_sessions ADD COLUMN IF NOT EXISTS device_fingerprint VARCHAR(64)`,
+		`CREATE TABLE IF NOT EXISTS login_challenges (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			code VARCHAR(6) NOT NULL,
+			ip_address INET,
+			user_agent TEXT,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			used BOOLEAN NOT NULL DEFAULT FALSE,
+			expires_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Groundwater resource assessments (CGWB / INGRES). Volumes are in hectare-metres (ham).
+		// Each imported file is a dataset; its version increases with every import.
+		`CREATE TABLE IF NOT EXISTS groundwater_datasets (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			version SERIAL UNIQUE,
+			source VARCHAR(20) NOT NULL,
+			file_name VARCHAR(255) NOT NULL,
+			checksum VARCHAR(64) NOT NULL,
+			rows_total INTEGER NOT NULL DEFAULT 0,
+			rows_imported INTEGER NOT NULL DEFAULT 0,
+			rows_rejected INTEGER NOT NULL DEFAULT 0,
+			report JSONB,
+			imported_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+		// Assessment units form a state > district > block hierarchy; path is the
+		// lower-cased "state/district/block" used to match rows across imports
+		`CREATE TABLE IF NOT EXISTS groundwater_units (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			parent_id UUID REFERENCES groundwater_units(id) ON DELETE CASCADE,
+			level VARCHAR(10) NOT NULL CHECK (level IN ('state', 'district', 'block')),
+			name VARCHAR(150) NOT NULL,
+			path VARCHAR(500) UNIQUE NOT NULL,
+			code VARCHAR(50),
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS groundwater_assessments (
+			unit_id UUID NOT NULL REFERENCES groundwater_units(id) ON DELETE CASCADE,
+			year INTEGER NOT NULL,
+			dataset_id UUID NOT NULL REFERENCES groundwater_datasets(id),
+			recharge_rainfall DOUBLE PRECISION,
+			recharge_other DOUBLE PRECISION,
+			annual_recharge DOUBLE PRECISION NOT NULL,
+			natural_discharge DOUBLE PRECISION,
+			extractable_resource DOUBLE PRECISION NOT NULL,
+			extraction_irrigation DOUBLE PRECISION,
+			extraction_industrial DOUBLE PRECISION,
+			extraction_domestic DOUBLE PRECISION,
+			total_extraction DOUBLE PRECISION NOT NULL,
+			stage_of_extraction DOUBLE PRECISION NOT NULL,
+			category VARCHAR(20) NOT NULL CHECK (category IN ('safe', 'semi_critical', 'critical', 'over_exploited', 'saline')),
+			future_availability DOUBLE PRECISION,
+			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (unit_id, year)
+		)`,
+		// Unit boundaries as GeoJSON (longitude/latitude, WGS 84). The full geometry answers
+		// point lookups; maps draw the copies simplified for their zoom level.
+		`CREATE TABLE IF NOT EXISTS groundwater_boundaries (
+			unit_id UUID PRIMARY KEY REFERENCES groundwater_units(id) ON DELETE CASCADE,
+			geometry JSONB NOT NULL,
+			min_lon DOUBLE PRECISION NOT NULL,
+			min_lat DOUBLE PRECISION NOT NULL,
+			max_lon DOUBLE PRECISION NOT NULL,
+			max_lat DOUBLE PRECISION NOT NULL,
+			source VARCHAR(255),
+			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS groundwater_boundary_shapes (
+			unit_id UUID NOT NULL REFERENCES groundwater_boundaries(unit_id) ON DELETE CASCADE,
+			zoom SMALLINT NOT NULL,
+			geometry JSONB NOT NULL,
+			PRIMARY KEY (unit_id, zoom)
+		)`,
+
+		// Watchlists and the alerts sent when a watched unit's category or stage changes.
+		// The system user sends them, and replies to shared locations, as system messages.
+		`INSERT INTO users (id, username, email, password_hash, first_name, last_name, role, status)
+			VALUES ('00000000-0000-0000-0000-000000000a1e', 'groundsense', 'alerts@groundsense.invalid', '!',
+			        'GroundSense', 'alerts', 'guest', 'inactive')
+			ON CONFLICT (id) DO NOTHING`,
+		`CREATE TABLE IF NOT EXISTS groundwater_watchlist (
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			unit_id UUID NOT NULL REFERENCES groundwater_units(id) ON DELETE CASCADE,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, unit_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS groundwater_alert_preferences (
+			user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			delivery VARCHAR(20) NOT NULL DEFAULT 'immediate',
+			email_enabled BOOLEAN NOT NULL DEFAULT TRUE,
+			stage_threshold DOUBLE PRECISION,
+			last_digest_at TIMESTAMP,
+			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS groundwater_alerts (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			unit_id UUID NOT NULL REFERENCES groundwater_units(id) ON DELETE CASCADE,
+			year INTEGER NOT NULL,
+			previous_year INTEGER NOT NULL,
+			category VARCHAR(20) NOT NULL,
+			previous_category VARCHAR(20) NOT NULL,
+			stage_of_extraction DOUBLE PRECISION NOT NULL,
+			previous_stage DOUBLE PRECISION NOT NULL,
+			dataset_id UUID NOT NULL REFERENCES groundwater_datasets(id),
+			message_id UUID REFERENCES messages(id) ON DELETE SET NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			delivered_at TIMESTAMP,
+			UNIQUE (user_id, unit_id, year)
+		)`,
+		`ALTER TABLE groundwater_datasets ADD COLUMN IF NOT EXISTS alerts_checked_at TIMESTAMP`,
+
+		// Observation wells and their depth-to-water readings, loaded from monitoring
+		// network exports. Readings flagged as outliers are kept but left out of series
+		`CREATE TABLE IF NOT EXISTS groundwater_well_imports (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			source VARCHAR(20) NOT NULL,
+			file_name VARCHAR(255) NOT NULL,
+			checksum VARCHAR(64) NOT NULL,
+			rows_total INTEGER NOT NULL DEFAULT 0,
+			rows_imported INTEGER NOT NULL DEFAULT 0,
+			rows_rejected INTEGER NOT NULL DEFAULT 0,
+			report JSONB,
+			imported_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS groundwater_wells (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			code VARCHAR(50) UNIQUE NOT NULL,
+			name VARCHAR(255) NOT NULL DEFAULT '',
+			unit_id UUID REFERENCES groundwater_units(id) ON DELETE SET NULL,
+			latitude DOUBLE PRECISION NOT NULL,
+			longitude DOUBLE PRECISION NOT NULL,
+			well_type VARCHAR(50) NOT NULL DEFAULT '',
+			aquifer VARCHAR(100) NOT NULL DEFAULT '',
+			depth DOUBLE PRECISION,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS groundwater_well_readings (
+			well_id UUID NOT NULL REFERENCES groundwater_wells(id) ON DELETE CASCADE,
+			measured_on DATE NOT NULL,
+			season VARCHAR(20) NOT NULL CHECK (season IN ('winter', 'pre_monsoon', 'monsoon', 'post_monsoon')),
+			depth_to_water DOUBLE PRECISION NOT NULL,
+			outlier BOOLEAN NOT NULL DEFAULT FALSE,
+			outlier_reason VARCHAR(255),
+			import_id UUID NOT NULL REFERENCES groundwater_well_imports(id),
+			PRIMARY KEY (well_id, measured_on)
+		)`,
+
+		// Monthly district rainfall in millimetres, and each district's normal for the
+		// month, loaded from IMD exports
+		`CREATE TABLE IF NOT EXISTS groundwater_rainfall_imports (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			source VARCHAR(20) NOT NULL,
+			file_name VARCHAR(255) NOT NULL,
+			checksum VARCHAR(64) NOT NULL,
+			rows_total INTEGER NOT NULL DEFAULT 0,
+			rows_imported INTEGER NOT NULL DEFAULT 0,
+			rows_rejected INTEGER NOT NULL DEFAULT 0,
+			report JSONB,
+			imported_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS groundwater_rainfall (
+			unit_id UUID NOT NULL REFERENCES groundwater_units(id) ON DELETE CASCADE,
+			year INTEGER NOT NULL,
+			month SMALLINT NOT NULL CHECK (month BETWEEN 1 AND 12),
+			rainfall DOUBLE PRECISION NOT NULL,
+			import_id UUID NOT NULL REFERENCES groundwater_rainfall_imports(id),
+			PRIMARY KEY (unit_id, year, month)
+		)`,
+		`CREATE TABLE IF NOT EXISTS groundwater_rainfall_normals (
+			unit_id UUID NOT NULL REFERENCES groundwater_units(id) ON DELETE CASCADE,
+			month SMALLINT NOT NULL CHECK (month BETWEEN 1 AND 12),
+			rainfall DOUBLE PRECISION NOT NULL,
+			import_id UUID NOT NULL REFERENCES groundwater_rainfall_imports(id),
+			PRIMARY KEY (unit_id, month)
+		)`,
+
+		// Emailed codes that confirm irreversible actions on accounts without a password
+		`CREATE TABLE IF NOT EXISTS reauth_codes (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			code VARCHAR(6) NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			used BOOLEAN NOT NULL DEFAULT FALSE,
+			expires_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Emailed links and codes are limited per client IP as well as per address
+		`ALTER TABLE login_tokens ADD COLUMN IF NOT EXISTS ip_address VARCHAR(45)`,
+		`ALTER TABLE password_reset_tokens ADD COLUMN IF NOT EXISTS ip_address VARCHAR(45)`,
+		`ALTER TABLE account_unlock_tokens ADD COLUMN IF NOT EXISTS ip_address VARCHAR(45)`,
 	}
 
 	for i, migration := range migrations {
@@ -239,10 +602,44 @@ func (s *Service) runMigrations(ctx context.Context) error {
 		`CREATE INDEX IF NOT EXISTS idx_message_reactions_message_id ON message_reactions(message_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_user_sessions_user_id ON user_sessions(user_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_user_sessions_token ON user_sessions(session_token)`,
+		`CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session_id ON refresh_tokens(session_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires_at ON revoked_tokens(expires_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_account_unlock_tokens_token ON account_unlock_tokens(token)`,
+		`CREATE INDEX IF NOT EXISTS idx_account_unlock_tokens_email ON account_unlock_tokens(email, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_account_unlock_tokens_ip_address ON account_unlock_tokens(ip_address, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_oidc_login_states_expires_at ON oidc_login_states(expires_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_login_tokens_email ON login_tokens(email, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_reauth_codes_user_id ON reauth_codes(user_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_login_tokens_ip_address ON login_tokens(ip_address, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_email ON password_reset_tokens(email, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_ip_address ON password_reset_tokens(ip_address, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_phone_otps_phone ON phone_otps(phone, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_phone_otps_user_id ON phone_otps(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_password_history_user_id ON password_history(user_id, created_at)`,
 		`CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_api_keys_key_hash ON api_keys(key_hash)`,
 		`CREATE INDEX IF NOT EXISTS idx_audit_logs_user_id ON audit_logs(user_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_audit_logs_created_at ON audit_logs(created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_logs_actor_id ON audit_logs(actor_id) WHERE actor_id IS NOT NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_users_deletion_cancel_token ON users(deletion_cancel_token) WHERE deletion_cancel_token IS NOT NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_users_purge_after ON users(purge_after) WHERE purge_after IS NOT NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_users_username_lower ON users(LOWER(username))`,
+		`CREATE INDEX IF NOT EXISTS idx_users_email_lower ON users(LOWER(email))`,
+		`CREATE INDEX IF NOT EXISTS idx_email_change_requests_user_id ON email_change_requests(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_service_account_secrets_user_id ON service_account_secrets(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_login_challenges_user_id ON login_challenges(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_login_challenges_ip_address ON login_challenges(ip_address, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_groundwater_datasets_checksum ON groundwater_datasets(checksum)`,
+		`CREATE INDEX IF NOT EXISTS idx_groundwater_units_parent_id ON groundwater_units(parent_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_groundwater_units_level ON groundwater_units(level)`,
+		`CREATE INDEX IF NOT EXISTS idx_groundwater_assessments_year ON groundwater_assessments(year, category)`,
+		`CREATE INDEX IF NOT EXISTS idx_groundwater_assessments_dataset_id ON groundwater_assessments(dataset_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_groundwater_alerts_pending ON groundwater_alerts(user_id) WHERE delivered_at IS NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_groundwater_well_imports_checksum ON groundwater_well_imports(checksum)`,
+		`CREATE INDEX IF NOT EXISTS idx_groundwater_wells_unit_id ON groundwater_wells(unit_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_groundwater_wells_location ON groundwater_wells(latitude, longitude)`,
+		`CREATE INDEX IF NOT EXISTS idx_groundwater_rainfall_imports_checksum ON groundwater_rainfall_imports(checksum)`,
 	}
 
 	for i, index := range indexes {
@@ -318,6 +715,45 @@ func (s *Service) GetUserByEmail(ctx context.Context, email string) (*User, erro
 	return &user, nil
 }
 
+// ConversationParticipants lists the user IDs taking part in a conversation.
+func (s *Service) ConversationParticipants(ctx context.Context, conversationID string) ([]string, error) {
+	rows, err := s.DB.QueryContext(ctx,
+		"SELECT user_id FROM conversation_participants WHERE conversation_id = $1", conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, rows.Err()
+}
+
+// SaveSystemMessage stores a message from the system user in its conversation. The
+// message it replies to is linked only if that message was stored too.
+func (s *Service) SaveSystemMessage(ctx context.Context, message *models.Message) error {
+	message.SenderID = SystemUserID
+	return s.WithTransaction(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO messages (id, conversation_id, sender_id, content, message_type, status, reply_to_id, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, (SELECT id FROM messages WHERE id = $7), $8, $8)`,
+			message.ID, message.ConversationID, message.SenderID, message.Content, message.MessageType,
+			message.Status, message.ReplyToID, message.CreatedAt); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx,
+			"UPDATE conversations SET last_activity_at = $2, updated_at = $2 WHERE id = $1",
+			message.ConversationID, message.CreatedAt)
+		return err
+	})
+}
+
 // User represents the user model for database operations
 type User struct {
 	ID             string    `db:"id"`
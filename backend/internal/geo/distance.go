@@ -0,0 +1,26 @@
+package geo
+
+import "math"
+
+// earthRadiusKm is the mean radius of the Earth.
+const earthRadiusKm = 6371.0
+
+// Distance is the great-circle distance between two points in kilometres.
+func Distance(a, b Point) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Lon - a.Lon) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Around returns a box holding every point within km of p, for a first cut before
+// Distance. It's wider than needed away from the equator, never narrower.
+func Around(p Point, km float64) BBox {
+	dLat := km / earthRadiusKm * 180 / math.Pi
+	dLon := 180.0
+	if cos := math.Cos(p.Lat * math.Pi / 180); cos > 1e-6 {
+		dLon = math.Min(180, dLat/cos)
+	}
+	return BBox{MinLon: p.Lon - dLon, MinLat: p.Lat - dLat, MaxLon: p.Lon + dLon, MaxLat: p.Lat + dLat}
+}
@@ -0,0 +1,185 @@
+// Package geo has the little planar geometry the groundwater maps need: GeoJSON
+// polygons, simplification for map zoom levels, point-in-polygon tests and an R-tree to
+// find the polygons around a point, plus great-circle distances for finding what's
+// nearby. Coordinates are longitude/latitude in degrees.
+package geo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+var (
+	ErrUnsupportedGeometry = errors.New("geometry must be a Polygon or MultiPolygon")
+	ErrInvalidGeometry     = errors.New("invalid geometry")
+)
+
+// Point is a longitude/latitude pair.
+type Point struct {
+	Lon float64
+	Lat float64
+}
+
+// Ring is a closed line: its first and last points are the same.
+type Ring []Point
+
+// Polygon is an outer ring followed by any holes.
+type Polygon []Ring
+
+// MultiPolygon is every polygon of one area. Single polygons are stored as one too.
+type MultiPolygon []Polygon
+
+// BBox is an axis-aligned bounding box.
+type BBox struct {
+	MinLon, MinLat, MaxLon, MaxLat float64
+}
+
+func (b BBox) Contains(p Point) bool {
+	return p.Lon >= b.MinLon && p.Lon <= b.MaxLon && p.Lat >= b.MinLat && p.Lat <= b.MaxLat
+}
+
+func (b BBox) extend(other BBox) BBox {
+	return BBox{
+		MinLon: math.Min(b.MinLon, other.MinLon),
+		MinLat: math.Min(b.MinLat, other.MinLat),
+		MaxLon: math.Max(b.MaxLon, other.MaxLon),
+		MaxLat: math.Max(b.MaxLat, other.MaxLat),
+	}
+}
+
+func emptyBBox() BBox {
+	return BBox{MinLon: math.Inf(1), MinLat: math.Inf(1), MaxLon: math.Inf(-1), MaxLat: math.Inf(-1)}
+}
+
+// Bounds returns the box around every outer ring.
+func (m MultiPolygon) Bounds() BBox {
+	box := emptyBBox()
+	for _, polygon := range m {
+		for _, p := range polygon[0] {
+			box = box.extend(BBox{p.Lon, p.Lat, p.Lon, p.Lat})
+		}
+	}
+	return box
+}
+
+// Contains reports whether p lies inside any polygon and outside its holes.
+func (m MultiPolygon) Contains(p Point) bool {
+	for _, polygon := range m {
+		if !polygon[0].contains(p) {
+			continue
+		}
+		inHole := false
+		for _, hole := range polygon[1:] {
+			if hole.contains(p) {
+				inHole = true
+				break
+			}
+		}
+		if !inHole {
+			return true
+		}
+	}
+	return false
+}
+
+// contains is the even-odd ray casting test.
+func (r Ring) contains(p Point) bool {
+	inside := false
+	for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+		a, b := r[i], r[j]
+		if (a.Lat > p.Lat) != (b.Lat > p.Lat) &&
+			p.Lon < (b.Lon-a.Lon)*(p.Lat-a.Lat)/(b.Lat-a.Lat)+a.Lon {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// geometryJSON is a GeoJSON geometry object.
+type geometryJSON struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// ParseGeometry reads a GeoJSON Polygon or MultiPolygon.
+func ParseGeometry(data []byte) (MultiPolygon, error) {
+	var g geometryJSON
+	if err := json.Unmarshal(data, &g); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidGeometry, err)
+	}
+
+	var coordinates [][][][]float64
+	switch g.Type {
+	case "Polygon":
+		var polygon [][][]float64
+		if err := json.Unmarshal(g.Coordinates, &polygon); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidGeometry, err)
+		}
+		coordinates = [][][][]float64{polygon}
+	case "MultiPolygon":
+		if err := json.Unmarshal(g.Coordinates, &coordinates); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidGeometry, err)
+		}
+	default:
+		return nil, ErrUnsupportedGeometry
+	}
+
+	result := make(MultiPolygon, 0, len(coordinates))
+	for _, polygon := range coordinates {
+		if len(polygon) == 0 {
+			continue
+		}
+		rings := make(Polygon, 0, len(polygon))
+		for _, ring := range polygon {
+			points := make(Ring, 0, len(ring))
+			for _, position := range ring {
+				if len(position) < 2 || math.Abs(position[0]) > 180 || math.Abs(position[1]) > 90 {
+					return nil, fmt.Errorf("%w: position %v is not a longitude/latitude", ErrInvalidGeometry, position)
+				}
+				points = append(points, Point{Lon: position[0], Lat: position[1]})
+			}
+			if len(points) < 4 {
+				return nil, fmt.Errorf("%w: a ring needs at least four positions", ErrInvalidGeometry)
+			}
+			rings = append(rings, points)
+		}
+		result = append(result, rings)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("%w: no polygons", ErrInvalidGeometry)
+	}
+	return result, nil
+}
+
+// MarshalGeometry writes m as a GeoJSON MultiPolygon with coordinates rounded to the
+// given number of decimals (5 is about a metre).
+func MarshalGeometry(m MultiPolygon, decimals int) ([]byte, error) {
+	scale := math.Pow(10, float64(decimals))
+	coordinates := make([][][][2]float64, 0, len(m))
+	for _, polygon := range m {
+		rings := make([][][2]float64, 0, len(polygon))
+		for _, ring := range polygon {
+			positions := make([][2]float64, 0, len(ring))
+			for _, p := range ring {
+				positions = append(positions, [2]float64{math.Round(p.Lon*scale) / scale, math.Round(p.Lat*scale) / scale})
+			}
+			rings = append(rings, positions)
+		}
+		coordinates = append(coordinates, rings)
+	}
+	return json.Marshal(map[string]interface{}{"type": "MultiPolygon", "coordinates": coordinates})
+}
+
+// Feature is a GeoJSON feature with its geometry left unparsed.
+type Feature struct {
+	Properties map[string]interface{} `json:"properties"`
+	Geometry   json.RawMessage        `json:"geometry"`
+}
+
+// FeatureCollection is a GeoJSON FeatureCollection.
+type FeatureCollection struct {
+	Type     string    `json:"type"`
+	Features []Feature `json:"features"`
+}
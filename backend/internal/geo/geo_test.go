@@ -0,0 +1,107 @@
+package geo
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// square returns the ring around a box, anticlockwise from its south-west corner.
+func square(minLon, minLat, maxLon, maxLat float64) Ring {
+	return Ring{{minLon, minLat}, {maxLon, minLat}, {maxLon, maxLat}, {minLon, maxLat}, {minLon, minLat}}
+}
+
+func TestMultiPolygonContains(t *testing.T) {
+	// A 10° square with a hole in the middle, and a small square off to the east
+	withHole := MultiPolygon{{square(0, 0, 10, 10), square(4, 4, 6, 6)}, {square(20, 0, 22, 2)}}
+	// An L whose notch is inside its bounding box
+	ell := MultiPolygon{{Ring{{0, 0}, {4, 0}, {4, 1}, {1, 1}, {1, 4}, {0, 4}, {0, 0}}}}
+
+	tests := []struct {
+		name     string
+		geometry MultiPolygon
+		point    Point
+		want     bool
+	}{
+		{name: "inside", geometry: withHole, point: Point{1, 1}, want: true},
+		{name: "in the hole", geometry: withHole, point: Point{5, 5}, want: false},
+		// The ray passes through two of the hole's corners, which count once each
+		{name: "level with the hole's corners", geometry: withHole, point: Point{2, 4}, want: true},
+		{name: "second polygon", geometry: withHole, point: Point{21, 1}, want: true},
+		{name: "between the polygons", geometry: withHole, point: Point{15, 5}, want: false},
+		{name: "outside", geometry: withHole, point: Point{-1, 5}, want: false},
+		{name: "arm of the L", geometry: ell, point: Point{3, 0.5}, want: true},
+		{name: "other arm of the L", geometry: ell, point: Point{0.5, 3}, want: true},
+		{name: "notch of the L", geometry: ell, point: Point{2, 2}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.geometry.Contains(tt.point); got != tt.want {
+				t.Errorf("Contains(%v) = %v, want %v", tt.point, got, tt.want)
+			}
+		})
+	}
+
+	if got, want := withHole.Bounds(), (BBox{0, 0, 22, 10}); got != want {
+		t.Errorf("Bounds() = %v, want %v", got, want)
+	}
+}
+
+func TestParseGeometry(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want MultiPolygon
+		err  error
+	}{
+		{
+			name: "polygon",
+			json: `{"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [1, 1], [0, 0]]]}`,
+			want: MultiPolygon{{{{0, 0}, {1, 0}, {1, 1}, {0, 0}}}},
+		},
+		{
+			name: "multipolygon",
+			json: `{"type": "MultiPolygon", "coordinates": [[[[0, 0], [1, 0], [1, 1], [0, 0]]], [[[5, 5], [6, 5], [6, 6], [5, 5]]]]}`,
+			want: MultiPolygon{{{{0, 0}, {1, 0}, {1, 1}, {0, 0}}}, {{{5, 5}, {6, 5}, {6, 6}, {5, 5}}}},
+		},
+		{name: "point", json: `{"type": "Point", "coordinates": [0, 0]}`, err: ErrUnsupportedGeometry},
+		{name: "not json", json: `{"type": `, err: ErrInvalidGeometry},
+		{
+			name: "open ring",
+			json: `{"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [0, 0]]]}`,
+			err:  ErrInvalidGeometry,
+		},
+		{
+			name: "not a longitude",
+			json: `{"type": "Polygon", "coordinates": [[[0, 0], [200, 0], [1, 1], [0, 0]]]}`,
+			err:  ErrInvalidGeometry,
+		},
+		{name: "empty", json: `{"type": "MultiPolygon", "coordinates": []}`, err: ErrInvalidGeometry},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseGeometry([]byte(tt.json))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseGeometry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarshalGeometry(t *testing.T) {
+	data, err := MarshalGeometry(MultiPolygon{{{{77.123456, 28.654321}, {77.2, 28.6}, {77.2, 28.7}, {77.123456, 28.654321}}}}, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseGeometry(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := MultiPolygon{{{{77.12346, 28.65432}, {77.2, 28.6}, {77.2, 28.7}, {77.12346, 28.65432}}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip = %v, want %v", got, want)
+	}
+}
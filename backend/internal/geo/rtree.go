@@ -0,0 +1,136 @@
+package geo
+
+import (
+	"math"
+	"sort"
+)
+
+// rtreeFanout is how many entries each R-tree node holds.
+const rtreeFanout = 16
+
+// RTreeItem is an entry of an R-tree: a box and the caller's index of what it bounds.
+type RTreeItem struct {
+	Bounds BBox
+	Index  int
+}
+
+type rtreeNode struct {
+	bounds   BBox
+	children []*rtreeNode
+	items    []RTreeItem
+}
+
+// RTree is a read-only R-tree packed with the Sort-Tile-Recursive algorithm, which suits
+// boundaries that are loaded once and searched many times.
+type RTree struct {
+	root *rtreeNode
+	size int
+}
+
+// NewRTree packs the items into a tree.
+func NewRTree(items []RTreeItem) *RTree {
+	if len(items) == 0 {
+		return &RTree{}
+	}
+	items = append([]RTreeItem{}, items...)
+
+	leaves := make([]*rtreeNode, 0, len(items)/rtreeFanout+1)
+	for _, group := range tile(len(items), func(i int) BBox { return items[i].Bounds }, func(order []int) {
+		sorted := make([]RTreeItem, len(order))
+		for i, j := range order {
+			sorted[i] = items[j]
+		}
+		copy(items, sorted)
+	}) {
+		node := &rtreeNode{items: append([]RTreeItem{}, items[group[0]:group[1]]...), bounds: emptyBBox()}
+		for _, item := range node.items {
+			node.bounds = node.bounds.extend(item.Bounds)
+		}
+		leaves = append(leaves, node)
+	}
+
+	level := leaves
+	for len(level) > 1 {
+		nodes := level
+		var parents []*rtreeNode
+		for _, group := range tile(len(nodes), func(i int) BBox { return nodes[i].bounds }, func(order []int) {
+			sorted := make([]*rtreeNode, len(order))
+			for i, j := range order {
+				sorted[i] = nodes[j]
+			}
+			copy(nodes, sorted)
+		}) {
+			parent := &rtreeNode{children: append([]*rtreeNode{}, nodes[group[0]:group[1]]...), bounds: emptyBBox()}
+			for _, child := range parent.children {
+				parent.bounds = parent.bounds.extend(child.bounds)
+			}
+			parents = append(parents, parent)
+		}
+		level = parents
+	}
+	return &RTree{root: level[0], size: len(items)}
+}
+
+// tile orders n boxes into vertical slices by centre longitude, each sorted by centre
+// latitude, and returns the [start, end) ranges that make one node each.
+func tile(n int, bounds func(i int) BBox, reorder func(order []int)) [][2]int {
+	centre := func(i int) Point {
+		b := bounds(i)
+		return Point{Lon: (b.MinLon + b.MaxLon) / 2, Lat: (b.MinLat + b.MaxLat) / 2}
+	}
+
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return centre(order[a]).Lon < centre(order[b]).Lon })
+
+	nodes := int(math.Ceil(float64(n) / rtreeFanout))
+	sliceSize := int(math.Ceil(math.Sqrt(float64(nodes)))) * rtreeFanout
+	for start := 0; start < n; start += sliceSize {
+		slice := order[start:minInt(start+sliceSize, n)]
+		sort.Slice(slice, func(a, b int) bool { return centre(slice[a]).Lat < centre(slice[b]).Lat })
+	}
+	reorder(order)
+
+	var groups [][2]int
+	for start := 0; start < n; start += rtreeFanout {
+		groups = append(groups, [2]int{start, minInt(start+rtreeFanout, n)})
+	}
+	return groups
+}
+
+// Len returns how many items the tree holds.
+func (t *RTree) Len() int {
+	return t.size
+}
+
+// Search returns the indexes of the items whose box contains p.
+func (t *RTree) Search(p Point) []int {
+	var found []int
+	if t.root == nil {
+		return found
+	}
+	stack := []*rtreeNode{t.root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if !node.bounds.Contains(p) {
+			continue
+		}
+		for _, item := range node.items {
+			if item.Bounds.Contains(p) {
+				found = append(found, item.Index)
+			}
+		}
+		stack = append(stack, node.children...)
+	}
+	return found
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,80 @@
+package geo
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestRTreeSearch(t *testing.T) {
+	// A 30 by 30 grid of 1° cells, numbered row by row: 900 items make a tree three
+	// levels deep
+	const size = 30
+	var items []RTreeItem
+	for row := 0; row < size; row++ {
+		for col := 0; col < size; col++ {
+			items = append(items, RTreeItem{
+				Bounds: BBox{float64(col), float64(row), float64(col + 1), float64(row + 1)},
+				Index:  row*size + col,
+			})
+		}
+	}
+	tree := NewRTree(items)
+	if tree.Len() != len(items) {
+		t.Fatalf("Len() = %d, want %d", tree.Len(), len(items))
+	}
+
+	tests := []struct {
+		name  string
+		point Point
+		want  []int
+	}{
+		{name: "first cell", point: Point{0.5, 0.5}, want: []int{0}},
+		{name: "middle", point: Point{12.5, 7.5}, want: []int{7*size + 12}},
+		{name: "last cell", point: Point{29.5, 29.5}, want: []int{size*size - 1}},
+		// Boxes include their edges, so a shared corner is in four cells
+		{name: "corner", point: Point{1, 1}, want: []int{0, 1, size, size + 1}},
+		{name: "edge", point: Point{15, 20.5}, want: []int{20*size + 14, 20*size + 15}},
+		{name: "outside", point: Point{-1, 5}},
+		{name: "beyond", point: Point{31, 31}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tree.Search(tt.point)
+			sort.Ints(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Search(%v) = %v, want %v", tt.point, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRTreeOverlapping(t *testing.T) {
+	// Nested and overlapping boxes, as district boxes overlap their neighbours'
+	items := []RTreeItem{
+		{Bounds: BBox{0, 0, 10, 10}, Index: 0},
+		{Bounds: BBox{2, 2, 4, 4}, Index: 1},
+		{Bounds: BBox{3, 3, 12, 5}, Index: 2},
+		{Bounds: BBox{20, 20, 21, 21}, Index: 3},
+	}
+	tree := NewRTree(items)
+	points := []Point{{3.5, 3.5}, {1, 1}, {11, 4}, {20.5, 20.5}, {15, 15}}
+	for _, p := range points {
+		var want []int
+		for _, item := range items {
+			if item.Bounds.Contains(p) {
+				want = append(want, item.Index)
+			}
+		}
+		got := tree.Search(p)
+		sort.Ints(got)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Search(%v) = %v, want %v", p, got, want)
+		}
+	}
+
+	empty := NewRTree(nil)
+	if empty.Len() != 0 || len(empty.Search(Point{0, 0})) != 0 {
+		t.Errorf("empty tree: Len() = %d, Search() = %v", empty.Len(), empty.Search(Point{0, 0}))
+	}
+}
@@ -0,0 +1,110 @@
+package geo
+
+import "math"
+
+// ToleranceForZoom is the size of one pixel in degrees at a web map zoom level, which is
+// as much detail as a map drawn at that zoom can show.
+func ToleranceForZoom(zoom int) float64 {
+	return 360 / (256 * math.Pow(2, float64(zoom)))
+}
+
+// Simplify drops points that are closer than tolerance to the line through their
+// neighbours (Douglas-Peucker). Rings that collapse are dropped, holes first; the
+// largest polygon is always kept so nothing disappears from the map entirely.
+func Simplify(m MultiPolygon, tolerance float64) MultiPolygon {
+	result := make(MultiPolygon, 0, len(m))
+	largest, largestArea := -1, 0.0
+	for i, polygon := range m {
+		if area := math.Abs(polygon[0].area()); area > largestArea {
+			largest, largestArea = i, area
+		}
+
+		outer := polygon[0].simplify(tolerance)
+		if len(outer) < 4 {
+			continue
+		}
+		simplified := Polygon{outer}
+		for _, hole := range polygon[1:] {
+			if ring := hole.simplify(tolerance); len(ring) >= 4 {
+				simplified = append(simplified, ring)
+			}
+		}
+		result = append(result, simplified)
+	}
+
+	if len(result) == 0 && largest >= 0 {
+		result = append(result, Polygon{m[largest][0]})
+	}
+	return result
+}
+
+// simplify keeps the ring closed and at least a triangle when it can.
+func (r Ring) simplify(tolerance float64) Ring {
+	if len(r) <= 4 {
+		return r
+	}
+	keep := make([]bool, len(r))
+	keep[0], keep[len(r)-1] = true, true
+
+	// The first point is also the last, so split the ring at its farthest point and
+	// simplify the two halves as open lines
+	far, farDistance := 0, 0.0
+	for i := range r {
+		if d := distance(r[0], r[i]); d > farDistance {
+			far, farDistance = i, d
+		}
+	}
+	keep[far] = true
+	douglasPeucker(r, 0, far, tolerance, keep)
+	douglasPeucker(r, far, len(r)-1, tolerance, keep)
+
+	result := make(Ring, 0, len(r))
+	for i, p := range r {
+		if keep[i] {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+func douglasPeucker(points []Point, first, last int, tolerance float64, keep []bool) {
+	if last-first < 2 {
+		return
+	}
+	index, maxDistance := -1, tolerance
+	for i := first + 1; i < last; i++ {
+		if d := segmentDistance(points[i], points[first], points[last]); d > maxDistance {
+			index, maxDistance = i, d
+		}
+	}
+	if index < 0 {
+		return
+	}
+	keep[index] = true
+	douglasPeucker(points, first, index, tolerance, keep)
+	douglasPeucker(points, index, last, tolerance, keep)
+}
+
+// area is the ring's signed area in square degrees (shoelace formula).
+func (r Ring) area() float64 {
+	var sum float64
+	for i := 0; i+1 < len(r); i++ {
+		sum += r[i].Lon*r[i+1].Lat - r[i+1].Lon*r[i].Lat
+	}
+	return sum / 2
+}
+
+func distance(a, b Point) float64 {
+	return math.Hypot(a.Lon-b.Lon, a.Lat-b.Lat)
+}
+
+// segmentDistance is the distance from p to the segment ab.
+func segmentDistance(p, a, b Point) float64 {
+	dx, dy := b.Lon-a.Lon, b.Lat-a.Lat
+	if dx == 0 && dy == 0 {
+		return distance(p, a)
+	}
+	t := ((p.Lon-a.Lon)*dx + (p.Lat-a.Lat)*dy) / (dx*dx + dy*dy)
+	t = math.Max(0, math.Min(1, t))
+	return distance(p, Point{Lon: a.Lon + t*dx, Lat: a.Lat + t*dy})
+}
@@ -0,0 +1,79 @@
+package geo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSimplify(t *testing.T) {
+	tests := []struct {
+		name      string
+		geometry  MultiPolygon
+		tolerance float64
+		want      MultiPolygon
+	}{
+		{
+			name:      "points on the edges",
+			geometry:  MultiPolygon{{Ring{{0, 0}, {5, 0}, {10, 0}, {10, 5}, {10, 10}, {5, 10}, {0, 10}, {0, 5}, {0, 0}}}},
+			tolerance: 0.1,
+			want:      MultiPolygon{{square(0, 0, 10, 10)}},
+		},
+		{
+			name:      "bend above the tolerance",
+			geometry:  MultiPolygon{{Ring{{0, 0}, {5, -0.5}, {10, 0}, {10, 10}, {0, 10}, {0, 0}}}},
+			tolerance: 0.1,
+			want:      MultiPolygon{{Ring{{0, 0}, {5, -0.5}, {10, 0}, {10, 10}, {0, 10}, {0, 0}}}},
+		},
+		{
+			name:      "bend below the tolerance",
+			geometry:  MultiPolygon{{Ring{{0, 0}, {5, -0.5}, {10, 0}, {10, 10}, {0, 10}, {0, 0}}}},
+			tolerance: 1,
+			want:      MultiPolygon{{square(0, 0, 10, 10)}},
+		},
+		{
+			// The hole simplifies to a line and goes; the outer ring is too short to touch
+			name:      "collapsed hole",
+			geometry:  MultiPolygon{{square(0, 0, 10, 10), Ring{{4, 4}, {5, 4.01}, {6, 4}, {5, 3.99}, {4, 4}}}},
+			tolerance: 0.1,
+			want:      MultiPolygon{{square(0, 0, 10, 10)}},
+		},
+		{
+			// Both slivers collapse, so the larger one is kept as it was
+			name: "everything collapses",
+			geometry: MultiPolygon{
+				{Ring{{0, 0}, {0.1, 0.01}, {0.2, 0}, {0.1, -0.01}, {0, 0}}},
+				{Ring{{5, 5}, {5.3, 5.02}, {5.6, 5}, {5.3, 4.98}, {5, 5}}},
+			},
+			tolerance: 1,
+			want:      MultiPolygon{{Ring{{5, 5}, {5.3, 5.02}, {5.6, 5}, {5.3, 4.98}, {5, 5}}}},
+		},
+		{
+			name:      "triangle",
+			geometry:  MultiPolygon{{Ring{{0, 0}, {1, 0}, {0, 1}, {0, 0}}}},
+			tolerance: 100,
+			want:      MultiPolygon{{Ring{{0, 0}, {1, 0}, {0, 1}, {0, 0}}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Simplify(tt.geometry, tt.tolerance); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Simplify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToleranceForZoom(t *testing.T) {
+	tests := []struct {
+		zoom int
+		want float64
+	}{
+		{0, 360.0 / 256},
+		{8, 360.0 / 65536},
+	}
+	for _, tt := range tests {
+		if got := ToleranceForZoom(tt.zoom); got != tt.want {
+			t.Errorf("ToleranceForZoom(%d) = %g, want %g", tt.zoom, got, tt.want)
+		}
+	}
+}
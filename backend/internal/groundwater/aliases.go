@@ -0,0 +1,108 @@
+package groundwater
+
+// aliasGroup lists names that mean the same place: abbreviations, names from before a
+// renaming and the Hindi name. A group with a state only applies to units in that state,
+// for names like Aurangabad that exist in more than one state but were renamed in one.
+type aliasGroup struct {
+	state string
+	names []string
+}
+
+// Abbreviations (all capitals, such as "UP") only match when the text writes them in
+// capitals too, or when they are the whole query.
+var placeAliases = []aliasGroup{
+	// States and union territories
+	{names: []string{"Uttar Pradesh", "UP", "उत्तर प्रदेश"}},
+	{names: []string{"Madhya Pradesh", "MP", "मध्य प्रदेश"}},
+	{names: []string{"Himachal Pradesh", "HP", "हिमाचल प्रदेश"}},
+	{names: []string{"Andhra Pradesh", "AP", "आंध्र प्रदेश"}},
+	{names: []string{"Arunachal Pradesh", "अरुणाचल प्रदेश"}},
+	{names: []string{"Tamil Nadu", "TN", "तमिलनाडु"}},
+	{names: []string{"West Bengal", "WB", "पश्चिम बंगाल"}},
+	{names: []string{"Jammu and Kashmir", "J&K", "JK", "जम्मू और कश्मीर", "जम्मू कश्मीर"}},
+	{names: []string{"Uttarakhand", "Uttaranchal", "उत्तराखंड"}},
+	{names: []string{"Odisha", "Orissa", "ओडिशा", "उड़ीसा"}},
+	{names: []string{"Puducherry", "Pondicherry", "पुडुचेरी"}},
+	{names: []string{"Delhi", "NCT of Delhi", "दिल्ली"}},
+	{names: []string{"Punjab", "पंजाब"}},
+	{names: []string{"Haryana", "हरियाणा"}},
+	{names: []string{"Rajasthan", "राजस्थान"}},
+	{names: []string{"Gujarat", "गुजरात"}},
+	{names: []string{"Maharashtra", "महाराष्ट्र"}},
+	{names: []string{"Bihar", "बिहार"}},
+	{names: []string{"Jharkhand", "झारखंड"}},
+	{names: []string{"Chhattisgarh", "Chattisgarh", "छत्तीसगढ़"}},
+	{names: []string{"Karnataka", "Mysore State", "कर्नाटक"}},
+	{names: []string{"Kerala", "केरल"}},
+	{names: []string{"Telangana", "तेलंगाना"}},
+	{names: []string{"Assam", "असम"}},
+	{names: []string{"Goa", "गोवा"}},
+
+	// Renamed districts
+	{state: "haryana", names: []string{"Gurugram", "Gurgaon", "गुरुग्राम", "गुड़गांव"}},
+	{state: "haryana", names: []string{"Nuh", "Mewat"}},
+	{state: "uttar pradesh", names: []string{"Prayagraj", "Allahabad", "प्रयागराज", "इलाहाबाद"}},
+	{state: "uttar pradesh", names: []string{"Ayodhya", "Faizabad", "अयोध्या", "फैजाबाद"}},
+	{state: "madhya pradesh", names: []string{"Narmadapuram", "Hoshangabad"}},
+	{state: "maharashtra", names: []string{"Chhatrapati Sambhajinagar", "Aurangabad"}},
+	{state: "maharashtra", names: []string{"Dharashiv", "Osmanabad"}},
+	{state: "maharashtra", names: []string{"Mumbai Suburban", "Bombay Suburban"}},
+	{state: "maharashtra", names: []string{"Mumbai City", "Mumbai", "Bombay"}},
+	{state: "karnataka", names: []string{"Bengaluru Urban", "Bangalore Urban", "Bengaluru", "Bangalore"}},
+	{state: "karnataka", names: []string{"Bengaluru Rural", "Bangalore Rural"}},
+	{state: "karnataka", names: []string{"Mysuru", "Mysore"}},
+	{state: "karnataka", names: []string{"Belagavi", "Belgaum"}},
+	{state: "karnataka", names: []string{"Kalaburagi", "Gulbarga"}},
+	{state: "karnataka", names: []string{"Shivamogga", "Shimoga"}},
+	{state: "karnataka", names: []string{"Ballari", "Bellary"}},
+	{state: "karnataka", names: []string{"Vijayapura", "Bijapur"}},
+	{state: "karnataka", names: []string{"Tumakuru", "Tumkur"}},
+	{state: "kerala", names: []string{"Thiruvananthapuram", "Trivandrum"}},
+	{state: "kerala", names: []string{"Kozhikode", "Calicut"}},
+	{state: "tamil nadu", names: []string{"Chennai", "Madras"}},
+	{state: "tamil nadu", names: []string{"Thoothukudi", "Tuticorin"}},
+	{state: "west bengal", names: []string{"Kolkata", "Calcutta"}},
+	{state: "gujarat", names: []string{"Vadodara", "Baroda"}},
+	{state: "punjab", names: []string{"Rupnagar", "Ropar"}},
+	{state: "punjab", names: []string{"Shahid Bhagat Singh Nagar", "SBS Nagar", "Nawanshahr"}},
+	{state: "punjab", names: []string{"Sahibzada Ajit Singh Nagar", "SAS Nagar", "Mohali"}},
+	{state: "punjab", names: []string{"Sri Muktsar Sahib", "Muktsar"}},
+}
+
+// placeAlias is another name a unit can be found by.
+type placeAlias struct {
+	name         string
+	key          string
+	abbreviation bool
+}
+
+// aliasesByKey maps a folded name to its groups' other names, by the state they are
+// limited to ("" for any state).
+var aliasesByKey = func() map[string]map[string][]placeAlias {
+	index := map[string]map[string][]placeAlias{}
+	for _, group := range placeAliases {
+		state := UnitPath(group.state)
+		for _, name := range group.names {
+			key := foldName(name)
+			if index[key] == nil {
+				index[key] = map[string][]placeAlias{}
+			}
+			for _, other := range group.names {
+				if other != name {
+					index[key][state] = append(index[key][state], placeAlias{
+						name:         other,
+						key:          foldName(other),
+						abbreviation: isAbbreviation(other),
+					})
+				}
+			}
+		}
+	}
+	return index
+}()
+
+// aliasesFor returns the other names of a unit called name in the given state.
+func aliasesFor(name, state string) []placeAlias {
+	byState := aliasesByKey[foldName(name)]
+	return append(append([]placeAlias{}, byState[""]...), byState[state]...)
+}
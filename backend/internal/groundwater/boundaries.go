@@ -0,0 +1,396 @@
+package groundwater
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/auth"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/database"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/geo"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+)
+
+// BoundaryZooms are the web map zoom levels simplified boundaries are stored for.
+var BoundaryZooms = []int{4, 6, 8, 10}
+
+var (
+	ErrNoBoundary               = errors.New("no boundary for this unit")
+	ErrInvalidFeatureCollection = errors.New("body must be a GeoJSON FeatureCollection")
+	ErrInvalidLevel             = errors.New("level must be state, district or block")
+)
+
+// Feature properties names are looked up in, case-insensitively, when an import doesn't
+// name them. They cover the usual Survey of India, LGD and census-derived layers.
+var (
+	stateProperties    = []string{"state", "st_nm", "state_name", "stname", "state_ut"}
+	districtProperties = []string{"district", "dtname", "district_name", "dist_name", "distname"}
+	blockProperties    = []string{"block", "block_name", "blockname", "block_nam", "tehsil", "taluk", "mandal", "sub_dist", "sdtname"}
+	codeProperties     = []string{"code", "lgd_code", "block_code", "district_code", "state_code", "censuscode"}
+)
+
+// BoundaryImportOptions describe a GeoJSON upload. Every feature is one unit of Level.
+type BoundaryImportOptions struct {
+	Level  models.UnitLevel
+	Source string
+	// Property names to read; empty ones fall back to the usual names
+	NameProperty     string
+	StateProperty    string
+	DistrictProperty string
+	CodeProperty     string
+}
+
+// BoundaryImportReport says which features were stored. An issue's Line is the
+// feature's position in the collection, from 1.
+type BoundaryImportReport struct {
+	Features int     `json:"features"`
+	Imported int     `json:"imported"`
+	Skipped  int     `json:"skipped"`
+	Issues   []Issue `json:"issues"`
+}
+
+// ImportBoundaries stores the boundaries of a FeatureCollection against the units they
+// name, replacing earlier boundaries of the same units.
+func (s *Service) ImportBoundaries(ctx context.Context, data []byte, opts BoundaryImportOptions, adminID uuid.UUID, client auth.ClientInfo) (*BoundaryImportReport, error) {
+	if opts.Level != models.LevelState && opts.Level != models.LevelDistrict && opts.Level != models.LevelBlock {
+		return nil, ErrInvalidLevel
+	}
+	var collection geo.FeatureCollection
+	if err := json.Unmarshal(data, &collection); err != nil || collection.Type != "FeatureCollection" {
+		return nil, ErrInvalidFeatureCollection
+	}
+
+	units, err := s.unitKeys(ctx, opts.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &BoundaryImportReport{Features: len(collection.Features), Issues: []Issue{}}
+	skip := func(feature int, format string, args ...interface{}) {
+		report.Skipped++
+		report.Issues = append(report.Issues, Issue{Line: feature, Severity: SeverityError, Message: fmt.Sprintf(format, args...)})
+	}
+
+	err = s.db.WithTransaction(ctx, func(tx *sql.Tx) error {
+		for i, feature := range collection.Features {
+			unitID, label, ok := units.match(feature.Properties, opts)
+			if !ok {
+				skip(i+1, "no %s matches %s", opts.Level, label)
+				continue
+			}
+			shape, err := geo.ParseGeometry(feature.Geometry)
+			if err != nil {
+				skip(i+1, "%s: %v", label, err)
+				continue
+			}
+			if err := storeBoundary(ctx, tx, unitID, shape, opts.Source); err != nil {
+				return fmt.Errorf("feature %d: %w", i+1, err)
+			}
+			report.Imported++
+		}
+
+		if report.Imported == 0 {
+			return nil
+		}
+		return database.RecordAudit(ctx, tx, database.AuditEntry{
+			UserID:       adminID.String(),
+			Action:       "groundwater.boundaries_imported",
+			ResourceType: "groundwater_boundaries",
+			ResourceID:   string(opts.Level),
+			NewValues: map[string]interface{}{
+				"source":   opts.Source,
+				"imported": report.Imported,
+				"skipped":  report.Skipped,
+			},
+			IPAddress: client.IPAddress,
+			UserAgent: client.UserAgent,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("boundary import error: %w", err)
+	}
+	return report, nil
+}
+
+func storeBoundary(ctx context.Context, tx *sql.Tx, unitID uuid.UUID, shape geo.MultiPolygon, source string) error {
+	full, err := geo.MarshalGeometry(shape, 6)
+	if err != nil {
+		return err
+	}
+	box := shape.Bounds()
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO groundwater_boundaries (unit_id, geometry, min_lon, min_lat, max_lon, max_lat, source, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+		ON CONFLICT (unit_id) DO UPDATE SET geometry = EXCLUDED.geometry, min_lon = EXCLUDED.min_lon,
+			min_lat = EXCLUDED.min_lat, max_lon = EXCLUDED.max_lon, max_lat = EXCLUDED.max_lat,
+			source = EXCLUDED.source, updated_at = EXCLUDED.updated_at`,
+		unitID, string(full), box.MinLon, box.MinLat, box.MaxLon, box.MaxLat, source); err != nil {
+		return err
+	}
+
+	for _, zoom := range BoundaryZooms {
+		simplified, err := geo.MarshalGeometry(geo.Simplify(shape, geo.ToleranceForZoom(zoom)), 5)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO groundwater_boundary_shapes (unit_id, zoom, geometry) VALUES ($1, $2, $3)
+			ON CONFLICT (unit_id, zoom) DO UPDATE SET geometry = EXCLUDED.geometry`,
+			unitID, zoom, string(simplified)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unitKeys finds the units of one level by code and by their folded path, so boundary
+// files that spell names a little differently from the assessments still match.
+type unitKeys struct {
+	level  models.UnitLevel
+	byCode map[string]uuid.UUID
+	byPath map[string]uuid.UUID
+}
+
+func (s *Service) unitKeys(ctx context.Context, level models.UnitLevel) (*unitKeys, error) {
+	rows, err := s.db.DB.QueryContext(ctx, "SELECT id, path, code FROM groundwater_units WHERE level = $1", level)
+	if err != nil {
+		return nil, fmt.Errorf("unit list error: %w", err)
+	}
+	defer rows.Close()
+
+	keys := &unitKeys{level: level, byCode: map[string]uuid.UUID{}, byPath: map[string]uuid.UUID{}}
+	for rows.Next() {
+		var id uuid.UUID
+		var path string
+		var code sql.NullString
+		if err := rows.Scan(&id, &path, &code); err != nil {
+			return nil, err
+		}
+		if code.Valid && code.String != "" {
+			keys.byCode[strings.ToLower(code.String)] = id
+		}
+		keys.byPath[foldPath(strings.Split(path, "/")...)] = id
+	}
+	return keys, rows.Err()
+}
+
+func foldPath(names ...string) string {
+	folded := make([]string, len(names))
+	for i, name := range names {
+		folded[i] = foldName(name)
+	}
+	return strings.Join(folded, "/")
+}
+
+// match finds a feature's unit, returning a label for the feature to report it by.
+func (k *unitKeys) match(properties map[string]interface{}, opts BoundaryImportOptions) (uuid.UUID, string, bool) {
+	lookup := func(name string, fallbacks []string) string {
+		if name != "" {
+			fallbacks = []string{name}
+		}
+		for _, key := range fallbacks {
+			for property, value := range properties {
+				if !strings.EqualFold(property, key) || value == nil {
+					continue
+				}
+				// JSON numbers decode as float64; codes must not come out as 1.234567e+06
+				if number, ok := value.(float64); ok {
+					return strconv.FormatFloat(number, 'f', -1, 64)
+				}
+				return strings.TrimSpace(fmt.Sprint(value))
+			}
+		}
+		return ""
+	}
+
+	if code := lookup(opts.CodeProperty, codeProperties); code != "" {
+		if id, ok := k.byCode[strings.ToLower(code)]; ok {
+			return id, code, true
+		}
+	}
+
+	nameFallbacks := map[models.UnitLevel][]string{
+		models.LevelState:    stateProperties,
+		models.LevelDistrict: districtProperties,
+		models.LevelBlock:    blockProperties,
+	}[k.level]
+	name := lookup(opts.NameProperty, append(nameFallbacks, "name"))
+	names := []string{name}
+	switch k.level {
+	case models.LevelDistrict:
+		names = []string{lookup(opts.StateProperty, stateProperties), name}
+	case models.LevelBlock:
+		names = []string{lookup(opts.StateProperty, stateProperties), lookup(opts.DistrictProperty, districtProperties), name}
+	}
+	label := strings.Join(names, " / ")
+	for _, n := range names {
+		if n == "" {
+			return uuid.Nil, fmt.Sprintf("%q (missing names)", label), false
+		}
+	}
+
+	id, ok := k.byPath[foldPath(names...)]
+	return id, fmt.Sprintf("%q", label), ok
+}
+
+// Boundary returns a unit's boundary as a GeoJSON geometry, simplified for the zoom
+// level. Zooms past the most detailed simplification, or 0, get the full geometry.
+func (s *Service) Boundary(ctx context.Context, unitID uuid.UUID, zoom int) (json.RawMessage, error) {
+	var geometry string
+	var err error
+	if zoom > 0 && zoom <= BoundaryZooms[len(BoundaryZooms)-1] {
+		// The least detailed copy that is still detailed enough for the zoom
+		err = s.db.DB.QueryRowContext(ctx, `
+			SELECT geometry FROM groundwater_boundary_shapes
+			WHERE unit_id = $1 AND zoom >= $2 ORDER BY zoom LIMIT 1`, unitID, zoom).Scan(&geometry)
+	} else {
+		err = s.db.DB.QueryRowContext(ctx,
+			"SELECT geometry FROM groundwater_boundaries WHERE unit_id = $1", unitID).Scan(&geometry)
+	}
+	if err == sql.ErrNoRows {
+		return nil, ErrNoBoundary
+	} else if err != nil {
+		return nil, fmt.Errorf("boundary lookup error: %w", err)
+	}
+	return json.RawMessage(geometry), nil
+}
+
+// boundaryIndex is every stored boundary behind an R-tree of their boxes.
+type boundaryIndex struct {
+	tree   *geo.RTree
+	units  []models.AssessmentUnit
+	shapes []geo.MultiPolygon
+}
+
+// boundaryIndexCache keeps the index until boundaries are added or replaced.
+type boundaryIndexCache struct {
+	mu      sync.Mutex
+	version string
+	index   *boundaryIndex
+}
+
+// boundaryVersion changes whenever boundaries are added or replaced.
+func (s *Service) boundaryVersion(ctx context.Context) (string, error) {
+	var count int
+	var updatedAt time.Time
+	if err := s.db.DB.QueryRowContext(ctx, `
+		SELECT COUNT(*), COALESCE(MAX(updated_at), 'epoch'::timestamp) FROM groundwater_boundaries`).
+		Scan(&count, &updatedAt); err != nil {
+		return "", fmt.Errorf("boundary version lookup error: %w", err)
+	}
+	return fmt.Sprintf("%d@%d", count, updatedAt.UnixNano()), nil
+}
+
+func (s *Service) boundaryIndex(ctx context.Context) (*boundaryIndex, error) {
+	version, err := s.boundaryVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := &s.boundaries
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.index != nil && cache.version == version {
+		return cache.index, nil
+	}
+
+	rows, err := s.db.DB.QueryContext(ctx, `
+		SELECT `+unitColumns+`, b.geometry
+		FROM groundwater_boundaries b JOIN groundwater_units u ON u.id = b.unit_id`)
+	if err != nil {
+		return nil, fmt.Errorf("boundary list error: %w", err)
+	}
+	defer rows.Close()
+
+	index := &boundaryIndex{}
+	var items []geo.RTreeItem
+	for rows.Next() {
+		var unit models.AssessmentUnit
+		var geometry []byte
+		if err := rows.Scan(&unit.ID, &unit.ParentID, &unit.Level, &unit.Name, &unit.Path, &unit.Code,
+			&unit.CreatedAt, &geometry); err != nil {
+			return nil, err
+		}
+		shape, err := geo.ParseGeometry(geometry)
+		if err != nil {
+			s.logger.WithError(err).WithField("unit_id", unit.ID).Warn("Skipping unreadable boundary")
+			continue
+		}
+		items = append(items, geo.RTreeItem{Bounds: shape.Bounds(), Index: len(index.units)})
+		index.units = append(index.units, unit)
+		index.shapes = append(index.shapes, shape)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	index.tree = geo.NewRTree(items)
+	cache.index, cache.version = index, version
+	return index, nil
+}
+
+// Locate returns the units whose boundaries contain the point, the most local first:
+// block, then district, then state. It's empty outside every stored boundary.
+func (s *Service) Locate(ctx context.Context, point geo.Point) ([]models.AssessmentUnit, error) {
+	index, err := s.boundaryIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	units := []models.AssessmentUnit{}
+	for _, i := range index.tree.Search(point) {
+		if index.shapes[i].Contains(point) {
+			units = append(units, index.units[i])
+		}
+	}
+	sort.Slice(units, func(i, j int) bool {
+		return strings.Count(units[i].Path, "/") > strings.Count(units[j].Path, "/")
+	})
+	return units, nil
+}
+
+// DescribeLocation answers a shared location with the groundwater status of the unit it
+// falls in and how the water table moved in the wells around it, as chat replies do.
+func (s *Service) DescribeLocation(ctx context.Context, location models.GeoPoint) (string, error) {
+	units, err := s.Locate(ctx, geo.Point{Lon: location.Longitude, Lat: location.Latitude})
+	if err != nil {
+		return "", err
+	}
+	waterTable := s.nearbyWaterTable(ctx, location)
+	if len(units) == 0 {
+		return joinSentences("That location isn't inside any area we have groundwater assessments for.", waterTable), nil
+	}
+
+	names := make([]string, 0, len(units))
+	for _, unit := range units {
+		names = append(names, unit.Name)
+	}
+	place := strings.Join(names, ", ")
+
+	r, err := s.rollup(ctx, units[0].ID)
+	if err != nil {
+		return "", err
+	}
+	latest, ok := r.latest()
+	if !ok {
+		return joinSentences(fmt.Sprintf("You are in %s. There is no groundwater assessment for this %s yet.",
+			place, units[0].Level), waterTable), nil
+	}
+	return joinSentences(fmt.Sprintf("You are in %s. In the %d assessment this %s was %s: extraction was %.0f%% of the extractable groundwater.",
+		place, latest.Year, units[0].Level, CategoryLabel(latest.Category), latest.StageOfExtraction), waterTable), nil
+}
+
+func joinSentences(first, second string) string {
+	if second == "" {
+		return first
+	}
+	return first + " " + second
+}
@@ -0,0 +1,274 @@
+package groundwater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/google/uuid"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+)
+
+var (
+	ErrUnknownVolumeUnit = errors.New("volume unit must be ham, mcm or bcm")
+	ErrYearNotAssessed   = errors.New("no assessment for that year")
+)
+
+// sparklineYears is how many years KPI sparklines and growth factors look back.
+const sparklineYears = 10
+
+// ChartOptions pick the year and volume unit of a unit's charts.
+type ChartOptions struct {
+	// Year defaults to the unit's latest assessed year
+	Year int
+	// VolumeUnit is ham, mcm or bcm; states default to bcm and smaller units to mcm
+	VolumeUnit string
+}
+
+// Charts returns the unit's chart data, rolled up from the units below it for years the
+// unit wasn't assessed itself.
+func (s *Service) Charts(ctx context.Context, unitID uuid.UUID, opts ChartOptions) (*models.UnitCharts, error) {
+	r, err := s.rollup(ctx, unitID)
+	if err != nil {
+		return nil, err
+	}
+
+	volumeUnit := opts.VolumeUnit
+	if volumeUnit == "" {
+		volumeUnit = "mcm"
+		if r.unit.Level == models.LevelState {
+			volumeUnit = "bcm"
+		}
+	}
+	scale, ok := unitScales[volumeUnit]
+	if !ok {
+		return nil, ErrUnknownVolumeUnit
+	}
+
+	current, ok := r.latest()
+	if opts.Year != 0 {
+		current, ok = r.year(opts.Year)
+	}
+	if !ok {
+		return nil, ErrYearNotAssessed
+	}
+
+	// Charts only look at the years up to the one asked for
+	var history []yearBalance
+	for _, b := range r.years {
+		if b.Year <= current.Year {
+			history = append(history, b)
+		}
+	}
+
+	return &models.UnitCharts{
+		Unit:           r.unit,
+		Year:           current.Year,
+		Category:       current.Category,
+		VolumeUnit:     volumeUnit,
+		DatasetVersion: r.version,
+		Trend:          trendChart(history, scale),
+		Recharge:       rechargeChart(current, scale),
+		Sectors:        sectorChart(current),
+		Risk:           riskChart(r.unit, history),
+		KPIs:           kpiChart(history, volumeUnit, scale),
+	}, nil
+}
+
+func trendChart(history []yearBalance, scale float64) []models.TrendPoint {
+	points := make([]models.TrendPoint, 0, len(history))
+	for _, b := range history {
+		recharge := round(b.AnnualRecharge/scale, 2)
+		net := round((b.AnnualRecharge-b.TotalExtraction)/scale, 2)
+		points = append(points, models.TrendPoint{
+			Year:       b.Year,
+			Extraction: round(b.TotalExtraction/scale, 2),
+			Recharge:   &recharge,
+			Net:        &net,
+		})
+	}
+	return points
+}
+
+func rechargeChart(b *yearBalance, scale float64) []models.ChartSlice {
+	if b.RechargeRainfall == nil && b.RechargeOther == nil {
+		return []models.ChartSlice{{Name: "Annual recharge", Value: round(b.AnnualRecharge/scale, 2), Color: "#10b981"}}
+	}
+
+	slices := []models.ChartSlice{}
+	if b.RechargeRainfall != nil {
+		slices = append(slices, models.ChartSlice{Name: "Rainfall", Value: round(*b.RechargeRainfall/scale, 2), Color: "#10b981"})
+	}
+	if b.RechargeOther != nil {
+		slices = append(slices, models.ChartSlice{Name: "Other sources", Value: round(*b.RechargeOther/scale, 2), Color: "#0ea5e9"})
+	}
+	return slices
+}
+
+func sectorChart(b *yearBalance) []models.SectorUsage {
+	sectors := []models.SectorUsage{}
+	if b.TotalExtraction <= 0 {
+		return sectors
+	}
+	for _, sector := range []struct {
+		name  string
+		value *float64
+	}{
+		{"Irrigation", b.ExtractionIrrigation},
+		{"Industrial", b.ExtractionIndustrial},
+		{"Domestic", b.ExtractionDomestic},
+	} {
+		if sector.value != nil {
+			sectors = append(sectors, models.SectorUsage{Sector: sector.name, Value: round(*sector.value/b.TotalExtraction*100, 1)})
+		}
+	}
+	return sectors
+}
+
+// riskChart scores what the data can tell about a unit's risk. Factors without enough
+// data are left out rather than scored as zero.
+func riskChart(unit models.AssessmentUnit, history []yearBalance) []models.RiskFactor {
+	current := history[len(history)-1]
+	factors := []models.RiskFactor{
+		// 150% of the extractable resource or more scores 100
+		{Factor: "Stage of Extraction", Score: clampScore(current.StageOfExtraction / 1.5)},
+	}
+
+	// Growth of 5% a year scores 100, a 5% yearly decline scores 0
+	recent := history
+	if len(recent) > sparklineYears {
+		recent = recent[len(recent)-sparklineYears:]
+	}
+	first := recent[0]
+	if growth, ok := annualGrowth(first.Year, first.TotalExtraction, current.Year, current.TotalExtraction); ok {
+		factors = append(factors, models.RiskFactor{Factor: "Extraction Growth", Score: clampScore(50 + 10*growth)})
+	}
+	if growth, ok := annualGrowth(first.Year, first.AnnualRecharge, current.Year, current.AnnualRecharge); ok {
+		factors = append(factors, models.RiskFactor{Factor: "Recharge Decline", Score: clampScore(50 - 10*growth)})
+	}
+
+	if current.ExtractionIrrigation != nil && current.TotalExtraction > 0 {
+		factors = append(factors, models.RiskFactor{
+			Factor: "Irrigation Dependence",
+			Score:  clampScore(*current.ExtractionIrrigation / current.TotalExtraction * 100),
+		})
+	}
+	if current.FutureAvailability != nil && current.ExtractableResource > 0 {
+		factors = append(factors, models.RiskFactor{
+			Factor: "Future Scarcity",
+			Score:  clampScore(100 - *current.FutureAvailability/current.ExtractableResource*100),
+		})
+	}
+
+	if unit.Level != models.LevelBlock {
+		var total, stressed int
+		for category, n := range current.categories {
+			total += n
+			if category == models.CategoryCritical || category == models.CategoryOverExploited {
+				stressed += n
+			}
+		}
+		if total > 1 {
+			factors = append(factors, models.RiskFactor{
+				Factor: "Stressed Units",
+				Score:  clampScore(float64(stressed) / float64(total) * 100),
+			})
+		}
+	}
+	return factors
+}
+
+func kpiChart(history []yearBalance, volumeUnit string, scale float64) []models.KPIItem {
+	recent := history
+	if len(recent) > sparklineYears {
+		recent = recent[len(recent)-sparklineYears:]
+	}
+	current := recent[len(recent)-1]
+	var previous *yearBalance
+	if len(recent) > 1 {
+		previous = &recent[len(recent)-2]
+	}
+
+	series := func(value func(b yearBalance) float64, decimals int) []float64 {
+		values := make([]float64, 0, len(recent))
+		for _, b := range recent {
+			values = append(values, round(value(b), decimals))
+		}
+		return values
+	}
+	percentChange := func(value func(b yearBalance) float64) *float64 {
+		if previous == nil || value(*previous) == 0 {
+			return nil
+		}
+		change := round((value(current)-value(*previous))/math.Abs(value(*previous))*100, 1)
+		return &change
+	}
+
+	stage := func(b yearBalance) float64 { return b.StageOfExtraction }
+	extraction := func(b yearBalance) float64 { return b.TotalExtraction / scale }
+	recharge := func(b yearBalance) float64 { return b.AnnualRecharge / scale }
+	net := func(b yearBalance) float64 { return (b.AnnualRecharge - b.TotalExtraction) / scale }
+
+	// The stage changes by percentage points, not by percent
+	var stageChange *float64
+	if previous != nil {
+		change := round(current.StageOfExtraction-previous.StageOfExtraction, 1)
+		stageChange = &change
+	}
+
+	label := map[string]string{"ham": "ham", "mcm": "MCM", "bcm": "BCM"}[volumeUnit]
+	return []models.KPIItem{
+		{
+			Label:     "Stage",
+			Value:     fmt.Sprintf("%.0f%%", current.StageOfExtraction),
+			Change:    stageChange,
+			Sparkline: series(stage, 1),
+			Color:     CategoryColor(current.Category),
+		},
+		{
+			Label:     "Extraction",
+			Value:     fmt.Sprintf("%.2f %s", extraction(current), label),
+			Change:    percentChange(extraction),
+			Sparkline: series(extraction, 2),
+			Color:     "#6366f1",
+		},
+		{
+			Label:     "Recharge",
+			Value:     fmt.Sprintf("%.2f %s", recharge(current), label),
+			Change:    percentChange(recharge),
+			Sparkline: series(recharge, 2),
+			Color:     "#10b981",
+		},
+		{
+			Label:     "Net Balance",
+			Value:     fmt.Sprintf("%.2f %s", net(current), label),
+			Change:    percentChange(net),
+			Sparkline: series(net, 2),
+			Color:     "#3b82f6",
+		},
+		{
+			Label: "Category",
+			Value: CategoryLabel(current.Category),
+			Color: CategoryColor(current.Category),
+		},
+	}
+}
+
+// annualGrowth is the compound yearly growth between two values, in percent.
+func annualGrowth(fromYear int, from float64, toYear int, to float64) (float64, bool) {
+	if toYear <= fromYear || from <= 0 || to <= 0 {
+		return 0, false
+	}
+	return (math.Pow(to/from, 1/float64(toYear-fromYear)) - 1) * 100, true
+}
+
+func clampScore(score float64) float64 {
+	return round(math.Max(0, math.Min(100, score)), 1)
+}
+
+func round(value float64, decimals int) float64 {
+	scale := math.Pow(10, float64(decimals))
+	// Adding zero turns -0 into 0, which JSON would otherwise show as "-0"
+	return math.Round(value*scale)/scale + 0
+}
@@ -0,0 +1,462 @@
+package groundwater
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+	"github.com/lib/pq"
+)
+
+const (
+	// MaxChoroplethBreaks keeps every class distinguishable in the palette
+	MaxChoroplethBreaks = 6
+	noDataColor         = "#d1d5db"
+)
+
+var (
+	ErrUnknownMetric = errors.New("unknown map metric")
+	ErrInvalidBreaks = fmt.Errorf("breaks must be at most %d ascending numbers", MaxChoroplethBreaks)
+)
+
+// choroplethPalette runs from the best class to the worst.
+var choroplethPalette = []string{"#10b981", "#84cc16", "#facc15", "#f59e0b", "#f97316", "#ef4444", "#b91c1c"}
+
+// choroplethMetric reads one value of a balance. Metrics where more is better are
+// coloured with the palette reversed.
+type choroplethMetric struct {
+	value        func(a models.Assessment) *float64
+	higherIsBest bool
+}
+
+func always(value float64) *float64 {
+	return &value
+}
+
+var choroplethMetrics = map[string]choroplethMetric{
+	"stage_of_extraction":   {value: func(a models.Assessment) *float64 { return always(a.StageOfExtraction) }},
+	"total_extraction":      {value: func(a models.Assessment) *float64 { return always(a.TotalExtraction) }},
+	"extraction_irrigation": {value: func(a models.Assessment) *float64 { return a.ExtractionIrrigation }},
+	"extraction_industrial": {value: func(a models.Assessment) *float64 { return a.ExtractionIndustrial }},
+	"extraction_domestic":   {value: func(a models.Assessment) *float64 { return a.ExtractionDomestic }},
+	"annual_recharge": {
+		value: func(a models.Assessment) *float64 { return always(a.AnnualRecharge) }, higherIsBest: true,
+	},
+	"recharge_rainfall": {
+		value: func(a models.Assessment) *float64 { return a.RechargeRainfall }, higherIsBest: true,
+	},
+	"extractable_resource": {
+		value: func(a models.Assessment) *float64 { return always(a.ExtractableResource) }, higherIsBest: true,
+	},
+	"future_availability": {
+		value: func(a models.Assessment) *float64 { return a.FutureAvailability }, higherIsBest: true,
+	},
+}
+
+// choroplethMetricNames lists the metrics a map can be coloured by.
+func choroplethMetricNames() []string {
+	names := make([]string, 0, len(choroplethMetrics))
+	for name := range choroplethMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ChoroplethOptions choose a map. Zoom picks the stored simplification, 0 the usual one
+// for the level. Breaks are the configured classes, without which the values are split
+// into quintiles; CustomBreaks reclassify the map for one request and aren't cached.
+type ChoroplethOptions struct {
+	Level        models.UnitLevel
+	Year         int
+	Metric       string
+	State        string
+	Zoom         int
+	Breaks       []float64
+	CustomBreaks []float64
+}
+
+// ChoroplethLayer is an encoded map, ready to serve as is or gzip-compressed. ETag
+// identifies its content.
+type ChoroplethLayer struct {
+	JSON []byte
+	Gzip []byte
+	ETag string
+}
+
+// choroplethCache keeps maps with their configured classes, and their encoding, until
+// assessments or boundaries change. Only maps with some values are kept, so there is at
+// most one per level, year with data, metric, state and stored zoom.
+type choroplethCache struct {
+	mu      sync.Mutex
+	version string
+	maps    map[string]*cachedChoropleth
+}
+
+type cachedChoropleth struct {
+	choropleth *models.Choropleth
+	layer      *ChoroplethLayer
+}
+
+// Choropleth returns the units of one level as a GeoJSON FeatureCollection with each
+// unit's metric, category and colour class. Units without a boundary are left out and
+// counted as unmapped.
+func (s *Service) Choropleth(ctx context.Context, opts ChoroplethOptions) (*ChoroplethLayer, error) {
+	if opts.Level != models.LevelState && opts.Level != models.LevelDistrict && opts.Level != models.LevelBlock {
+		return nil, ErrInvalidLevel
+	}
+	if _, ok := choroplethMetrics[opts.Metric]; !ok {
+		return nil, fmt.Errorf("%w; use one of %s", ErrUnknownMetric, strings.Join(choroplethMetricNames(), ", "))
+	}
+	if !validBreaks(opts.Breaks) || !validBreaks(opts.CustomBreaks) {
+		return nil, ErrInvalidBreaks
+	}
+
+	datasetVersion, err := s.DatasetVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	boundaryVersion, err := s.boundaryVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Year == 0 {
+		if opts.Year, err = s.LatestYear(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	version := fmt.Sprintf("%d/%s", datasetVersion, boundaryVersion)
+	key := fmt.Sprintf("%s|%d|%s|%s|%d|%v", opts.Level, opts.Year, opts.Metric, UnitPath(opts.State),
+		storedZoom(opts.Level, opts.Zoom), opts.Breaks)
+	cache := &s.choropleths
+	cache.mu.Lock()
+	if cache.version != version {
+		cache.version = version
+		cache.maps = map[string]*cachedChoropleth{}
+	}
+	cached := cache.maps[key]
+	cache.mu.Unlock()
+
+	if cached == nil {
+		choropleth, err := s.buildChoropleth(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		choropleth.DatasetVersion = datasetVersion
+		layer, err := encodeChoropleth(choropleth)
+		if err != nil {
+			return nil, err
+		}
+		cached = &cachedChoropleth{choropleth: choropleth, layer: layer}
+
+		if hasValues(choropleth) {
+			cache.mu.Lock()
+			if cache.version == version {
+				cache.maps[key] = cached
+			}
+			cache.mu.Unlock()
+		}
+	}
+	if len(opts.CustomBreaks) == 0 {
+		return cached.layer, nil
+	}
+
+	custom := *cached.choropleth
+	custom.Features = append([]models.ChoroplethFeature{}, custom.Features...)
+	classify(&custom, opts.CustomBreaks, choroplethMetrics[opts.Metric].higherIsBest)
+	return encodeChoropleth(&custom)
+}
+
+// validBreaks reports whether breaks are few enough and strictly ascending.
+func validBreaks(breaks []float64) bool {
+	if len(breaks) > MaxChoroplethBreaks {
+		return false
+	}
+	for i := 1; i < len(breaks); i++ {
+		if breaks[i] <= breaks[i-1] {
+			return false
+		}
+	}
+	return true
+}
+
+// hasValues reports whether any unit of the map has a value.
+func hasValues(choropleth *models.Choropleth) bool {
+	for _, class := range choropleth.Classes {
+		if class.Units > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) buildChoropleth(ctx context.Context, opts ChoroplethOptions) (*models.Choropleth, error) {
+	balances, units, err := s.levelBalances(ctx, opts.Level, opts.Year, opts.State)
+	if err != nil {
+		return nil, err
+	}
+	geometries, err := s.boundaryGeometries(ctx, units, opts.Level, opts.Zoom)
+	if err != nil {
+		return nil, err
+	}
+
+	metric := choroplethMetrics[opts.Metric]
+	values := map[uuid.UUID]*float64{}
+	var present []float64
+	for _, unit := range units {
+		if balance, ok := balances[unit.ID]; ok {
+			if value := metric.value(balance.Assessment); value != nil {
+				rounded := round(*value, 2)
+				values[unit.ID] = &rounded
+				present = append(present, rounded)
+			}
+		}
+	}
+
+	choropleth := &models.Choropleth{
+		Type:        "FeatureCollection",
+		Level:       opts.Level,
+		Year:        opts.Year,
+		Metric:      opts.Metric,
+		NoDataColor: noDataColor,
+		Features:    []models.ChoroplethFeature{},
+	}
+	for _, unit := range units {
+		geometry, ok := geometries[unit.ID]
+		if !ok {
+			choropleth.Unmapped++
+			continue
+		}
+		properties := models.ChoroplethProperties{
+			Name: unit.Name, Path: unit.Path, Code: unit.Code, Value: values[unit.ID], Color: noDataColor,
+		}
+		if balance, ok := balances[unit.ID]; ok {
+			properties.Category = balance.Category
+		}
+		choropleth.Features = append(choropleth.Features, models.ChoroplethFeature{
+			Type: "Feature", ID: unit.ID, Geometry: geometry, Properties: properties,
+		})
+	}
+
+	breaks := opts.Breaks
+	if len(breaks) == 0 {
+		breaks = quantileBreaks(present, 5)
+	}
+	classify(choropleth, breaks, metric.higherIsBest)
+	return choropleth, nil
+}
+
+// classify splits the map's features into classes at the breaks and colours them.
+func classify(choropleth *models.Choropleth, breaks []float64, higherIsBest bool) {
+	colors := classColors(len(breaks)+1, higherIsBest)
+	choropleth.Breaks = append([]float64{}, breaks...)
+	choropleth.Classes = make([]models.ChoroplethClass, len(breaks)+1)
+	for i := range choropleth.Classes {
+		class := models.ChoroplethClass{Class: i, Color: colors[i]}
+		if i > 0 {
+			class.Min = &choropleth.Breaks[i-1]
+		}
+		if i < len(breaks) {
+			class.Max = &choropleth.Breaks[i]
+		}
+		choropleth.Classes[i] = class
+	}
+
+	for i := range choropleth.Features {
+		properties := &choropleth.Features[i].Properties
+		if properties.Value == nil {
+			continue
+		}
+		class := classOf(*properties.Value, breaks)
+		properties.Class, properties.Color = &class, colors[class]
+		choropleth.Classes[class].Units++
+	}
+}
+
+// levelBalances computes the year's balance of every unit of a level in one pass over
+// the tree, the way rollups do for a single unit.
+func (s *Service) levelBalances(ctx context.Context, level models.UnitLevel, year int, state string) (map[uuid.UUID]*yearBalance, []models.AssessmentUnit, error) {
+	query := "SELECT " + unitColumns + " FROM groundwater_units u"
+	args := []interface{}{}
+	if state != "" {
+		query += " WHERE split_part(u.path, '/', 1) = $1"
+		args = append(args, UnitPath(state))
+	}
+	rows, err := s.db.DB.QueryContext(ctx, query+" ORDER BY u.path", args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unit list error: %w", err)
+	}
+	defer rows.Close()
+
+	var units []models.AssessmentUnit
+	ids := []uuid.UUID{}
+	children := map[uuid.UUID][]uuid.UUID{}
+	for rows.Next() {
+		var unit models.AssessmentUnit
+		if err := rows.Scan(&unit.ID, &unit.ParentID, &unit.Level, &unit.Name, &unit.Path, &unit.Code,
+			&unit.CreatedAt); err != nil {
+			return nil, nil, err
+		}
+		ids = append(ids, unit.ID)
+		if unit.ParentID != nil {
+			children[*unit.ParentID] = append(children[*unit.ParentID], unit.ID)
+		}
+		if unit.Level == level {
+			units = append(units, unit)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	assessments, err := s.assessments(ctx, ids, year)
+	if err != nil {
+		return nil, nil, err
+	}
+	balances := map[uuid.UUID]*yearBalance{}
+	for _, unit := range units {
+		if balance, ok := balanceTree(unit.ID, children, assessments)[year]; ok {
+			balances[unit.ID] = balance
+		}
+	}
+	return balances, units, nil
+}
+
+// boundaryGeometries returns the boundaries of the units, simplified for the zoom or the
+// level's usual zoom.
+func (s *Service) boundaryGeometries(ctx context.Context, units []models.AssessmentUnit, level models.UnitLevel, zoom int) (map[uuid.UUID]json.RawMessage, error) {
+	stored := storedZoom(level, zoom)
+	ids := make([]uuid.UUID, len(units))
+	for i, unit := range units {
+		ids[i] = unit.ID
+	}
+	var rows *sql.Rows
+	var err error
+	if stored > 0 {
+		rows, err = s.db.DB.QueryContext(ctx, `
+			SELECT unit_id, geometry FROM groundwater_boundary_shapes
+			WHERE unit_id = ANY($1) AND zoom = $2`, pq.Array(ids), stored)
+	} else {
+		// Past the most detailed simplification the full geometry is used
+		rows, err = s.db.DB.QueryContext(ctx,
+			"SELECT unit_id, geometry FROM groundwater_boundaries WHERE unit_id = ANY($1)", pq.Array(ids))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("boundary lookup error: %w", err)
+	}
+	defer rows.Close()
+
+	geometries := map[uuid.UUID]json.RawMessage{}
+	for rows.Next() {
+		var id uuid.UUID
+		var geometry []byte
+		if err := rows.Scan(&id, &geometry); err != nil {
+			return nil, err
+		}
+		geometries[id] = geometry
+	}
+	return geometries, rows.Err()
+}
+
+// storedZoom is the stored simplification used for a zoom, or 0 past the most detailed
+// one.
+func storedZoom(level models.UnitLevel, zoom int) int {
+	if zoom == 0 {
+		zoom = map[models.UnitLevel]int{models.LevelState: 4, models.LevelDistrict: 6, models.LevelBlock: 8}[level]
+	}
+	for _, z := range BoundaryZooms {
+		if z >= zoom {
+			return z
+		}
+	}
+	return 0
+}
+
+// quantileBreaks splits the values into classes of about equal size, dropping breaks
+// that repeat because many values are equal.
+func quantileBreaks(values []float64, classes int) []float64 {
+	if len(values) == 0 {
+		return []float64{}
+	}
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+
+	breaks := []float64{}
+	for i := 1; i < classes; i++ {
+		b := sorted[(len(sorted)*i-1)/classes]
+		if (len(breaks) == 0 || b > breaks[len(breaks)-1]) && b < sorted[len(sorted)-1] {
+			breaks = append(breaks, b)
+		}
+	}
+	return breaks
+}
+
+// classOf is the index of the first class whose upper break the value doesn't exceed.
+func classOf(value float64, breaks []float64) int {
+	return sort.Search(len(breaks), func(i int) bool { return value <= breaks[i] })
+}
+
+// classColors spreads n classes over the palette, worst class last.
+func classColors(n int, higherIsBest bool) []string {
+	colors := make([]string, n)
+	for i := range colors {
+		position := 0
+		if n > 1 {
+			position = int(math.Round(float64(i*(len(choroplethPalette)-1)) / float64(n-1)))
+		}
+		if higherIsBest {
+			position = len(choroplethPalette) - 1 - position
+		}
+		colors[i] = choroplethPalette[position]
+	}
+	return colors
+}
+
+func encodeChoropleth(choropleth *models.Choropleth) (*ChoroplethLayer, error) {
+	data, err := json.Marshal(choropleth)
+	if err != nil {
+		return nil, err
+	}
+
+	var compressed bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&compressed, gzip.BestCompression)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	return &ChoroplethLayer{
+		JSON: data,
+		Gzip: compressed.Bytes(),
+		ETag: fmt.Sprintf(`W/"%x"`, sum[:16]),
+	}, nil
+}
+
+// ParseBreaks reads comma-separated breakpoints such as "70,90,100".
+func ParseBreaks(value string) ([]float64, error) {
+	var breaks []float64
+	for _, item := range strings.Split(value, ",") {
+		b, err := strconv.ParseFloat(strings.TrimSpace(item), 64)
+		if err != nil || math.IsNaN(b) || math.IsInf(b, 0) {
+			return nil, ErrInvalidBreaks
+		}
+		breaks = append(breaks, b)
+	}
+	return breaks, nil
+}
@@ -0,0 +1,453 @@
+package groundwater
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+)
+
+type field int
+
+const (
+	fieldState field = iota
+	fieldDistrict
+	fieldBlock
+	fieldCode
+	fieldYear
+	fieldRechargeRainfall
+	fieldRechargeOther
+	fieldAnnualRecharge
+	fieldNaturalDischarge
+	fieldExtractable
+	fieldIrrigation
+	fieldIndustrial
+	fieldDomestic
+	fieldTotalExtraction
+	fieldStage
+	fieldCategory
+	fieldFuture
+)
+
+var fieldNames = map[field]string{
+	fieldState:            "state",
+	fieldDistrict:         "district",
+	fieldBlock:            "block",
+	fieldCode:             "code",
+	fieldYear:             "year",
+	fieldRechargeRainfall: "recharge_rainfall",
+	fieldRechargeOther:    "recharge_other",
+	fieldAnnualRecharge:   "annual_recharge",
+	fieldNaturalDischarge: "natural_discharge",
+	fieldExtractable:      "extractable_resource",
+	fieldIrrigation:       "extraction_irrigation",
+	fieldIndustrial:       "extraction_industrial",
+	fieldDomestic:         "extraction_domestic",
+	fieldTotalExtraction:  "total_extraction",
+	fieldStage:            "stage_of_extraction",
+	fieldCategory:         "category",
+	fieldFuture:           "future_availability",
+}
+
+// fieldAliases are header spellings seen in CGWB report annexures and INGRES exports,
+// after normaliseHeader. Every column matching a summed field is added up, which is how
+// monsoon and non-monsoon recharge columns become one figure.
+var fieldAliases = map[field][]string{
+	fieldState:    {"state", "state name", "name of state", "state ut", "name of state ut"},
+	fieldDistrict: {"district", "district name", "name of district"},
+	fieldBlock: {"assessment unit", "assessment unit name", "name of assessment unit", "block", "block name",
+		"taluk", "taluka", "mandal", "tehsil", "firka"},
+	fieldCode: {"code", "unit code", "assessment unit code", "au code"},
+	fieldYear: {"year", "assessment year"},
+	fieldRechargeRainfall: {"recharge from rainfall", "rainfall recharge",
+		"recharge from rainfall monsoon season", "recharge from rainfall non monsoon season"},
+	fieldRechargeOther: {"recharge from other sources", "other sources recharge",
+		"recharge from other sources monsoon season", "recharge from other sources non monsoon season"},
+	fieldAnnualRecharge: {"total annual ground water recharge", "annual ground water recharge",
+		"total annual recharge", "annual recharge"},
+	fieldNaturalDischarge: {"total natural discharges", "natural discharges", "natural discharge"},
+	fieldExtractable: {"annual extractable ground water resource", "extractable ground water resource",
+		"annual extractable resource", "annual extractable ground water resources"},
+	fieldIrrigation: {"irrigation", "irrigation use", "ground water extraction for irrigation use",
+		"current annual ground water extraction irrigation", "annual ground water extraction irrigation"},
+	fieldIndustrial: {"industrial", "industrial use", "ground water extraction for industrial use",
+		"current annual ground water extraction industrial", "annual ground water extraction industrial"},
+	fieldDomestic: {"domestic", "domestic use", "ground water extraction for domestic use",
+		"current annual ground water extraction domestic", "annual ground water extraction domestic"},
+	fieldTotalExtraction: {"total extraction", "total ground water extraction", "ground water extraction for all uses",
+		"current annual ground water extraction total", "annual ground water extraction total"},
+	fieldStage: {"stage of ground water extraction", "stage of extraction", "stage of ground water development"},
+	fieldCategory: {"category", "categorization", "categorisation", "categorization of assessment unit",
+		"categorization of assessment units"},
+	fieldFuture: {"net annual ground water availability for future use",
+		"net ground water availability for future use", "annual ground water availability for future use"},
+}
+
+var summedFields = map[field]bool{fieldRechargeRainfall: true, fieldRechargeOther: true}
+
+// unitScales convert a volume column to hectare-metres from the unit its header ends in.
+var unitScales = map[string]float64{"ham": 1, "mcm": 100, "bcm": 100000}
+
+// summaryNames mark total rows that exports append to each state or to the whole file.
+var summaryNames = map[string]bool{"total": true, "grand total": true, "india": true, "all india": true}
+
+const (
+	// headerSearchRows is how far into a file the header row may be, below title rows
+	headerSearchRows = 20
+	minYear          = 1990
+	maxYear          = 2100
+	// stageTolerance is how far a reported stage may be from the computed one, in points
+	stageTolerance = 1.0
+)
+
+// Record is one validated row, ready to be stored.
+type Record struct {
+	Line       int
+	State      string
+	District   string
+	Block      string
+	Code       string
+	Assessment models.Assessment
+}
+
+// Level is the most specific level the row names.
+func (r *Record) Level() models.UnitLevel {
+	switch {
+	case r.Block != "":
+		return models.LevelBlock
+	case r.District != "":
+		return models.LevelDistrict
+	default:
+		return models.LevelState
+	}
+}
+
+func (r *Record) Path() string {
+	return UnitPath(r.State, r.District, r.Block)
+}
+
+// ParseOptions adjust how a file is read.
+type ParseOptions struct {
+	// Year applies to files without a year column
+	Year int
+}
+
+type column struct {
+	index int
+	scale float64
+}
+
+// ParseCSV reads an assessment export, collecting rejected rows and suspicious values in
+// the report. It only fails outright when the file can't be read or lacks required columns.
+func ParseCSV(r io.Reader, opts ParseOptions, report *ImportReport) ([]Record, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	columns, err := findHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkColumns(columns, opts); err != nil {
+		return nil, err
+	}
+
+	var records []Record
+	seen := map[string]int{}
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("reading CSV: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+		if blankRow(row) {
+			continue
+		}
+
+		record, ok := parseRow(row, line, columns, opts, report)
+		if ok && record == nil {
+			continue
+		}
+		report.Rows++
+		if !ok {
+			report.Rejected++
+			continue
+		}
+
+		key := fmt.Sprintf("%s@%d", record.Path(), record.Assessment.Year)
+		if first, dup := seen[key]; dup {
+			report.addError(line, "", "duplicate of line %d for %s %d", first, record.Path(), record.Assessment.Year)
+			report.Rejected++
+			continue
+		}
+		seen[key] = line
+
+		report.Accepted++
+		records = append(records, *record)
+	}
+	return records, nil
+}
+
+// findHeader skips title rows until one names a state column.
+func findHeader(reader *csv.Reader) (map[field][]column, error) {
+	for i := 0; i < headerSearchRows; i++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("reading CSV header: %w", err)
+		}
+
+		columns := map[field][]column{}
+		for index, cell := range row {
+			name, scale := normaliseHeader(cell)
+			if f, ok := matchField(name); ok && (summedFields[f] || len(columns[f]) == 0) {
+				columns[f] = append(columns[f], column{index: index, scale: scale})
+			}
+		}
+		if len(columns[fieldState]) > 0 {
+			return columns, nil
+		}
+	}
+	return nil, errors.New("no header row with a State column in the first rows")
+}
+
+func checkColumns(columns map[field][]column, opts ParseOptions) error {
+	var missing []string
+	for _, f := range []field{fieldAnnualRecharge, fieldExtractable, fieldCategory} {
+		if len(columns[f]) == 0 {
+			missing = append(missing, fieldNames[f])
+		}
+	}
+	if len(columns[fieldTotalExtraction]) == 0 && len(columns[fieldIrrigation]) == 0 &&
+		len(columns[fieldIndustrial]) == 0 && len(columns[fieldDomestic]) == 0 {
+		missing = append(missing, fieldNames[fieldTotalExtraction])
+	}
+	if len(columns[fieldYear]) == 0 && opts.Year == 0 {
+		missing = append(missing, "year (or pass a year for the whole file)")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing columns: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// normaliseHeader lower-cases a header, reduces punctuation to single spaces and strips a
+// trailing unit such as "(ham)" or "(%)", returning the scale to hectare-metres.
+func normaliseHeader(header string) (string, float64) {
+	header = strings.TrimPrefix(header, "\ufeff")
+	words := strings.FieldsFunc(strings.ToLower(header), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	})
+
+	scale := 1.0
+	for len(words) > 0 {
+		last := words[len(words)-1]
+		if s, ok := unitScales[last]; ok {
+			scale = s
+		} else if last != "in" && last != "percent" && last != "pct" {
+			break
+		}
+		words = words[:len(words)-1]
+	}
+	return strings.Join(words, " "), scale
+}
+
+func matchField(name string) (field, bool) {
+	for f, aliases := range fieldAliases {
+		for _, alias := range aliases {
+			if name == alias {
+				return f, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func blankRow(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// parseRow validates one row. Problems that make the row unusable are errors and reject
+// it; values that are merely inconsistent are kept with a warning. Summary rows come
+// back as nil without being rejected.
+func parseRow(row []string, line int, columns map[field][]column, opts ParseOptions, report *ImportReport) (*Record, bool) {
+	text := func(f field) string {
+		if cols := columns[f]; len(cols) > 0 && cols[0].index < len(row) {
+			return strings.Join(strings.Fields(row[cols[0].index]), " ")
+		}
+		return ""
+	}
+
+	ok := true
+	number := func(f field) *float64 {
+		var total float64
+		found := false
+		for _, col := range columns[f] {
+			if col.index >= len(row) {
+				continue
+			}
+			raw := strings.ReplaceAll(strings.TrimSpace(row[col.index]), ",", "")
+			if raw == "" || raw == "-" || strings.EqualFold(raw, "na") || strings.EqualFold(raw, "n/a") {
+				continue
+			}
+			value, err := strconv.ParseFloat(raw, 64)
+			if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+				report.addError(line, fieldNames[f], "%q is not a number", row[col.index])
+				ok = false
+				return nil
+			}
+			if value < 0 {
+				report.addError(line, fieldNames[f], "%s is negative", raw)
+				ok = false
+				return nil
+			}
+			total += value * col.scale
+			found = true
+		}
+		if !found {
+			return nil
+		}
+		return &total
+	}
+
+	record := &Record{
+		Line:     line,
+		State:    text(fieldState),
+		District: text(fieldDistrict),
+		Block:    text(fieldBlock),
+		Code:     text(fieldCode),
+	}
+	if record.State == "" {
+		report.addError(line, "state", "state is empty")
+		return nil, false
+	}
+	for _, name := range []string{record.State, record.District, record.Block} {
+		if summaryNames[strings.ToLower(name)] {
+			report.addWarning(line, "", "skipped summary row %q", name)
+			return nil, true
+		}
+	}
+	if record.District == "" && record.Block != "" {
+		report.addError(line, "district", "block %q has no district", record.Block)
+		return nil, false
+	}
+
+	a := &record.Assessment
+	a.Year = opts.Year
+	if raw := text(fieldYear); raw != "" {
+		// "2022-23" is the 2022 assessment
+		a.Year = 0
+		if len(raw) >= 4 {
+			a.Year, _ = strconv.Atoi(raw[:4])
+		}
+	}
+	if a.Year < minYear || a.Year > maxYear {
+		report.addError(line, "year", "year %q is not between %d and %d", text(fieldYear), minYear, maxYear)
+		ok = false
+	}
+
+	a.RechargeRainfall = number(fieldRechargeRainfall)
+	a.RechargeOther = number(fieldRechargeOther)
+	a.NaturalDischarge = number(fieldNaturalDischarge)
+	a.ExtractionIrrigation = number(fieldIrrigation)
+	a.ExtractionIndustrial = number(fieldIndustrial)
+	a.ExtractionDomestic = number(fieldDomestic)
+	a.FutureAvailability = number(fieldFuture)
+	recharge := number(fieldAnnualRecharge)
+	extractable := number(fieldExtractable)
+	total := number(fieldTotalExtraction)
+	stage := number(fieldStage)
+	if !ok {
+		return nil, false
+	}
+
+	// Annual recharge is sometimes only given as its components
+	if recharge == nil && (a.RechargeRainfall != nil || a.RechargeOther != nil) {
+		sum := valueOf(a.RechargeRainfall) + valueOf(a.RechargeOther)
+		recharge = &sum
+	}
+	if recharge == nil {
+		report.addError(line, "annual_recharge", "annual recharge is missing")
+		return nil, false
+	}
+	if extractable == nil {
+		report.addError(line, "extractable_resource", "extractable resource is missing")
+		return nil, false
+	}
+	a.AnnualRecharge, a.ExtractableResource = *recharge, *extractable
+
+	sectors := []*float64{a.ExtractionIrrigation, a.ExtractionIndustrial, a.ExtractionDomestic}
+	var sectorSum float64
+	hasSectors := false
+	for _, value := range sectors {
+		if value != nil {
+			sectorSum += *value
+			hasSectors = true
+		}
+	}
+	switch {
+	case total != nil:
+		a.TotalExtraction = *total
+		if hasSectors && math.Abs(sectorSum-*total) > math.Max(0.5, *total*0.01) {
+			report.addWarning(line, "total_extraction", "total extraction %.2f differs from the sector sum %.2f",
+				*total, sectorSum)
+		}
+	case hasSectors:
+		a.TotalExtraction = sectorSum
+	default:
+		report.addError(line, "total_extraction", "total extraction is missing")
+		return nil, false
+	}
+
+	switch {
+	case a.ExtractableResource > 0:
+		computed := a.TotalExtraction / a.ExtractableResource * 100
+		a.StageOfExtraction = computed
+		if stage != nil {
+			a.StageOfExtraction = *stage
+			if math.Abs(*stage-computed) > stageTolerance {
+				report.addWarning(line, "stage_of_extraction", "stage %.2f%% differs from the computed %.2f%%",
+					*stage, computed)
+			}
+		}
+	case stage != nil:
+		a.StageOfExtraction = *stage
+	default:
+		report.addError(line, "stage_of_extraction", "stage can't be computed without an extractable resource")
+		return nil, false
+	}
+
+	category, known := ParseCategory(text(fieldCategory))
+	if !known {
+		report.addError(line, "category", "unknown category %q", text(fieldCategory))
+		return nil, false
+	}
+	a.Category = category
+	if category != models.CategorySaline && CategoryForStage(a.StageOfExtraction) != category {
+		report.addWarning(line, "category", "category %s doesn't match a stage of %.2f%%",
+			CategoryLabel(category), a.StageOfExtraction)
+	}
+
+	return record, true
+}
+
+func valueOf(value *float64) float64 {
+	if value == nil {
+		return 0
+	}
+	return *value
+}
@@ -0,0 +1,107 @@
+// Package groundwater holds the CGWB dynamic groundwater resource assessments: the
+// state > district > block assessment units, their yearly balances and the imports
+// that load them from official CSV exports.
+package groundwater
+
+import (
+	"strings"
+
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/database"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+type Service struct {
+	db          *database.Service
+	logger      *logrus.Logger
+	rollups     rollupCache
+	places      placeIndexCache
+	boundaries  boundaryIndexCache
+	choropleths choroplethCache
+}
+
+func NewService(db *database.Service, logger *logrus.Logger) *Service {
+	return &Service{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// CategoryForStage applies the CGWB thresholds on the stage of extraction. Saline units
+// are categorised by water quality instead, so they never come out of this.
+func CategoryForStage(stage float64) models.GroundwaterCategory {
+	switch {
+	case stage <= 70:
+		return models.CategorySafe
+	case stage <= 90:
+		return models.CategorySemiCritical
+	case stage <= 100:
+		return models.CategoryCritical
+	default:
+		return models.CategoryOverExploited
+	}
+}
+
+var categoryLabels = map[models.GroundwaterCategory]string{
+	models.CategorySafe:          "Safe",
+	models.CategorySemiCritical:  "Semi-Critical",
+	models.CategoryCritical:      "Critical",
+	models.CategoryOverExploited: "Over-Exploited",
+	models.CategorySaline:        "Saline",
+}
+
+// CategoryLabel returns the category as the reports and the web app spell it.
+func CategoryLabel(category models.GroundwaterCategory) string {
+	return categoryLabels[category]
+}
+
+var categoryColors = map[models.GroundwaterCategory]string{
+	models.CategorySafe:          "#10b981",
+	models.CategorySemiCritical:  "#f59e0b",
+	models.CategoryCritical:      "#f97316",
+	models.CategoryOverExploited: "#ef4444",
+	models.CategorySaline:        "#8b5cf6",
+}
+
+// CategoryColor returns the colour the web app uses for the category.
+func CategoryColor(category models.GroundwaterCategory) string {
+	return categoryColors[category]
+}
+
+// ParseCategory accepts the spellings found in CGWB and INGRES exports, such as
+// "Over-Exploited", "over exploited", "OE" or "Semi Critical".
+func ParseCategory(label string) (models.GroundwaterCategory, bool) {
+	var b strings.Builder
+	for _, r := range strings.ToLower(label) {
+		if r >= 'a' && r <= 'z' {
+			b.WriteRune(r)
+		}
+	}
+	switch b.String() {
+	case "safe", "s":
+		return models.CategorySafe, true
+	case "semicritical", "sc":
+		return models.CategorySemiCritical, true
+	case "critical", "c":
+		return models.CategoryCritical, true
+	case "overexploited", "oe":
+		return models.CategoryOverExploited, true
+	case "saline", "sal":
+		return models.CategorySaline, true
+	}
+	return "", false
+}
+
+// UnitPath builds the key a unit is matched by across imports: the lower-cased names
+// from state down, with whitespace collapsed, joined by "/".
+func UnitPath(names ...string) string {
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		if name == "" {
+			break
+		}
+		name = strings.Join(strings.Fields(strings.ToLower(name)), " ")
+		parts = append(parts, strings.ReplaceAll(name, "/", "-"))
+	}
+	return strings.Join(parts, "/")
+}
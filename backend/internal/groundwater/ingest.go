@@ -0,0 +1,238 @@
+package groundwater
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/database"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Issue is one problem found in a file. Errors reject the row; warnings keep it.
+type Issue struct {
+	Line     int    `json:"line,omitempty"`
+	Severity string `json:"severity"`
+	Field    string `json:"field,omitempty"`
+	Message  string `json:"message"`
+}
+
+// ImportReport says what an import did with every row of a file.
+type ImportReport struct {
+	FileName        string  `json:"file_name"`
+	Checksum        string  `json:"checksum"`
+	Source          string  `json:"source"`
+	DryRun          bool    `json:"dry_run"`
+	AlreadyImported bool    `json:"already_imported"`
+	DatasetVersion  int     `json:"dataset_version,omitempty"`
+	Rows            int     `json:"rows"`
+	Accepted        int     `json:"accepted"`
+	Rejected        int     `json:"rejected"`
+	Inserted        int     `json:"inserted"`
+	Updated         int     `json:"updated"`
+	Unchanged       int     `json:"unchanged"`
+	UnitsCreated    int     `json:"units_created"`
+	Issues          []Issue `json:"issues"`
+}
+
+func (r *ImportReport) addError(line int, field, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, Issue{Line: line, Severity: SeverityError, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *ImportReport) addWarning(line int, field, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, Issue{Line: line, Severity: SeverityWarning, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// ImportOptions control one import.
+type ImportOptions struct {
+	// Source names where the file came from, e.g. "cgwb" or "ingres"
+	Source string
+	// Year applies to files without a year column
+	Year int
+	// DryRun validates the file and reports without writing anything
+	DryRun bool
+	// Force applies a file again even though one with the same checksum was imported
+	Force bool
+}
+
+// Import validates a CSV export and upserts its rows as a new dataset version. Importing
+// the same file twice is a no-op, and rows whose values didn't change are left alone, so
+// re-running an import after fixing a few rows only touches those rows.
+func (s *Service) Import(ctx context.Context, fileName string, data []byte, opts ImportOptions) (*ImportReport, error) {
+	sum := sha256.Sum256(data)
+	report := &ImportReport{
+		FileName: fileName,
+		Checksum: hex.EncodeToString(sum[:]),
+		Source:   opts.Source,
+		DryRun:   opts.DryRun,
+		Issues:   []Issue{},
+	}
+
+	if !opts.Force {
+		err := s.db.DB.QueryRowContext(ctx, `
+			SELECT version FROM groundwater_datasets WHERE checksum = $1
+			ORDER BY version DESC LIMIT 1`, report.Checksum).Scan(&report.DatasetVersion)
+		if err == nil {
+			report.AlreadyImported = true
+			return report, nil
+		} else if err != sql.ErrNoRows {
+			return nil, fmt.Errorf("dataset lookup error: %w", err)
+		}
+	}
+
+	records, err := ParseCSV(bytes.NewReader(data), ParseOptions{Year: opts.Year}, report)
+	if err != nil {
+		return report, err
+	}
+	if opts.DryRun {
+		return report, nil
+	}
+
+	err = s.db.WithTransaction(ctx, func(tx *sql.Tx) error {
+		var datasetID uuid.UUID
+		if err := tx.QueryRowContext(ctx, `
+			INSERT INTO groundwater_datasets (source, file_name, checksum, rows_total)
+			VALUES ($1, $2, $3, $4) RETURNING id, version`,
+			opts.Source, fileName, report.Checksum, report.Rows).Scan(&datasetID, &report.DatasetVersion); err != nil {
+			return err
+		}
+
+		units := map[string]uuid.UUID{}
+		for i := range records {
+			unitID, err := s.ensureUnit(ctx, tx, &records[i], units, report)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", records[i].Line, err)
+			}
+			if err := upsertAssessment(ctx, tx, unitID, datasetID, &records[i].Assessment, report); err != nil {
+				return fmt.Errorf("line %d: %w", records[i].Line, err)
+			}
+		}
+
+		reportJSON, err := json.Marshal(report)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE groundwater_datasets SET rows_imported = $1, rows_rejected = $2, report = $3 WHERE id = $4`,
+			report.Inserted+report.Updated+report.Unchanged, report.Rejected, string(reportJSON), datasetID); err != nil {
+			return err
+		}
+
+		return database.RecordAudit(ctx, tx, database.AuditEntry{
+			Action:       "groundwater.dataset_imported",
+			ResourceType: "groundwater_dataset",
+			ResourceID:   datasetID.String(),
+			NewValues: map[string]interface{}{
+				"file_name": fileName,
+				"version":   report.DatasetVersion,
+				"inserted":  report.Inserted,
+				"updated":   report.Updated,
+				"rejected":  report.Rejected,
+			},
+		})
+	})
+	if err != nil {
+		return report, fmt.Errorf("import error: %w", err)
+	}
+	return report, nil
+}
+
+// ensureUnit finds or creates the record's unit and every unit above it.
+func (s *Service) ensureUnit(ctx context.Context, tx *sql.Tx, record *Record, units map[string]uuid.UUID, report *ImportReport) (uuid.UUID, error) {
+	levels := []struct {
+		level models.UnitLevel
+		name  string
+	}{
+		{models.LevelState, record.State},
+		{models.LevelDistrict, record.District},
+		{models.LevelBlock, record.Block},
+	}
+
+	var parentID *uuid.UUID
+	var unitID uuid.UUID
+	names := make([]string, 0, len(levels))
+	for _, l := range levels {
+		if l.name == "" {
+			break
+		}
+		names = append(names, l.name)
+		path := UnitPath(names...)
+
+		// Codes belong to the row's own unit, not the ones above it
+		var code interface{}
+		if l.level == record.Level() && record.Code != "" {
+			code = record.Code
+		}
+
+		id, cached := units[path]
+		if !cached || code != nil {
+			var inserted bool
+			if err := tx.QueryRowContext(ctx, `
+				INSERT INTO groundwater_units (parent_id, level, name, path, code)
+				VALUES ($1, $2, $3, $4, $5)
+				ON CONFLICT (path) DO UPDATE SET code = COALESCE(EXCLUDED.code, groundwater_units.code)
+				RETURNING id, xmax = 0`, parentID, l.level, l.name, path, code).Scan(&id, &inserted); err != nil {
+				return uuid.Nil, fmt.Errorf("unit %s: %w", path, err)
+			}
+			if inserted {
+				report.UnitsCreated++
+			}
+			units[path] = id
+		}
+
+		parent := id
+		unitID, parentID = id, &parent
+	}
+	return unitID, nil
+}
+
+// upsertAssessment writes a row unless the stored one already has the same values.
+func upsertAssessment(ctx context.Context, tx *sql.Tx, unitID, datasetID uuid.UUID, a *models.Assessment, report *ImportReport) error {
+	var inserted bool
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO groundwater_assessments AS ga (unit_id, year, dataset_id, recharge_rainfall, recharge_other,
+			annual_recharge, natural_discharge, extractable_resource, extraction_irrigation, extraction_industrial,
+			extraction_domestic, total_extraction, stage_of_extraction, category, future_availability, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, NOW())
+		ON CONFLICT (unit_id, year) DO UPDATE SET
+			dataset_id = EXCLUDED.dataset_id, recharge_rainfall = EXCLUDED.recharge_rainfall,
+			recharge_other = EXCLUDED.recharge_other, annual_recharge = EXCLUDED.annual_recharge,
+			natural_discharge = EXCLUDED.natural_discharge, extractable_resource = EXCLUDED.extractable_resource,
+			extraction_irrigation = EXCLUDED.extraction_irrigation, extraction_industrial = EXCLUDED.extraction_industrial,
+			extraction_domestic = EXCLUDED.extraction_domestic, total_extraction = EXCLUDED.total_extraction,
+			stage_of_extraction = EXCLUDED.stage_of_extraction, category = EXCLUDED.category,
+			future_availability = EXCLUDED.future_availability, updated_at = EXCLUDED.updated_at
+		WHERE (ga.recharge_rainfall, ga.recharge_other, ga.annual_recharge, ga.natural_discharge,
+		       ga.extractable_resource, ga.extraction_irrigation, ga.extraction_industrial, ga.extraction_domestic,
+		       ga.total_extraction, ga.stage_of_extraction, ga.category, ga.future_availability)
+		      IS DISTINCT FROM
+		      (EXCLUDED.recharge_rainfall, EXCLUDED.recharge_other, EXCLUDED.annual_recharge, EXCLUDED.natural_discharge,
+		       EXCLUDED.extractable_resource, EXCLUDED.extraction_irrigation, EXCLUDED.extraction_industrial,
+		       EXCLUDED.extraction_domestic, EXCLUDED.total_extraction, EXCLUDED.stage_of_extraction,
+		       EXCLUDED.category, EXCLUDED.future_availability)
+		RETURNING xmax = 0`,
+		unitID, a.Year, datasetID, a.RechargeRainfall, a.RechargeOther, a.AnnualRecharge, a.NaturalDischarge,
+		a.ExtractableResource, a.ExtractionIrrigation, a.ExtractionIndustrial, a.ExtractionDomestic,
+		a.TotalExtraction, a.StageOfExtraction, a.Category, a.FutureAvailability).Scan(&inserted)
+	switch {
+	case err == sql.ErrNoRows:
+		report.Unchanged++
+	case err != nil:
+		return err
+	case inserted:
+		report.Inserted++
+	default:
+		report.Updated++
+	}
+	return nil
+}
@@ -0,0 +1,314 @@
+package groundwater
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+)
+
+const (
+	// maxPlaceWords is how many words of free text are looked at
+	maxPlaceWords = 12
+	// maxWindowWords is the longest run of words matched against one name
+	maxWindowWords = 3
+	// ambiguityMargin is how close two candidates' confidences must be to call it a tie
+	ambiguityMargin = 0.05
+	// contextBoost is added when the text also names the candidate's state or district
+	contextBoost = 0.1
+)
+
+// Confidence of each kind of match, before any context boost. Exact matches leave room
+// for the boost so that "Aurangabad, Bihar" can beat the Aurangabad in Maharashtra.
+const (
+	exactConfidence  = 0.9
+	aliasConfidence  = 0.85
+	fuzzyConfidence  = 0.85
+	prefixConfidence = 0.8
+)
+
+// placeStopWords never name a place on their own.
+var placeStopWords = map[string]bool{
+	"in": true, "of": true, "the": true, "at": true, "for": true, "near": true,
+	"state": true, "district": true, "block": true, "tehsil": true, "taluk": true, "taluka": true,
+	"mandal": true, "groundwater": true, "ground": true, "water": true, "level": true, "levels": true,
+	"show": true, "me": true, "what": true, "is": true, "how": true, "about": true,
+}
+
+// placeEntry is one unit and the keys it can be found by.
+type placeEntry struct {
+	unit     models.AssessmentUnit
+	state    string
+	district string
+	keys     []placeKey
+}
+
+type placeKey struct {
+	name         string
+	key          string
+	alias        bool
+	abbreviation bool
+}
+
+type placeIndex struct {
+	entries []placeEntry
+}
+
+// placeIndexCache keeps the index until another dataset is imported.
+type placeIndexCache struct {
+	mu      sync.Mutex
+	version int
+	index   *placeIndex
+}
+
+// PlaceOptions narrow ResolvePlace.
+type PlaceOptions struct {
+	Level models.UnitLevel
+	Limit int
+}
+
+// ResolvePlace maps free text such as "ludhiana", "groundwater in UP" or "लुधियाना" to
+// assessment units, best match first.
+func (s *Service) ResolvePlace(ctx context.Context, text string, opts PlaceOptions) (*models.PlaceResolution, error) {
+	index, err := s.placeIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := index.resolve(text, opts.Level)
+	resolution := &models.PlaceResolution{Query: text, Candidates: candidates}
+	if len(candidates) > 1 && candidates[0].Confidence-candidates[1].Confidence <= ambiguityMargin {
+		resolution.Ambiguous = true
+	}
+	if opts.Limit > 0 && len(resolution.Candidates) > opts.Limit {
+		resolution.Candidates = resolution.Candidates[:opts.Limit]
+	}
+	return resolution, nil
+}
+
+func (s *Service) placeIndex(ctx context.Context) (*placeIndex, error) {
+	version, err := s.DatasetVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := &s.places
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.index != nil && cache.version == version {
+		return cache.index, nil
+	}
+
+	index, err := s.buildPlaceIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cache.index, cache.version = index, version
+	return index, nil
+}
+
+func (s *Service) buildPlaceIndex(ctx context.Context) (*placeIndex, error) {
+	rows, err := s.db.DB.QueryContext(ctx, "SELECT "+unitColumns+" FROM groundwater_units u ORDER BY u.path")
+	if err != nil {
+		return nil, fmt.Errorf("unit list error: %w", err)
+	}
+	defer rows.Close()
+
+	var units []models.AssessmentUnit
+	for rows.Next() {
+		var unit models.AssessmentUnit
+		if err := rows.Scan(&unit.ID, &unit.ParentID, &unit.Level, &unit.Name, &unit.Path, &unit.Code,
+			&unit.CreatedAt); err != nil {
+			return nil, err
+		}
+		units = append(units, unit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return newPlaceIndex(units), nil
+}
+
+// newPlaceIndex indexes units sorted by path.
+func newPlaceIndex(units []models.AssessmentUnit) *placeIndex {
+	index := &placeIndex{}
+	names := map[string]string{}
+	for _, unit := range units {
+		// Paths sort parents first, so ancestors' names are known by now
+		names[unit.Path] = unit.Name
+		parts := strings.Split(unit.Path, "/")
+		entry := placeEntry{unit: unit, state: names[parts[0]]}
+		if len(parts) > 2 {
+			entry.district = names[parts[0]+"/"+parts[1]]
+		}
+
+		entry.keys = []placeKey{{name: unit.Name, key: foldName(unit.Name)}}
+		for _, alias := range aliasesFor(unit.Name, parts[0]) {
+			entry.keys = append(entry.keys, placeKey{
+				name: alias.name, key: alias.key, alias: true, abbreviation: alias.abbreviation,
+			})
+		}
+		index.entries = append(index.entries, entry)
+	}
+	return index
+}
+
+// placeWindow is a run of up to maxWindowWords words of the text.
+type placeWindow struct {
+	raw string
+	key string
+}
+
+func placeWindows(text string) []placeWindow {
+	var raw []string
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool {
+		return r == ' ' || r == ',' || r == '.' || r == '?' || r == '!' || r == ';' || r == ':' || r == '/' || r == '\t' || r == '\n'
+	}) {
+		if !placeStopWords[strings.ToLower(word)] {
+			raw = append(raw, word)
+		}
+		if len(raw) == maxPlaceWords {
+			break
+		}
+	}
+
+	var windows []placeWindow
+	for size := 1; size <= maxWindowWords; size++ {
+		for start := 0; start+size <= len(raw); start++ {
+			words := raw[start : start+size]
+			window := placeWindow{raw: strings.Join(words, " "), key: foldName(strings.Join(words, " "))}
+			if window.key != "" {
+				windows = append(windows, window)
+			}
+		}
+	}
+	return windows
+}
+
+// match scores one window against one key.
+func (k placeKey) match(w placeWindow, wholeQuery bool) (float64, string) {
+	if k.abbreviation {
+		if w.key == k.key && (wholeQuery || isAbbreviation(w.raw)) {
+			return aliasConfidence, models.MatchAlias
+		}
+		return 0, ""
+	}
+
+	if w.key == k.key {
+		if k.alias {
+			return aliasConfidence, models.MatchAlias
+		}
+		return exactConfidence, models.MatchExact
+	}
+
+	if len(w.key) >= 3 && len(w.key) < len(k.key) && strings.HasPrefix(k.key, w.key) {
+		score := prefixConfidence * (0.5 + 0.5*float64(len(w.key))/float64(len(k.key)))
+		return score, models.MatchPrefix
+	}
+
+	if len(w.key) < 4 || len(k.key) < 4 {
+		return 0, ""
+	}
+	longest := math.Max(float64(len(w.key)), float64(len(k.key)))
+	maxDistance := int(longest / 4)
+	distance := levenshtein(w.key, k.key, maxDistance)
+	if distance > maxDistance {
+		return 0, ""
+	}
+	score := fuzzyConfidence * (1 - float64(distance)/longest)
+	if k.alias {
+		score *= aliasConfidence / exactConfidence
+	}
+	return score, models.MatchFuzzy
+}
+
+func (index *placeIndex) resolve(text string, level models.UnitLevel) []models.PlaceCandidate {
+	windows := placeWindows(text)
+	if len(windows) == 0 {
+		return []models.PlaceCandidate{}
+	}
+	wholeQuery := len(strings.Fields(text)) == 1
+
+	type best struct {
+		entry     *placeEntry
+		score     float64
+		matchType string
+		matched   string
+		name      string
+	}
+	matches := map[int]*best{}
+	for i := range index.entries {
+		entry := &index.entries[i]
+		for _, key := range entry.keys {
+			for _, window := range windows {
+				score, matchType := key.match(window, wholeQuery)
+				if score == 0 {
+					continue
+				}
+				if current, ok := matches[i]; !ok || score > current.score {
+					matches[i] = &best{entry: entry, score: score, matchType: matchType, matched: window.raw, name: key.key}
+				}
+			}
+		}
+	}
+
+	// Places the text names outright give context to the places inside them
+	named := map[string]bool{}
+	for _, m := range matches {
+		if m.matchType == models.MatchExact || m.matchType == models.MatchAlias {
+			named[m.entry.unit.Path] = true
+		}
+	}
+
+	candidates := make([]models.PlaceCandidate, 0, len(matches))
+	keys := make([]string, 0, len(matches))
+	for _, m := range matches {
+		if level != "" && m.entry.unit.Level != level {
+			continue
+		}
+		score := m.score
+		parts := strings.Split(m.entry.unit.Path, "/")
+		for i := 1; i < len(parts); i++ {
+			if named[strings.Join(parts[:i], "/")] {
+				score += contextBoost
+				break
+			}
+		}
+		candidates = append(candidates, models.PlaceCandidate{
+			Unit:        m.entry.unit,
+			State:       m.entry.state,
+			District:    m.entry.district,
+			MatchedText: m.matched,
+			MatchType:   m.matchType,
+			Confidence:  round(math.Min(score, 1), 2),
+		})
+		keys = append(keys, m.name)
+	}
+
+	// A candidate is ambiguous when another place by the same name scores about as well
+	for i := range candidates {
+		for j := range candidates {
+			if i != j && keys[i] == keys[j] && math.Abs(candidates[i].Confidence-candidates[j].Confidence) <= ambiguityMargin {
+				candidates[i].Ambiguous = true
+				break
+			}
+		}
+	}
+
+	levelRank := map[models.UnitLevel]int{models.LevelState: 0, models.LevelDistrict: 1, models.LevelBlock: 2}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.Confidence != b.Confidence {
+			return a.Confidence > b.Confidence
+		}
+		if levelRank[a.Unit.Level] != levelRank[b.Unit.Level] {
+			return levelRank[a.Unit.Level] < levelRank[b.Unit.Level]
+		}
+		return a.Unit.Path < b.Unit.Path
+	})
+	return candidates
+}
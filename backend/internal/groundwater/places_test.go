@@ -0,0 +1,127 @@
+package groundwater
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+)
+
+// testPlaces is a few states, districts and blocks, with two districts called
+// Aurangabad, sorted by path as buildPlaceIndex reads them.
+func testPlaces() *placeIndex {
+	units := []struct {
+		level models.UnitLevel
+		names []string
+	}{
+		{models.LevelState, []string{"Bihar"}},
+		{models.LevelDistrict, []string{"Bihar", "Aurangabad"}},
+		{models.LevelState, []string{"Haryana"}},
+		{models.LevelDistrict, []string{"Haryana", "Gurugram"}},
+		{models.LevelState, []string{"Maharashtra"}},
+		{models.LevelDistrict, []string{"Maharashtra", "Aurangabad"}},
+		{models.LevelState, []string{"Punjab"}},
+		{models.LevelDistrict, []string{"Punjab", "Ludhiana"}},
+		{models.LevelBlock, []string{"Punjab", "Ludhiana", "Doraha"}},
+		{models.LevelState, []string{"Uttar Pradesh"}},
+		{models.LevelDistrict, []string{"Uttar Pradesh", "Prayagraj"}},
+	}
+	var result []models.AssessmentUnit
+	for _, u := range units {
+		result = append(result, models.AssessmentUnit{
+			Level: u.level, Name: u.names[len(u.names)-1], Path: UnitPath(u.names...),
+		})
+	}
+	return newPlaceIndex(result)
+}
+
+// placeMatch is what a test checks of a candidate.
+type placeMatch struct {
+	path       string
+	matchType  string
+	confidence float64
+	ambiguous  bool
+}
+
+func TestResolvePlace(t *testing.T) {
+	index := testPlaces()
+	tests := []struct {
+		name  string
+		text  string
+		level models.UnitLevel
+		want  []placeMatch
+	}{
+		{name: "exact", text: "ludhiana", want: []placeMatch{{"punjab/ludhiana", models.MatchExact, 0.9, false}}},
+		{
+			name: "devanagari",
+			text: "लुधियाना",
+			want: []placeMatch{{"punjab/ludhiana", models.MatchExact, 0.9, false}},
+		},
+		{
+			name: "stop words",
+			text: "show me groundwater in Ludhiana district",
+			want: []placeMatch{{"punjab/ludhiana", models.MatchExact, 0.9, false}},
+		},
+		{
+			// ludhyan is one edit from ludhian: 0.85 × (1 - 1/7)
+			name: "misspelt",
+			text: "ludhyana",
+			want: []placeMatch{{"punjab/ludhiana", models.MatchFuzzy, 0.73, false}},
+		},
+		{
+			// Four letters of seven: 0.8 × (0.5 + 0.5 × 4/7)
+			name: "prefix",
+			text: "ludh",
+			want: []placeMatch{{"punjab/ludhiana", models.MatchPrefix, 0.63, false}},
+		},
+		{name: "old name", text: "Allahabad", want: []placeMatch{{"uttar pradesh/prayagraj", models.MatchAlias, 0.85, false}}},
+		{name: "hindi alias", text: "गुड़गांव", want: []placeMatch{{"haryana/gurugram", models.MatchAlias, 0.85, false}}},
+		{
+			name: "abbreviation",
+			text: "groundwater in UP",
+			want: []placeMatch{{"uttar pradesh", models.MatchAlias, 0.85, false}},
+		},
+		{name: "abbreviation alone", text: "up", want: []placeMatch{{"uttar pradesh", models.MatchAlias, 0.85, false}}},
+		// Written in lower case among other words, "up" is just a word
+		{name: "not an abbreviation", text: "is it going up", want: []placeMatch{}},
+		{
+			name: "ambiguous",
+			text: "Aurangabad",
+			want: []placeMatch{
+				{"bihar/aurangabad", models.MatchExact, 0.9, true},
+				{"maharashtra/aurangabad", models.MatchExact, 0.9, true},
+			},
+		},
+		{
+			// Naming the state settles it
+			name: "state as context",
+			text: "Aurangabad, Bihar",
+			want: []placeMatch{
+				{"bihar/aurangabad", models.MatchExact, 1, false},
+				{"bihar", models.MatchExact, 0.9, false},
+				{"maharashtra/aurangabad", models.MatchExact, 0.9, false},
+			},
+		},
+		{
+			name: "district as context",
+			text: "Doraha Ludhiana",
+			want: []placeMatch{
+				{"punjab/ludhiana/doraha", models.MatchExact, 1, false},
+				{"punjab/ludhiana", models.MatchExact, 0.9, false},
+			},
+		},
+		{name: "level", text: "Aurangabad, Bihar", level: models.LevelState, want: []placeMatch{{"bihar", models.MatchExact, 0.9, false}}},
+		{name: "no place", text: "what is the water level", want: []placeMatch{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []placeMatch{}
+			for _, c := range index.resolve(tt.text, tt.level) {
+				got = append(got, placeMatch{c.Unit.Path, c.MatchType, c.Confidence, c.Ambiguous})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolve(%q) = %+v\nwant %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
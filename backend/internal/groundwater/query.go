@@ -0,0 +1,234 @@
+package groundwater
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+	"github.com/lib/pq"
+)
+
+// MaxCompareUnits caps how many units one comparison may ask for.
+const MaxCompareUnits = 10
+
+var (
+	ErrUnitNotFound  = errors.New("assessment unit not found")
+	ErrNoAssessments = errors.New("no assessment data has been imported")
+	ErrTooManyUnits  = fmt.Errorf("at most %d units can be compared", MaxCompareUnits)
+)
+
+const unitColumns = `u.id, u.parent_id, u.level, u.name, u.path, u.code, u.created_at`
+
+const assessmentColumns = `a.unit_id, a.year, a.dataset_id, a.recharge_rainfall, a.recharge_other,
+	a.annual_recharge, a.natural_discharge, a.extractable_resource, a.extraction_irrigation,
+	a.extraction_industrial, a.extraction_domestic, a.total_extraction, a.stage_of_extraction,
+	a.category, a.future_availability, a.updated_at`
+
+// UnitFilter narrows ListUnits. State and District match unit names the way UnitPath
+// spells them, so "Uttar  Pradesh" and "uttar pradesh" are the same state.
+type UnitFilter struct {
+	State    string
+	District string
+	Level    models.UnitLevel
+	Category models.GroundwaterCategory
+	// Year defaults to the latest assessment year
+	Year   int
+	Limit  int
+	Offset int
+}
+
+// LatestYear returns the most recent assessment year on record.
+func (s *Service) LatestYear(ctx context.Context) (int, error) {
+	var year sql.NullInt64
+	if err := s.db.DB.QueryRowContext(ctx, "SELECT MAX(year) FROM groundwater_assessments").Scan(&year); err != nil {
+		return 0, fmt.Errorf("latest year lookup error: %w", err)
+	}
+	if !year.Valid {
+		return 0, ErrNoAssessments
+	}
+	return int(year.Int64), nil
+}
+
+// ListUnits returns one page of units with their assessment for the filter's year, and
+// the number of units matching the filter. Units without an assessment that year are
+// listed without one unless the filter asks for a category.
+func (s *Service) ListUnits(ctx context.Context, filter UnitFilter) ([]models.UnitAssessment, int, error) {
+	if filter.Year == 0 {
+		year, err := s.LatestYear(ctx)
+		if err != nil {
+			return nil, 0, err
+		}
+		filter.Year = year
+	}
+
+	args := []interface{}{filter.Year}
+	conditions := []string{"TRUE"}
+	addCondition := func(format string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(format, len(args)))
+	}
+	if filter.State != "" {
+		addCondition("split_part(u.path, '/', 1) = $%d", UnitPath(filter.State))
+	}
+	if filter.District != "" {
+		addCondition("split_part(u.path, '/', 2) = $%d", UnitPath(filter.District))
+	}
+	if filter.Level != "" {
+		addCondition("u.level = $%d", filter.Level)
+	}
+	if filter.Category != "" {
+		addCondition("a.category = $%d", filter.Category)
+	}
+	from := fmt.Sprintf(`
+		FROM groundwater_units u
+		LEFT JOIN groundwater_assessments a ON a.unit_id = u.id AND a.year = $1
+		WHERE %s`, strings.Join(conditions, " AND "))
+
+	// Counted separately, so a page past the end still reports the total
+	var total int
+	if err := s.db.DB.QueryRowContext(ctx, "SELECT COUNT(*)"+from, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("unit count error: %w", err)
+	}
+
+	args = append(args, filter.Limit, filter.Offset)
+	rows, err := s.db.DB.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s, a.year%s
+		ORDER BY u.path LIMIT $%d OFFSET $%d`,
+		unitColumns, from, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unit list error: %w", err)
+	}
+	defer rows.Close()
+
+	units := []models.UnitAssessment{}
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		var item models.UnitAssessment
+		var year sql.NullInt64
+		if err := rows.Scan(&item.Unit.ID, &item.Unit.ParentID, &item.Unit.Level, &item.Unit.Name,
+			&item.Unit.Path, &item.Unit.Code, &item.Unit.CreatedAt, &year); err != nil {
+			return nil, 0, err
+		}
+		if year.Valid {
+			ids = append(ids, item.Unit.ID)
+		}
+		units = append(units, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	if len(ids) == 0 {
+		return units, total, nil
+	}
+
+	assessments, err := s.assessments(ctx, ids, filter.Year)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range units {
+		if series := assessments[units[i].Unit.ID]; len(series) > 0 {
+			units[i].Assessment = &series[0]
+		}
+	}
+	return units, total, nil
+}
+
+// Unit returns one assessment unit.
+func (s *Service) Unit(ctx context.Context, id uuid.UUID) (*models.AssessmentUnit, error) {
+	var unit models.AssessmentUnit
+	err := s.db.DB.QueryRowContext(ctx, "SELECT "+unitColumns+" FROM groundwater_units u WHERE u.id = $1", id).
+		Scan(&unit.ID, &unit.ParentID, &unit.Level, &unit.Name, &unit.Path, &unit.Code, &unit.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrUnitNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("unit lookup error: %w", err)
+	}
+	return &unit, nil
+}
+
+// UnitSeries returns a unit with every year assessed for it, oldest first.
+func (s *Service) UnitSeries(ctx context.Context, id uuid.UUID) (*models.UnitSeries, error) {
+	series, err := s.CompareUnits(ctx, []uuid.UUID{id}, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &series[0], nil
+}
+
+// CompareUnits returns the series of several units in the order they were asked for,
+// limited to one year when year is set.
+func (s *Service) CompareUnits(ctx context.Context, ids []uuid.UUID, year int) ([]models.UnitSeries, error) {
+	if len(ids) > MaxCompareUnits {
+		return nil, ErrTooManyUnits
+	}
+
+	rows, err := s.db.DB.QueryContext(ctx,
+		"SELECT "+unitColumns+" FROM groundwater_units u WHERE u.id = ANY($1)", pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("unit lookup error: %w", err)
+	}
+	defer rows.Close()
+
+	units := map[uuid.UUID]models.AssessmentUnit{}
+	for rows.Next() {
+		var unit models.AssessmentUnit
+		if err := rows.Scan(&unit.ID, &unit.ParentID, &unit.Level, &unit.Name, &unit.Path, &unit.Code,
+			&unit.CreatedAt); err != nil {
+			return nil, err
+		}
+		units[unit.ID] = unit
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	assessments, err := s.assessments(ctx, ids, year)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]models.UnitSeries, 0, len(ids))
+	for _, id := range ids {
+		unit, ok := units[id]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnitNotFound, id)
+		}
+		series := assessments[id]
+		if series == nil {
+			series = []models.Assessment{}
+		}
+		result = append(result, models.UnitSeries{Unit: unit, Series: series})
+	}
+	return result, nil
+}
+
+// assessments loads the units' assessments by unit, oldest year first. A zero year loads
+// every year.
+func (s *Service) assessments(ctx context.Context, ids []uuid.UUID, year int) (map[uuid.UUID][]models.Assessment, error) {
+	rows, err := s.db.DB.QueryContext(ctx, `
+		SELECT `+assessmentColumns+`
+		FROM groundwater_assessments a
+		WHERE a.unit_id = ANY($1) AND ($2 = 0 OR a.year = $2)
+		ORDER BY a.unit_id, a.year`, pq.Array(ids), year)
+	if err != nil {
+		return nil, fmt.Errorf("assessment lookup error: %w", err)
+	}
+	defer rows.Close()
+
+	result := map[uuid.UUID][]models.Assessment{}
+	for rows.Next() {
+		var a models.Assessment
+		if err := rows.Scan(&a.UnitID, &a.Year, &a.DatasetID, &a.RechargeRainfall, &a.RechargeOther,
+			&a.AnnualRecharge, &a.NaturalDischarge, &a.ExtractableResource, &a.ExtractionIrrigation,
+			&a.ExtractionIndustrial, &a.ExtractionDomestic, &a.TotalExtraction, &a.StageOfExtraction,
+			&a.Category, &a.FutureAvailability, &a.UpdatedAt); err != nil {
+			return nil, err
+		}
+		result[a.UnitID] = append(result[a.UnitID], a)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,519 @@
+package groundwater
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/analytics"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/database"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+)
+
+const (
+	// minNormalYears is how many years of a month a normal is averaged from when no
+	// normals were imported
+	minNormalYears = 10
+	// monsoonFirst and monsoonLast bound the southwest monsoon, June to September
+	monsoonFirst = 6
+	monsoonLast  = 9
+)
+
+// Which rainfall a correlation uses, as RainfallCorrelation.Rainfall.
+const (
+	RainfallAnnual  = "annual"
+	RainfallMonsoon = "monsoon"
+)
+
+var (
+	ErrNoRainfall            = errors.New("no rainfall on record here")
+	ErrUnknownRainfallPeriod = errors.New("rainfall must be annual or monsoon")
+)
+
+// RainfallImportReport says what a rainfall import did with every row of a file. Inserted,
+// Updated and Unchanged count monthly values.
+type RainfallImportReport struct {
+	FileName           string  `json:"file_name"`
+	Checksum           string  `json:"checksum"`
+	Source             string  `json:"source"`
+	DryRun             bool    `json:"dry_run"`
+	AlreadyImported    bool    `json:"already_imported"`
+	Normals            bool    `json:"normals"`
+	Rows               int     `json:"rows"`
+	Accepted           int     `json:"accepted"`
+	Rejected           int     `json:"rejected"`
+	Inserted           int     `json:"inserted"`
+	Updated            int     `json:"updated"`
+	Unchanged          int     `json:"unchanged"`
+	DistrictsUnmatched int     `json:"districts_unmatched"`
+	Issues             []Issue `json:"issues"`
+}
+
+func (r *RainfallImportReport) addError(line int, field, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, Issue{Line: line, Severity: SeverityError, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *RainfallImportReport) addWarning(line int, field, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, Issue{Line: line, Severity: SeverityWarning, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// ImportRainfall validates a district rainfall export and stores its monthly values, or
+// its normals when the file has no years. Like Import, a file is only applied once and
+// unchanged values are left alone. Rows for districts not on record are skipped.
+func (s *Service) ImportRainfall(ctx context.Context, fileName string, data []byte, opts ImportOptions) (*RainfallImportReport, error) {
+	sum := sha256.Sum256(data)
+	report := &RainfallImportReport{
+		FileName: fileName,
+		Checksum: hex.EncodeToString(sum[:]),
+		Source:   opts.Source,
+		DryRun:   opts.DryRun,
+		Issues:   []Issue{},
+	}
+
+	if !opts.Force {
+		var exists bool
+		if err := s.db.DB.QueryRowContext(ctx,
+			"SELECT EXISTS (SELECT 1 FROM groundwater_rainfall_imports WHERE checksum = $1)", report.Checksum).
+			Scan(&exists); err != nil {
+			return nil, fmt.Errorf("rainfall import lookup error: %w", err)
+		}
+		if exists {
+			report.AlreadyImported = true
+			return report, nil
+		}
+	}
+
+	records, err := ParseRainfallCSV(bytes.NewReader(data), ParseOptions{Year: opts.Year}, report)
+	if err != nil {
+		return report, err
+	}
+	if opts.DryRun {
+		return report, nil
+	}
+
+	districts, err := s.unitKeys(ctx, models.LevelDistrict)
+	if err != nil {
+		return report, err
+	}
+
+	err = s.db.WithTransaction(ctx, func(tx *sql.Tx) error {
+		var importID uuid.UUID
+		if err := tx.QueryRowContext(ctx, `
+			INSERT INTO groundwater_rainfall_imports (source, file_name, checksum, rows_total)
+			VALUES ($1, $2, $3, $4) RETURNING id`,
+			opts.Source, fileName, report.Checksum, report.Rows).Scan(&importID); err != nil {
+			return err
+		}
+
+		// Each unmatched district is reported once, and its rows count as rejected
+		unmatched := map[string]map[int]bool{}
+		for _, r := range records {
+			path := foldPath(r.State, r.District)
+			unitID, ok := districts.byPath[path]
+			if !ok {
+				if unmatched[path] == nil {
+					unmatched[path] = map[int]bool{}
+					report.addWarning(r.Line, "district", "district %s, %s isn't on record; its rows were skipped",
+						r.District, r.State)
+				}
+				unmatched[path][r.Line] = true
+				continue
+			}
+			if err := upsertRainfall(ctx, tx, unitID, importID, r, report); err != nil {
+				return fmt.Errorf("line %d: %w", r.Line, err)
+			}
+		}
+		for _, lines := range unmatched {
+			report.Accepted -= len(lines)
+			report.Rejected += len(lines)
+		}
+		report.DistrictsUnmatched = len(unmatched)
+
+		reportJSON, err := json.Marshal(report)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE groundwater_rainfall_imports SET rows_imported = $1, rows_rejected = $2, report = $3 WHERE id = $4`,
+			report.Accepted, report.Rejected, string(reportJSON), importID); err != nil {
+			return err
+		}
+
+		return database.RecordAudit(ctx, tx, database.AuditEntry{
+			Action:       "groundwater.rainfall_imported",
+			ResourceType: "groundwater_rainfall_import",
+			ResourceID:   importID.String(),
+			NewValues: map[string]interface{}{
+				"file_name": fileName,
+				"normals":   report.Normals,
+				"inserted":  report.Inserted,
+				"updated":   report.Updated,
+				"rejected":  report.Rejected,
+			},
+		})
+	})
+	if err != nil {
+		return report, fmt.Errorf("rainfall import error: %w", err)
+	}
+	return report, nil
+}
+
+// upsertRainfall writes a month's rainfall or normal unless the stored one is the same.
+func upsertRainfall(ctx context.Context, tx *sql.Tx, unitID, importID uuid.UUID, r RainfallRecord, report *RainfallImportReport) error {
+	var inserted bool
+	var err error
+	if r.Year == 0 {
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO groundwater_rainfall_normals AS n (unit_id, month, rainfall, import_id)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (unit_id, month) DO UPDATE SET rainfall = EXCLUDED.rainfall, import_id = EXCLUDED.import_id
+			WHERE n.rainfall IS DISTINCT FROM EXCLUDED.rainfall
+			RETURNING xmax = 0`,
+			unitID, r.Month, r.Rainfall, importID).Scan(&inserted)
+	} else {
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO groundwater_rainfall AS r (unit_id, year, month, rainfall, import_id)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (unit_id, year, month) DO UPDATE SET rainfall = EXCLUDED.rainfall, import_id = EXCLUDED.import_id
+			WHERE r.rainfall IS DISTINCT FROM EXCLUDED.rainfall
+			RETURNING xmax = 0`,
+			unitID, r.Year, r.Month, r.Rainfall, importID).Scan(&inserted)
+	}
+	switch {
+	case err == sql.ErrNoRows:
+		report.Unchanged++
+	case err != nil:
+		return err
+	case inserted:
+		report.Inserted++
+	default:
+		report.Updated++
+	}
+	return nil
+}
+
+// rainfallPath is the path of the units whose district rainfall stands for a unit: a
+// block takes its district's.
+func rainfallPath(unit *models.AssessmentUnit) string {
+	if unit.Level == models.LevelBlock {
+		if i := strings.LastIndex(unit.Path, "/"); i >= 0 {
+			return unit.Path[:i]
+		}
+	}
+	return unit.Path
+}
+
+// UnitRainfall returns a unit's rainfall by year with its departure from normal, and the
+// months of year, or of the latest year when year is 0. States average their districts'
+// rainfall month by month.
+func (s *Service) UnitRainfall(ctx context.Context, unitID uuid.UUID, year int) (*models.RainfallSeries, error) {
+	unit, err := s.Unit(ctx, unitID)
+	if err != nil {
+		return nil, err
+	}
+	path := rainfallPath(unit)
+
+	rows, err := s.db.DB.QueryContext(ctx, `
+		SELECT r.year, r.month, AVG(r.rainfall)
+		FROM groundwater_rainfall r JOIN groundwater_units u ON u.id = r.unit_id
+		WHERE u.path = $1 OR left(u.path, length($1) + 1) = $1 || '/'
+		GROUP BY 1, 2 ORDER BY 1, 2`, path)
+	if err != nil {
+		return nil, fmt.Errorf("rainfall lookup error: %w", err)
+	}
+	defer rows.Close()
+
+	monthly := map[int]map[int]float64{}
+	var years []int
+	for rows.Next() {
+		var y, month int
+		var rainfall float64
+		if err := rows.Scan(&y, &month, &rainfall); err != nil {
+			return nil, err
+		}
+		if monthly[y] == nil {
+			monthly[y] = map[int]float64{}
+			years = append(years, y)
+		}
+		monthly[y][month] = rainfall
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(years) == 0 {
+		return nil, ErrNoRainfall
+	}
+
+	series := &models.RainfallSeries{Unit: *unit, Years: make([]models.RainfallYear, 0, len(years))}
+	if err := s.db.DB.QueryRowContext(ctx, `
+		SELECT COUNT(DISTINCT r.unit_id)
+		FROM groundwater_rainfall r JOIN groundwater_units u ON u.id = r.unit_id
+		WHERE u.path = $1 OR left(u.path, length($1) + 1) = $1 || '/'`, path).Scan(&series.Districts); err != nil {
+		return nil, fmt.Errorf("rainfall district count error: %w", err)
+	}
+
+	normals, err := s.rainfallNormals(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if len(normals) > 0 {
+		series.NormalSource = "imported"
+	} else if normals = averageNormals(years, monthly); len(normals) > 0 {
+		series.NormalSource = "computed"
+	}
+
+	for _, y := range years {
+		series.Years = append(series.Years, rainfallYear(y, monthly[y], normals))
+	}
+
+	if year == 0 {
+		year = years[len(years)-1]
+	}
+	if monthly[year] == nil {
+		return nil, fmt.Errorf("%w for %d", ErrNoRainfall, year)
+	}
+	series.Year = year
+	for month := 1; month <= 12; month++ {
+		rainfall, ok := monthly[year][month]
+		if !ok {
+			continue
+		}
+		m := models.RainfallMonth{Month: month, Rainfall: round(rainfall, 1)}
+		if normal, ok := normals[month]; ok {
+			n := round(normal, 1)
+			m.Normal, m.Departure = &n, departure(rainfall, normal)
+		}
+		series.Months = append(series.Months, m)
+	}
+	return series, nil
+}
+
+// rainfallNormals loads the imported monthly normals of the districts under path,
+// averaged across them.
+func (s *Service) rainfallNormals(ctx context.Context, path string) (map[int]float64, error) {
+	rows, err := s.db.DB.QueryContext(ctx, `
+		SELECT n.month, AVG(n.rainfall)
+		FROM groundwater_rainfall_normals n JOIN groundwater_units u ON u.id = n.unit_id
+		WHERE u.path = $1 OR left(u.path, length($1) + 1) = $1 || '/'
+		GROUP BY 1`, path)
+	if err != nil {
+		return nil, fmt.Errorf("rainfall normal lookup error: %w", err)
+	}
+	defer rows.Close()
+
+	normals := map[int]float64{}
+	for rows.Next() {
+		var month int
+		var normal float64
+		if err := rows.Scan(&month, &normal); err != nil {
+			return nil, err
+		}
+		normals[month] = normal
+	}
+	return normals, rows.Err()
+}
+
+// averageNormals averages each month over the years on record, for months with at least
+// minNormalYears of them. Years are summed in order so results are identical from run to
+// run.
+func averageNormals(years []int, monthly map[int]map[int]float64) map[int]float64 {
+	sums, counts := map[int]float64{}, map[int]int{}
+	for _, year := range years {
+		for month, rainfall := range monthly[year] {
+			sums[month] += rainfall
+			counts[month]++
+		}
+	}
+	normals := map[int]float64{}
+	for month, n := range counts {
+		if n >= minNormalYears {
+			normals[month] = sums[month] / float64(n)
+		}
+	}
+	return normals
+}
+
+// rainfallYear totals a year's months and compares them with the normal for the same
+// months, so a year still being reported isn't counted as a deficit.
+func rainfallYear(year int, months map[int]float64, normals map[int]float64) models.RainfallYear {
+	total, normal, hasNormals := 0.0, 0.0, true
+	for month := 1; month <= 12; month++ {
+		rainfall, ok := months[month]
+		if !ok {
+			continue
+		}
+		total += rainfall
+		n, ok := normals[month]
+		hasNormals = hasNormals && ok
+		normal += n
+	}
+
+	result := models.RainfallYear{Year: year, Months: len(months), Rainfall: round(total, 1)}
+	if hasNormals {
+		n := round(normal, 1)
+		result.Normal, result.Departure = &n, departure(total, normal)
+		if result.Departure != nil {
+			result.Category = rainfallCategory(*result.Departure)
+		}
+	}
+
+	var monsoon, monsoonNormal float64
+	monsoonComplete, monsoonNormals := true, true
+	for month := monsoonFirst; month <= monsoonLast; month++ {
+		rainfall, ok := months[month]
+		monsoonComplete = monsoonComplete && ok
+		monsoon += rainfall
+		n, ok := normals[month]
+		monsoonNormals = monsoonNormals && ok
+		monsoonNormal += n
+	}
+	if monsoonComplete {
+		m := round(monsoon, 1)
+		result.Monsoon = &m
+		if monsoonNormals {
+			n := round(monsoonNormal, 1)
+			result.MonsoonNormal, result.MonsoonDeparture = &n, departure(monsoon, monsoonNormal)
+		}
+	}
+	return result
+}
+
+// departure is the percentage by which rainfall is above or below normal, or nil
+// without a normal to compare with.
+func departure(rainfall, normal float64) *float64 {
+	if normal <= 0 {
+		return nil
+	}
+	d := round((rainfall-normal)/normal*100, 1)
+	return &d
+}
+
+// rainfallCategory is IMD's category for a departure from normal.
+func rainfallCategory(departure float64) models.RainfallCategory {
+	switch {
+	case departure >= 60:
+		return models.RainfallLargeExcess
+	case departure >= 20:
+		return models.RainfallExcess
+	case departure > -20:
+		return models.RainfallNormal
+	case departure > -60:
+		return models.RainfallDeficient
+	case departure > -100:
+		return models.RainfallLargeDeficient
+	default:
+		return models.RainfallNoRain
+	}
+}
+
+// RainfallCorrelation relates a unit's annual or monsoon rainfall by year to its annual
+// recharge and to the yearly change in its wells' water level. Only years with the whole
+// period reported are used. A relation without data has no points.
+func (s *Service) RainfallCorrelation(ctx context.Context, unitID uuid.UUID, period string) (*models.RainfallCorrelation, error) {
+	if period == "" {
+		period = RainfallAnnual
+	}
+	if period != RainfallAnnual && period != RainfallMonsoon {
+		return nil, ErrUnknownRainfallPeriod
+	}
+
+	rainfall, err := s.UnitRainfall(ctx, unitID, 0)
+	if err != nil {
+		return nil, err
+	}
+	byYear := map[int]float64{}
+	for _, y := range rainfall.Years {
+		switch {
+		case period == RainfallAnnual && y.Months == 12:
+			byYear[y.Year] = y.Rainfall
+		case period == RainfallMonsoon && y.Monsoon != nil:
+			byYear[y.Year] = *y.Monsoon
+		}
+	}
+
+	balances, err := s.rollup(ctx, unitID)
+	if err != nil {
+		return nil, err
+	}
+	recharge := map[int]float64{}
+	for _, b := range balances.years {
+		if b.AnnualRecharge > 0 {
+			recharge[b.Year] = round(b.AnnualRecharge, 2)
+		}
+	}
+
+	// A positive change means the water table fell over the year
+	levelChange := map[int]float64{}
+	levels, err := s.UnitWaterLevels(ctx, unitID, DefaultChangeYears)
+	switch {
+	case err == nil:
+		trend := map[int]float64{}
+		for _, p := range levels.Points {
+			trend[p.Year] = p.Trend
+		}
+		for year, level := range trend {
+			if previous, ok := trend[year-1]; ok {
+				levelChange[year] = round(level-previous, 2)
+			}
+		}
+	case !errors.Is(err, ErrNoWellReadings):
+		return nil, err
+	}
+
+	result := &models.RainfallCorrelation{Unit: rainfall.Unit, Rainfall: period}
+	for _, relation := range []struct {
+		variable, unit string
+		values         map[int]float64
+	}{
+		{"annual_recharge", "ham", recharge},
+		{"water_level_change", "m", levelChange},
+	} {
+		r, err := rainfallRelation(byYear, relation.values)
+		if err != nil {
+			return nil, err
+		}
+		r.Variable, r.VariableUnit = relation.variable, relation.unit
+		result.Relations = append(result.Relations, r)
+	}
+	return result, nil
+}
+
+// rainfallRelation pairs rainfall with a variable over the years both have.
+func rainfallRelation(rainfall, values map[int]float64) (models.RainfallRelation, error) {
+	relation := models.RainfallRelation{Points: []models.ScatterPoint{}}
+	for year, y := range values {
+		if x, ok := rainfall[year]; ok {
+			relation.Points = append(relation.Points, models.ScatterPoint{Year: year, X: x, Y: y})
+		}
+	}
+	sort.Slice(relation.Points, func(i, j int) bool { return relation.Points[i].Year < relation.Points[j].Year })
+
+	x := make([]float64, len(relation.Points))
+	y := make([]float64, len(relation.Points))
+	for i, p := range relation.Points {
+		x[i], y[i] = p.X, p.Y
+	}
+	c, err := analytics.Correlate(x, y)
+	switch {
+	case err == nil:
+		relation.Coefficients = &models.CorrelationCoefficients{
+			N:         c.N,
+			Pearson:   round(c.Pearson, 3),
+			Spearman:  round(c.Spearman, 3),
+			PValue:    round(c.PValue, 4),
+			Slope:     round(c.Slope, 6),
+			Intercept: round(c.Intercept, 3),
+		}
+	case !errors.Is(err, analytics.ErrTooFewPoints) && !errors.Is(err, analytics.ErrNoVariation):
+		return relation, err
+	}
+	return relation, nil
+}
@@ -0,0 +1,337 @@
+package groundwater
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type rainfallField int
+
+const (
+	rainfallFieldState rainfallField = iota
+	rainfallFieldDistrict
+	rainfallFieldYear
+	rainfallFieldMonth
+	rainfallFieldRainfall
+	rainfallFieldAnnual
+)
+
+// rainfallFieldAliases are header spellings seen in IMD and India-WRIS rainfall exports,
+// after normaliseRainfallHeader. Month columns are matched by monthNames.
+var rainfallFieldAliases = map[rainfallField][]string{
+	rainfallFieldState:    append([]string{"state ut name", "state name ut"}, fieldAliases[fieldState]...),
+	rainfallFieldDistrict: fieldAliases[fieldDistrict],
+	rainfallFieldYear:     {"year"},
+	rainfallFieldMonth:    {"month"},
+	rainfallFieldRainfall: {"rainfall", "actual rainfall", "actual", "rain", "precipitation", "monthly rainfall"},
+	rainfallFieldAnnual:   {"annual", "annual rainfall", "annual total"},
+}
+
+// monthNames map a lower-cased month name or abbreviation to its number.
+var monthNames = map[string]int{
+	"jan": 1, "january": 1, "feb": 2, "february": 2, "mar": 3, "march": 3, "apr": 4, "april": 4,
+	"may": 5, "jun": 6, "june": 6, "jul": 7, "july": 7, "aug": 8, "august": 8,
+	"sep": 9, "sept": 9, "september": 9, "oct": 10, "october": 10, "nov": 11, "november": 11,
+	"dec": 12, "december": 12,
+}
+
+const (
+	// minRainfallYear is the first year of IMD's district rainfall series
+	minRainfallYear = 1901
+	// maxMonthlyRainfall is beyond the wettest month on record in India, in millimetres
+	maxMonthlyRainfall = 10000
+)
+
+// RainfallRecord is one district's rainfall in one month, in millimetres. Year is 0 for
+// a normal.
+type RainfallRecord struct {
+	Line     int
+	State    string
+	District string
+	Year     int
+	Month    int
+	Rainfall float64
+}
+
+func (r RainfallRecord) key() string {
+	return fmt.Sprintf("%s/%d/%d", foldPath(r.State, r.District), r.Year, r.Month)
+}
+
+// rainfallColumns is where a file keeps each field. A wide file has a column per month;
+// a long one has a month and a rainfall column.
+type rainfallColumns struct {
+	fields map[rainfallField]int
+	months map[int]int
+}
+
+// ParseRainfallCSV reads a district rainfall export, either a column per month or a row
+// per month, collecting rejected rows and suspicious values in the report. A file with
+// no year column, imported without a year, holds normals.
+func ParseRainfallCSV(r io.Reader, opts ParseOptions, report *RainfallImportReport) ([]RainfallRecord, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	columns, err := findRainfallHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRainfallColumns(columns); err != nil {
+		return nil, err
+	}
+	_, hasYear := columns.fields[rainfallFieldYear]
+	report.Normals = !hasYear && opts.Year == 0
+
+	var records []RainfallRecord
+	seen := map[string]int{}
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("reading CSV: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+		if blankRow(row) {
+			continue
+		}
+
+		report.Rows++
+		rowRecords, ok := parseRainfallRow(row, line, columns, opts, report)
+		if !ok {
+			report.Rejected++
+			continue
+		}
+		if rowRecords == nil {
+			continue
+		}
+
+		duplicate := false
+		for _, record := range rowRecords {
+			if first, dup := seen[record.key()]; dup {
+				report.addError(line, "", "duplicate of line %d for %s, %s in %s", first, record.District,
+					record.State, rainfallPeriod(record))
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			report.Rejected++
+			continue
+		}
+		for _, record := range rowRecords {
+			seen[record.key()] = line
+		}
+
+		report.Accepted++
+		records = append(records, rowRecords...)
+	}
+	return records, nil
+}
+
+// findRainfallHeader skips title rows until one names a district and its rainfall.
+func findRainfallHeader(reader *csv.Reader) (*rainfallColumns, error) {
+	for i := 0; i < headerSearchRows; i++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("reading CSV header: %w", err)
+		}
+
+		columns := &rainfallColumns{fields: map[rainfallField]int{}, months: map[int]int{}}
+		for index, cell := range row {
+			name := normaliseRainfallHeader(cell)
+			if month, ok := monthNames[name]; ok {
+				if _, taken := columns.months[month]; !taken {
+					columns.months[month] = index
+				}
+			} else if f, ok := matchRainfallField(name); ok {
+				if _, taken := columns.fields[f]; !taken {
+					columns.fields[f] = index
+				}
+			}
+		}
+		_, hasDistrict := columns.fields[rainfallFieldDistrict]
+		_, hasRainfall := columns.fields[rainfallFieldRainfall]
+		if hasDistrict && (hasRainfall || len(columns.months) > 0) {
+			return columns, nil
+		}
+	}
+	return nil, errors.New("no header row with district and rainfall or month columns in the first rows")
+}
+
+func checkRainfallColumns(columns *rainfallColumns) error {
+	var missing []string
+	if _, ok := columns.fields[rainfallFieldState]; !ok {
+		missing = append(missing, "state")
+	}
+	if len(columns.months) == 0 {
+		if _, ok := columns.fields[rainfallFieldMonth]; !ok {
+			missing = append(missing, "month (or a column per month)")
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing columns: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// normaliseRainfallHeader is normaliseHeader without a trailing "mm".
+func normaliseRainfallHeader(header string) string {
+	name, _ := normaliseHeader(header)
+	words := strings.Fields(name)
+	for len(words) > 1 && (words[len(words)-1] == "mm" || words[len(words)-1] == "in") {
+		words = words[:len(words)-1]
+	}
+	return strings.Join(words, " ")
+}
+
+func matchRainfallField(name string) (rainfallField, bool) {
+	for f, aliases := range rainfallFieldAliases {
+		for _, alias := range aliases {
+			if name == alias {
+				return f, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// parseMonth reads a month name, abbreviation or number.
+func parseMonth(raw string) (int, bool) {
+	if month, ok := monthNames[strings.ToLower(strings.TrimSuffix(raw, "."))]; ok {
+		return month, true
+	}
+	month, err := strconv.Atoi(raw)
+	return month, err == nil && month >= 1 && month <= 12
+}
+
+// rainfallPeriod names a record's month for messages.
+func rainfallPeriod(r RainfallRecord) string {
+	if r.Year == 0 {
+		return "the " + time.Month(r.Month).String() + " normal"
+	}
+	return fmt.Sprintf("%d-%02d", r.Year, r.Month)
+}
+
+// parseRainfallRow validates one row, returning a record for each month it reports. A
+// summary row is skipped with no records. Unusable values reject the whole row.
+func parseRainfallRow(row []string, line int, columns *rainfallColumns, opts ParseOptions, report *RainfallImportReport) ([]RainfallRecord, bool) {
+	cell := func(index int) string {
+		if index < len(row) {
+			return strings.Join(strings.Fields(row[index]), " ")
+		}
+		return ""
+	}
+	text := func(f rainfallField) string {
+		if index, ok := columns.fields[f]; ok {
+			return cell(index)
+		}
+		return ""
+	}
+
+	ok := true
+	number := func(raw, name string, max float64) *float64 {
+		raw = strings.ReplaceAll(raw, ",", "")
+		if raw == "" || raw == "-" || strings.EqualFold(raw, "na") || strings.EqualFold(raw, "n/a") {
+			return nil
+		}
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			report.addError(line, name, "%q is not a number", raw)
+			ok = false
+			return nil
+		}
+		if value < 0 || value > max {
+			report.addError(line, name, "%g mm of rain is not plausible", value)
+			ok = false
+			return nil
+		}
+		return &value
+	}
+
+	state, district := text(rainfallFieldState), text(rainfallFieldDistrict)
+	for _, name := range []string{state, district} {
+		if summaryNames[strings.ToLower(name)] {
+			report.addWarning(line, "", "skipped summary row %q", name)
+			return nil, true
+		}
+	}
+	if state == "" || district == "" {
+		report.addError(line, "district", "state and district are both needed")
+		return nil, false
+	}
+
+	year := opts.Year
+	if raw := text(rainfallFieldYear); raw != "" {
+		year = 0
+		if len(raw) >= 4 {
+			year, _ = strconv.Atoi(raw[:4])
+		}
+		if year < minRainfallYear || year > maxYear {
+			report.addError(line, "year", "year %q is not between %d and %d", raw, minRainfallYear, maxYear)
+			return nil, false
+		}
+	} else if _, hasYear := columns.fields[rainfallFieldYear]; hasYear && year == 0 {
+		report.addError(line, "year", "no year")
+		return nil, false
+	}
+
+	var records []RainfallRecord
+	record := func(month int, rainfall float64) {
+		records = append(records, RainfallRecord{Line: line, State: state, District: district, Year: year,
+			Month: month, Rainfall: rainfall})
+	}
+
+	if len(columns.months) > 0 {
+		var sum float64
+		for month := 1; month <= 12; month++ {
+			index, has := columns.months[month]
+			if !has {
+				continue
+			}
+			if value := number(cell(index), strings.ToLower(time.Month(month).String()[:3]), maxMonthlyRainfall); value != nil {
+				record(month, *value)
+				sum += *value
+			}
+		}
+		if !ok {
+			return nil, false
+		}
+		annual := number(text(rainfallFieldAnnual), "annual", 12*maxMonthlyRainfall)
+		if !ok {
+			return nil, false
+		}
+		if annual != nil && len(records) == 12 && math.Abs(sum-*annual) > math.Max(1, *annual/100) {
+			report.addWarning(line, "annual", "months add up to %.1f mm, not the annual %.1f mm", sum, *annual)
+		}
+	} else {
+		raw := text(rainfallFieldMonth)
+		month, parsed := parseMonth(raw)
+		if !parsed {
+			report.addError(line, "month", "%q is not a month", raw)
+			return nil, false
+		}
+		value := number(text(rainfallFieldRainfall), "rainfall", maxMonthlyRainfall)
+		if !ok {
+			return nil, false
+		}
+		if value != nil {
+			record(month, *value)
+		}
+	}
+
+	if len(records) == 0 {
+		report.addError(line, "rainfall", "no rainfall for %s, %s", district, state)
+		return nil, false
+	}
+	return records, true
+}
@@ -0,0 +1,219 @@
+package groundwater
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+)
+
+// yearBalance is a unit's groundwater balance for one year: its own assessment when it
+// has one, otherwise the sum of the units below it.
+type yearBalance struct {
+	models.Assessment
+	// categories counts the lowest-level units the balance covers by category
+	categories map[models.GroundwaterCategory]int
+}
+
+// rollup is a unit's balances, oldest year first.
+type rollup struct {
+	unit    models.AssessmentUnit
+	version int
+	years   []yearBalance
+}
+
+func (r *rollup) year(year int) (*yearBalance, bool) {
+	for i := range r.years {
+		if r.years[i].Year == year {
+			return &r.years[i], true
+		}
+	}
+	return nil, false
+}
+
+func (r *rollup) latest() (*yearBalance, bool) {
+	if len(r.years) == 0 {
+		return nil, false
+	}
+	return &r.years[len(r.years)-1], true
+}
+
+// rollupCache keeps rollups until another dataset is imported.
+type rollupCache struct {
+	mu      sync.Mutex
+	version int
+	rollups map[uuid.UUID]*rollup
+}
+
+// DatasetVersion returns the version of the latest import, or 0 before the first one.
+func (s *Service) DatasetVersion(ctx context.Context) (int, error) {
+	var version int
+	if err := s.db.DB.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM groundwater_datasets").Scan(&version); err != nil {
+		return 0, fmt.Errorf("dataset version lookup error: %w", err)
+	}
+	return version, nil
+}
+
+// rollup returns the unit's balances, computing them once per dataset version.
+func (s *Service) rollup(ctx context.Context, unitID uuid.UUID) (*rollup, error) {
+	version, err := s.DatasetVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := &s.rollups
+	cache.mu.Lock()
+	if cache.version != version {
+		cache.version = version
+		cache.rollups = map[uuid.UUID]*rollup{}
+	}
+	cached := cache.rollups[unitID]
+	cache.mu.Unlock()
+	if cached != nil {
+		return cached, nil
+	}
+
+	result, err := s.computeRollup(ctx, unitID)
+	if err != nil {
+		return nil, err
+	}
+	result.version = version
+
+	cache.mu.Lock()
+	if cache.version == version {
+		cache.rollups[unitID] = result
+	}
+	cache.mu.Unlock()
+	return result, nil
+}
+
+func (s *Service) computeRollup(ctx context.Context, unitID uuid.UUID) (*rollup, error) {
+	unit, err := s.Unit(ctx, unitID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.DB.QueryContext(ctx, `
+		SELECT id, parent_id FROM groundwater_units
+		WHERE path = $1 OR left(path, length($1) + 1) = $1 || '/'`, unit.Path)
+	if err != nil {
+		return nil, fmt.Errorf("unit tree lookup error: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []uuid.UUID{}
+	children := map[uuid.UUID][]uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		var parentID *uuid.UUID
+		if err := rows.Scan(&id, &parentID); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+		if parentID != nil {
+			children[*parentID] = append(children[*parentID], id)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	assessments, err := s.assessments(ctx, ids, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	balances := balanceTree(unitID, children, assessments)
+	result := &rollup{unit: *unit, years: make([]yearBalance, 0, len(balances))}
+	for _, balance := range balances {
+		result.years = append(result.years, *balance)
+	}
+	sort.Slice(result.years, func(i, j int) bool { return result.years[i].Year < result.years[j].Year })
+	return result, nil
+}
+
+// balanceTree computes the unit's balance for every year from its own assessments, or
+// from its children's balances for years it wasn't assessed itself. Category counts
+// always come from the lowest level that has data.
+func balanceTree(unitID uuid.UUID, children map[uuid.UUID][]uuid.UUID, assessments map[uuid.UUID][]models.Assessment) map[int]*yearBalance {
+	balances := map[int]*yearBalance{}
+	for _, childID := range children[unitID] {
+		for year, child := range balanceTree(childID, children, assessments) {
+			if total, ok := balances[year]; ok {
+				total.add(child)
+			} else {
+				balances[year] = child
+			}
+		}
+	}
+	for _, balance := range balances {
+		balance.UnitID = unitID
+		balance.DatasetID = uuid.Nil
+		balance.finish()
+	}
+
+	for _, own := range assessments[unitID] {
+		balance := &yearBalance{Assessment: own}
+		if summed, ok := balances[own.Year]; ok {
+			balance.categories = summed.categories
+		} else {
+			balance.categories = map[models.GroundwaterCategory]int{own.Category: 1}
+		}
+		balances[own.Year] = balance
+	}
+	return balances
+}
+
+func (b *yearBalance) add(other *yearBalance) {
+	b.RechargeRainfall = addOptional(b.RechargeRainfall, other.RechargeRainfall)
+	b.RechargeOther = addOptional(b.RechargeOther, other.RechargeOther)
+	b.AnnualRecharge += other.AnnualRecharge
+	b.NaturalDischarge = addOptional(b.NaturalDischarge, other.NaturalDischarge)
+	b.ExtractableResource += other.ExtractableResource
+	b.ExtractionIrrigation = addOptional(b.ExtractionIrrigation, other.ExtractionIrrigation)
+	b.ExtractionIndustrial = addOptional(b.ExtractionIndustrial, other.ExtractionIndustrial)
+	b.ExtractionDomestic = addOptional(b.ExtractionDomestic, other.ExtractionDomestic)
+	b.TotalExtraction += other.TotalExtraction
+	b.FutureAvailability = addOptional(b.FutureAvailability, other.FutureAvailability)
+	if other.UpdatedAt.After(b.UpdatedAt) {
+		b.UpdatedAt = other.UpdatedAt
+	}
+
+	categories := make(map[models.GroundwaterCategory]int, len(b.categories))
+	for category, n := range b.categories {
+		categories[category] = n
+	}
+	for category, n := range other.categories {
+		categories[category] += n
+	}
+	b.categories = categories
+}
+
+// finish derives the stage and category of a summed balance.
+func (b *yearBalance) finish() {
+	if b.ExtractableResource > 0 {
+		b.StageOfExtraction = b.TotalExtraction / b.ExtractableResource * 100
+	}
+	b.Category = CategoryForStage(b.StageOfExtraction)
+	if len(b.categories) == 1 && b.categories[models.CategorySaline] > 0 {
+		b.Category = models.CategorySaline
+	}
+}
+
+// addOptional sums the values that are present, staying nil when neither is.
+func addOptional(a, b *float64) *float64 {
+	if a == nil && b == nil {
+		return nil
+	}
+	var sum float64
+	if a != nil {
+		sum += *a
+	}
+	if b != nil {
+		sum += *b
+	}
+	return &sum
+}
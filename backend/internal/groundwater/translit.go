@@ -0,0 +1,204 @@
+package groundwater
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Devanagari letters as they are commonly romanised in Indian place names. Long vowels
+// keep their doubled spelling here; foldName treats them like short ones.
+var (
+	devanagariVowels = map[rune]string{
+		'अ': "a", 'आ': "aa", 'इ': "i", 'ई': "ii", 'उ': "u", 'ऊ': "uu", 'ऋ': "ri",
+		'ए': "e", 'ऐ': "ai", 'ओ': "o", 'औ': "au", 'ऑ': "o",
+	}
+	devanagariConsonants = map[rune]string{
+		'क': "k", 'ख': "kh", 'ग': "g", 'घ': "gh", 'ङ': "n",
+		'च': "ch", 'छ': "chh", 'ज': "j", 'झ': "jh", 'ञ': "n",
+		'ट': "t", 'ठ': "th", 'ड': "d", 'ढ': "dh", 'ण': "n",
+		'त': "t", 'थ': "th", 'द': "d", 'ध': "dh", 'न': "n",
+		'प': "p", 'फ': "ph", 'ब': "b", 'भ': "bh", 'म': "m",
+		'य': "y", 'र': "r", 'ल': "l", 'ळ': "l", 'व': "v",
+		'श': "sh", 'ष': "sh", 'स': "s", 'ह': "h",
+		'\u0958': "k", '\u0959': "kh", '\u095A': "g", '\u095B': "z", '\u095C': "r", '\u095D': "rh", '\u095E': "f", '\u095F': "y",
+	}
+	devanagariMatras = map[rune]string{
+		'ा': "aa", 'ि': "i", 'ी': "ii", 'ु': "u", 'ू': "uu", 'ृ': "ri",
+		'े': "e", 'ै': "ai", 'ो': "o", 'ौ': "au", 'ॅ': "e", 'ॉ': "o",
+	}
+	// Nukta forms of consonants that change their sound rather than just their spelling
+	devanagariNukta = map[rune]string{'ड': "r", 'ढ': "rh", 'ज': "z", 'फ': "f"}
+)
+
+const (
+	devanagariVirama      = '्'
+	devanagariNuktaSign   = '़'
+	devanagariAnusvara    = 'ं'
+	devanagariCandrabindu = 'ँ'
+	devanagariVisarga     = 'ः'
+)
+
+// transliterate romanises Devanagari in s and leaves everything else alone. Consonants
+// carry an inherent "a" unless a vowel sign or virama follows, and drop it at the end of a
+// word as Hindi does: "लुधियाना" becomes "ludhiyaanaa", "पंजाब" becomes "panjaab".
+func transliterate(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if vowel, ok := devanagariVowels[r]; ok {
+			b.WriteString(vowel)
+			continue
+		}
+		if matra, ok := devanagariMatras[r]; ok {
+			b.WriteString(matra)
+			continue
+		}
+		consonant, ok := devanagariConsonants[r]
+		if !ok {
+			switch r {
+			case devanagariAnusvara, devanagariCandrabindu:
+				b.WriteString("n")
+			case devanagariVisarga:
+				b.WriteString("h")
+			case devanagariVirama, devanagariNuktaSign:
+			default:
+				if r >= 0x0900 && r <= 0x097F {
+					// Dandas, digits and other signs separate words
+					b.WriteRune(' ')
+				} else {
+					b.WriteRune(r)
+				}
+			}
+			continue
+		}
+
+		if i+1 < len(runes) && runes[i+1] == devanagariNuktaSign {
+			if nukta, ok := devanagariNukta[r]; ok {
+				consonant = nukta
+			}
+			i++
+		}
+		b.WriteString(consonant)
+
+		next := rune(0)
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+		_, matra := devanagariMatras[next]
+		if matra || next == devanagariVirama {
+			continue
+		}
+		if isDevanagariLetter(next) || next == devanagariAnusvara || next == devanagariCandrabindu || next == devanagariVisarga {
+			b.WriteString("a")
+		}
+	}
+	return b.String()
+}
+
+func isDevanagariLetter(r rune) bool {
+	_, consonant := devanagariConsonants[r]
+	_, vowel := devanagariVowels[r]
+	return consonant || vowel
+}
+
+// nameWords lower-cases a name, romanises any Devanagari in it and splits it into words
+// of letters, so "Jammu & Kashmir" becomes ["jammu", "and", "kashmir"].
+func nameWords(s string) []string {
+	s = strings.ToLower(transliterate(strings.ReplaceAll(s, "&", " and ")))
+	return strings.FieldsFunc(s, func(r rune) bool { return r < 'a' || r > 'z' })
+}
+
+// spellingFolds even out the usual variation in romanised Indian names.
+var spellingFolds = strings.NewReplacer(
+	"aa", "a", "ee", "i", "ii", "i", "oo", "u", "uu", "u",
+	"iya", "ia", "ph", "f", "w", "v", "z", "j", "q", "k",
+)
+
+// foldWord reduces a word to the key names are matched by, so that "Ludhiyana",
+// "Ludhiana" and "लुधियाना" all become "ludhian".
+func foldWord(word string) string {
+	word = spellingFolds.Replace(word)
+
+	var b strings.Builder
+	var last rune
+	for _, r := range word {
+		if r != last {
+			b.WriteRune(r)
+		}
+		last = r
+	}
+	// A trailing "a" comes and goes with the inherent vowel: "Karnatak" / "Karnataka"
+	return strings.TrimSuffix(b.String(), "a")
+}
+
+// foldName is the key of a whole name: its folded words run together.
+func foldName(name string) string {
+	var b strings.Builder
+	for _, word := range nameWords(name) {
+		b.WriteString(foldWord(word))
+	}
+	return b.String()
+}
+
+// isAbbreviation reports whether a name is written like "UP" or "J&K".
+func isAbbreviation(name string) bool {
+	letters := 0
+	for _, r := range name {
+		if unicode.IsLetter(r) {
+			if !unicode.IsUpper(r) {
+				return false
+			}
+			letters++
+		} else if r != '&' {
+			return false
+		}
+	}
+	return letters > 0 && letters <= 4
+}
+
+// levenshtein returns the edit distance between a and b, or max+1 once it's sure to
+// be more than max.
+func levenshtein(a, b string, max int) int {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	if len(b)-len(a) > max {
+		return max + 1
+	}
+
+	previous := make([]int, len(a)+1)
+	current := make([]int, len(a)+1)
+	for i := range previous {
+		previous[i] = i
+	}
+	for j := 1; j <= len(b); j++ {
+		current[0] = j
+		best := current[0]
+		for i := 1; i <= len(a); i++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[i] = minInt(previous[i]+1, current[i-1]+1, previous[i-1]+cost)
+			if current[i] < best {
+				best = current[i]
+			}
+		}
+		if best > max {
+			return max + 1
+		}
+		previous, current = current, previous
+	}
+	return previous[len(a)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
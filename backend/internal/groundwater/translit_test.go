@@ -0,0 +1,87 @@
+package groundwater
+
+import "testing"
+
+func TestTransliterate(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"लुधियाना", "ludhiyaanaa"},
+		{"पंजाब", "panjaab"},
+		// Conjuncts through the virama, and the inherent vowel kept inside a word
+		{"उत्तर प्रदेश", "uttar pradesh"},
+		// A nukta changes ड to r
+		{"गुड़गांव", "guragaanv"},
+		// The danda ends a word
+		{"दिल्ली।", "dillii "},
+		{"groundwater in लुधियाना", "groundwater in ludhiyaanaa"},
+		{"Ludhiana", "Ludhiana"},
+	}
+	for _, tt := range tests {
+		if got := transliterate(tt.text); got != tt.want {
+			t.Errorf("transliterate(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestFoldName(t *testing.T) {
+	tests := []struct {
+		names []string
+		want  string
+	}{
+		{[]string{"Ludhiana", "Ludhiyana", "ludhiana", "लुधियाना"}, "ludhian"},
+		{[]string{"Karnataka", "Karnatak"}, "karnatak"},
+		{[]string{"Chhattisgarh", "Chattisgarh"}, "chatisgarh"},
+		{[]string{"Jammu & Kashmir", "Jammu and Kashmir", "jammu  and  kashmir"}, "jamuandkashmir"},
+		{[]string{"Phagwara", "Fagvara"}, "fagvar"},
+	}
+	for _, tt := range tests {
+		for _, name := range tt.names {
+			if got := foldName(name); got != tt.want {
+				t.Errorf("foldName(%q) = %q, want %q", name, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestIsAbbreviation(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"UP", true},
+		{"J&K", true},
+		{"Up", false},
+		{"SBS Nagar", false},
+		{"ABCDE", false},
+		{"&", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := isAbbreviation(tt.name); got != tt.want {
+			t.Errorf("isAbbreviation(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		max  int
+		want int
+	}{
+		{"kitten", "sitting", 5, 3},
+		{"ludhian", "ludhyan", 1, 1},
+		{"abc", "abc", 0, 0},
+		{"", "abc", 3, 3},
+		// Past max the answer is only max+1
+		{"kitten", "sitting", 2, 3},
+		{"a", "abcdef", 1, 2},
+	}
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b, tt.max); got != tt.want {
+			t.Errorf("levenshtein(%q, %q, %d) = %d, want %d", tt.a, tt.b, tt.max, got, tt.want)
+		}
+	}
+}
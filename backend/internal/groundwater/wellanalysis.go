@@ -0,0 +1,239 @@
+package groundwater
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/analytics"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+)
+
+const (
+	// DefaultForecastHorizon is how many seasons ahead a series is forecast
+	DefaultForecastHorizon = 4
+	MaxForecastHorizon     = 12
+	DefaultConfidence      = 0.95
+)
+
+var ErrInvalidHorizon = fmt.Errorf("horizon must be between 1 and %d", MaxForecastHorizon)
+
+// AnalysisOptions controls AnalyseWaterLevels. Zero values take the defaults.
+type AnalysisOptions struct {
+	// Years is how many years before the newest the trends and forecasts go back to
+	Years int
+	// Horizon is how many seasons to forecast
+	Horizon    int
+	Confidence float64
+}
+
+func (o *AnalysisOptions) defaults() error {
+	if o.Years == 0 {
+		o.Years = DefaultChangeYears
+	}
+	if o.Horizon == 0 {
+		o.Horizon = DefaultForecastHorizon
+	}
+	if o.Horizon < 0 || o.Horizon > MaxForecastHorizon {
+		return ErrInvalidHorizon
+	}
+	if o.Confidence == 0 {
+		o.Confidence = DefaultConfidence
+	}
+	return analytics.CheckConfidence(o.Confidence)
+}
+
+// AnalyseWaterLevels tests a series for trends, over its yearly levels and over each
+// season on its own, and forecasts its coming seasons two ways: the same season's last
+// depth, and a straight line through the deseasonalised depths with the season effect
+// added back. Trends are significant below a p-value of one less the confidence.
+func AnalyseWaterLevels(series *models.WaterLevelSeries, opts AnalysisOptions) (*models.WaterLevelAnalysis, error) {
+	if err := opts.defaults(); err != nil {
+		return nil, err
+	}
+	analysis := &models.WaterLevelAnalysis{
+		Well:       series.Well,
+		Unit:       series.Unit,
+		Location:   series.Location,
+		RadiusKm:   series.RadiusKm,
+		Wells:      series.Wells,
+		Confidence: opts.Confidence,
+		Trends:     []models.TrendTest{},
+	}
+	if len(series.Points) == 0 {
+		return analysis, nil
+	}
+
+	last := series.Points[len(series.Points)-1].Year
+	var points []models.WaterLevelPoint
+	for _, p := range series.Points {
+		if p.Year >= last-opts.Years {
+			points = append(points, p)
+		}
+	}
+
+	// Every point of a year carries the same year level
+	var years, levels []float64
+	bySeason := map[models.Season][][2]float64{}
+	for _, p := range points {
+		if len(years) == 0 || years[len(years)-1] != float64(p.Year) {
+			years = append(years, float64(p.Year))
+			levels = append(levels, p.Trend)
+		}
+		bySeason[p.Season] = append(bySeason[p.Season], [2]float64{float64(p.Year), p.DepthToWater})
+	}
+	test, err := trendTest("", years, levels, opts.Confidence)
+	if err != nil && !errors.Is(err, analytics.ErrTooFewPoints) {
+		return nil, err
+	}
+	if test != nil {
+		analysis.Trends = append(analysis.Trends, *test)
+	}
+	for _, season := range seasonOrder {
+		var times, values []float64
+		for _, v := range bySeason[season] {
+			times, values = append(times, v[0]), append(values, v[1])
+		}
+		test, err := trendTest(season, times, values, opts.Confidence)
+		if err != nil && !errors.Is(err, analytics.ErrTooFewPoints) {
+			return nil, err
+		}
+		if test != nil {
+			analysis.Trends = append(analysis.Trends, *test)
+		}
+	}
+
+	if err := forecastWaterLevels(analysis, points, series.Seasonal, opts); err != nil {
+		return nil, err
+	}
+	return analysis, nil
+}
+
+// trendTest runs the Mann-Kendall test and Sen's slope on values over years. It's nil
+// when there are too few years.
+func trendTest(season models.Season, years, values []float64, confidence float64) (*models.TrendTest, error) {
+	mk, err := analytics.MannKendallTest(values)
+	if err != nil {
+		return nil, err
+	}
+	sen, err := analytics.SensSlope(years, values, confidence)
+	if err != nil {
+		return nil, err
+	}
+
+	test := &models.TrendTest{
+		Season:      season,
+		FromYear:    int(years[0]),
+		ToYear:      int(years[len(years)-1]),
+		Years:       len(years),
+		S:           mk.S,
+		Z:           round(mk.Z, 3),
+		PValue:      round(mk.PValue, 4),
+		Tau:         round(mk.Tau, 3),
+		Significant: mk.Significant(1 - confidence),
+		Direction:   WaterTableStable,
+		Slope:       round(sen.Slope, 3),
+		SlopeLower:  round(sen.Lower, 3),
+		SlopeUpper:  round(sen.Upper, 3),
+	}
+	// Depth to water grows as the water table falls
+	if test.Significant {
+		if mk.S > 0 {
+			test.Direction = WaterTableFalling
+		} else {
+			test.Direction = WaterTableRising
+		}
+	}
+	return test, nil
+}
+
+// forecastWaterLevels fills in the analysis's forecasts. The points are laid on a grid
+// of the seasons the series measures, one slot per season a year, with gaps for missing
+// rounds; each forecast runs horizon slots past the last point. A method the series is
+// too short for is left out.
+func forecastWaterLevels(analysis *models.WaterLevelAnalysis, points []models.WaterLevelPoint, seasonal map[models.Season]float64, opts AnalysisOptions) error {
+	used := map[models.Season]bool{}
+	for _, p := range points {
+		used[p.Season] = true
+	}
+	var seasons []models.Season
+	for _, s := range seasonOrder {
+		if used[s] {
+			seasons = append(seasons, s)
+		}
+	}
+	period := len(seasons)
+	slotOf := map[models.Season]int{}
+	for i, s := range seasons {
+		slotOf[s] = i
+	}
+
+	first := points[0].Year
+	slot := func(p models.WaterLevelPoint) int { return (p.Year-first)*period + slotOf[p.Season] }
+	values := make([]float64, slot(points[len(points)-1])+1)
+	for i := range values {
+		values[i] = math.NaN()
+	}
+	var times, deseasonalised []float64
+	for _, p := range points {
+		values[slot(p)] = p.DepthToWater
+		times = append(times, seasonTime(p.Year, p.Season))
+		deseasonalised = append(deseasonalised, p.DepthToWater-seasonal[p.Season])
+	}
+
+	// The slots after the data, as years and seasons
+	type target struct {
+		year   int
+		season models.Season
+	}
+	targets := make([]target, opts.Horizon)
+	targetTimes := make([]float64, opts.Horizon)
+	for i := range targets {
+		n := len(values) + i
+		targets[i] = target{first + n/period, seasons[n%period]}
+		targetTimes[i] = seasonTime(targets[i].year, targets[i].season)
+	}
+	label := func(forecasts []analytics.Forecast, effect func(models.Season) float64) []models.WaterLevelForecast {
+		labelled := make([]models.WaterLevelForecast, len(forecasts))
+		for i, f := range forecasts {
+			t := targets[i]
+			e := effect(t.season)
+			labelled[i] = models.WaterLevelForecast{
+				Year:         t.year,
+				Season:       t.season,
+				DepthToWater: round(f.Value+e, 2),
+				Lower:        round(f.Lower+e, 2),
+				Upper:        round(f.Upper+e, 2),
+			}
+		}
+		return labelled
+	}
+
+	naive, err := analytics.SeasonalNaive(values, period, opts.Horizon, opts.Confidence)
+	switch {
+	case err == nil:
+		analysis.SeasonalNaive = label(naive, func(models.Season) float64 { return 0 })
+	case !errors.Is(err, analytics.ErrTooFewPoints):
+		return err
+	}
+
+	if len(times) < analytics.MinTrendPoints {
+		return nil
+	}
+	fit, err := analytics.FitLinear(times, deseasonalised)
+	if err == nil {
+		var linear []analytics.Forecast
+		if linear, err = fit.Forecast(targetTimes, opts.Confidence); err == nil {
+			analysis.Linear = label(linear, func(s models.Season) float64 { return seasonal[s] })
+		}
+	}
+	if err != nil && !errors.Is(err, analytics.ErrTooFewPoints) {
+		return err
+	}
+	return nil
+}
+
+// seasonTime places a season within its year, in years.
+func seasonTime(year int, season models.Season) float64 {
+	return float64(year) + float64(seasonIndex(season))/float64(len(seasonOrder))
+}
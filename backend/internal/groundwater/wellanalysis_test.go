@@ -0,0 +1,95 @@
+package groundwater
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+)
+
+// analysisSeries is ten years of pre- and post-monsoon depths, the water table falling
+// about a third of a metre a year and recovering two metres over each monsoon.
+func analysisSeries() *models.WaterLevelSeries {
+	pre := []float64{5.1, 4.8, 5.6, 6.0, 5.9, 6.4, 7.1, 6.8, 7.5, 7.9}
+	series := &models.WaterLevelSeries{
+		Wells:    1,
+		Seasonal: map[models.Season]float64{models.SeasonPreMonsoon: 1, models.SeasonPostMonsoon: -1},
+	}
+	for i, depth := range pre {
+		year := 2011 + i
+		series.Points = append(series.Points,
+			models.WaterLevelPoint{Year: year, Season: models.SeasonPreMonsoon, DepthToWater: depth, Trend: depth - 1, Wells: 1},
+			models.WaterLevelPoint{Year: year, Season: models.SeasonPostMonsoon, DepthToWater: depth - 2, Trend: depth - 1, Wells: 1},
+		)
+	}
+	return series
+}
+
+func TestAnalyseWaterLevels(t *testing.T) {
+	analysis, err := AnalyseWaterLevels(analysisSeries(), AnalysisOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each series is the same shape, 36 rising pairs of 45 and 3 falling: S = 39 with
+	// Var(S) = 125, so Z = 38/√125 and p = 0.00068. Sen's slope is 2.3/7, within the
+	// 95% bounds of the 9th and 36th pairwise slopes (Gilbert 1987).
+	trend := models.TrendTest{
+		FromYear: 2011, ToYear: 2020, Years: 10,
+		S: 39, Z: 3.399, PValue: 0.0007, Tau: 0.867,
+		Significant: true, Direction: WaterTableFalling,
+		Slope: 0.329, SlopeLower: 0.25, SlopeUpper: 0.4,
+	}
+	var trends []models.TrendTest
+	for _, season := range []models.Season{"", models.SeasonPreMonsoon, models.SeasonPostMonsoon} {
+		test := trend
+		test.Season = season
+		trends = append(trends, test)
+	}
+	if !reflect.DeepEqual(analysis.Trends, trends) {
+		t.Errorf("trends = %+v\nwant %+v", analysis.Trends, trends)
+	}
+
+	// The last depth of each season, with a root mean square year-on-year change of
+	// 0.514 m widening by √2 in the second year
+	naive := []models.WaterLevelForecast{
+		{Year: 2021, Season: models.SeasonPreMonsoon, DepthToWater: 7.9, Lower: 6.89, Upper: 8.91},
+		{Year: 2021, Season: models.SeasonPostMonsoon, DepthToWater: 5.9, Lower: 4.89, Upper: 6.91},
+		{Year: 2022, Season: models.SeasonPreMonsoon, DepthToWater: 7.9, Lower: 6.47, Upper: 9.33},
+		{Year: 2022, Season: models.SeasonPostMonsoon, DepthToWater: 5.9, Lower: 4.47, Upper: 7.33},
+	}
+	if !reflect.DeepEqual(analysis.SeasonalNaive, naive) {
+		t.Errorf("seasonal naive = %+v\nwant %+v", analysis.SeasonalNaive, naive)
+	}
+
+	// The line through the deseasonalised depths, 20 points at quarter-year offsets,
+	// with t(0.975, 18) = 2.1009 and the season effect added back
+	linear := []models.WaterLevelForecast{
+		{Year: 2021, Season: models.SeasonPreMonsoon, DepthToWater: 8.01, Lower: 7.42, Upper: 8.61},
+		{Year: 2021, Season: models.SeasonPostMonsoon, DepthToWater: 6.17, Lower: 5.57, Upper: 6.78},
+		{Year: 2022, Season: models.SeasonPreMonsoon, DepthToWater: 8.34, Lower: 7.73, Upper: 8.95},
+		{Year: 2022, Season: models.SeasonPostMonsoon, DepthToWater: 6.5, Lower: 5.88, Upper: 7.12},
+	}
+	if !reflect.DeepEqual(analysis.Linear, linear) {
+		t.Errorf("linear = %+v\nwant %+v", analysis.Linear, linear)
+	}
+}
+
+func TestAnalyseWaterLevelsShortSeries(t *testing.T) {
+	series := analysisSeries()
+	series.Points = series.Points[:6]
+
+	// Three years are too few to test for a trend, but the forecasts draw on both
+	// seasons' six depths
+	analysis, err := AnalyseWaterLevels(series, AnalysisOptions{Horizon: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(analysis.Trends) != 0 || len(analysis.SeasonalNaive) != 2 || len(analysis.Linear) != 2 {
+		t.Errorf("analysis = %+v, want no trends and two forecasts each way", analysis)
+	}
+
+	if _, err := AnalyseWaterLevels(series, AnalysisOptions{Horizon: MaxForecastHorizon + 1}); err != ErrInvalidHorizon {
+		t.Errorf("horizon %d: err = %v, want ErrInvalidHorizon", MaxForecastHorizon+1, err)
+	}
+}
@@ -0,0 +1,404 @@
+package groundwater
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+)
+
+type wellField int
+
+const (
+	wellFieldCode wellField = iota
+	wellFieldName
+	wellFieldState
+	wellFieldDistrict
+	wellFieldBlock
+	wellFieldLatitude
+	wellFieldLongitude
+	wellFieldType
+	wellFieldAquifer
+	wellFieldDepth
+	wellFieldDate
+	wellFieldYear
+	wellFieldSeason
+	wellFieldDepthToWater
+)
+
+var wellFieldNames = map[wellField]string{
+	wellFieldCode:         "well_code",
+	wellFieldName:         "well_name",
+	wellFieldState:        "state",
+	wellFieldDistrict:     "district",
+	wellFieldBlock:        "block",
+	wellFieldLatitude:     "latitude",
+	wellFieldLongitude:    "longitude",
+	wellFieldType:         "well_type",
+	wellFieldAquifer:      "aquifer",
+	wellFieldDepth:        "well_depth",
+	wellFieldDate:         "date",
+	wellFieldYear:         "year",
+	wellFieldSeason:       "season",
+	wellFieldDepthToWater: "depth_to_water",
+}
+
+// wellFieldAliases are header spellings seen in CGWB and India-WRIS water level exports,
+// after normaliseWellHeader.
+var wellFieldAliases = map[wellField][]string{
+	wellFieldCode: {"well id", "well code", "well no", "site id", "site code", "station id", "station code",
+		"wlcode", "wl code"},
+	wellFieldName:      {"well name", "site name", "station name", "location", "village"},
+	wellFieldState:     fieldAliases[fieldState],
+	wellFieldDistrict:  fieldAliases[fieldDistrict],
+	wellFieldBlock:     fieldAliases[fieldBlock],
+	wellFieldLatitude:  {"latitude", "lat", "lat dd", "latitude dd"},
+	wellFieldLongitude: {"longitude", "lon", "long", "lng", "long dd", "longitude dd"},
+	wellFieldType:      {"well type", "type of well", "site type", "structure type"},
+	wellFieldAquifer:   {"aquifer", "aquifer type", "principal aquifer", "major aquifer"},
+	wellFieldDepth:     {"well depth", "depth of well", "total depth", "total depth of well"},
+	wellFieldDate:      {"date", "date of measurement", "measurement date", "observation date", "monitoring date"},
+	wellFieldYear:      {"year", "monitoring year"},
+	wellFieldSeason:    {"season", "monitoring season", "period"},
+	wellFieldDepthToWater: {"depth to water", "depth to water level", "water level", "dtw", "dtwl", "wl",
+		"ground water level"},
+}
+
+// wellHeaderUnits are trailing words stripped from water level headers: "Water Level
+// (m bgl)" is "water level".
+var wellHeaderUnits = map[string]bool{"in": true, "m": true, "mbgl": true, "bgl": true, "metres": true, "meters": true, "mts": true}
+
+// seasonNames map a folded season label to a season. CGWB calls the January round
+// "post-monsoon rabi" and the November one "post-monsoon kharif".
+var seasonNames = map[string]models.Season{
+	"winter": models.SeasonWinter, "january": models.SeasonWinter, "jan": models.SeasonWinter,
+	"postmonsoonrabi": models.SeasonWinter, "rabi": models.SeasonWinter,
+	"premonsoon": models.SeasonPreMonsoon, "may": models.SeasonPreMonsoon, "summer": models.SeasonPreMonsoon,
+	"monsoon": models.SeasonMonsoon, "august": models.SeasonMonsoon, "aug": models.SeasonMonsoon,
+	"postmonsoon": models.SeasonPostMonsoon, "postmonsoonkharif": models.SeasonPostMonsoon,
+	"kharif": models.SeasonPostMonsoon, "november": models.SeasonPostMonsoon, "nov": models.SeasonPostMonsoon,
+}
+
+// seasonDates are the nominal measurement dates for rows with a season but no date.
+var seasonDates = map[models.Season]time.Month{
+	models.SeasonWinter:      time.January,
+	models.SeasonPreMonsoon:  time.May,
+	models.SeasonMonsoon:     time.August,
+	models.SeasonPostMonsoon: time.November,
+}
+
+var readingDateLayouts = []string{"2006-01-02", "02-01-2006", "02/01/2006", "2/1/2006", "02.01.2006",
+	"02-Jan-2006", "02-Jan-06", "02 Jan 2006", "Jan 2006", "January 2006", "2006-01"}
+
+const (
+	// Depths to water beyond these aren't a reading error a flag can describe
+	minDepthToWater = -20
+	maxDepthToWater = 500
+)
+
+// indiaBounds is a generous box around India; wells outside it get a warning.
+var indiaBounds = struct{ minLat, maxLat, minLon, maxLon float64 }{6, 38, 68, 98}
+
+// WellRecord is one validated reading with the well it was taken at.
+type WellRecord struct {
+	Line         int
+	Code         string
+	Name         string
+	State        string
+	District     string
+	Block        string
+	Latitude     *float64
+	Longitude    *float64
+	WellType     string
+	Aquifer      string
+	Depth        *float64
+	MeasuredOn   time.Time
+	Season       models.Season
+	DepthToWater float64
+}
+
+// ParseWellCSV reads a water level export with one reading per row, collecting rejected
+// rows and suspicious values in the report. Well details may repeat on every row.
+func ParseWellCSV(r io.Reader, opts ParseOptions, report *WellImportReport) ([]WellRecord, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	columns, err := findWellHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkWellColumns(columns, opts); err != nil {
+		return nil, err
+	}
+
+	var records []WellRecord
+	seen := map[string]int{}
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("reading CSV: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+		if blankRow(row) {
+			continue
+		}
+
+		report.Rows++
+		record, ok := parseWellRow(row, line, columns, opts, report)
+		if !ok {
+			report.Rejected++
+			continue
+		}
+
+		key := strings.ToLower(record.Code) + "@" + measuredOn(record.MeasuredOn)
+		if first, dup := seen[key]; dup {
+			report.addError(line, "", "duplicate of line %d for well %s on %s", first, record.Code,
+				measuredOn(record.MeasuredOn))
+			report.Rejected++
+			continue
+		}
+		seen[key] = line
+
+		report.Accepted++
+		records = append(records, *record)
+	}
+	return records, nil
+}
+
+// findWellHeader skips title rows until one names a well code and a water level.
+func findWellHeader(reader *csv.Reader) (map[wellField]int, error) {
+	for i := 0; i < headerSearchRows; i++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("reading CSV header: %w", err)
+		}
+
+		columns := map[wellField]int{}
+		for index, cell := range row {
+			if f, ok := matchWellField(normaliseWellHeader(cell)); ok {
+				if _, taken := columns[f]; !taken {
+					columns[f] = index
+				}
+			}
+		}
+		_, hasCode := columns[wellFieldCode]
+		_, hasDepth := columns[wellFieldDepthToWater]
+		if hasCode && hasDepth {
+			return columns, nil
+		}
+	}
+	return nil, errors.New("no header row with well code and water level columns in the first rows")
+}
+
+func checkWellColumns(columns map[wellField]int, opts ParseOptions) error {
+	has := func(f wellField) bool {
+		_, ok := columns[f]
+		return ok
+	}
+	var missing []string
+	if has(wellFieldLatitude) != has(wellFieldLongitude) {
+		missing = append(missing, "latitude and longitude (both or neither)")
+	}
+	if !has(wellFieldDate) && !has(wellFieldSeason) {
+		missing = append(missing, "date or season")
+	}
+	if !has(wellFieldDate) && !has(wellFieldYear) && opts.Year == 0 {
+		missing = append(missing, "date or year (or pass a year for the whole file)")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing columns: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// normaliseWellHeader is normaliseHeader without the trailing length unit.
+func normaliseWellHeader(header string) string {
+	name, _ := normaliseHeader(header)
+	words := strings.Fields(name)
+	for len(words) > 1 && wellHeaderUnits[words[len(words)-1]] {
+		words = words[:len(words)-1]
+	}
+	return strings.Join(words, " ")
+}
+
+func matchWellField(name string) (wellField, bool) {
+	for f, aliases := range wellFieldAliases {
+		for _, alias := range aliases {
+			if name == alias {
+				return f, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// ParseSeason reads a season label such as "Pre-monsoon" or "Post Monsoon (Kharif)".
+func ParseSeason(label string) (models.Season, bool) {
+	folded := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r
+		}
+		return -1
+	}, strings.ToLower(label))
+	season, ok := seasonNames[folded]
+	return season, ok
+}
+
+// SeasonOf is the measurement round a date falls in.
+func SeasonOf(date time.Time) models.Season {
+	switch date.Month() {
+	case time.January, time.February:
+		return models.SeasonWinter
+	case time.March, time.April, time.May:
+		return models.SeasonPreMonsoon
+	case time.June, time.July, time.August, time.September:
+		return models.SeasonMonsoon
+	default:
+		return models.SeasonPostMonsoon
+	}
+}
+
+func parseReadingDate(raw string) (time.Time, bool) {
+	for _, layout := range readingDateLayouts {
+		if date, err := time.Parse(layout, raw); err == nil {
+			return date, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseWellRow validates one row. Unusable values are errors and reject it; odd but
+// possible ones are kept with a warning.
+func parseWellRow(row []string, line int, columns map[wellField]int, opts ParseOptions, report *WellImportReport) (*WellRecord, bool) {
+	text := func(f wellField) string {
+		if index, ok := columns[f]; ok && index < len(row) {
+			return strings.Join(strings.Fields(row[index]), " ")
+		}
+		return ""
+	}
+
+	ok := true
+	number := func(f wellField) *float64 {
+		raw := strings.ReplaceAll(text(f), ",", "")
+		if raw == "" || raw == "-" || strings.EqualFold(raw, "na") || strings.EqualFold(raw, "n/a") {
+			return nil
+		}
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			report.addError(line, wellFieldNames[f], "%q is not a number", raw)
+			ok = false
+			return nil
+		}
+		return &value
+	}
+
+	record := &WellRecord{
+		Line:     line,
+		Code:     text(wellFieldCode),
+		Name:     text(wellFieldName),
+		State:    text(wellFieldState),
+		District: text(wellFieldDistrict),
+		Block:    text(wellFieldBlock),
+		WellType: strings.ToLower(text(wellFieldType)),
+		Aquifer:  text(wellFieldAquifer),
+	}
+	if record.Code == "" {
+		report.addError(line, "well_code", "well code is empty")
+		return nil, false
+	}
+
+	record.Latitude = number(wellFieldLatitude)
+	record.Longitude = number(wellFieldLongitude)
+	record.Depth = number(wellFieldDepth)
+	depth := number(wellFieldDepthToWater)
+	if !ok {
+		return nil, false
+	}
+
+	if (record.Latitude == nil) != (record.Longitude == nil) {
+		report.addError(line, "latitude", "well %s has only one of latitude and longitude", record.Code)
+		return nil, false
+	}
+	if record.Latitude != nil {
+		lat, lon := *record.Latitude, *record.Longitude
+		if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+			report.addError(line, "latitude", "%g, %g is not a latitude and longitude", lat, lon)
+			return nil, false
+		}
+		if lat < indiaBounds.minLat || lat > indiaBounds.maxLat || lon < indiaBounds.minLon || lon > indiaBounds.maxLon {
+			report.addWarning(line, "latitude", "well %s at %g, %g is outside India; are latitude and longitude swapped?",
+				record.Code, lat, lon)
+		}
+	}
+	if record.Depth != nil && *record.Depth <= 0 {
+		report.addWarning(line, "well_depth", "ignored well depth %g", *record.Depth)
+		record.Depth = nil
+	}
+
+	if depth == nil {
+		// Dry and unmeasured wells are exported with a blank level
+		report.addError(line, "depth_to_water", "no water level")
+		return nil, false
+	}
+	if *depth < minDepthToWater || *depth > maxDepthToWater {
+		report.addError(line, "depth_to_water", "a depth to water of %g m is not plausible", *depth)
+		return nil, false
+	}
+	record.DepthToWater = *depth
+
+	season, hasSeason := models.Season(""), false
+	if raw := text(wellFieldSeason); raw != "" {
+		if season, hasSeason = ParseSeason(raw); !hasSeason {
+			report.addError(line, "season", "unknown season %q", raw)
+			return nil, false
+		}
+	}
+
+	if raw := text(wellFieldDate); raw != "" {
+		date, parsed := parseReadingDate(raw)
+		if !parsed {
+			report.addError(line, "date", "%q is not a date", raw)
+			return nil, false
+		}
+		record.MeasuredOn = date
+	} else if hasSeason {
+		year := opts.Year
+		if raw := text(wellFieldYear); raw != "" {
+			year = 0
+			if len(raw) >= 4 {
+				year, _ = strconv.Atoi(raw[:4])
+			}
+		}
+		if year < minYear || year > maxYear {
+			report.addError(line, "year", "year %q is not between %d and %d", text(wellFieldYear), minYear, maxYear)
+			return nil, false
+		}
+		record.MeasuredOn = time.Date(year, seasonDates[season], 15, 0, 0, 0, 0, time.UTC)
+	} else {
+		report.addError(line, "date", "no date or season")
+		return nil, false
+	}
+	if year := record.MeasuredOn.Year(); year < minYear || year > maxYear {
+		report.addError(line, "date", "%s is not between %d and %d", measuredOn(record.MeasuredOn), minYear, maxYear)
+		return nil, false
+	}
+
+	record.Season = SeasonOf(record.MeasuredOn)
+	if hasSeason && season != record.Season {
+		report.addWarning(line, "season", "%s reading taken on %s", season, measuredOn(record.MeasuredOn))
+		record.Season = season
+	}
+	return record, true
+}
@@ -0,0 +1,694 @@
+package groundwater
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/database"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/geo"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+	"github.com/lib/pq"
+)
+
+const (
+	DefaultWellRadiusKm = 10
+	MaxWellRadiusKm     = 50
+	// DefaultChangeYears is how far back a series' change is measured from
+	DefaultChangeYears = 10
+)
+
+var (
+	ErrWellNotFound   = errors.New("observation well not found")
+	ErrNoWellReadings = errors.New("no observation well readings here")
+	ErrInvalidRadius  = fmt.Errorf("radius_km must be more than 0 and at most %d", MaxWellRadiusKm)
+)
+
+// WellImportReport says what a water level import did with every row of a file.
+type WellImportReport struct {
+	FileName        string  `json:"file_name"`
+	Checksum        string  `json:"checksum"`
+	Source          string  `json:"source"`
+	DryRun          bool    `json:"dry_run"`
+	AlreadyImported bool    `json:"already_imported"`
+	Rows            int     `json:"rows"`
+	Accepted        int     `json:"accepted"`
+	Rejected        int     `json:"rejected"`
+	Inserted        int     `json:"inserted"`
+	Updated         int     `json:"updated"`
+	Unchanged       int     `json:"unchanged"`
+	WellsCreated    int     `json:"wells_created"`
+	WellsUpdated    int     `json:"wells_updated"`
+	WellsUnlocated  int     `json:"wells_unlocated"`
+	Outliers        int     `json:"outliers"`
+	Issues          []Issue `json:"issues"`
+}
+
+func (r *WellImportReport) addError(line int, field, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, Issue{Line: line, Severity: SeverityError, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *WellImportReport) addWarning(line int, field, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, Issue{Line: line, Severity: SeverityWarning, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// wellDetails is what a file says about one well, merged over its rows.
+type wellDetails struct {
+	code      string
+	name      string
+	names     []string
+	point     *geo.Point
+	wellType  string
+	aquifer   string
+	depth     *float64
+	firstLine int
+	readings  []WellRecord
+}
+
+// groupWells collects a file's readings by well, taking each detail from the first row
+// that has it.
+func groupWells(records []WellRecord, report *WellImportReport) []*wellDetails {
+	byCode := map[string]*wellDetails{}
+	var wells []*wellDetails
+	for _, record := range records {
+		w := byCode[record.Code]
+		if w == nil {
+			w = &wellDetails{code: record.Code, firstLine: record.Line}
+			byCode[record.Code] = w
+			wells = append(wells, w)
+		}
+		w.readings = append(w.readings, record)
+
+		if w.name == "" {
+			w.name = record.Name
+		}
+		if w.names == nil && record.State != "" && record.District != "" && record.Block != "" {
+			w.names = []string{record.State, record.District, record.Block}
+		}
+		if w.wellType == "" {
+			w.wellType = record.WellType
+		}
+		if w.aquifer == "" {
+			w.aquifer = record.Aquifer
+		}
+		if w.depth == nil {
+			w.depth = record.Depth
+		}
+		if record.Latitude == nil {
+			continue
+		}
+		point := geo.Point{Lon: *record.Longitude, Lat: *record.Latitude}
+		if w.point == nil {
+			w.point = &point
+		} else if math.Abs(point.Lat-w.point.Lat) > 0.001 || math.Abs(point.Lon-w.point.Lon) > 0.001 {
+			report.addWarning(record.Line, "latitude", "well %s is at %g, %g on an earlier line; keeping that",
+				record.Code, w.point.Lat, w.point.Lon)
+		}
+	}
+	sort.Slice(wells, func(i, j int) bool { return wells[i].code < wells[j].code })
+	return wells
+}
+
+// ImportWells validates a water level export and stores its wells and readings, then
+// flags outliers again in every well it touched. Like Import, a file is only applied
+// once and unchanged readings are left alone. Wells go into the block named on their
+// rows, or else the unit their coordinates fall in.
+func (s *Service) ImportWells(ctx context.Context, fileName string, data []byte, opts ImportOptions) (*WellImportReport, error) {
+	sum := sha256.Sum256(data)
+	report := &WellImportReport{
+		FileName: fileName,
+		Checksum: hex.EncodeToString(sum[:]),
+		Source:   opts.Source,
+		DryRun:   opts.DryRun,
+		Issues:   []Issue{},
+	}
+
+	if !opts.Force {
+		var exists bool
+		if err := s.db.DB.QueryRowContext(ctx,
+			"SELECT EXISTS (SELECT 1 FROM groundwater_well_imports WHERE checksum = $1)", report.Checksum).
+			Scan(&exists); err != nil {
+			return nil, fmt.Errorf("well import lookup error: %w", err)
+		}
+		if exists {
+			report.AlreadyImported = true
+			return report, nil
+		}
+	}
+
+	records, err := ParseWellCSV(bytes.NewReader(data), ParseOptions{Year: opts.Year}, report)
+	if err != nil {
+		return report, err
+	}
+	if opts.DryRun {
+		return report, nil
+	}
+
+	blocks, err := s.unitKeys(ctx, models.LevelBlock)
+	if err != nil {
+		return report, err
+	}
+	wells := groupWells(records, report)
+
+	err = s.db.WithTransaction(ctx, func(tx *sql.Tx) error {
+		var importID uuid.UUID
+		if err := tx.QueryRowContext(ctx, `
+			INSERT INTO groundwater_well_imports (source, file_name, checksum, rows_total)
+			VALUES ($1, $2, $3, $4) RETURNING id`,
+			opts.Source, fileName, report.Checksum, report.Rows).Scan(&importID); err != nil {
+			return err
+		}
+
+		for _, w := range wells {
+			wellID, depth, ok, err := s.upsertWell(ctx, tx, w, blocks, report)
+			if err != nil {
+				return fmt.Errorf("well %s: %w", w.code, err)
+			}
+			if !ok {
+				continue
+			}
+
+			lines := map[string]int{}
+			for _, r := range w.readings {
+				if err := upsertReading(ctx, tx, wellID, importID, r, report); err != nil {
+					return fmt.Errorf("line %d: %w", r.Line, err)
+				}
+				lines[measuredOn(r.MeasuredOn)] = r.Line
+			}
+			if err := reflagWell(ctx, tx, w.code, wellID, depth, lines, report); err != nil {
+				return fmt.Errorf("well %s: %w", w.code, err)
+			}
+		}
+
+		reportJSON, err := json.Marshal(report)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE groundwater_well_imports SET rows_imported = $1, rows_rejected = $2, report = $3 WHERE id = $4`,
+			report.Inserted+report.Updated+report.Unchanged, report.Rejected, string(reportJSON), importID); err != nil {
+			return err
+		}
+
+		return database.RecordAudit(ctx, tx, database.AuditEntry{
+			Action:       "groundwater.wells_imported",
+			ResourceType: "groundwater_well_import",
+			ResourceID:   importID.String(),
+			NewValues: map[string]interface{}{
+				"file_name":     fileName,
+				"wells_created": report.WellsCreated,
+				"inserted":      report.Inserted,
+				"updated":       report.Updated,
+				"rejected":      report.Rejected,
+				"outliers":      report.Outliers,
+			},
+		})
+	})
+	if err != nil {
+		return report, fmt.Errorf("well import error: %w", err)
+	}
+	return report, nil
+}
+
+// upsertWell stores what the file says about a well over what was known, returning the
+// well's id and depth. New wells without coordinates are rejected with their readings.
+func (s *Service) upsertWell(ctx context.Context, tx *sql.Tx, w *wellDetails, blocks *unitKeys, report *WellImportReport) (uuid.UUID, *float64, bool, error) {
+	var id uuid.UUID
+	var name, wellType, aquifer string
+	var unitID *uuid.UUID
+	var point geo.Point
+	var depth *float64
+	err := tx.QueryRowContext(ctx, `
+		SELECT id, name, unit_id, latitude, longitude, well_type, aquifer, depth
+		FROM groundwater_wells WHERE code = $1 FOR UPDATE`, w.code).
+		Scan(&id, &name, &unitID, &point.Lat, &point.Lon, &wellType, &aquifer, &depth)
+	exists := err == nil
+	if err != nil && err != sql.ErrNoRows {
+		return uuid.Nil, nil, false, err
+	}
+
+	if !exists && w.point == nil {
+		report.addError(w.firstLine, "latitude", "well %s is new and has no coordinates; its %d reading(s) were skipped",
+			w.code, len(w.readings))
+		report.Accepted -= len(w.readings)
+		report.Rejected += len(w.readings)
+		return uuid.Nil, nil, false, nil
+	}
+
+	if w.name != "" {
+		name = w.name
+	}
+	if w.wellType != "" {
+		wellType = w.wellType
+	}
+	if w.aquifer != "" {
+		aquifer = w.aquifer
+	}
+	if w.depth != nil {
+		depth = w.depth
+	}
+
+	located := false
+	if w.names != nil {
+		if block, ok := blocks.byPath[foldPath(w.names...)]; ok {
+			unitID, located = &block, true
+		}
+	}
+	if w.point != nil {
+		point = *w.point
+		if !located {
+			units, err := s.Locate(ctx, point)
+			if err != nil {
+				return uuid.Nil, nil, false, err
+			}
+			if len(units) > 0 {
+				unitID = &units[0].ID
+			}
+		}
+	}
+	if unitID == nil {
+		report.addWarning(w.firstLine, "block", "well %s isn't in any assessment unit on record", w.code)
+		report.WellsUnlocated++
+	}
+
+	var inserted bool
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO groundwater_wells AS w (code, name, unit_id, latitude, longitude, well_type, aquifer, depth)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (code) DO UPDATE SET name = EXCLUDED.name, unit_id = EXCLUDED.unit_id,
+			latitude = EXCLUDED.latitude, longitude = EXCLUDED.longitude, well_type = EXCLUDED.well_type,
+			aquifer = EXCLUDED.aquifer, depth = EXCLUDED.depth, updated_at = NOW()
+		WHERE (w.name, w.unit_id, w.latitude, w.longitude, w.well_type, w.aquifer, w.depth)
+		      IS DISTINCT FROM
+		      (EXCLUDED.name, EXCLUDED.unit_id, EXCLUDED.latitude, EXCLUDED.longitude, EXCLUDED.well_type,
+		       EXCLUDED.aquifer, EXCLUDED.depth)
+		RETURNING id, xmax = 0`,
+		w.code, name, unitID, point.Lat, point.Lon, wellType, aquifer, depth).Scan(&id, &inserted)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return uuid.Nil, nil, false, err
+	case inserted:
+		report.WellsCreated++
+	default:
+		report.WellsUpdated++
+	}
+	return id, depth, true, nil
+}
+
+// upsertReading writes a reading unless the stored one already has the same values.
+func upsertReading(ctx context.Context, tx *sql.Tx, wellID, importID uuid.UUID, r WellRecord, report *WellImportReport) error {
+	var inserted bool
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO groundwater_well_readings AS r (well_id, measured_on, season, depth_to_water, import_id)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (well_id, measured_on) DO UPDATE SET
+			season = EXCLUDED.season, depth_to_water = EXCLUDED.depth_to_water, import_id = EXCLUDED.import_id
+		WHERE (r.season, r.depth_to_water) IS DISTINCT FROM (EXCLUDED.season, EXCLUDED.depth_to_water)
+		RETURNING xmax = 0`,
+		wellID, r.MeasuredOn, r.Season, r.DepthToWater, importID).Scan(&inserted)
+	switch {
+	case err == sql.ErrNoRows:
+		report.Unchanged++
+	case err != nil:
+		return err
+	case inserted:
+		report.Inserted++
+	default:
+		report.Updated++
+	}
+	return nil
+}
+
+// reflagWell flags the outliers among all of a well's readings, since new readings can
+// change which of the old ones stand out. Flagged readings from the file are reported
+// by the line they came from.
+func reflagWell(ctx context.Context, tx *sql.Tx, code string, wellID uuid.UUID, depth *float64, lines map[string]int, report *WellImportReport) error {
+	readings, err := wellReadings(ctx, tx, wellID)
+	if err != nil {
+		return err
+	}
+
+	for i, reason := range flagOutliers(readings, depth) {
+		r := readings[i]
+		if reason != "" {
+			report.Outliers++
+			if line, ok := lines[measuredOn(r.MeasuredOn)]; ok {
+				report.addWarning(line, "depth_to_water", "well %s reading of %g m flagged as an outlier: %s",
+					code, r.DepthToWater, reason)
+			}
+		}
+		if reason == r.OutlierReason {
+			continue
+		}
+		var stored interface{}
+		if reason != "" {
+			stored = reason
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE groundwater_well_readings SET outlier = $3, outlier_reason = $4
+			WHERE well_id = $1 AND measured_on = $2`, wellID, r.MeasuredOn, reason != "", stored); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rowsQuerier is satisfied by both *sql.DB and *sql.Tx.
+type rowsQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func wellReadings(ctx context.Context, q rowsQuerier, wellID uuid.UUID) ([]models.WellReading, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT measured_on, season, depth_to_water, outlier, COALESCE(outlier_reason, '')
+		FROM groundwater_well_readings WHERE well_id = $1 ORDER BY measured_on`, wellID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	readings := []models.WellReading{}
+	for rows.Next() {
+		var r models.WellReading
+		if err := rows.Scan(&r.MeasuredOn, &r.Season, &r.DepthToWater, &r.Outlier, &r.OutlierReason); err != nil {
+			return nil, err
+		}
+		readings = append(readings, r)
+	}
+	return readings, rows.Err()
+}
+
+const wellColumns = `w.id, w.code, w.name, w.unit_id, COALESCE(u.name, ''), w.latitude, w.longitude, w.well_type,
+	w.aquifer, w.depth, r.readings, r.first_year, r.last_year, w.created_at, w.updated_at`
+
+const wellTables = `groundwater_wells w
+	LEFT JOIN groundwater_units u ON u.id = w.unit_id
+	LEFT JOIN LATERAL (
+		SELECT COUNT(*) AS readings, MIN(EXTRACT(YEAR FROM measured_on))::int AS first_year,
+			MAX(EXTRACT(YEAR FROM measured_on))::int AS last_year
+		FROM groundwater_well_readings WHERE well_id = w.id
+	) r ON TRUE`
+
+func (s *Service) queryWells(ctx context.Context, query string, args ...interface{}) ([]models.ObservationWell, error) {
+	rows, err := s.db.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("well lookup error: %w", err)
+	}
+	defer rows.Close()
+
+	wells := []models.ObservationWell{}
+	for rows.Next() {
+		var w models.ObservationWell
+		if err := rows.Scan(&w.ID, &w.Code, &w.Name, &w.UnitID, &w.UnitName, &w.Latitude, &w.Longitude, &w.WellType,
+			&w.Aquifer, &w.Depth, &w.Readings, &w.FirstYear, &w.LastYear, &w.CreatedAt, &w.UpdatedAt); err != nil {
+			return nil, err
+		}
+		wells = append(wells, w)
+	}
+	return wells, rows.Err()
+}
+
+// WellFilter narrows a well listing to a unit and everything in it, or to a radius
+// around a point. Near takes precedence.
+type WellFilter struct {
+	UnitID   uuid.UUID
+	Near     *geo.Point
+	RadiusKm float64
+	Limit    int
+	Offset   int
+}
+
+// Wells lists observation wells by code, or nearest first around a point.
+func (s *Service) Wells(ctx context.Context, filter WellFilter) ([]models.ObservationWell, int, error) {
+	if filter.Near != nil {
+		wells, err := s.wellsNear(ctx, *filter.Near, filter.RadiusKm)
+		if err != nil {
+			return nil, 0, err
+		}
+		total := len(wells)
+		if filter.Offset >= total {
+			return []models.ObservationWell{}, total, nil
+		}
+		end := filter.Offset + filter.Limit
+		if end > total {
+			end = total
+		}
+		return wells[filter.Offset:end], total, nil
+	}
+
+	where, args := "TRUE", []interface{}{}
+	if filter.UnitID != uuid.Nil {
+		unit, err := s.Unit(ctx, filter.UnitID)
+		if err != nil {
+			return nil, 0, err
+		}
+		where, args = "u.path = $1 OR left(u.path, length($1) + 1) = $1 || '/'", []interface{}{unit.Path}
+	}
+
+	var total int
+	if err := s.db.DB.QueryRowContext(ctx, fmt.Sprintf(`
+		SELECT COUNT(*) FROM groundwater_wells w LEFT JOIN groundwater_units u ON u.id = w.unit_id WHERE %s`, where),
+		args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("well count error: %w", err)
+	}
+	args = append(args, filter.Limit, filter.Offset)
+	wells, err := s.queryWells(ctx, fmt.Sprintf("SELECT %s FROM %s WHERE %s ORDER BY w.code LIMIT $%d OFFSET $%d",
+		wellColumns, wellTables, where, len(args)-1, len(args)), args...)
+	return wells, total, err
+}
+
+// wellsNear returns every well within radiusKm of the point, nearest first.
+func (s *Service) wellsNear(ctx context.Context, point geo.Point, radiusKm float64) ([]models.ObservationWell, error) {
+	box := geo.Around(point, radiusKm)
+	candidates, err := s.queryWells(ctx, `
+		SELECT `+wellColumns+` FROM `+wellTables+`
+		WHERE w.latitude BETWEEN $1 AND $2 AND w.longitude BETWEEN $3 AND $4`,
+		box.MinLat, box.MaxLat, box.MinLon, box.MaxLon)
+	if err != nil {
+		return nil, err
+	}
+
+	wells := candidates[:0]
+	for _, w := range candidates {
+		distance := geo.Distance(point, geo.Point{Lon: w.Longitude, Lat: w.Latitude})
+		if distance <= radiusKm {
+			rounded := round(distance, 2)
+			w.DistanceKm = &rounded
+			wells = append(wells, w)
+		}
+	}
+	sort.SliceStable(wells, func(i, j int) bool {
+		if *wells[i].DistanceKm != *wells[j].DistanceKm {
+			return *wells[i].DistanceKm < *wells[j].DistanceKm
+		}
+		return wells[i].Code < wells[j].Code
+	})
+	return wells, nil
+}
+
+// Well returns one observation well.
+func (s *Service) Well(ctx context.Context, id uuid.UUID) (*models.ObservationWell, error) {
+	wells, err := s.queryWells(ctx, "SELECT "+wellColumns+" FROM "+wellTables+" WHERE w.id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(wells) == 0 {
+		return nil, ErrWellNotFound
+	}
+	return &wells[0], nil
+}
+
+// WellReadings returns every reading of a well, oldest first, outliers included.
+func (s *Service) WellReadings(ctx context.Context, id uuid.UUID) ([]models.WellReading, error) {
+	readings, err := wellReadings(ctx, s.db.DB, id)
+	if err != nil {
+		return nil, fmt.Errorf("well reading lookup error: %w", err)
+	}
+	return readings, nil
+}
+
+// WellSeries returns one well's decomposed series. years is how far back the change
+// is measured from.
+func (s *Service) WellSeries(ctx context.Context, id uuid.UUID, years int) (*models.WaterLevelSeries, error) {
+	well, err := s.Well(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	series, err := s.waterLevelSeries(ctx, []models.ObservationWell{*well}, years)
+	if err != nil {
+		return nil, err
+	}
+	series.Well = well
+	return series, nil
+}
+
+// UnitWaterLevels returns the series of every well in a unit and the units inside it.
+func (s *Service) UnitWaterLevels(ctx context.Context, unitID uuid.UUID, years int) (*models.WaterLevelSeries, error) {
+	unit, err := s.Unit(ctx, unitID)
+	if err != nil {
+		return nil, err
+	}
+	wells, err := s.queryWells(ctx, `
+		SELECT `+wellColumns+` FROM `+wellTables+`
+		WHERE u.path = $1 OR left(u.path, length($1) + 1) = $1 || '/'`, unit.Path)
+	if err != nil {
+		return nil, err
+	}
+	series, err := s.waterLevelSeries(ctx, wells, years)
+	if err != nil {
+		return nil, err
+	}
+	series.Unit = unit
+	return series, nil
+}
+
+// NearbyWaterLevels returns the series of every well within radiusKm of a point: how
+// the water table has changed near someone.
+func (s *Service) NearbyWaterLevels(ctx context.Context, location models.GeoPoint, radiusKm float64, years int) (*models.WaterLevelSeries, error) {
+	if radiusKm <= 0 || radiusKm > MaxWellRadiusKm {
+		return nil, ErrInvalidRadius
+	}
+	wells, err := s.wellsNear(ctx, geo.Point{Lon: location.Longitude, Lat: location.Latitude}, radiusKm)
+	if err != nil {
+		return nil, err
+	}
+	series, err := s.waterLevelSeries(ctx, wells, years)
+	if err != nil {
+		return nil, err
+	}
+	series.Location, series.RadiusKm = &location, radiusKm
+	return series, nil
+}
+
+// waterLevelSeries decomposes the wells' readings, leaving out outliers. Readings of a
+// well in the same season of a year are averaged first.
+func (s *Service) waterLevelSeries(ctx context.Context, wells []models.ObservationWell, years int) (*models.WaterLevelSeries, error) {
+	if len(wells) == 0 {
+		return nil, ErrNoWellReadings
+	}
+	ids := make([]uuid.UUID, len(wells))
+	for i, w := range wells {
+		ids[i] = w.ID
+	}
+
+	rows, err := s.db.DB.QueryContext(ctx, `
+		SELECT well_id, EXTRACT(YEAR FROM measured_on)::int, season, AVG(depth_to_water)
+		FROM groundwater_well_readings WHERE well_id = ANY($1) AND NOT outlier
+		GROUP BY 1, 2, 3 ORDER BY 1, 2, 3`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("well reading lookup error: %w", err)
+	}
+	defer rows.Close()
+
+	index := map[uuid.UUID]int{}
+	var obs []observation
+	for rows.Next() {
+		var wellID uuid.UUID
+		var o observation
+		if err := rows.Scan(&wellID, &o.year, &o.season, &o.depth); err != nil {
+			return nil, err
+		}
+		if _, ok := index[wellID]; !ok {
+			index[wellID] = len(index)
+		}
+		o.well = index[wellID]
+		obs = append(obs, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(obs) == 0 {
+		return nil, ErrNoWellReadings
+	}
+
+	series := &models.WaterLevelSeries{Wells: len(index)}
+	if err := s.db.DB.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM groundwater_well_readings WHERE well_id = ANY($1) AND outlier", pq.Array(ids)).
+		Scan(&series.Outliers); err != nil {
+		return nil, fmt.Errorf("well reading count error: %w", err)
+	}
+	series.Points, series.Seasonal = decompose(obs)
+	series.Change = waterLevelChange(series.Points, years)
+	return series, nil
+}
+
+// describeWaterTable is a sentence on how the water table moved near a point, or "".
+func describeWaterTable(series *models.WaterLevelSeries) string {
+	c := series.Change
+	if c == nil {
+		return ""
+	}
+	wells := "the observation well"
+	if series.Wells > 1 {
+		wells = fmt.Sprintf("the %d observation wells", series.Wells)
+	}
+	where := fmt.Sprintf("At %s within %g km", wells, series.RadiusKm)
+
+	switch c.Direction {
+	case WaterTableFalling:
+		return fmt.Sprintf("%s the water table has fallen %.1f m since %d, about %.2f m a year, to %.1f m below ground.",
+			where, c.Change, c.FromYear, c.PerYear, c.To)
+	case WaterTableRising:
+		return fmt.Sprintf("%s the water table has risen %.1f m since %d, about %.2f m a year, to %.1f m below ground.",
+			where, -c.Change, c.FromYear, -c.PerYear, c.To)
+	default:
+		return fmt.Sprintf("%s the water table has held at about %.1f m below ground since %d.", where, c.To, c.FromYear)
+	}
+}
+
+// nearbyWaterTable describes the water table around a shared location. Without wells
+// nearby, or when the lookup fails, there's nothing to add.
+func (s *Service) nearbyWaterTable(ctx context.Context, location models.GeoPoint) string {
+	series, err := s.NearbyWaterLevels(ctx, location, DefaultWellRadiusKm, DefaultChangeYears)
+	if err != nil {
+		if !errors.Is(err, ErrNoWellReadings) {
+			s.logger.WithError(err).Warn("Nearby water level lookup failed")
+		}
+		return ""
+	}
+	text := describeWaterTable(series)
+	if analysis, err := AnalyseWaterLevels(series, AnalysisOptions{}); err == nil && text != "" {
+		text = joinSentences(text, describeTrendTest(analysis))
+	}
+	return text
+}
+
+// describeTrendTest says whether the yearly levels' trend is statistically significant,
+// or "" when there were too few years to test.
+func describeTrendTest(analysis *models.WaterLevelAnalysis) string {
+	for _, t := range analysis.Trends {
+		if t.Season != "" {
+			continue
+		}
+		if !t.Significant {
+			return fmt.Sprintf("Over %d years of readings that isn't a statistically significant trend (Mann-Kendall p = %.2f).",
+				t.Years, t.PValue)
+		}
+		movement, slope := "decline", t.Slope
+		if t.Direction == WaterTableRising {
+			movement, slope = "rise", -t.Slope
+		}
+		p := fmt.Sprintf("p = %.3f", t.PValue)
+		if t.PValue < 0.001 {
+			p = "p < 0.001"
+		}
+		return fmt.Sprintf("That's a statistically significant %s over %d years (Mann-Kendall %s), about %.2f m a year by Sen's slope.",
+			movement, t.Years, p, slope)
+	}
+	return ""
+}
+
+// measuredOn formats a reading's date.
+func measuredOn(t time.Time) string {
+	return t.Format("2006-01-02")
+}
@@ -0,0 +1,244 @@
+package groundwater
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/analytics"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+)
+
+// seasonOrder is the order of the measurement rounds within a year.
+var seasonOrder = []models.Season{models.SeasonWinter, models.SeasonPreMonsoon, models.SeasonMonsoon, models.SeasonPostMonsoon}
+
+func seasonIndex(season models.Season) int {
+	for i, s := range seasonOrder {
+		if s == season {
+			return i
+		}
+	}
+	return len(seasonOrder)
+}
+
+const (
+	// hampelYears is how many years either side of a reading its same-season
+	// neighbours are drawn from
+	hampelYears = 3
+	// hampelMinNeighbours is how many neighbours a reading needs to be judged at all
+	hampelMinNeighbours = 4
+	// hampelThreshold is how many robust standard deviations from the neighbours'
+	// median make an outlier
+	hampelThreshold = 3.5
+	// minSpread floors the neighbours' median absolute deviation, in metres, so a well
+	// that barely moves doesn't flag every small change
+	minSpread = 0.5
+	// stableChange is the change in metres below which the water table counts as stable
+	stableChange = 0.5
+	// decomposeIterations bounds the backfitting in decompose
+	decomposeIterations = 100
+)
+
+// Which way the water table moved, as WaterLevelChange.Direction.
+const (
+	WaterTableFalling = "falling"
+	WaterTableRising  = "rising"
+	WaterTableStable  = "stable"
+)
+
+// flagOutliers returns a reason for each reading that doesn't belong in the well's
+// series, or "". Readings deeper than the well are flagged outright; the rest are
+// compared with readings of the same season in the years around them (a Hampel filter),
+// so a long decline isn't mistaken for outliers.
+func flagOutliers(readings []models.WellReading, wellDepth *float64) []string {
+	reasons := make([]string, len(readings))
+	for i, r := range readings {
+		if wellDepth != nil && r.DepthToWater > *wellDepth {
+			reasons[i] = fmt.Sprintf("deeper than the %.1f m well", *wellDepth)
+		}
+	}
+
+	for i, r := range readings {
+		if reasons[i] != "" {
+			continue
+		}
+		var neighbours []float64
+		for j, other := range readings {
+			if j == i || reasons[j] != "" || other.Season != r.Season {
+				continue
+			}
+			if gap := other.MeasuredOn.Year() - r.MeasuredOn.Year(); gap >= -hampelYears && gap <= hampelYears {
+				neighbours = append(neighbours, other.DepthToWater)
+			}
+		}
+		if len(neighbours) < hampelMinNeighbours {
+			continue
+		}
+
+		center := analytics.Median(neighbours)
+		deviations := make([]float64, len(neighbours))
+		for k, v := range neighbours {
+			deviations[k] = math.Abs(v - center)
+		}
+		// 1.4826 scales the median absolute deviation to a standard deviation
+		spread := 1.4826 * math.Max(analytics.Median(deviations), minSpread)
+		if score := (r.DepthToWater - center) / spread; math.Abs(score) > hampelThreshold {
+			reasons[i] = fmt.Sprintf("%.1f m from the usual %.1f m for the season", r.DepthToWater-center, center)
+		}
+	}
+	return reasons
+}
+
+// observation is one well's depth to water in one season, for decompose.
+type observation struct {
+	well   int
+	year   int
+	season models.Season
+	depth  float64
+}
+
+type seasonKey struct {
+	year   int
+	season models.Season
+}
+
+// decompose fits depth = year level + season effect + well offset to the observations
+// by backfitting, so missing rounds and wells joining or leaving the network don't bend
+// the series. Each point's depth is the mean of its wells' readings, each moved by the
+// well's offset from the others; for a single well that's simply its reading. Season
+// effects average zero over the seasons seen. Readings of the same well in one season
+// should be averaged first.
+func decompose(obs []observation) ([]models.WaterLevelPoint, map[models.Season]float64) {
+	effects := map[models.Season]float64{}
+	if len(obs) == 0 {
+		return []models.WaterLevelPoint{}, effects
+	}
+
+	// Years, seasons and wells are all keyed by int; seasons by their seasonIndex
+	groupMean := func(key func(o observation) int, value func(o observation) float64) map[int]float64 {
+		sums, counts := map[int]float64{}, map[int]int{}
+		for _, o := range obs {
+			sums[key(o)] += value(o)
+			counts[key(o)]++
+		}
+		for k := range sums {
+			sums[k] /= float64(counts[k])
+		}
+		return sums
+	}
+	// Summing in key order keeps results identical from run to run
+	centre := func(values map[int]float64) {
+		keys := make([]int, 0, len(values))
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Ints(keys)
+		var sum float64
+		for _, k := range keys {
+			sum += values[k]
+		}
+		for k := range values {
+			values[k] -= sum / float64(len(values))
+		}
+	}
+	maxChange := func(before, after map[int]float64) float64 {
+		change := 0.0
+		for k, v := range after {
+			change = math.Max(change, math.Abs(v-before[k]))
+		}
+		return change
+	}
+
+	trend, seasonal, offsets := map[int]float64{}, map[int]float64{}, map[int]float64{}
+	byYear := func(o observation) int { return o.year }
+	bySeason := func(o observation) int { return seasonIndex(o.season) }
+	byWell := func(o observation) int { return o.well }
+	for i := 0; i < decomposeIterations; i++ {
+		years := groupMean(byYear, func(o observation) float64 {
+			return o.depth - seasonal[seasonIndex(o.season)] - offsets[o.well]
+		})
+		seasons := groupMean(bySeason, func(o observation) float64 {
+			return o.depth - years[o.year] - offsets[o.well]
+		})
+		centre(seasons)
+		wells := groupMean(byWell, func(o observation) float64 {
+			return o.depth - years[o.year] - seasons[seasonIndex(o.season)]
+		})
+		centre(wells)
+
+		change := math.Max(maxChange(trend, years), math.Max(maxChange(seasonal, seasons), maxChange(offsets, wells)))
+		trend, seasonal, offsets = years, seasons, wells
+		if change < 1e-9 {
+			break
+		}
+	}
+
+	type cell struct {
+		sum   float64
+		wells int
+	}
+	cells := map[seasonKey]*cell{}
+	for _, o := range obs {
+		key := seasonKey{o.year, o.season}
+		if cells[key] == nil {
+			cells[key] = &cell{}
+		}
+		cells[key].sum += o.depth - offsets[o.well]
+		cells[key].wells++
+	}
+
+	points := make([]models.WaterLevelPoint, 0, len(cells))
+	for key, c := range cells {
+		depth := c.sum / float64(c.wells)
+		effect := seasonal[seasonIndex(key.season)]
+		points = append(points, models.WaterLevelPoint{
+			Year:         key.year,
+			Season:       key.season,
+			DepthToWater: round(depth, 2),
+			Trend:        round(trend[key.year], 2),
+			Seasonal:     round(effect, 2),
+			Residual:     round(depth-trend[key.year]-effect, 2),
+			Wells:        c.wells,
+		})
+		effects[key.season] = round(effect, 2)
+	}
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].Year != points[j].Year {
+			return points[i].Year < points[j].Year
+		}
+		return seasonIndex(points[i].Season) < seasonIndex(points[j].Season)
+	})
+	return points, effects
+}
+
+// waterLevelChange compares the newest year level with the oldest one at most years
+// before it. It's nil without two years to compare.
+func waterLevelChange(points []models.WaterLevelPoint, years int) *models.WaterLevelChange {
+	if len(points) == 0 {
+		return nil
+	}
+	last := points[len(points)-1]
+	for _, p := range points {
+		if p.Year < last.Year-years || p.Year == last.Year {
+			continue
+		}
+		change := last.Trend - p.Trend
+		direction := WaterTableStable
+		switch {
+		case change >= stableChange:
+			direction = WaterTableFalling
+		case change <= -stableChange:
+			direction = WaterTableRising
+		}
+		return &models.WaterLevelChange{
+			FromYear:  p.Year,
+			ToYear:    last.Year,
+			From:      p.Trend,
+			To:        last.Trend,
+			Change:    round(change, 2),
+			PerYear:   round(change/float64(last.Year-p.Year), 2),
+			Direction: direction,
+		}
+	}
+	return nil
+}
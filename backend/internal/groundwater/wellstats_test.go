@@ -0,0 +1,209 @@
+package groundwater
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+)
+
+// readings returns one reading a year from 2015 for each depth, in the given season.
+func readings(season models.Season, depths ...float64) []models.WellReading {
+	var result []models.WellReading
+	for i, depth := range depths {
+		result = append(result, models.WellReading{
+			MeasuredOn:   time.Date(2015+i, time.May, 1, 0, 0, 0, 0, time.UTC),
+			Season:       season,
+			DepthToWater: depth,
+		})
+	}
+	return result
+}
+
+func TestFlagOutliers(t *testing.T) {
+	wellDepth := 20.0
+	tests := []struct {
+		name      string
+		readings  []models.WellReading
+		wellDepth *float64
+		want      []string
+	}{
+		{
+			name:     "spike",
+			readings: readings(models.SeasonPreMonsoon, 5.0, 5.2, 5.1, 5.3, 12.0, 5.2, 5.4),
+			// The 2019 neighbours have a median of 5.2 m and a spread floored at 0.5 m
+			want: []string{"", "", "", "", "6.8 m from the usual 5.2 m for the season", "", ""},
+		},
+		{
+			// Each year is judged against the years around it, so a fall of a metre a
+			// year is a trend rather than a run of outliers
+			name:     "steady decline",
+			readings: readings(models.SeasonPreMonsoon, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12),
+			want:     make([]string, 10),
+		},
+		{
+			name: "seasons apart",
+			readings: append(readings(models.SeasonPreMonsoon, 5.0, 5.2, 5.1, 5.3, 5.2),
+				readings(models.SeasonPostMonsoon, 1.0, 1.2, 1.1, 1.3, 1.2)...),
+			want: make([]string, 10),
+		},
+		{
+			// Too few neighbours to judge the spike, but not the well's depth
+			name:      "deeper than the well",
+			readings:  readings(models.SeasonPreMonsoon, 5.0, 21.5, 12.0),
+			wellDepth: &wellDepth,
+			want:      []string{"", "deeper than the 20.0 m well", ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := flagOutliers(tt.readings, tt.wellDepth); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("flagOutliers() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecompose(t *testing.T) {
+	// Year levels of 5, 6 and 7 m, a metre deeper before the monsoon and a metre
+	// shallower after it
+	levels := map[int]float64{2019: 5, 2020: 6, 2021: 7}
+	effects := map[models.Season]float64{models.SeasonPreMonsoon: 1, models.SeasonPostMonsoon: -1}
+	observe := func(well int, offset float64, skip seasonKey) []observation {
+		var obs []observation
+		for year := 2019; year <= 2021; year++ {
+			for _, season := range []models.Season{models.SeasonPreMonsoon, models.SeasonPostMonsoon} {
+				if (seasonKey{year, season}) != skip {
+					obs = append(obs, observation{well, year, season, levels[year] + effects[season] + offset})
+				}
+			}
+		}
+		return obs
+	}
+	points := func(wells map[seasonKey]int) []models.WaterLevelPoint {
+		var result []models.WaterLevelPoint
+		for year := 2019; year <= 2021; year++ {
+			for _, season := range []models.Season{models.SeasonPreMonsoon, models.SeasonPostMonsoon} {
+				count, ok := wells[seasonKey{year, season}]
+				if !ok {
+					count = 1
+				}
+				result = append(result, models.WaterLevelPoint{
+					Year: year, Season: season, DepthToWater: levels[year] + effects[season],
+					Trend: levels[year], Seasonal: effects[season], Wells: count,
+				})
+			}
+		}
+		return result
+	}
+
+	tests := []struct {
+		name    string
+		obs     []observation
+		points  []models.WaterLevelPoint
+		effects map[models.Season]float64
+	}{
+		{
+			name:    "empty",
+			points:  []models.WaterLevelPoint{},
+			effects: map[models.Season]float64{},
+		},
+		{
+			name:    "one well",
+			obs:     observe(0, 0, seasonKey{}),
+			points:  points(nil),
+			effects: effects,
+		},
+		{
+			// A deeper and a shallower well, the shallower one missing a round: each is
+			// moved by its offset, so the missing reading doesn't shift that point
+			name: "two wells",
+			obs: append(observe(0, 0.5, seasonKey{}),
+				observe(1, -0.5, seasonKey{2020, models.SeasonPostMonsoon})...),
+			points: points(map[seasonKey]int{
+				{2019, models.SeasonPreMonsoon}: 2, {2019, models.SeasonPostMonsoon}: 2,
+				{2020, models.SeasonPreMonsoon}: 2, {2020, models.SeasonPostMonsoon}: 1,
+				{2021, models.SeasonPreMonsoon}: 2, {2021, models.SeasonPostMonsoon}: 2,
+			}),
+			effects: effects,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			points, effects := decompose(tt.obs)
+			if !reflect.DeepEqual(points, tt.points) {
+				t.Errorf("points = %+v\nwant %+v", points, tt.points)
+			}
+			if !reflect.DeepEqual(effects, tt.effects) {
+				t.Errorf("effects = %v, want %v", effects, tt.effects)
+			}
+		})
+	}
+}
+
+func TestWaterLevelChange(t *testing.T) {
+	trend := func(levels map[int]float64) []models.WaterLevelPoint {
+		var points []models.WaterLevelPoint
+		for year := 2011; year <= 2020; year++ {
+			if level, ok := levels[year]; ok {
+				points = append(points, models.WaterLevelPoint{Year: year, Trend: level})
+			}
+		}
+		return points
+	}
+
+	tests := []struct {
+		name   string
+		points []models.WaterLevelPoint
+		years  int
+		want   *models.WaterLevelChange
+	}{
+		{
+			// The oldest year within five of the last is compared
+			name:   "falling",
+			points: trend(map[int]float64{2011: 5, 2014: 5.9, 2016: 6.5, 2018: 7.1, 2020: 7.7}),
+			years:  5,
+			want: &models.WaterLevelChange{
+				FromYear: 2016, ToYear: 2020, From: 6.5, To: 7.7,
+				Change: 1.2, PerYear: 0.3, Direction: WaterTableFalling,
+			},
+		},
+		{
+			name:   "rising",
+			points: trend(map[int]float64{2019: 6, 2020: 5.2}),
+			years:  5,
+			want: &models.WaterLevelChange{
+				FromYear: 2019, ToYear: 2020, From: 6, To: 5.2,
+				Change: -0.8, PerYear: -0.8, Direction: WaterTableRising,
+			},
+		},
+		{
+			name:   "stable",
+			points: trend(map[int]float64{2018: 6, 2020: 6.3}),
+			years:  5,
+			want: &models.WaterLevelChange{
+				FromYear: 2018, ToYear: 2020, From: 6, To: 6.3,
+				Change: 0.3, PerYear: 0.15, Direction: WaterTableStable,
+			},
+		},
+		{
+			name:   "one year",
+			points: trend(map[int]float64{2020: 6}),
+			years:  5,
+		},
+		{
+			name:   "nothing recent",
+			points: trend(map[int]float64{2011: 5, 2020: 7}),
+			years:  5,
+		},
+		{name: "empty", years: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := waterLevelChange(tt.points, tt.years); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("waterLevelChange() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/account"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/auth"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/chat"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+type AccountHandler struct {
+	accountService *account.Service
+	logger         *logrus.Logger
+}
+
+func NewAccountHandler(accountService *account.Service, logger *logrus.Logger) *AccountHandler {
+	return &AccountHandler{
+		accountService: accountService,
+		logger:         logger,
+	}
+}
+
+// Export serves GET /users/account/export as a ZIP download of the caller's data.
+func (h *AccountHandler) Export(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	claims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="ground-sense-%s-%s.zip"`,
+		claims.Username, time.Now().UTC().Format("20060102")))
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := h.accountService.Export(r.Context(), claims.UserID, w, clientInfo(r)); err != nil {
+		// Headers are already sent, so the client sees a truncated archive
+		h.logger.WithError(err).WithField("user_id", claims.UserID).Error("Failed to export account")
+	}
+}
+
+// Delete serves DELETE /users/account, closing the caller's account. It can be restored
+// from the emailed link until the returned purge_after.
+func (h *AccountHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodDelete) {
+		return
+	}
+
+	claims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.DeleteAccountRequest
+	if err := decodeAndValidate(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	purgeAfter, err := h.accountService.RequestDeletion(r.Context(), claims.UserID, auth.Reauthentication{
+		SessionID: claims.SessionID,
+		Password:  req.Password,
+		Code:      req.ReauthCode,
+	}, clientInfo(r))
+	if err != nil {
+		respondAuthError(w, h.logger, err)
+		return
+	}
+	chat.GetHub().DisconnectUser(claims.UserID.String())
+
+	respondJSON(w, http.StatusAccepted, map[string]interface{}{
+		"message":     "Account scheduled for deletion",
+		"purge_after": purgeAfter,
+	})
+}
+
+// CancelDeletion serves POST /auth/account-deletion/cancel with the token from the deletion email.
+func (h *AccountHandler) CancelDeletion(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req models.CancelDeletionRequest
+	if err := decodeAndValidate(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.accountService.CancelDeletion(r.Context(), req.Token, clientInfo(r)); err != nil {
+		if err == account.ErrInvalidCancelToken {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		h.logger.WithError(err).Error("Failed to cancel account deletion")
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{
+		"message": "Account restored; sign in to continue",
+	})
+}
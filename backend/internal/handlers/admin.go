@@ -0,0 +1,385 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/auth"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/chat"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/database"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+const adminUsersPath = "/api/v1/admin/users"
+
+type AdminHandler struct {
+	db          *database.Service
+	authService *auth.Service
+	logger      *logrus.Logger
+}
+
+func NewAdminHandler(db *database.Service, authService *auth.Service, logger *logrus.Logger) *AdminHandler {
+	return &AdminHandler{
+		db:          db,
+		authService: authService,
+		logger:      logger,
+	}
+}
+
+func (h *AdminHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	limit, offset := pagination(r)
+	rows, err := h.db.DB.QueryContext(r.Context(), `
+		SELECT id, username, email, COALESCE(first_name, ''), COALESCE(last_name, ''), role, status,
+		       email_verified, phone_verified, last_login_at, created_at, updated_at, account_type
+		FROM users WHERE deleted_at IS NULL
+		ORDER BY created_at DESC LIMIT $1 OFFSET $2`, limit, offset)
+	if err != nil {
+		h.internalError(w, err, "Failed to list users")
+		return
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var user models.User
+		var accountType models.AccountType
+		if err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.FirstName, &user.LastName,
+			&user.Role, &user.Status, &user.EmailVerified, &user.PhoneVerified, &user.LastLoginAt,
+			&user.CreatedAt, &user.UpdatedAt, &accountType); err != nil {
+			h.internalError(w, err, "Failed to scan user")
+			return
+		}
+		user.SetAccountType(accountType)
+		users = append(users, user)
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"users":  users,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// UserActions dispatches /admin/users/{id}/{action}.
+func (h *AdminHandler) UserActions(w http.ResponseWriter, r *http.Request) {
+	segments := pathSegments(r, adminUsersPath)
+	if len(segments) != 2 {
+		respondError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	switch segments[1] {
+	case "status":
+		h.UpdateUserStatus(w, r)
+	case "unlock":
+		h.UnlockUser(w, r)
+	case "impersonate":
+		h.Impersonate(w, r)
+	default:
+		respondError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// UpdateUserStatus serves PUT /admin/users/{id}/status. Any status other than active
+// signs the user out everywhere and drops their live sockets.
+func (h *AdminHandler) UpdateUserStatus(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPut) || !h.requirePermission(w, r, auth.PermUsersBan) {
+		return
+	}
+
+	userID, ok := parseUUIDSegment(w, pathSegments(r, adminUsersPath)[0])
+	if !ok {
+		return
+	}
+
+	var req models.UpdateUserStatusRequest
+	if err := decodeAndValidate(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Suspending someone who holds more permissions would lock them out of what the
+	// actor can't do themselves
+	admin, _ := currentUser(w, r)
+	var role string
+	err := h.db.DB.QueryRowContext(r.Context(),
+		"SELECT role FROM users WHERE id = $1 AND deleted_at IS NULL", userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		respondError(w, http.StatusNotFound, "User not found")
+		return
+	} else if err != nil {
+		h.internalError(w, err, "Failed to update user status")
+		return
+	}
+	if within, err := h.authService.RoleWithin(r.Context(), admin, role); err != nil {
+		h.internalError(w, err, "Failed to update user status")
+		return
+	} else if !within {
+		respondError(w, http.StatusForbidden, auth.ErrPermissionEscalation.Error())
+		return
+	}
+
+	var oldStatus models.UserStatus
+	err = h.db.DB.QueryRowContext(r.Context(), `
+		UPDATE users u SET status = $1, updated_at = $2
+		FROM (SELECT id, status FROM users WHERE id = $3 AND role = $4 AND deleted_at IS NULL FOR UPDATE) old
+		WHERE u.id = old.id
+		RETURNING old.status`, req.Status, time.Now(), userID, role).Scan(&oldStatus)
+	if err == sql.ErrNoRows {
+		respondError(w, http.StatusNotFound, "User not found")
+		return
+	} else if err != nil {
+		h.internalError(w, err, "Failed to update user status")
+		return
+	}
+
+	// Tokens carry the role and status they were issued with, so any change invalidates them
+	if err := h.authService.InvalidateUserTokens(r.Context(), userID); err != nil {
+		h.internalError(w, err, "Failed to invalidate tokens")
+		return
+	}
+
+	var revoked int64
+	if req.Status != models.StatusActive {
+		revoked, err = h.authService.RevokeAllSessions(r.Context(), userID)
+		if err != nil {
+			h.internalError(w, err, "Failed to revoke sessions")
+			return
+		}
+		chat.GetHub().DisconnectUser(userID.String())
+	}
+
+	if err := h.db.RecordAudit(r.Context(), database.AuditEntry{
+		UserID:       admin.UserID.String(),
+		Action:       "user.status_changed",
+		ResourceType: "user",
+		ResourceID:   userID.String(),
+		OldValues:    map[string]interface{}{"status": oldStatus},
+		NewValues:    map[string]interface{}{"status": req.Status, "reason": req.Reason, "sessions_revoked": revoked},
+		IPAddress:    clientInfo(r).IPAddress,
+		UserAgent:    r.UserAgent(),
+	}); err != nil {
+		h.logger.WithError(err).Warn("Failed to record audit log")
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"id":               userID,
+		"status":           req.Status,
+		"sessions_revoked": revoked,
+	})
+}
+
+// UnlockUser serves POST /admin/users/{id}/unlock, clearing a login lockout.
+func (h *AdminHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) || !h.requirePermission(w, r, auth.PermUsersUnlock) {
+		return
+	}
+
+	userID, ok := parseUUIDSegment(w, pathSegments(r, adminUsersPath)[0])
+	if !ok {
+		return
+	}
+
+	admin, _ := currentUser(w, r)
+	if err := h.authService.AdminUnlockAccount(r.Context(), admin.UserID, userID, clientInfo(r)); err != nil {
+		if err == auth.ErrUserNotFound {
+			respondError(w, http.StatusNotFound, "User not found")
+			return
+		}
+		h.internalError(w, err, "Failed to unlock user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Impersonate serves POST /admin/users/{id}/impersonate, issuing a short-lived token
+// to act as the user. The user is notified and every request made with it is audited.
+func (h *AdminHandler) Impersonate(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) || !h.requirePermission(w, r, auth.PermUsersImpersonate) {
+		return
+	}
+
+	userID, ok := parseUUIDSegment(w, pathSegments(r, adminUsersPath)[0])
+	if !ok {
+		return
+	}
+
+	var req models.ImpersonateRequest
+	if err := decodeAndValidate(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	admin, _ := currentUser(w, r)
+	response, err := h.authService.Impersonate(r.Context(), admin, userID, req.Reason, clientInfo(r))
+	if err != nil {
+		respondAuthError(w, h.logger, err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, response)
+}
+
+func (h *AdminHandler) GetSystemStats(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	stats := map[string]int64{}
+	for name, query := range map[string]string{
+		"users":           "SELECT COUNT(*) FROM users WHERE deleted_at IS NULL",
+		"active_sessions": "SELECT COUNT(*) FROM user_sessions WHERE revoked_at IS NULL AND expires_at > NOW()",
+		"conversations":   "SELECT COUNT(*) FROM conversations",
+		"messages":        "SELECT COUNT(*) FROM messages WHERE deleted_at IS NULL",
+	} {
+		var count int64
+		if err := h.db.DB.QueryRowContext(r.Context(), query).Scan(&count); err != nil {
+			h.internalError(w, err, "Failed to load stats")
+			return
+		}
+		stats[name] = count
+	}
+
+	respondJSON(w, http.StatusOK, stats)
+}
+
+func (h *AdminHandler) GetAuditLogs(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	limit, offset := pagination(r)
+	rows, err := h.db.DB.QueryContext(r.Context(), `
+		SELECT id, user_id, actor_id, action, resource_type, resource_id, old_values, new_values,
+		       HOST(ip_address), user_agent, created_at
+		FROM audit_logs ORDER BY created_at DESC LIMIT $1 OFFSET $2`, limit, offset)
+	if err != nil {
+		h.internalError(w, err, "Failed to list audit logs")
+		return
+	}
+	defer rows.Close()
+
+	logs := []models.AuditLog{}
+	for rows.Next() {
+		var entry models.AuditLog
+		if err := rows.Scan(&entry.ID, &entry.UserID, &entry.ActorID, &entry.Action, &entry.ResourceType, &entry.ResourceID,
+			&entry.OldValues, &entry.NewValues, &entry.IPAddress, &entry.UserAgent, &entry.CreatedAt); err != nil {
+			h.internalError(w, err, "Failed to scan audit log")
+			return
+		}
+		logs = append(logs, entry)
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"audit_logs": logs,
+		"limit":      limit,
+		"offset":     offset,
+	})
+}
+
+// Roles serves GET /admin/roles: every role's permissions and the permission catalog.
+func (h *AdminHandler) Roles(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	roles, err := h.authService.RolePermissions(r.Context())
+	if err != nil {
+		h.internalError(w, err, "Failed to load role permissions")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"roles":       roles,
+		"permissions": auth.PermissionCatalog,
+	})
+}
+
+// UpdateRole serves PUT /admin/roles/{role}, replacing the role's permissions.
+func (h *AdminHandler) UpdateRole(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPut) {
+		return
+	}
+
+	segments := pathSegments(r, "/api/v1/admin/roles")
+	if len(segments) != 1 {
+		respondError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	var req models.UpdateRolePermissionsRequest
+	if err := decodeAndValidate(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	admin, _ := currentUser(w, r)
+	err := h.authService.SetRolePermissions(r.Context(), admin.UserID, segments[0], req.Permissions, clientInfo(r))
+	switch {
+	case err == auth.ErrUnknownRole:
+		respondError(w, http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, auth.ErrUnknownPermission), err == auth.ErrAdminLockout:
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		h.internalError(w, err, "Failed to update role permissions")
+		return
+	}
+
+	roles, err := h.authService.RolePermissions(r.Context())
+	if err != nil {
+		h.internalError(w, err, "Failed to load role permissions")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"role":        segments[0],
+		"permissions": roles[segments[0]],
+	})
+}
+
+// requirePermission is for handlers that dispatch several actions and so can't be
+// wrapped in a single RequirePermission middleware.
+func (h *AdminHandler) requirePermission(w http.ResponseWriter, r *http.Request, permission string) bool {
+	claims, ok := currentUser(w, r)
+	if !ok {
+		return false
+	}
+	allowed, err := h.authService.Authorize(r.Context(), claims, permission)
+	if err != nil {
+		h.internalError(w, err, "Failed to check permissions")
+		return false
+	}
+	if !allowed {
+		respondError(w, http.StatusForbidden, "Missing permission "+permission)
+		return false
+	}
+	return true
+}
+
+func (h *AdminHandler) internalError(w http.ResponseWriter, err error, message string) {
+	h.logger.WithError(err).Error(message)
+	respondError(w, http.StatusInternalServerError, "Internal server error")
+}
+
+// pagination reads limit/offset query parameters, capping limit at 100.
+func pagination(r *http.Request) (limit, offset int) {
+	limit, _ = strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ = strconv.Atoi(r.URL.Query().Get("offset"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/alerts"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/groundwater"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+const watchlistPath = "/api/v1/users/watchlist"
+
+type AlertHandler struct {
+	alertService *alerts.Service
+	logger       *logrus.Logger
+}
+
+func NewAlertHandler(alertService *alerts.Service, logger *logrus.Logger) *AlertHandler {
+	return &AlertHandler{
+		alertService: alertService,
+		logger:       logger,
+	}
+}
+
+type watchRequest struct {
+	UnitID uuid.UUID `json:"unit_id" validate:"required"`
+}
+
+// Watchlist serves GET /users/watchlist (list) and POST /users/watchlist (watch a unit).
+func (h *AlertHandler) Watchlist(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet, http.MethodPost) {
+		return
+	}
+	claims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var req watchRequest
+		if err := decodeAndValidate(r, &req); err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := h.alertService.Watch(r.Context(), claims.UserID, req.UnitID); err != nil {
+			h.respondAlertError(w, err)
+			return
+		}
+	}
+
+	watched, err := h.alertService.Watchlist(r.Context(), claims.UserID)
+	if err != nil {
+		h.respondAlertError(w, err)
+		return
+	}
+	status := http.StatusOK
+	if r.Method == http.MethodPost {
+		status = http.StatusCreated
+	}
+	respondJSON(w, status, map[string]interface{}{"watchlist": watched})
+}
+
+// Unwatch serves DELETE /users/watchlist/{unit_id}.
+func (h *AlertHandler) Unwatch(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodDelete) {
+		return
+	}
+	claims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	segments := pathSegments(r, watchlistPath)
+	if len(segments) != 1 {
+		respondError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	unitID, ok := parseUUIDSegment(w, segments[0])
+	if !ok {
+		return
+	}
+
+	if err := h.alertService.Unwatch(r.Context(), claims.UserID, unitID); err != nil {
+		h.respondAlertError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Preferences serves GET and PUT /users/alert-preferences: immediate or weekly delivery,
+// email on or off and the stage-of-extraction change worth an alert.
+func (h *AlertHandler) Preferences(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet, http.MethodPut) {
+		return
+	}
+	claims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		prefs, err := h.alertService.Preferences(r.Context(), claims.UserID)
+		if err != nil {
+			h.respondAlertError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, prefs)
+		return
+	}
+
+	var req models.AlertPreferences
+	if err := decodeAndValidate(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	prefs, err := h.alertService.SetPreferences(r.Context(), claims.UserID, req)
+	if err != nil {
+		h.respondAlertError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, prefs)
+}
+
+// Alerts serves GET /users/alerts: every alert about the user's watchlist, newest first.
+func (h *AlertHandler) Alerts(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	claims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	limit, offset := pagination(r)
+	list, total, err := h.alertService.Alerts(r.Context(), claims.UserID, limit, offset)
+	if err != nil {
+		h.respondAlertError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"alerts": list,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+func (h *AlertHandler) respondAlertError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, groundwater.ErrUnitNotFound), errors.Is(err, alerts.ErrNotWatching):
+		respondError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, alerts.ErrWatchlistFull):
+		respondError(w, http.StatusConflict, err.Error())
+	default:
+		h.logger.WithError(err).Error("Watchlist request failed")
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
@@ -0,0 +1,458 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/auth"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/middleware"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+type AuthHandler struct {
+	authService *auth.Service
+	logger      *logrus.Logger
+}
+
+type refreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+func NewAuthHandler(authService *auth.Service, logger *logrus.Logger) *AuthHandler {
+	return &AuthHandler{
+		authService: authService,
+		logger:      logger,
+	}
+}
+
+func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req models.RegisterRequest
+	if err := decodeAndValidate(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp, err := h.authService.Register(r.Context(), req, clientInfo(r))
+	if err != nil {
+		respondAuthError(w, h.logger, err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, resp)
+}
+
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req models.LoginRequest
+	if err := decodeAndValidate(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp, err := h.authService.Login(r.Context(), req, clientInfo(r))
+	if err != nil {
+		respondAuthError(w, h.logger, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// VerifyLogin finishes a login that needed step-up verification with the emailed code.
+func (h *AuthHandler) VerifyLogin(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req models.LoginChallengeRequest
+	if err := decodeAndValidate(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	challengeID, ok := parseUUIDSegment(w, req.ChallengeID)
+	if !ok {
+		return
+	}
+	resp, err := h.authService.VerifyLoginChallenge(r.Context(), challengeID, req.Code, clientInfo(r))
+	if err != nil {
+		respondAuthError(w, h.logger, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req refreshTokenRequest
+	if err := decodeAndValidate(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp, err := h.authService.RefreshToken(r.Context(), req.RefreshToken)
+	if err != nil {
+		respondAuthError(w, h.logger, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req refreshTokenRequest
+	if err := decodeAndValidate(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.authService.Logout(r.Context(), req.RefreshToken); err != nil {
+		respondAuthError(w, h.logger, err)
+		return
+	}
+
+	// The route runs under OptionalAuth; drop the presented access token right away too
+	if claims, ok := middleware.GetUserFromContext(r.Context()); ok {
+		if err := h.authService.RevokeAccessToken(r.Context(), claims); err != nil {
+			h.logger.WithError(err).Warn("Failed to revoke access token")
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AuthHandler) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req models.PasswordResetRequest
+	if err := decodeAndValidate(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Always answer the same way so the endpoint can't be used to probe for accounts
+	if err := h.authService.RequestPasswordReset(r.Context(), req.Email, clientInfo(r)); err != nil {
+		h.logger.WithError(err).Error("Password reset request failed")
+	}
+
+	respondJSON(w, http.StatusAccepted, map[string]string{
+		"message": "If the email is registered, a reset link has been sent",
+	})
+}
+
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req models.PasswordResetConfirm
+	if err := decodeAndValidate(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.authService.ResetPassword(r.Context(), req); err != nil {
+		respondAuthError(w, h.logger, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{
+		"message": "Password has been reset",
+	})
+}
+
+func (h *AuthHandler) RequestPasswordlessLogin(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req models.PasswordlessLoginRequest
+	if err := decodeAndValidate(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Same answer whether or not the email is registered
+	if err := h.authService.RequestPasswordlessLogin(r.Context(), req.Email, req.Method, clientInfo(r)); err != nil {
+		h.logger.WithError(err).Error("Passwordless login request failed")
+	}
+
+	respondJSON(w, http.StatusAccepted, map[string]string{
+		"message": "If the email is registered, a sign-in email has been sent",
+	})
+}
+
+func (h *AuthHandler) LoginWithMagicLink(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req models.MagicLinkLoginRequest
+	if err := decodeAndValidate(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp, err := h.authService.LoginWithMagicLink(r.Context(), req.Token, clientInfo(r))
+	if err != nil {
+		respondAuthError(w, h.logger, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+func (h *AuthHandler) LoginWithCode(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req models.LoginCodeRequest
+	if err := decodeAndValidate(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp, err := h.authService.LoginWithCode(r.Context(), req.Email, req.Code, clientInfo(r))
+	if err != nil {
+		respondAuthError(w, h.logger, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+func (h *AuthHandler) RequestAccountUnlock(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req models.UnlockAccountRequest
+	if err := decodeAndValidate(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Same answer whether or not the account exists or is locked
+	if err := h.authService.RequestAccountUnlock(r.Context(), req.Email, clientInfo(r)); err != nil {
+		h.logger.WithError(err).Error("Account unlock request failed")
+	}
+
+	respondJSON(w, http.StatusAccepted, map[string]string{
+		"message": "If the account is locked, an unlock link has been sent",
+	})
+}
+
+func (h *AuthHandler) UnlockAccount(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req models.UnlockAccountConfirm
+	if err := decodeAndValidate(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.authService.UnlockAccount(r.Context(), req.Token, clientInfo(r)); err != nil {
+		respondAuthError(w, h.logger, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{
+		"message": "Account unlocked",
+	})
+}
+
+// Token serves POST /auth/token, the OAuth 2.0 token endpoint. Only the client_credentials
+// grant is supported; service accounts send their ID and secret as HTTP Basic credentials
+// or as client_id/client_secret form fields. Errors use the OAuth error codes.
+func (h *AuthHandler) Token(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := r.ParseForm(); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+	if r.PostForm.Get("grant_type") != "client_credentials" {
+		respondError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	resp, err := h.authService.ClientCredentialsToken(r.Context(), clientID, clientSecret, r.PostForm.Get("scope"))
+	switch err {
+	case nil:
+		respondJSON(w, http.StatusOK, resp)
+	case auth.ErrInvalidClient, auth.ErrAccountInactive:
+		w.Header().Set("WWW-Authenticate", `Basic realm="ground-sense-bot"`)
+		respondError(w, http.StatusUnauthorized, "invalid_client")
+	case auth.ErrInvalidScope:
+		respondError(w, http.StatusBadRequest, "invalid_scope")
+	default:
+		h.logger.WithError(err).Error("Client credentials grant failed")
+		respondError(w, http.StatusInternalServerError, "server_error")
+	}
+}
+
+// JWKS serves the public verification keys so other services can validate our tokens.
+func (h *AuthHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondJSON(w, http.StatusOK, h.authService.JWKS())
+}
+
+// OIDC serves /api/v1/auth/oidc/providers, /{provider}/login and /{provider}/callback. The
+// callback sends the browser back to the frontend with a one-time code for OIDCExchange.
+func (h *AuthHandler) OIDC(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	segments := pathSegments(r, "/api/v1/auth/oidc/")
+	switch {
+	case len(segments) == 1 && segments[0] == "providers":
+		respondJSON(w, http.StatusOK, map[string][]string{"providers": h.authService.OIDCProviders()})
+	case len(segments) == 2 && segments[1] == "login":
+		authURL, binding, err := h.authService.OIDCAuthorizationURL(r.Context(), segments[0])
+		if err != nil {
+			respondAuthError(w, h.logger, err)
+			return
+		}
+		http.SetCookie(w, h.authService.OIDCStateCookie(binding))
+		http.Redirect(w, r, authURL, http.StatusFound)
+	case len(segments) == 2 && segments[1] == "callback":
+		query := r.URL.Query()
+		if providerErr := query.Get("error"); providerErr != "" {
+			respondError(w, http.StatusUnauthorized, "Identity provider returned "+providerErr)
+			return
+		}
+		if query.Get("code") == "" || query.Get("state") == "" {
+			respondError(w, http.StatusBadRequest, "Missing code or state")
+			return
+		}
+
+		var binding string
+		if cookie, err := r.Cookie(auth.OIDCStateCookieName); err == nil {
+			binding = cookie.Value
+		}
+		http.SetCookie(w, h.authService.OIDCStateCookie(""))
+
+		redirectURL, err := h.authService.OIDCCallback(r.Context(), segments[0], query.Get("code"), query.Get("state"), binding)
+		if err != nil {
+			respondAuthError(w, h.logger, err)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, redirectURL, http.StatusFound)
+	default:
+		respondError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// OIDCExchange serves POST /api/v1/auth/oidc/exchange, trading the one-time code the
+// frontend got back from a provider login for tokens.
+func (h *AuthHandler) OIDCExchange(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req models.OIDCExchangeRequest
+	if err := decodeAndValidate(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp, err := h.authService.ExchangeOIDCLoginCode(r.Context(), req.Code, clientInfo(r))
+	if err != nil {
+		respondAuthError(w, h.logger, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// respondAuthError maps auth service errors to responses, logging anything unexpected.
+func respondAuthError(w http.ResponseWriter, logger *logrus.Logger, err error) {
+	var throttled *auth.ThrottleError
+	if errors.As(err, &throttled) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		respondError(w, http.StatusTooManyRequests, throttled.Error())
+		return
+	}
+
+	var cooldown *auth.UsernameCooldownError
+	if errors.As(err, &cooldown) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(cooldown.Until).Seconds()))))
+		respondError(w, http.StatusTooManyRequests, cooldown.Error())
+		return
+	}
+
+	var stepUp *auth.StepUpRequiredError
+	if errors.As(err, &stepUp) {
+		respondJSON(w, http.StatusUnauthorized, map[string]interface{}{
+			"error":        stepUp.Error(),
+			"step_up":      "email_code",
+			"challenge_id": stepUp.ChallengeID,
+			"expires_at":   stepUp.ExpiresAt,
+		})
+		return
+	}
+
+	var policy *auth.PasswordPolicyError
+	if errors.As(err, &policy) {
+		respondJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":      policy.Error(),
+			"violations": policy.Violations,
+		})
+		return
+	}
+
+	switch err {
+	case auth.ErrInvalidCredentials, auth.ErrInvalidToken, auth.ErrTokenExpired, auth.ErrTokenRevoked,
+		auth.ErrOIDCStateInvalid, auth.ErrInvalidAPIKey, auth.ErrInvalidClient:
+		respondError(w, http.StatusUnauthorized, err.Error())
+	case auth.ErrAccountInactive, auth.ErrOIDCSignupDisabled, auth.ErrImpersonationForbidden,
+		auth.ErrCannotImpersonate, auth.ErrReauthRequired, auth.ErrPermissionEscalation:
+		respondError(w, http.StatusForbidden, err.Error())
+	case auth.ErrOIDCProviderNotFound, auth.ErrUserNotFound, auth.ErrAPIKeyNotFound:
+		respondError(w, http.StatusNotFound, err.Error())
+	case auth.ErrUserExists, auth.ErrPhoneInUse, auth.ErrUsernameReserved, auth.ErrUsernameTaken, auth.ErrEmailInUse:
+		respondError(w, http.StatusConflict, err.Error())
+	case auth.ErrInvalidPassword, auth.ErrInvalidPhone, auth.ErrUsernameInvalid, auth.ErrEmailUnchanged,
+		auth.ErrEmailChangeToken, auth.ErrInvalidScope:
+		respondError(w, http.StatusBadRequest, err.Error())
+	default:
+		logger.WithError(err).Error("Authentication request failed")
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
@@ -0,0 +1,834 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/analytics"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/geo"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/groundwater"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	groundwaterUnitsPath       = "/api/v1/groundwater/units"
+	groundwaterWellsPath       = "/api/v1/groundwater/wells"
+	groundwaterWaterLevelsPath = "/api/v1/groundwater/water-levels"
+)
+
+// maxChangeYears bounds ?years=, how far back a water level change is measured from.
+const maxChangeYears = 50
+
+// maxPlaceQueryLength bounds the text the place resolver is asked to read.
+const maxPlaceQueryLength = 200
+
+// maxBoundaryUploadBytes bounds a GeoJSON boundary upload; a national block layer at
+// full detail is a few tens of megabytes.
+const maxBoundaryUploadBytes = 128 << 20
+
+type GroundwaterHandler struct {
+	groundwaterService *groundwater.Service
+	// mapBreakpoints are the configured colour classes of each map metric
+	mapBreakpoints map[string][]float64
+	logger         *logrus.Logger
+}
+
+func NewGroundwaterHandler(groundwaterService *groundwater.Service, mapBreakpoints map[string][]float64, logger *logrus.Logger) *GroundwaterHandler {
+	return &GroundwaterHandler{
+		groundwaterService: groundwaterService,
+		mapBreakpoints:     mapBreakpoints,
+		logger:             logger,
+	}
+}
+
+// ListUnits serves GET /groundwater/units, filtered by state, district, level, category
+// and year (the latest by default).
+func (h *GroundwaterHandler) ListUnits(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	query := r.URL.Query()
+	fields, err := parseAssessmentFields(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	year, err := optionalYear(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter := groundwater.UnitFilter{
+		State:    query.Get("state"),
+		District: query.Get("district"),
+		Year:     year,
+	}
+	if filter.Level, err = optionalLevel(r); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if category := query.Get("category"); category != "" {
+		var ok bool
+		if filter.Category, ok = groundwater.ParseCategory(category); !ok {
+			respondError(w, http.StatusBadRequest, "Unknown category "+category)
+			return
+		}
+	}
+	filter.Limit, filter.Offset = pagination(r)
+
+	if filter.Year == 0 {
+		if filter.Year, err = h.groundwaterService.LatestYear(r.Context()); err != nil {
+			h.respondGroundwaterError(w, err)
+			return
+		}
+	}
+	units, total, err := h.groundwaterService.ListUnits(r.Context(), filter)
+	if err != nil {
+		h.respondGroundwaterError(w, err)
+		return
+	}
+
+	items := make([]map[string]interface{}, 0, len(units))
+	for _, unit := range units {
+		item := map[string]interface{}{"unit": unit.Unit}
+		if unit.Assessment != nil {
+			item["assessment"] = fields.project(*unit.Assessment)
+		}
+		items = append(items, item)
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"units":  items,
+		"year":   filter.Year,
+		"total":  total,
+		"limit":  filter.Limit,
+		"offset": filter.Offset,
+	})
+}
+
+// Unit serves GET /groundwater/units/{id}: the unit with every assessed year, and the
+// /{id}/charts, /{id}/charts/{chart}, /{id}/boundary, /{id}/water-levels,
+// /{id}/water-levels/analysis, /{id}/rainfall and /{id}/rainfall/correlation
+// sub-resources.
+func (h *GroundwaterHandler) Unit(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	segments := pathSegments(r, groundwaterUnitsPath)
+	switch {
+	case len(segments) == 1:
+	case (len(segments) == 2 || len(segments) == 3) && segments[1] == "charts":
+	case len(segments) == 2 && (segments[1] == "boundary" || segments[1] == "water-levels" || segments[1] == "rainfall"):
+	case len(segments) == 3 && segments[1] == "water-levels" && segments[2] == "analysis":
+	case len(segments) == 3 && segments[1] == "rainfall" && segments[2] == "correlation":
+	default:
+		respondError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	unitID, ok := parseUUIDSegment(w, segments[0])
+	if !ok {
+		return
+	}
+	if len(segments) == 2 && segments[1] == "boundary" {
+		h.boundary(w, r, unitID)
+		return
+	}
+	if segments[len(segments)-1] == "water-levels" || segments[len(segments)-1] == "analysis" {
+		h.unitWaterLevels(w, r, unitID, len(segments) == 3)
+		return
+	}
+	if len(segments) > 1 && segments[1] == "rainfall" {
+		h.rainfall(w, r, unitID, len(segments) == 3)
+		return
+	}
+	if len(segments) > 1 {
+		chart := ""
+		if len(segments) == 3 {
+			chart = segments[2]
+		}
+		h.charts(w, r, unitID, chart)
+		return
+	}
+
+	fields, err := parseAssessmentFields(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	series, err := h.groundwaterService.UnitSeries(r.Context(), unitID)
+	if err != nil {
+		h.respondGroundwaterError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, fields.projectSeries(*series))
+}
+
+// Compare serves GET /groundwater/compare?units={id},{id}...: the units' series side by
+// side, limited to one year with ?year=.
+func (h *GroundwaterHandler) Compare(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	var unitIDs []uuid.UUID
+	for _, value := range strings.Split(r.URL.Query().Get("units"), ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		id, ok := parseUUIDSegment(w, value)
+		if !ok {
+			return
+		}
+		unitIDs = append(unitIDs, id)
+	}
+	if len(unitIDs) < 2 {
+		respondError(w, http.StatusBadRequest, "units must list at least two unit IDs")
+		return
+	}
+	fields, err := parseAssessmentFields(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	year, err := optionalYear(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	series, err := h.groundwaterService.CompareUnits(r.Context(), unitIDs, year)
+	if err != nil {
+		h.respondGroundwaterError(w, err)
+		return
+	}
+
+	units := make([]map[string]interface{}, 0, len(series))
+	for _, s := range series {
+		units = append(units, fields.projectSeries(s))
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"units": units})
+}
+
+// Places serves GET /groundwater/places?q=: the assessment units free text may refer to,
+// best match first, for autocomplete and for finding the place in a chat message.
+func (h *GroundwaterHandler) Places(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	query := r.URL.Query()
+	text := strings.TrimSpace(query.Get("q"))
+	if text == "" {
+		respondError(w, http.StatusBadRequest, "q is required")
+		return
+	}
+	if len(text) > maxPlaceQueryLength {
+		respondError(w, http.StatusBadRequest, "q is too long")
+		return
+	}
+	level, err := optionalLevel(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	opts := groundwater.PlaceOptions{Level: level, Limit: 10}
+	if limit, err := strconv.Atoi(query.Get("limit")); err == nil && limit > 0 && limit <= 25 {
+		opts.Limit = limit
+	}
+
+	resolution, err := h.groundwaterService.ResolvePlace(r.Context(), text, opts)
+	if err != nil {
+		h.respondGroundwaterError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, resolution)
+}
+
+// Locate serves GET /groundwater/locate?lat=&lon=: the units whose boundaries contain the
+// point, block first.
+func (h *GroundwaterHandler) Locate(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	point, err := optionalLocation(r)
+	if err != nil || point == nil {
+		respondError(w, http.StatusBadRequest, errLocation.Error())
+		return
+	}
+
+	units, err := h.groundwaterService.Locate(r.Context(), *point)
+	if err != nil {
+		h.respondGroundwaterError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"location": models.GeoPoint{Latitude: point.Lat, Longitude: point.Lon},
+		"units":    units,
+	})
+}
+
+// Wells serves GET /groundwater/wells: observation wells by code, those in ?unit= and
+// the units inside it, or those within ?radius_km= of ?lat=&lon=, nearest first.
+func (h *GroundwaterHandler) Wells(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	limit, offset := pagination(r)
+	filter := groundwater.WellFilter{Limit: limit, Offset: offset}
+	var err error
+	if filter.Near, err = optionalLocation(r); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if filter.RadiusKm, err = wellRadius(r); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if value := r.URL.Query().Get("unit"); value != "" {
+		if filter.UnitID, err = uuid.Parse(value); err != nil {
+			respondError(w, http.StatusBadRequest, "unit must be a unit id")
+			return
+		}
+	}
+
+	wells, total, err := h.groundwaterService.Wells(r.Context(), filter)
+	if err != nil {
+		h.respondGroundwaterError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"wells":  wells,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// Well serves GET /groundwater/wells/{id}: the well with every reading, outliers
+// flagged, /{id}/series: its series split into trend, season and residual, and
+// /{id}/analysis: the series' trend tests and forecasts.
+func (h *GroundwaterHandler) Well(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	segments := pathSegments(r, groundwaterWellsPath)
+	if len(segments) == 0 || len(segments) > 2 || (len(segments) == 2 && segments[1] != "series" && segments[1] != "analysis") {
+		respondError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	wellID, ok := parseUUIDSegment(w, segments[0])
+	if !ok {
+		return
+	}
+
+	if len(segments) == 2 {
+		years, err := changeYears(r)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		series, err := h.groundwaterService.WellSeries(r.Context(), wellID, years)
+		if err != nil {
+			h.respondGroundwaterError(w, err)
+			return
+		}
+		h.respondWaterLevels(w, r, series, years, segments[1] == "analysis")
+		return
+	}
+
+	well, err := h.groundwaterService.Well(r.Context(), wellID)
+	if err != nil {
+		h.respondGroundwaterError(w, err)
+		return
+	}
+	readings, err := h.groundwaterService.WellReadings(r.Context(), wellID)
+	if err != nil {
+		h.respondGroundwaterError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"well":     well,
+		"readings": readings,
+	})
+}
+
+// WaterLevels serves GET /groundwater/water-levels?lat=&lon=: the combined series of the
+// wells within ?radius_km= of the point, and how far the water table moved over the last
+// ?years=. /water-levels/analysis has the series' trend tests and forecasts instead.
+func (h *GroundwaterHandler) WaterLevels(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	segments := pathSegments(r, groundwaterWaterLevelsPath)
+	if len(segments) > 1 || (len(segments) == 1 && segments[0] != "analysis") {
+		respondError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	point, err := optionalLocation(r)
+	if err != nil || point == nil {
+		respondError(w, http.StatusBadRequest, errLocation.Error())
+		return
+	}
+	radius, err := wellRadius(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	years, err := changeYears(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	series, err := h.groundwaterService.NearbyWaterLevels(r.Context(),
+		models.GeoPoint{Latitude: point.Lat, Longitude: point.Lon}, radius, years)
+	if err != nil {
+		h.respondGroundwaterError(w, err)
+		return
+	}
+	h.respondWaterLevels(w, r, series, years, len(segments) == 1)
+}
+
+// Map serves GET /groundwater/map?level=&metric=: a GeoJSON FeatureCollection of the
+// level's units for a choropleth, optionally limited to one ?state= and ?year=. ?zoom=
+// picks the boundary detail and ?breaks= overrides the configured colour classes. The
+// response carries an ETag and is gzip-compressed for clients that accept it.
+func (h *GroundwaterHandler) Map(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	query := r.URL.Query()
+	opts := groundwater.ChoroplethOptions{
+		Metric: strings.ToLower(query.Get("metric")),
+		State:  query.Get("state"),
+	}
+	if opts.Metric == "" {
+		opts.Metric = "stage_of_extraction"
+	}
+	var err error
+	if opts.Level, err = optionalLevel(r); err != nil || opts.Level == "" {
+		respondError(w, http.StatusBadRequest, "level must be state, district or block")
+		return
+	}
+	if opts.Year, err = optionalYear(r); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if value := query.Get("zoom"); value != "" {
+		if opts.Zoom, err = strconv.Atoi(value); err != nil || opts.Zoom < 0 || opts.Zoom > 22 {
+			respondError(w, http.StatusBadRequest, "zoom must be between 0 and 22")
+			return
+		}
+	}
+	opts.Breaks = h.mapBreakpoints[opts.Metric]
+	if value := query.Get("breaks"); value != "" {
+		if opts.CustomBreaks, err = groundwater.ParseBreaks(value); err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	layer, err := h.groundwaterService.Choropleth(r.Context(), opts)
+	if err != nil {
+		h.respondGroundwaterError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", layer.ETag)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Vary", "Accept-Encoding")
+	if etagMatches(r.Header.Get("If-None-Match"), layer.ETag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/geo+json")
+	body := layer.JSON
+	if acceptsGzip(r) {
+		w.Header().Set("Content-Encoding", "gzip")
+		body = layer.Gzip
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// ImportBoundaries serves POST /admin/groundwater/boundaries?level=: a GeoJSON
+// FeatureCollection of one level's boundaries. ?source= and ?name_property=,
+// ?state_property=, ?district_property= and ?code_property= describe the file.
+func (h *GroundwaterHandler) ImportBoundaries(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	claims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	level, err := optionalLevel(r)
+	if err != nil || level == "" {
+		respondError(w, http.StatusBadRequest, "level must be state, district or block")
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBoundaryUploadBytes))
+	if err != nil {
+		respondError(w, http.StatusRequestEntityTooLarge, "Boundary file is too large")
+		return
+	}
+
+	report, err := h.groundwaterService.ImportBoundaries(r.Context(), data, groundwater.BoundaryImportOptions{
+		Level:            level,
+		Source:           query.Get("source"),
+		NameProperty:     query.Get("name_property"),
+		StateProperty:    query.Get("state_property"),
+		DistrictProperty: query.Get("district_property"),
+		CodeProperty:     query.Get("code_property"),
+	}, claims.UserID, clientInfo(r))
+	if err != nil {
+		h.respondGroundwaterError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, report)
+}
+
+// boundary writes the unit's boundary as a GeoJSON Feature, simplified for ?zoom= when
+// given.
+func (h *GroundwaterHandler) boundary(w http.ResponseWriter, r *http.Request, unitID uuid.UUID) {
+	zoom := 0
+	if value := r.URL.Query().Get("zoom"); value != "" {
+		var err error
+		if zoom, err = strconv.Atoi(value); err != nil || zoom < 0 || zoom > 22 {
+			respondError(w, http.StatusBadRequest, "zoom must be between 0 and 22")
+			return
+		}
+	}
+
+	unit, err := h.groundwaterService.Unit(r.Context(), unitID)
+	if err != nil {
+		h.respondGroundwaterError(w, err)
+		return
+	}
+	geometry, err := h.groundwaterService.Boundary(r.Context(), unitID, zoom)
+	if err != nil {
+		h.respondGroundwaterError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"type":     "Feature",
+		"id":       unit.ID,
+		"geometry": geometry,
+		"properties": map[string]interface{}{
+			"name":  unit.Name,
+			"level": unit.Level,
+			"path":  unit.Path,
+			"code":  unit.Code,
+		},
+	})
+}
+
+// unitWaterLevels writes the combined series of every well in the unit, or its analysis.
+func (h *GroundwaterHandler) unitWaterLevels(w http.ResponseWriter, r *http.Request, unitID uuid.UUID, analyse bool) {
+	years, err := changeYears(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	series, err := h.groundwaterService.UnitWaterLevels(r.Context(), unitID, years)
+	if err != nil {
+		h.respondGroundwaterError(w, err)
+		return
+	}
+	h.respondWaterLevels(w, r, series, years, analyse)
+}
+
+// rainfall writes the unit's rainfall with its departure from normal and the months of
+// ?year=, or with correlate set how ?rainfall=annual|monsoon relates to its recharge and
+// water levels.
+func (h *GroundwaterHandler) rainfall(w http.ResponseWriter, r *http.Request, unitID uuid.UUID, correlate bool) {
+	if correlate {
+		correlation, err := h.groundwaterService.RainfallCorrelation(r.Context(), unitID,
+			strings.ToLower(r.URL.Query().Get("rainfall")))
+		if err != nil {
+			h.respondGroundwaterError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, correlation)
+		return
+	}
+
+	year, err := optionalYear(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	series, err := h.groundwaterService.UnitRainfall(r.Context(), unitID, year)
+	if err != nil {
+		h.respondGroundwaterError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, series)
+}
+
+// respondWaterLevels writes a water level series, or when analyse is set its trend tests
+// and forecasts over the last years, ?horizon= seasons ahead at ?confidence=.
+func (h *GroundwaterHandler) respondWaterLevels(w http.ResponseWriter, r *http.Request, series *models.WaterLevelSeries, years int, analyse bool) {
+	if !analyse {
+		respondJSON(w, http.StatusOK, series)
+		return
+	}
+	opts, err := analysisOptions(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	opts.Years = years
+	analysis, err := groundwater.AnalyseWaterLevels(series, opts)
+	if err != nil {
+		h.respondGroundwaterError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, analysis)
+}
+
+// charts writes every chart of the unit, or only the named one under "data". Each chart
+// has the shape of the web app component of the same purpose.
+func (h *GroundwaterHandler) charts(w http.ResponseWriter, r *http.Request, unitID uuid.UUID, chart string) {
+	year, err := optionalYear(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	charts, err := h.groundwaterService.Charts(r.Context(), unitID, groundwater.ChartOptions{
+		Year:       year,
+		VolumeUnit: strings.ToLower(r.URL.Query().Get("volume_unit")),
+	})
+	if err != nil {
+		h.respondGroundwaterError(w, err)
+		return
+	}
+	if chart == "" {
+		respondJSON(w, http.StatusOK, charts)
+		return
+	}
+
+	var data interface{}
+	switch chart {
+	case "trend":
+		data = charts.Trend
+	case "recharge":
+		data = charts.Recharge
+	case "sectors":
+		data = charts.Sectors
+	case "risk":
+		data = charts.Risk
+	case "kpis":
+		data = charts.KPIs
+	default:
+		respondError(w, http.StatusNotFound, "Unknown chart "+chart)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"unit":            charts.Unit,
+		"year":            charts.Year,
+		"category":        charts.Category,
+		"volume_unit":     charts.VolumeUnit,
+		"dataset_version": charts.DatasetVersion,
+		"data":            data,
+	})
+}
+
+func (h *GroundwaterHandler) respondGroundwaterError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, groundwater.ErrUnitNotFound), errors.Is(err, groundwater.ErrNoAssessments),
+		errors.Is(err, groundwater.ErrYearNotAssessed), errors.Is(err, groundwater.ErrNoBoundary),
+		errors.Is(err, groundwater.ErrWellNotFound), errors.Is(err, groundwater.ErrNoWellReadings),
+		errors.Is(err, groundwater.ErrNoRainfall):
+		respondError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, groundwater.ErrTooManyUnits), errors.Is(err, groundwater.ErrUnknownVolumeUnit),
+		errors.Is(err, groundwater.ErrInvalidFeatureCollection), errors.Is(err, groundwater.ErrInvalidLevel),
+		errors.Is(err, groundwater.ErrUnknownMetric), errors.Is(err, groundwater.ErrInvalidBreaks),
+		errors.Is(err, groundwater.ErrInvalidRadius), errors.Is(err, groundwater.ErrInvalidHorizon),
+		errors.Is(err, analytics.ErrInvalidConfidence), errors.Is(err, groundwater.ErrUnknownRainfallPeriod):
+		respondError(w, http.StatusBadRequest, err.Error())
+	default:
+		h.logger.WithError(err).Error("Groundwater query failed")
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
+
+// etagMatches compares weakly, as If-None-Match does.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, coding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(coding), ";")
+		if strings.EqualFold(strings.TrimSpace(name), "gzip") && strings.ReplaceAll(params, " ", "") != "q=0" {
+			return true
+		}
+	}
+	return false
+}
+
+func optionalYear(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("year")
+	if value == "" {
+		return 0, nil
+	}
+	year, err := strconv.Atoi(value)
+	if err != nil || year < 1900 || year > 2100 {
+		return 0, errors.New("invalid year")
+	}
+	return year, nil
+}
+
+var errLocation = errors.New("lat and lon must be a latitude and longitude in degrees")
+
+// optionalLocation reads ?lat=&lon=, or nil without either.
+func optionalLocation(r *http.Request) (*geo.Point, error) {
+	query := r.URL.Query()
+	if query.Get("lat") == "" && query.Get("lon") == "" {
+		return nil, nil
+	}
+	lat, latErr := strconv.ParseFloat(query.Get("lat"), 64)
+	lon, lonErr := strconv.ParseFloat(query.Get("lon"), 64)
+	if latErr != nil || lonErr != nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return nil, errLocation
+	}
+	return &geo.Point{Lon: lon, Lat: lat}, nil
+}
+
+func wellRadius(r *http.Request) (float64, error) {
+	value := r.URL.Query().Get("radius_km")
+	if value == "" {
+		return groundwater.DefaultWellRadiusKm, nil
+	}
+	radius, err := strconv.ParseFloat(value, 64)
+	if err != nil || radius <= 0 || radius > groundwater.MaxWellRadiusKm {
+		return 0, groundwater.ErrInvalidRadius
+	}
+	return radius, nil
+}
+
+func changeYears(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("years")
+	if value == "" {
+		return groundwater.DefaultChangeYears, nil
+	}
+	years, err := strconv.Atoi(value)
+	if err != nil || years < 1 || years > maxChangeYears {
+		return 0, fmt.Errorf("years must be between 1 and %d", maxChangeYears)
+	}
+	return years, nil
+}
+
+func analysisOptions(r *http.Request) (groundwater.AnalysisOptions, error) {
+	var opts groundwater.AnalysisOptions
+	query := r.URL.Query()
+	if value := query.Get("horizon"); value != "" {
+		horizon, err := strconv.Atoi(value)
+		if err != nil || horizon < 1 || horizon > groundwater.MaxForecastHorizon {
+			return opts, groundwater.ErrInvalidHorizon
+		}
+		opts.Horizon = horizon
+	}
+	if value := query.Get("confidence"); value != "" {
+		confidence, err := strconv.ParseFloat(value, 64)
+		if err != nil || analytics.CheckConfidence(confidence) != nil {
+			return opts, analytics.ErrInvalidConfidence
+		}
+		opts.Confidence = confidence
+	}
+	return opts, nil
+}
+
+func optionalLevel(r *http.Request) (models.UnitLevel, error) {
+	level := models.UnitLevel(strings.ToLower(r.URL.Query().Get("level")))
+	switch level {
+	case "", models.LevelState, models.LevelDistrict, models.LevelBlock:
+		return level, nil
+	}
+	return "", errors.New("level must be state, district or block")
+}
+
+// assessmentFieldNames are the JSON names of models.Assessment, which ?fields= picks from.
+var assessmentFieldNames = func() map[string]bool {
+	names := map[string]bool{}
+	t := reflect.TypeOf(models.Assessment{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		names[name] = true
+	}
+	return names
+}()
+
+// assessmentFields is the ?fields= selection; nil keeps every field.
+type assessmentFields map[string]bool
+
+func parseAssessmentFields(r *http.Request) (assessmentFields, error) {
+	value := r.URL.Query().Get("fields")
+	if value == "" {
+		return nil, nil
+	}
+
+	// The year always stays so series remain readable
+	fields := assessmentFields{"year": true}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if !assessmentFieldNames[name] {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+		fields[name] = true
+	}
+	return fields, nil
+}
+
+func (f assessmentFields) project(a models.Assessment) interface{} {
+	if f == nil {
+		return a
+	}
+
+	var all map[string]interface{}
+	data, _ := json.Marshal(a)
+	json.Unmarshal(data, &all)
+	for name := range all {
+		if !f[name] {
+			delete(all, name)
+		}
+	}
+	return all
+}
+
+func (f assessmentFields) projectSeries(s models.UnitSeries) map[string]interface{} {
+	series := make([]interface{}, 0, len(s.Series))
+	for _, a := range s.Series {
+		series = append(series, f.project(a))
+	}
+	return map[string]interface{}{"unit": s.Unit, "series": series}
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/auth"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+type PhoneHandler struct {
+	authService *auth.Service
+	logger      *logrus.Logger
+}
+
+func NewPhoneHandler(authService *auth.Service, logger *logrus.Logger) *PhoneHandler {
+	return &PhoneHandler{
+		authService: authService,
+		logger:      logger,
+	}
+}
+
+// SendVerification serves POST /users/phone/send, texting a code to the given number.
+func (h *PhoneHandler) SendVerification(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	claims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.PhoneRequest
+	if err := decodeAndValidate(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.authService.SendPhoneVerification(r.Context(), claims.UserID, req.Phone); err != nil {
+		respondAuthError(w, h.logger, err)
+		return
+	}
+
+	respondJSON(w, http.StatusAccepted, map[string]string{
+		"message": "Verification code sent",
+	})
+}
+
+// Verify serves POST /users/phone/verify, confirming the number the latest code was sent to.
+func (h *PhoneHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	claims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.PhoneVerifyRequest
+	if err := decodeAndValidate(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	phone, err := h.authService.VerifyPhone(r.Context(), claims.UserID, req.Code)
+	if err != nil {
+		respondAuthError(w, h.logger, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"phone":          phone,
+		"phone_verified": true,
+	})
+}
+
+// RequestLogin serves POST /auth/phone/request, texting a sign-in code to a verified number.
+func (h *PhoneHandler) RequestLogin(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req models.PhoneRequest
+	if err := decodeAndValidate(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Same answer whether or not the number is registered; only malformed numbers are rejected
+	if err := h.authService.RequestPhoneLogin(r.Context(), req.Phone); err == auth.ErrInvalidPhone {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		h.logger.WithError(err).Error("Phone login request failed")
+	}
+
+	respondJSON(w, http.StatusAccepted, map[string]string{
+		"message": "If the number is registered, a sign-in code has been sent",
+	})
+}
+
+// Login serves POST /auth/phone/login.
+func (h *PhoneHandler) Login(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req models.PhoneLoginRequest
+	if err := decodeAndValidate(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp, err := h.authService.LoginWithPhone(r.Context(), req.Phone, req.Code, clientInfo(r))
+	if err != nil {
+		respondAuthError(w, h.logger, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/auth"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+type ProfileHandler struct {
+	authService *auth.Service
+	logger      *logrus.Logger
+}
+
+func NewProfileHandler(authService *auth.Service, logger *logrus.Logger) *ProfileHandler {
+	return &ProfileHandler{
+		authService: authService,
+		logger:      logger,
+	}
+}
+
+// ChangeUsername serves PUT /users/username. The response carries an access token with
+// the new username; other devices pick it up when they next refresh.
+func (h *ProfileHandler) ChangeUsername(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPut) {
+		return
+	}
+
+	claims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.ChangeUsernameRequest
+	if err := decodeAndValidate(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response, err := h.authService.ChangeUsername(r.Context(), claims.UserID, claims.SessionID, req.Username, clientInfo(r))
+	if err != nil {
+		respondAuthError(w, h.logger, err)
+		return
+	}
+	// The presented token still carries the old username; the response has its replacement
+	if err := h.authService.RevokeAccessToken(r.Context(), claims); err != nil {
+		h.logger.WithError(err).Warn("Failed to revoke access token")
+	}
+
+	respondJSON(w, http.StatusOK, response)
+}
+
+// RequestEmailChange serves POST /users/email, emailing confirmation links to the
+// current and the new address.
+func (h *ProfileHandler) RequestEmailChange(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	claims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.ChangeEmailRequest
+	if err := decodeAndValidate(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.authService.RequestEmailChange(r.Context(), claims.UserID, req.NewEmail, auth.Reauthentication{
+		SessionID: claims.SessionID,
+		Password:  req.Password,
+		Code:      req.ReauthCode,
+	}, clientInfo(r)); err != nil {
+		respondAuthError(w, h.logger, err)
+		return
+	}
+
+	respondJSON(w, http.StatusAccepted, map[string]string{
+		"message": "Confirm the change from both your current and your new email address",
+	})
+}
+
+// RequestReauthCode serves POST /users/reauth-code, emailing the code that accounts
+// without a password give in place of one when changing their email or deleting.
+func (h *ProfileHandler) RequestReauthCode(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	claims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.authService.RequestReauthCode(r.Context(), claims.UserID); err != nil {
+		respondAuthError(w, h.logger, err)
+		return
+	}
+
+	respondJSON(w, http.StatusAccepted, map[string]string{
+		"message": "A confirmation code has been sent to your email address",
+	})
+}
+
+// ConfirmEmailChange serves POST /auth/email-change/confirm with a token from either email.
+func (h *ProfileHandler) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req models.ConfirmEmailChangeRequest
+	if err := decodeAndValidate(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	status, err := h.authService.ConfirmEmailChange(r.Context(), req.Token, clientInfo(r))
+	if err != nil {
+		respondAuthError(w, h.logger, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, status)
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/auth"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/middleware"
+)
+
+var validate = validator.New()
+
+func respondJSON(w http.ResponseWriter, status int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(payload)
+}
+
+// respondError writes the same {"error": "..."} envelope the recovery middleware uses.
+func respondError(w http.ResponseWriter, status int, message string) {
+	respondJSON(w, status, map[string]string{
+		"error": message,
+	})
+}
+
+// decodeAndValidate reads a JSON body into dst and runs its validate tags.
+func decodeAndValidate(r *http.Request, dst interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(dst); err != nil {
+		return errors.New("invalid request body")
+	}
+	return validate.Struct(dst)
+}
+
+func requireMethod(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	return false
+}
+
+// currentUser returns the authenticated caller, writing a 401 when there is none.
+func currentUser(w http.ResponseWriter, r *http.Request) (*auth.JWTClaims, bool) {
+	claims, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondError(w, http.StatusUnauthorized, "Authentication required")
+	}
+	return claims, ok
+}
+
+// pathSegments splits the request path after prefix, e.g. "/users/{id}/status" -> ["{id}", "status"].
+func pathSegments(r *http.Request, prefix string) []string {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	if rest == "" {
+		return nil
+	}
+	return strings.Split(rest, "/")
+}
+
+func parseUUIDSegment(w http.ResponseWriter, value string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(value)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid ID")
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func clientInfo(r *http.Request) auth.ClientInfo {
+	return auth.ClientInfo{
+		IPAddress: middleware.GetClientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+}
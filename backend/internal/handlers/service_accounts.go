@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/auth"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+const serviceAccountsPath = "/api/v1/admin/service-accounts"
+
+type ServiceAccountHandler struct {
+	authService *auth.Service
+	logger      *logrus.Logger
+}
+
+func NewServiceAccountHandler(authService *auth.Service, logger *logrus.Logger) *ServiceAccountHandler {
+	return &ServiceAccountHandler{
+		authService: authService,
+		logger:      logger,
+	}
+}
+
+// ServiceAccounts serves GET /admin/service-accounts (list) and POST (create).
+func (h *ServiceAccountHandler) ServiceAccounts(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet, http.MethodPost) {
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		accounts, err := h.authService.ListServiceAccounts(r.Context())
+		if err != nil {
+			respondAuthError(w, h.logger, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, map[string]interface{}{"service_accounts": accounts})
+		return
+	}
+
+	var req models.CreateServiceAccountRequest
+	if err := decodeAndValidate(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	admin, _ := currentUser(w, r)
+	account, err := h.authService.CreateServiceAccount(r.Context(), admin, req, clientInfo(r))
+	if err == auth.ErrUnknownRole {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		respondAuthError(w, h.logger, err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, account)
+}
+
+// ServiceAccount serves DELETE /admin/service-accounts/{id} (disable) and the
+// /{id}/keys, /{id}/keys/{keyID} and /{id}/client-secret sub-resources.
+func (h *ServiceAccountHandler) ServiceAccount(w http.ResponseWriter, r *http.Request) {
+	segments := pathSegments(r, serviceAccountsPath)
+	if len(segments) == 0 || len(segments) > 3 {
+		respondError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	accountID, ok := parseUUIDSegment(w, segments[0])
+	if !ok {
+		return
+	}
+	admin, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	switch {
+	case len(segments) == 1:
+		if !requireMethod(w, r, http.MethodDelete) {
+			return
+		}
+		if err := h.authService.DisableServiceAccount(r.Context(), admin, accountID, clientInfo(r)); err != nil {
+			respondAuthError(w, h.logger, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case len(segments) == 2 && segments[1] == "keys":
+		if !requireMethod(w, r, http.MethodGet, http.MethodPost) {
+			return
+		}
+		if r.Method == http.MethodGet {
+			keys, err := h.authService.ListAPIKeys(r.Context(), accountID)
+			if err != nil {
+				respondAuthError(w, h.logger, err)
+				return
+			}
+			respondJSON(w, http.StatusOK, map[string]interface{}{"keys": keys})
+			return
+		}
+
+		var req models.CreateAPIKeyRequest
+		if err := decodeAndValidate(r, &req); err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		key, err := h.authService.CreateAPIKey(r.Context(), admin, accountID, req, clientInfo(r))
+		if errors.Is(err, auth.ErrUnknownPermission) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		} else if err != nil {
+			respondAuthError(w, h.logger, err)
+			return
+		}
+		respondJSON(w, http.StatusCreated, key)
+
+	case len(segments) == 3 && segments[1] == "keys":
+		if !requireMethod(w, r, http.MethodDelete) {
+			return
+		}
+		keyID, ok := parseUUIDSegment(w, segments[2])
+		if !ok {
+			return
+		}
+		if err := h.authService.RevokeAPIKey(r.Context(), admin, accountID, keyID, clientInfo(r)); err != nil {
+			respondAuthError(w, h.logger, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case len(segments) == 2 && segments[1] == "client-secret":
+		if !requireMethod(w, r, http.MethodPost) {
+			return
+		}
+		secret, err := h.authService.RotateClientSecret(r.Context(), admin, accountID, clientInfo(r))
+		if err != nil {
+			respondAuthError(w, h.logger, err)
+			return
+		}
+		respondJSON(w, http.StatusCreated, secret)
+
+	default:
+		respondError(w, http.StatusNotFound, "Not found")
+	}
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/auth"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+const sessionsPath = "/api/v1/users/sessions"
+
+type SessionHandler struct {
+	authService *auth.Service
+	logger      *logrus.Logger
+}
+
+func NewSessionHandler(authService *auth.Service, logger *logrus.Logger) *SessionHandler {
+	return &SessionHandler{
+		authService: authService,
+		logger:      logger,
+	}
+}
+
+// Sessions serves GET /users/sessions (list) and DELETE /users/sessions (sign out all other devices).
+func (h *SessionHandler) Sessions(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet, http.MethodDelete) {
+		return
+	}
+
+	claims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		sessions, err := h.authService.ListSessions(r.Context(), claims.UserID, claims.SessionID)
+		if err != nil {
+			h.logger.WithError(err).Error("Failed to list sessions")
+			respondError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		respondJSON(w, http.StatusOK, map[string]interface{}{
+			"sessions": sessions,
+		})
+		return
+	}
+
+	revoked, err := h.authService.RevokeOtherSessions(r.Context(), claims.UserID, claims.SessionID)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to revoke sessions")
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, models.RevokeSessionsResponse{Revoked: revoked})
+}
+
+// RevokeSession serves DELETE /users/sessions/{id}.
+func (h *SessionHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodDelete) {
+		return
+	}
+
+	claims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	segments := pathSegments(r, sessionsPath)
+	if len(segments) != 1 {
+		respondError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	sessionID, ok := parseUUIDSegment(w, segments[0])
+	if !ok {
+		return
+	}
+
+	if err := h.authService.RevokeSession(r.Context(), claims.UserID, sessionID); err != nil {
+		if err == auth.ErrSessionNotFound {
+			respondError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		h.logger.WithError(err).Error("Failed to revoke session")
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
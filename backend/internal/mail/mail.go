@@ -0,0 +1,67 @@
+package mail
+
+import (
+	"context"
+
+	gomail "github.com/go-mail/mail/v2"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers transactional email such as reset links and security notices.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewSender returns an SMTP sender when SMTP credentials are configured and a
+// logging stand-in otherwise, so development never needs a mail server. Config.Validate
+// requires the credentials outside development.
+func NewSender(cfg config.EmailConfig, logger *logrus.Logger) Sender {
+	if cfg.Username == "" || cfg.FromEmail == "" {
+		return &LogSender{logger: logger}
+	}
+	return NewSMTPSender(cfg)
+}
+
+type SMTPSender struct {
+	dialer *gomail.Dialer
+	from   string
+	name   string
+}
+
+func NewSMTPSender(cfg config.EmailConfig) *SMTPSender {
+	return &SMTPSender{
+		dialer: gomail.NewDialer(cfg.SMTPHost, cfg.SMTPPort, cfg.Username, cfg.Password),
+		from:   cfg.FromEmail,
+		name:   cfg.FromName,
+	}
+}
+
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	m := gomail.NewMessage()
+	m.SetAddressHeader("From", s.from, s.name)
+	m.SetHeader("To", msg.To)
+	m.SetHeader("Subject", msg.Subject)
+	m.SetBody("text/plain", msg.Body)
+	return s.dialer.DialAndSend(m)
+}
+
+// LogSender notes messages in the log instead of sending them. Bodies are left out, as
+// they carry reset links and one-time codes.
+type LogSender struct {
+	logger *logrus.Logger
+}
+
+func (s *LogSender) Send(ctx context.Context, msg Message) error {
+	s.logger.WithFields(logrus.Fields{
+		"to":      msg.To,
+		"subject": msg.Subject,
+	}).Info("Email not sent: SMTP is not configured")
+	return nil
+}
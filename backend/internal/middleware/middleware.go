@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -16,6 +17,7 @@ import (
 	"github.com/gorilla/sessions"
 	"github.com/hxrshxz/ground-sense-bot/backend/internal/auth"
 	"github.com/hxrshxz/ground-sense-bot/backend/internal/config"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/database"
 	"github.com/hxrshxz/ground-sense-bot/backend/internal/models"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -80,30 +82,77 @@ func Authenticate(authService *auth.Service) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
-				http.Error(w, "Authorization header required", http.StatusUnauthorized)
+			apiKey := apiKeyFromRequest(r)
+			if authHeader == "" && apiKey == "" {
+				respondError(w, http.StatusUnauthorized, "Authorization header required")
 				return
 			}
 
-			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-			if tokenString == authHeader {
-				http.Error(w, "Bearer token required", http.StatusUnauthorized)
-				return
+			var claims *auth.JWTClaims
+			var err error
+			if apiKey != "" {
+				// Service accounts may present an API key instead of a token
+				claims, err = authService.AuthenticateAPIKey(r.Context(), apiKey)
+			} else {
+				tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+				if tokenString == authHeader {
+					respondError(w, http.StatusUnauthorized, "Bearer token required")
+					return
+				}
+				claims, err = authService.ValidateToken(r.Context(), tokenString)
 			}
-
-			claims, err := authService.ValidateToken(tokenString)
 			if err != nil {
 				status := http.StatusUnauthorized
 				if err == auth.ErrTokenExpired {
 					status = http.StatusUnauthorized
 				}
-				http.Error(w, err.Error(), status)
+				respondError(w, status, err.Error())
 				return
 			}
 
 			// Add user info to context
 			ctx := context.WithValue(r.Context(), UserContextKey, claims)
-			r = r.WithContext(ctx)
+			if !claims.Impersonated() {
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			// Everything done under impersonation is attributed to the administrator too
+			ctx = database.WithActor(ctx, claims.Actor.UserID.String())
+			rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			next.ServeHTTP(rw, r.WithContext(ctx))
+
+			client := auth.ClientInfo{IPAddress: GetClientIP(r), UserAgent: r.UserAgent()}
+			if err := authService.RecordImpersonatedRequest(context.Background(), claims, r.Method, r.URL.Path,
+				rw.statusCode, client); err != nil {
+				if logger, ok := GetLoggerFromContext(r.Context()); ok {
+					logger.WithError(err).Error("Failed to audit impersonated request")
+				}
+			}
+		})
+	}
+}
+
+// apiKeyFromRequest reads a key from "X-API-Key: <key>" or "Authorization: ApiKey <key>".
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if key := strings.TrimPrefix(r.Header.Get("Authorization"), "ApiKey "); key != r.Header.Get("Authorization") {
+		return key
+	}
+	return ""
+}
+
+// DenyImpersonation rejects impersonation tokens on routes that change how the user
+// signs in or whether the account exists. It must run after Authenticate.
+func DenyImpersonation() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if claims, ok := GetUserFromContext(r.Context()); ok && claims.Impersonated() {
+				respondError(w, http.StatusForbidden, auth.ErrImpersonationForbidden.Error())
+				return
+			}
 
 			next.ServeHTTP(w, r)
 		})
@@ -118,7 +167,7 @@ func OptionalAuth(authService *auth.Service) Middleware {
 			if authHeader != "" {
 				tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 				if tokenString != authHeader {
-					claims, err := authService.ValidateToken(tokenString)
+					claims, err := authService.ValidateToken(r.Context(), tokenString)
 					if err == nil {
 						// Add user info to context if token is valid
 						ctx := context.WithValue(r.Context(), UserContextKey, claims)
@@ -132,6 +181,57 @@ func OptionalAuth(authService *auth.Service) Middleware {
 	}
 }
 
+// RequirePermission rejects requests whose user lacks the permission. It must run after Authenticate.
+func RequirePermission(authService *auth.Service, permission string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := GetUserFromContext(r.Context())
+			if !ok {
+				respondError(w, http.StatusUnauthorized, "Authentication required")
+				return
+			}
+
+			allowed, err := authService.Authorize(r.Context(), claims, permission)
+			if err != nil {
+				respondError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			if !allowed {
+				respondError(w, http.StatusForbidden, "Missing permission "+permission)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GuestAccess serves requests without credentials when the guest role has the
+// permission. Requests with credentials are authenticated and checked as usual.
+func GuestAccess(authService *auth.Service, permission string) Middleware {
+	return func(next http.Handler) http.Handler {
+		authenticated := Authenticate(authService)(RequirePermission(authService, permission)(next))
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "" || apiKeyFromRequest(r) != "" {
+				authenticated.ServeHTTP(w, r)
+				return
+			}
+
+			roles, err := authService.RolePermissions(r.Context())
+			if err != nil {
+				respondError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			if !auth.HasPermission(roles[string(models.RoleGuest)], permission) {
+				respondError(w, http.StatusUnauthorized, "Authorization header required")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // Rate limiting middleware
 func RateLimit(lmt *limiter.Limiter) Middleware {
 	return func(next http.Handler) http.Handler {
@@ -158,7 +258,7 @@ func RequestLogger(logger *logrus.Logger) Middleware {
 				"request_id": requestID,
 				"method":     r.Method,
 				"path":       r.URL.Path,
-				"remote_ip":  getClientIP(r),
+				"remote_ip":  GetClientIP(r),
 				"user_agent": r.UserAgent(),
 			})
 			ctx = context.WithValue(ctx, LoggerContextKey, entry)
@@ -187,11 +287,7 @@ func Recovery(logger *logrus.Logger) Middleware {
 						"stack": string(stack()),
 					}).Error("Panic recovered")
 
-					w.Header().Set("Content-Type", "application/json")
-					w.WriteHeader(http.StatusInternalServerError)
-					json.NewEncoder(w).Encode(map[string]string{
-						"error": "Internal server error",
-					})
+					respondError(w, http.StatusInternalServerError, "Internal server error")
 				}
 			}()
 
@@ -200,6 +296,15 @@ func Recovery(logger *logrus.Logger) Middleware {
 	}
 }
 
+// respondError writes the {"error": "..."} envelope every JSON response uses.
+func respondError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error": message,
+	})
+}
+
 // Content type middleware
 func ContentType(contentType string) Middleware {
 	return func(next http.Handler) http.Handler {
@@ -330,27 +435,82 @@ func GetRequestIDFromContext(ctx context.Context) (string, bool) {
 	return requestID, ok
 }
 
-func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header
-	xForwardedFor := r.Header.Get("X-Forwarded-For")
-	if xForwardedFor != "" {
-		// Take the first IP if there are multiple
-		ips := strings.Split(xForwardedFor, ",")
-		return strings.TrimSpace(ips[0])
+// trustedProxies are the networks whose forwarding headers GetClientIP believes.
+var trustedProxies []*net.IPNet
+
+// TrustProxies sets the proxies, as IPs or CIDR ranges, whose X-Forwarded-For and
+// X-Real-IP headers GetClientIP believes. With none, only the peer address is used.
+func TrustProxies(proxies []string) error {
+	networks := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return fmt.Errorf("trusted proxy %q is not an IP or CIDR range", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return fmt.Errorf("trusted proxy %q is not an IP or CIDR range", proxy)
+		}
+		networks = append(networks, network)
+	}
+	trustedProxies = networks
+	return nil
+}
+
+func isTrustedProxy(ip net.IP) bool {
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
 	}
+	return false
+}
 
-	// Check X-Real-IP header
-	xRealIP := r.Header.Get("X-Real-IP")
-	if xRealIP != "" {
-		return xRealIP
+// GetClientIP is the address of the client behind any trusted proxies. Forwarding
+// headers are only read when the peer is a trusted proxy, and X-Forwarded-For is walked
+// from the right, so the answer is the nearest hop no trusted proxy vouches for rather
+// than whatever the client claims.
+func GetClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	remote := net.ParseIP(host)
+	if remote == nil {
+		return host
+	}
+	if !isTrustedProxy(remote) {
+		return remote.String()
+	}
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		client := remote
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := net.ParseIP(strings.TrimSpace(hops[i]))
+			if hop == nil {
+				break
+			}
+			client = hop
+			if !isTrustedProxy(hop) {
+				break
+			}
+		}
+		return client.String()
 	}
 
-	// Fall back to RemoteAddr
-	ip := r.RemoteAddr
-	if strings.Contains(ip, ":") {
-		ip, _, _ = strings.Cut(ip, ":")
+	if realIP := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); realIP != nil {
+		return realIP.String()
 	}
-	return ip
+	return remote.String()
 }
 
 // responseWriter wraps http.ResponseWriter to capture status code and response size
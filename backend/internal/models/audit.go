@@ -0,0 +1,22 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AuditLog struct {
+	ID           uuid.UUID        `json:"id" db:"id"`
+	UserID       *uuid.UUID       `json:"user_id,omitempty" db:"user_id"`
+	ActorID      *uuid.UUID       `json:"actor_id,omitempty" db:"actor_id"`
+	Action       string           `json:"action" db:"action"`
+	ResourceType string           `json:"resource_type" db:"resource_type"`
+	ResourceID   *uuid.UUID       `json:"resource_id,omitempty" db:"resource_id"`
+	OldValues    *json.RawMessage `json:"old_values,omitempty" db:"old_values"`
+	NewValues    *json.RawMessage `json:"new_values,omitempty" db:"new_values"`
+	IPAddress    *string          `json:"ip_address,omitempty" db:"ip_address"`
+	UserAgent    *string          `json:"user_agent,omitempty" db:"user_agent"`
+	CreatedAt    time.Time        `json:"created_at" db:"created_at"`
+}
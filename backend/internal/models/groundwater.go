@@ -0,0 +1,458 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UnitLevel is where an assessment unit sits in the state > district > block hierarchy.
+// Blocks are called taluks, mandals or firkas in some states.
+type UnitLevel string
+
+const (
+	LevelState    UnitLevel = "state"
+	LevelDistrict UnitLevel = "district"
+	LevelBlock    UnitLevel = "block"
+)
+
+// GroundwaterCategory is the CGWB categorisation of an assessment unit.
+type GroundwaterCategory string
+
+const (
+	CategorySafe          GroundwaterCategory = "safe"
+	CategorySemiCritical  GroundwaterCategory = "semi_critical"
+	CategoryCritical      GroundwaterCategory = "critical"
+	CategoryOverExploited GroundwaterCategory = "over_exploited"
+	CategorySaline        GroundwaterCategory = "saline"
+)
+
+// AssessmentUnit is a state, district or block that groundwater resources are assessed for.
+type AssessmentUnit struct {
+	ID       uuid.UUID  `json:"id" db:"id"`
+	ParentID *uuid.UUID `json:"parent_id,omitempty" db:"parent_id"`
+	Level    UnitLevel  `json:"level" db:"level"`
+	Name     string     `json:"name" db:"name"`
+	// Path is the lower-cased "state/district/block" the unit is matched by
+	Path      string    `json:"path" db:"path"`
+	Code      *string   `json:"code,omitempty" db:"code"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// Assessment is one unit's groundwater balance for one assessment year. Volumes are in
+// hectare-metres (ham); StageOfExtraction is total extraction as a percentage of the
+// extractable resource.
+type Assessment struct {
+	UnitID               uuid.UUID           `json:"unit_id" db:"unit_id"`
+	Year                 int                 `json:"year" db:"year"`
+	DatasetID            uuid.UUID           `json:"dataset_id" db:"dataset_id"`
+	RechargeRainfall     *float64            `json:"recharge_rainfall,omitempty" db:"recharge_rainfall"`
+	RechargeOther        *float64            `json:"recharge_other,omitempty" db:"recharge_other"`
+	AnnualRecharge       float64             `json:"annual_recharge" db:"annual_recharge"`
+	NaturalDischarge     *float64            `json:"natural_discharge,omitempty" db:"natural_discharge"`
+	ExtractableResource  float64             `json:"extractable_resource" db:"extractable_resource"`
+	ExtractionIrrigation *float64            `json:"extraction_irrigation,omitempty" db:"extraction_irrigation"`
+	ExtractionIndustrial *float64            `json:"extraction_industrial,omitempty" db:"extraction_industrial"`
+	ExtractionDomestic   *float64            `json:"extraction_domestic,omitempty" db:"extraction_domestic"`
+	TotalExtraction      float64             `json:"total_extraction" db:"total_extraction"`
+	StageOfExtraction    float64             `json:"stage_of_extraction" db:"stage_of_extraction"`
+	Category             GroundwaterCategory `json:"category" db:"category"`
+	FutureAvailability   *float64            `json:"future_availability,omitempty" db:"future_availability"`
+	UpdatedAt            time.Time           `json:"updated_at" db:"updated_at"`
+}
+
+// GroundwaterDataset records one imported assessment file.
+type GroundwaterDataset struct {
+	ID           uuid.UUID `json:"id" db:"id"`
+	Version      int       `json:"version" db:"version"`
+	Source       string    `json:"source" db:"source"`
+	FileName     string    `json:"file_name" db:"file_name"`
+	Checksum     string    `json:"checksum" db:"checksum"`
+	RowsTotal    int       `json:"rows_total" db:"rows_total"`
+	RowsImported int       `json:"rows_imported" db:"rows_imported"`
+	RowsRejected int       `json:"rows_rejected" db:"rows_rejected"`
+	ImportedAt   time.Time `json:"imported_at" db:"imported_at"`
+}
+
+// UnitAssessment is a unit with its assessment for one year, if it has one.
+type UnitAssessment struct {
+	Unit       AssessmentUnit `json:"unit"`
+	Assessment *Assessment    `json:"assessment,omitempty"`
+}
+
+// UnitSeries is a unit with its assessments, oldest year first.
+type UnitSeries struct {
+	Unit   AssessmentUnit `json:"unit"`
+	Series []Assessment   `json:"series"`
+}
+
+// The chart types below match the props of the web app's chart components.
+
+// TrendPoint feeds ExtractionTrendLine. Net is recharge minus extraction.
+type TrendPoint struct {
+	Year       int      `json:"year"`
+	Extraction float64  `json:"extraction"`
+	Recharge   *float64 `json:"recharge,omitempty"`
+	Net        *float64 `json:"net,omitempty"`
+}
+
+// ChartSlice feeds RechargeCompositionDonut.
+type ChartSlice struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+	Color string  `json:"color,omitempty"`
+}
+
+// SectorUsage feeds SectorUsageStackedBar. Value is the sector's share of extraction in percent.
+type SectorUsage struct {
+	Sector string  `json:"sector"`
+	Value  float64 `json:"value"`
+}
+
+// RiskFactor feeds RiskRadar. Scores run from 0 (no risk) to 100.
+type RiskFactor struct {
+	Factor string  `json:"factor"`
+	Score  float64 `json:"score"`
+}
+
+// KPIItem feeds KPIStatGroup.
+type KPIItem struct {
+	Label     string    `json:"label"`
+	Value     string    `json:"value"`
+	Change    *float64  `json:"change,omitempty"`
+	Sparkline []float64 `json:"sparkline,omitempty"`
+	Color     string    `json:"color,omitempty"`
+}
+
+// UnitCharts is every chart for one unit and year. Volumes are in VolumeUnit.
+type UnitCharts struct {
+	Unit           AssessmentUnit      `json:"unit"`
+	Year           int                 `json:"year"`
+	Category       GroundwaterCategory `json:"category"`
+	VolumeUnit     string              `json:"volume_unit"`
+	DatasetVersion int                 `json:"dataset_version"`
+	Trend          []TrendPoint        `json:"trend"`
+	Recharge       []ChartSlice        `json:"recharge"`
+	Sectors        []SectorUsage       `json:"sectors"`
+	Risk           []RiskFactor        `json:"risk"`
+	KPIs           []KPIItem           `json:"kpis"`
+}
+
+// How a place candidate matched the text.
+const (
+	MatchExact  = "exact"
+	MatchAlias  = "alias"
+	MatchPrefix = "prefix"
+	MatchFuzzy  = "fuzzy"
+)
+
+// PlaceCandidate is an assessment unit that free text may refer to. Ambiguous is set
+// when another place of the same name is about as likely.
+type PlaceCandidate struct {
+	Unit        AssessmentUnit `json:"unit"`
+	State       string         `json:"state,omitempty"`
+	District    string         `json:"district,omitempty"`
+	MatchedText string         `json:"matched_text"`
+	MatchType   string         `json:"match_type"`
+	Confidence  float64        `json:"confidence"`
+	Ambiguous   bool           `json:"ambiguous"`
+}
+
+// PlaceResolution ranks the places a text may refer to. Ambiguous is set when the best
+// two candidates are about as likely.
+type PlaceResolution struct {
+	Query      string           `json:"query"`
+	Candidates []PlaceCandidate `json:"candidates"`
+	Ambiguous  bool             `json:"ambiguous"`
+}
+
+// Choropleth is a GeoJSON FeatureCollection of one level's units coloured by a metric.
+// The members besides type and features describe the classes for a legend.
+type Choropleth struct {
+	Type           string              `json:"type"`
+	Level          UnitLevel           `json:"level"`
+	Year           int                 `json:"year"`
+	Metric         string              `json:"metric"`
+	DatasetVersion int                 `json:"dataset_version"`
+	Breaks         []float64           `json:"breaks"`
+	Classes        []ChoroplethClass   `json:"classes"`
+	NoDataColor    string              `json:"no_data_color"`
+	Unmapped       int                 `json:"unmapped"`
+	Features       []ChoroplethFeature `json:"features"`
+}
+
+// ChoroplethClass is one legend entry: values above Min (if any) up to and including Max
+// (if any).
+type ChoroplethClass struct {
+	Class int      `json:"class"`
+	Min   *float64 `json:"min,omitempty"`
+	Max   *float64 `json:"max,omitempty"`
+	Color string   `json:"color"`
+	Units int      `json:"units"`
+}
+
+type ChoroplethFeature struct {
+	Type       string               `json:"type"`
+	ID         uuid.UUID            `json:"id"`
+	Geometry   json.RawMessage      `json:"geometry"`
+	Properties ChoroplethProperties `json:"properties"`
+}
+
+// ChoroplethProperties leave Value, Category and Class out for units without an
+// assessment that year.
+type ChoroplethProperties struct {
+	Name     string              `json:"name"`
+	Path     string              `json:"path"`
+	Code     *string             `json:"code,omitempty"`
+	Value    *float64            `json:"value,omitempty"`
+	Category GroundwaterCategory `json:"category,omitempty"`
+	Class    *int                `json:"class,omitempty"`
+	Color    string              `json:"color"`
+}
+
+// How watchlist alerts reach a user.
+const (
+	AlertDeliveryImmediate = "immediate"
+	AlertDeliveryWeekly    = "weekly"
+)
+
+// AlertPreferences say how a user hears about changes to their watchlist. Without a
+// StageThreshold the server default applies.
+type AlertPreferences struct {
+	Delivery       string     `json:"delivery" validate:"required,oneof=immediate weekly"`
+	EmailEnabled   bool       `json:"email_enabled"`
+	StageThreshold *float64   `json:"stage_threshold,omitempty" validate:"omitempty,gt=0,lte=100"`
+	LastDigestAt   *time.Time `json:"last_digest_at,omitempty"`
+}
+
+// WatchedUnit is a unit on a user's watchlist. Watching a state or district also
+// watches every unit inside it.
+type WatchedUnit struct {
+	Unit      AssessmentUnit `json:"unit"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// GroundwaterAlert is a change in a watched unit from one assessment year to the next.
+type GroundwaterAlert struct {
+	ID                uuid.UUID           `json:"id"`
+	Unit              AssessmentUnit      `json:"unit"`
+	State             string              `json:"state"`
+	Year              int                 `json:"year"`
+	PreviousYear      int                 `json:"previous_year"`
+	Category          GroundwaterCategory `json:"category"`
+	PreviousCategory  GroundwaterCategory `json:"previous_category"`
+	StageOfExtraction float64             `json:"stage_of_extraction"`
+	PreviousStage     float64             `json:"previous_stage"`
+	CreatedAt         time.Time           `json:"created_at"`
+	DeliveredAt       *time.Time          `json:"delivered_at,omitempty"`
+}
+
+// Season is when in the year an observation well was measured. The CGWB network is
+// measured in January, before the monsoon (May), during it (August) and after it
+// (November).
+type Season string
+
+const (
+	SeasonWinter      Season = "winter"
+	SeasonPreMonsoon  Season = "pre_monsoon"
+	SeasonMonsoon     Season = "monsoon"
+	SeasonPostMonsoon Season = "post_monsoon"
+)
+
+// ObservationWell is a monitoring well. UnitID is the most local assessment unit it
+// falls in, usually a block. Depth is how deep the well is, in metres.
+type ObservationWell struct {
+	ID         uuid.UUID  `json:"id"`
+	Code       string     `json:"code"`
+	Name       string     `json:"name"`
+	UnitID     *uuid.UUID `json:"unit_id,omitempty"`
+	UnitName   string     `json:"unit_name,omitempty"`
+	Latitude   float64    `json:"latitude"`
+	Longitude  float64    `json:"longitude"`
+	WellType   string     `json:"well_type,omitempty"`
+	Aquifer    string     `json:"aquifer,omitempty"`
+	Depth      *float64   `json:"depth,omitempty"`
+	Readings   int        `json:"readings"`
+	FirstYear  *int       `json:"first_year,omitempty"`
+	LastYear   *int       `json:"last_year,omitempty"`
+	DistanceKm *float64   `json:"distance_km,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// WellReading is one measurement of a well's depth to water, in metres below ground
+// level. Negative depths are flowing wells.
+type WellReading struct {
+	MeasuredOn    time.Time `json:"measured_on"`
+	Season        Season    `json:"season"`
+	DepthToWater  float64   `json:"depth_to_water"`
+	Outlier       bool      `json:"outlier"`
+	OutlierReason string    `json:"outlier_reason,omitempty"`
+}
+
+// WaterLevelPoint is the depth to water in one season of one year, split into the
+// year's level (Trend), the usual difference of the season from it (Seasonal) and what's
+// left (Residual). Wells counts the wells measured that season.
+type WaterLevelPoint struct {
+	Year         int     `json:"year"`
+	Season       Season  `json:"season"`
+	DepthToWater float64 `json:"depth_to_water"`
+	Trend        float64 `json:"trend"`
+	Seasonal     float64 `json:"seasonal"`
+	Residual     float64 `json:"residual"`
+	Wells        int     `json:"wells"`
+}
+
+// WaterLevelChange is how far the yearly level moved over a span of years. A positive
+// Change means the water is deeper: the water table fell.
+type WaterLevelChange struct {
+	FromYear  int     `json:"from_year"`
+	ToYear    int     `json:"to_year"`
+	From      float64 `json:"from"`
+	To        float64 `json:"to"`
+	Change    float64 `json:"change"`
+	PerYear   float64 `json:"per_year"`
+	Direction string  `json:"direction"`
+}
+
+// WaterLevelSeries is the depth-to-water series of one well, or of every well in a unit
+// or near a point, oldest first. Depths are in metres below ground level.
+type WaterLevelSeries struct {
+	Well     *ObservationWell   `json:"well,omitempty"`
+	Unit     *AssessmentUnit    `json:"unit,omitempty"`
+	Location *GeoPoint          `json:"location,omitempty"`
+	RadiusKm float64            `json:"radius_km,omitempty"`
+	Wells    int                `json:"wells"`
+	Outliers int                `json:"outliers"`
+	Points   []WaterLevelPoint  `json:"points"`
+	Seasonal map[Season]float64 `json:"seasonal"`
+	Change   *WaterLevelChange  `json:"change,omitempty"`
+}
+
+// TrendTest is the Mann-Kendall test and Sen's slope over one season's depths, one per
+// year, or over the yearly levels when Season is empty. Slopes are metres a year; a
+// positive slope means the water is getting deeper. Direction is stable unless the
+// trend is significant.
+type TrendTest struct {
+	Season      Season  `json:"season,omitempty"`
+	FromYear    int     `json:"from_year"`
+	ToYear      int     `json:"to_year"`
+	Years       int     `json:"years"`
+	S           float64 `json:"s"`
+	Z           float64 `json:"z"`
+	PValue      float64 `json:"p_value"`
+	Tau         float64 `json:"tau"`
+	Significant bool    `json:"significant"`
+	Direction   string  `json:"direction"`
+	Slope       float64 `json:"slope"`
+	SlopeLower  float64 `json:"slope_lower"`
+	SlopeUpper  float64 `json:"slope_upper"`
+}
+
+// WaterLevelForecast is the predicted depth to water in a coming season, with its
+// prediction interval.
+type WaterLevelForecast struct {
+	Year         int     `json:"year"`
+	Season       Season  `json:"season"`
+	DepthToWater float64 `json:"depth_to_water"`
+	Lower        float64 `json:"lower"`
+	Upper        float64 `json:"upper"`
+}
+
+// WaterLevelAnalysis is the trend tests and forecasts of a water level series. A
+// forecast is missing when the series is too short or gappy for it.
+type WaterLevelAnalysis struct {
+	Well          *ObservationWell     `json:"well,omitempty"`
+	Unit          *AssessmentUnit      `json:"unit,omitempty"`
+	Location      *GeoPoint            `json:"location,omitempty"`
+	RadiusKm      float64              `json:"radius_km,omitempty"`
+	Wells         int                  `json:"wells"`
+	Confidence    float64              `json:"confidence"`
+	Trends        []TrendTest          `json:"trends"`
+	SeasonalNaive []WaterLevelForecast `json:"seasonal_naive,omitempty"`
+	Linear        []WaterLevelForecast `json:"linear,omitempty"`
+}
+
+// RainfallCategory is the IMD category of a rainfall departure from normal.
+type RainfallCategory string
+
+const (
+	RainfallLargeExcess    RainfallCategory = "large_excess"
+	RainfallExcess         RainfallCategory = "excess"
+	RainfallNormal         RainfallCategory = "normal"
+	RainfallDeficient      RainfallCategory = "deficient"
+	RainfallLargeDeficient RainfallCategory = "large_deficient"
+	RainfallNoRain         RainfallCategory = "no_rain"
+)
+
+// RainfallMonth is a month's rainfall in millimetres. Departure is the percentage above
+// or below Normal.
+type RainfallMonth struct {
+	Month     int      `json:"month"`
+	Rainfall  float64  `json:"rainfall"`
+	Normal    *float64 `json:"normal,omitempty"`
+	Departure *float64 `json:"departure,omitempty"`
+}
+
+// RainfallYear is a year's rainfall over the Months reported, compared with the normal
+// for the same months. The monsoon figures cover June to September and are only set
+// when all four months were reported.
+type RainfallYear struct {
+	Year             int              `json:"year"`
+	Months           int              `json:"months"`
+	Rainfall         float64          `json:"rainfall"`
+	Normal           *float64         `json:"normal,omitempty"`
+	Departure        *float64         `json:"departure,omitempty"`
+	Category         RainfallCategory `json:"category,omitempty"`
+	Monsoon          *float64         `json:"monsoon,omitempty"`
+	MonsoonNormal    *float64         `json:"monsoon_normal,omitempty"`
+	MonsoonDeparture *float64         `json:"monsoon_departure,omitempty"`
+}
+
+// RainfallSeries is a unit's rainfall by year, averaged over the Districts it takes in,
+// with the months of one Year. NormalSource says whether normals came from an imported
+// normals file or were averaged from the years on record.
+type RainfallSeries struct {
+	Unit         AssessmentUnit  `json:"unit"`
+	Districts    int             `json:"districts"`
+	NormalSource string          `json:"normal_source,omitempty"`
+	Years        []RainfallYear  `json:"years"`
+	Year         int             `json:"year,omitempty"`
+	Months       []RainfallMonth `json:"months,omitempty"`
+}
+
+// ScatterPoint is one year's pair of values for a scatter chart.
+type ScatterPoint struct {
+	Year int     `json:"year"`
+	X    float64 `json:"x"`
+	Y    float64 `json:"y"`
+}
+
+// CorrelationCoefficients relate rainfall to another variable. PValue is two-sided, for
+// Pearson's r; Slope and Intercept are the least squares line of the variable on rainfall.
+type CorrelationCoefficients struct {
+	N         int     `json:"n"`
+	Pearson   float64 `json:"pearson"`
+	Spearman  float64 `json:"spearman"`
+	PValue    float64 `json:"p_value"`
+	Slope     float64 `json:"slope"`
+	Intercept float64 `json:"intercept"`
+}
+
+// RainfallRelation pairs rainfall (x, in millimetres) with a variable (y) by year.
+// Coefficients are missing with too few years or when either side doesn't vary.
+type RainfallRelation struct {
+	Variable     string                   `json:"variable"`
+	VariableUnit string                   `json:"variable_unit"`
+	Coefficients *CorrelationCoefficients `json:"coefficients,omitempty"`
+	Points       []ScatterPoint           `json:"points"`
+}
+
+// RainfallCorrelation relates a unit's annual or monsoon rainfall to its recharge and
+// to how its water table moved.
+type RainfallCorrelation struct {
+	Unit      AssessmentUnit     `json:"unit"`
+	Rainfall  string             `json:"rainfall"`
+	Relations []RainfallRelation `json:"relations"`
+}
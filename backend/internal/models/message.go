@@ -54,6 +54,13 @@ type MessageMetadata struct {
 	MentionedUsers []uuid.UUID `json:"mentioned_users,omitempty"`
 	Hashtags   []string  `json:"hashtags,omitempty"`
 	URLs       []string  `json:"urls,omitempty"`
+	Location   *GeoPoint `json:"location,omitempty"`
+}
+
+// GeoPoint is the position shared by a location message.
+type GeoPoint struct {
+	Latitude  float64 `json:"latitude" validate:"min=-90,max=90"`
+	Longitude float64 `json:"longitude" validate:"min=-180,max=180"`
 }
 
 type Attachment struct {
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type CreateServiceAccountRequest struct {
+	Username    string `json:"username" validate:"required,min=3,max=50"`
+	DisplayName string `json:"display_name,omitempty" validate:"omitempty,max=100"`
+	Role        string `json:"role,omitempty" validate:"omitempty,max=20"`
+}
+
+// APIKey describes a service account's key; the secret itself is only shown once, see CreatedAPIKey.
+type APIKey struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	UserID      uuid.UUID  `json:"user_id" db:"user_id"`
+	Name        string     `json:"name" db:"name"`
+	Prefix      string     `json:"prefix" db:"key_prefix"`
+	Permissions []string   `json:"permissions" db:"permissions"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	Revoked     bool       `json:"revoked" db:"revoked"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" validate:"required,max=100"`
+	Permissions   []string `json:"permissions" validate:"required,min=1,dive,required"`
+	ExpiresInDays int      `json:"expires_in_days,omitempty" validate:"min=0,max=3650"`
+}
+
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+type ClientSecretResponse struct {
+	ClientID     uuid.UUID `json:"client_id"`
+	ClientSecret string    `json:"client_secret"`
+}
+
+// ClientCredentialsResponse is the OAuth 2.0 token response for the client_credentials grant.
+type ClientCredentialsResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+}
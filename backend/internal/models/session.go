@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Session struct {
+	ID             uuid.UUID    `json:"id" db:"id"`
+	IPAddress      string       `json:"ip_address,omitempty" db:"ip_address"`
+	UserAgent      string       `json:"user_agent,omitempty" db:"user_agent"`
+	Device         DeviceInfo   `json:"device" db:"-"`
+	Location       LocationHint `json:"location" db:"-"`
+	Current        bool         `json:"current" db:"-"`
+	ExpiresAt      time.Time    `json:"expires_at" db:"expires_at"`
+	CreatedAt      time.Time    `json:"created_at" db:"created_at"`
+	LastActivityAt time.Time    `json:"last_activity_at" db:"last_activity_at"`
+}
+
+type DeviceInfo struct {
+	Type    string `json:"type"`
+	OS      string `json:"os"`
+	Browser string `json:"browser"`
+}
+
+type LocationHint struct {
+	Network string `json:"network,omitempty"`
+	Scope   string `json:"scope"`
+}
+
+type RevokeSessionsResponse struct {
+	Revoked int64 `json:"revoked"`
+}
@@ -22,6 +22,10 @@ type User struct {
 	CreatedAt         time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt         time.Time  `json:"updated_at" db:"updated_at"`
 	DeletedAt         *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+
+	AccountType AccountType `json:"account_type,omitempty" db:"account_type"`
+	// IsBot marks service accounts so clients render them as bots rather than people.
+	IsBot bool `json:"is_bot" db:"-"`
 }
 
 type UserRole string
@@ -31,8 +35,23 @@ const (
 	RoleModerator UserRole = "moderator"
 	RoleUser     UserRole = "user"
 	RoleGuest    UserRole = "guest"
+	RoleService  UserRole = "service" // default role of service accounts
+)
+
+// AccountType separates people from service accounts used by bots and integrations.
+type AccountType string
+
+const (
+	AccountTypeHuman   AccountType = "human"
+	AccountTypeService AccountType = "service"
 )
 
+// SetAccountType sets the account type and whether the user renders as a bot.
+func (u *User) SetAccountType(accountType AccountType) {
+	u.AccountType = accountType
+	u.IsBot = accountType == AccountTypeService
+}
+
 type UserStatus string
 
 const (
@@ -57,7 +76,7 @@ type LoginRequest struct {
 type RegisterRequest struct {
 	Username  string `json:"username" validate:"required,min=3,max=50"`
 	Email     string `json:"email" validate:"required,email"`
-	Password  string `json:"password" validate:"required,min=8"`
+	Password  string `json:"password" validate:"required"`
 	FirstName string `json:"first_name,omitempty"`
 	LastName  string `json:"last_name,omitempty"`
 	Phone     string `json:"phone,omitempty"`
@@ -72,13 +91,19 @@ type UpdateProfileRequest struct {
 
 type ChangePasswordRequest struct {
 	CurrentPassword string `json:"current_password" validate:"required"`
-	NewPassword     string `json:"new_password" validate:"required,min=8"`
+	NewPassword     string `json:"new_password" validate:"required"`
 	ConfirmPassword string `json:"confirm_password" validate:"required,eqfield=NewPassword"`
 }
 
+type UpdateUserStatusRequest struct {
+	Status UserStatus `json:"status" validate:"required,oneof=active inactive suspended banned"`
+	Reason string     `json:"reason,omitempty" validate:"max=500"`
+}
+
 type AuthResponse struct {
-	User  UserProfile `json:"user"`
-	Token string      `json:"token"`
+	User         UserProfile `json:"user"`
+	Token        string      `json:"token"`
+	RefreshToken string      `json:"refresh_token,omitempty"`
 }
 
 type PasswordResetRequest struct {
@@ -87,5 +112,87 @@ type PasswordResetRequest struct {
 
 type PasswordResetConfirm struct {
 	Token    string `json:"token" validate:"required"`
-	Password string `json:"password" validate:"required,min=8"`
+	Password string `json:"password" validate:"required"`
+}
+
+type PasswordlessLoginRequest struct {
+	Email  string `json:"email" validate:"required,email"`
+	Method string `json:"method" validate:"omitempty,oneof=link code"`
+}
+
+type MagicLinkLoginRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// OIDCExchangeRequest carries the one-time code an identity provider login redirects back with.
+type OIDCExchangeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type LoginCodeRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	Code  string `json:"code" validate:"required,len=6,numeric"`
+}
+
+// LoginChallengeRequest completes a sign-in that needed step-up verification.
+type LoginChallengeRequest struct {
+	ChallengeID string `json:"challenge_id" validate:"required,uuid"`
+	Code        string `json:"code" validate:"required,len=6,numeric"`
+}
+
+type PhoneRequest struct {
+	Phone string `json:"phone" validate:"required"`
+}
+
+type PhoneVerifyRequest struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+type PhoneLoginRequest struct {
+	Phone string `json:"phone" validate:"required"`
+	Code  string `json:"code" validate:"required,len=6,numeric"`
+}
+
+type UpdateRolePermissionsRequest struct {
+	Permissions []string `json:"permissions" validate:"required,dive,required"`
+}
+
+type ChangeUsernameRequest struct {
+	Username string `json:"username" validate:"required"`
+}
+
+type ChangeEmailRequest struct {
+	NewEmail string `json:"new_email" validate:"required,email"`
+	// Password is required unless the account only signs in through an identity provider
+	Password string `json:"password"`
+	// ReauthCode stands in for the password on accounts without one
+	ReauthCode string `json:"reauth_code"`
+}
+
+type ConfirmEmailChangeRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type DeleteAccountRequest struct {
+	// Password is required unless the account only signs in through an identity provider
+	Password string `json:"password"`
+	// ReauthCode stands in for the password on accounts without one
+	ReauthCode string `json:"reauth_code"`
+	Confirm    string `json:"confirm" validate:"required,eq=DELETE"`
+}
+
+type CancelDeletionRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type ImpersonateRequest struct {
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+type UnlockAccountRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type UnlockAccountConfirm struct {
+	Token string `json:"token" validate:"required"`
 }
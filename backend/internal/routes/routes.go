@@ -1,26 +1,50 @@
 package routes
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/didip/tollbooth"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/account"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/alerts"
 	"github.com/hxrshxz/ground-sense-bot/backend/internal/auth"
 	"github.com/hxrshxz/ground-sense-bot/backend/internal/chat"
 	"github.com/hxrshxz/ground-sense-bot/backend/internal/config"
 	"github.com/hxrshxz/ground-sense-bot/backend/internal/database"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/groundwater"
 	"github.com/hxrshxz/ground-sense-bot/backend/internal/handlers"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/mail"
 	"github.com/hxrshxz/ground-sense-bot/backend/internal/middleware"
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/sms"
 	"github.com/sirupsen/logrus"
 )
 
 func RegisterRoutes(mux *http.ServeMux, cfg *config.Config, db *database.Service, logger *logrus.Logger) {
+	if err := middleware.TrustProxies(cfg.Server.TrustedProxies); err != nil {
+		logger.WithError(err).Fatal("Invalid trusted proxies")
+	}
+
 	// Initialize services
-	authService := auth.NewService(db.DB, cfg)
+	mailer := mail.NewSender(cfg.Email, logger)
+	smsSender := sms.NewSender(cfg.SMS, logger)
+	authService, err := auth.NewService(db.DB, cfg, mailer, smsSender)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to initialize auth service")
+	}
+	accountService := account.NewService(db, cfg, authService, mailer, logger)
+	groundwaterService := groundwater.NewService(db, logger)
+	alertService := alerts.NewService(db, cfg, mailer, logger)
 
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(authService, logger)
 	chatHandler := handlers.NewChatHandler(logger)
 	userHandler := handlers.NewUserHandler(db, logger)
+	sessionHandler := handlers.NewSessionHandler(authService, logger)
+	phoneHandler := handlers.NewPhoneHandler(authService, logger)
+	accountHandler := handlers.NewAccountHandler(accountService, logger)
+	profileHandler := handlers.NewProfileHandler(authService, logger)
+	alertHandler := handlers.NewAlertHandler(alertService, logger)
+	groundwaterHandler := handlers.NewGroundwaterHandler(groundwaterService, cfg.Map.Breakpoints, logger)
 	healthHandler := handlers.NewHealthHandler(db, logger)
 
 	// Rate limiter
@@ -42,19 +66,64 @@ func RegisterRoutes(mux *http.ServeMux, cfg *config.Config, db *database.Service
 	mux.Handle("/api/v1/health", middleware.HealthCheck(db.DB))
 	mux.Handle("/api/v1/metrics", middleware.MetricsHandler())
 
+	// Public verification keys for other services
+	mux.HandleFunc("/.well-known/jwks.json", authHandler.JWKS)
+
 	// Authentication routes (no auth required)
 	mux.HandleFunc("/api/v1/auth/register", authHandler.Register)
 	mux.HandleFunc("/api/v1/auth/login", authHandler.Login)
+	mux.HandleFunc("/api/v1/auth/login/verify", authHandler.VerifyLogin)
 	mux.HandleFunc("/api/v1/auth/refresh", authHandler.RefreshToken)
+	mux.Handle("/api/v1/auth/logout", middleware.OptionalAuth(authService)(http.HandlerFunc(authHandler.Logout)))
 	mux.HandleFunc("/api/v1/auth/password-reset/request", authHandler.RequestPasswordReset)
 	mux.HandleFunc("/api/v1/auth/password-reset/confirm", authHandler.ResetPassword)
+	mux.HandleFunc("/api/v1/auth/unlock/request", authHandler.RequestAccountUnlock)
+	mux.HandleFunc("/api/v1/auth/unlock/confirm", authHandler.UnlockAccount)
+	mux.HandleFunc("/api/v1/auth/passwordless/request", authHandler.RequestPasswordlessLogin)
+	mux.HandleFunc("/api/v1/auth/passwordless/link", authHandler.LoginWithMagicLink)
+	mux.HandleFunc("/api/v1/auth/passwordless/code", authHandler.LoginWithCode)
+	mux.HandleFunc("/api/v1/auth/phone/request", phoneHandler.RequestLogin)
+	mux.HandleFunc("/api/v1/auth/phone/login", phoneHandler.Login)
+	mux.HandleFunc("/api/v1/auth/oidc/exchange", authHandler.OIDCExchange)
+	mux.HandleFunc("/api/v1/auth/oidc/", authHandler.OIDC)
+	mux.HandleFunc("/api/v1/auth/account-deletion/cancel", accountHandler.CancelDeletion)
+	mux.HandleFunc("/api/v1/auth/email-change/confirm", profileHandler.ConfirmEmailChange)
+	mux.HandleFunc("/api/v1/auth/token", authHandler.Token)
+
+	// Groundwater data (readable without signing in while the guest role has datasets:read)
+	readDatasets := middleware.GuestAccess(authService, auth.PermDatasetsRead)
+	mux.Handle("/api/v1/groundwater/units", readDatasets(http.HandlerFunc(groundwaterHandler.ListUnits)))
+	mux.Handle("/api/v1/groundwater/units/", readDatasets(http.HandlerFunc(groundwaterHandler.Unit)))
+	mux.Handle("/api/v1/groundwater/compare", readDatasets(http.HandlerFunc(groundwaterHandler.Compare)))
+	mux.Handle("/api/v1/groundwater/places", readDatasets(http.HandlerFunc(groundwaterHandler.Places)))
+	mux.Handle("/api/v1/groundwater/locate", readDatasets(http.HandlerFunc(groundwaterHandler.Locate)))
+	mux.Handle("/api/v1/groundwater/map", readDatasets(http.HandlerFunc(groundwaterHandler.Map)))
+	mux.Handle("/api/v1/groundwater/wells", readDatasets(http.HandlerFunc(groundwaterHandler.Wells)))
+	mux.Handle("/api/v1/groundwater/wells/", readDatasets(http.HandlerFunc(groundwaterHandler.Well)))
+	mux.Handle("/api/v1/groundwater/water-levels", readDatasets(http.HandlerFunc(groundwaterHandler.WaterLevels)))
+	mux.Handle("/api/v1/groundwater/water-levels/", readDatasets(http.HandlerFunc(groundwaterHandler.WaterLevels)))
 
 	// Protected routes with authentication
 	protectedMux := http.NewServeMux()
 
 	// User routes
 	protectedMux.HandleFunc("/api/v1/users/profile", userHandler.GetProfile)
-	protectedMux.HandleFunc("/api/v1/users/change-password", userHandler.ChangePassword)
+	// Sign-in details stay out of reach of administrators acting as the user
+	denyImpersonation := middleware.DenyImpersonation()
+	protectedMux.Handle("/api/v1/users/change-password", denyImpersonation(http.HandlerFunc(userHandler.ChangePassword)))
+	protectedMux.Handle("/api/v1/users/sessions", denyImpersonation(http.HandlerFunc(sessionHandler.Sessions)))
+	protectedMux.Handle("/api/v1/users/sessions/", denyImpersonation(http.HandlerFunc(sessionHandler.RevokeSession)))
+	protectedMux.Handle("/api/v1/users/phone/send", denyImpersonation(http.HandlerFunc(phoneHandler.SendVerification)))
+	protectedMux.Handle("/api/v1/users/phone/verify", denyImpersonation(http.HandlerFunc(phoneHandler.Verify)))
+	protectedMux.Handle("/api/v1/users/username", denyImpersonation(http.HandlerFunc(profileHandler.ChangeUsername)))
+	protectedMux.Handle("/api/v1/users/email", denyImpersonation(http.HandlerFunc(profileHandler.RequestEmailChange)))
+	protectedMux.Handle("/api/v1/users/reauth-code", denyImpersonation(http.HandlerFunc(profileHandler.RequestReauthCode)))
+	protectedMux.Handle("/api/v1/users/account", denyImpersonation(http.HandlerFunc(accountHandler.Delete)))
+	protectedMux.Handle("/api/v1/users/account/export", denyImpersonation(http.HandlerFunc(accountHandler.Export)))
+	protectedMux.HandleFunc("/api/v1/users/watchlist", alertHandler.Watchlist)
+	protectedMux.HandleFunc("/api/v1/users/watchlist/", alertHandler.Unwatch)
+	protectedMux.HandleFunc("/api/v1/users/alert-preferences", alertHandler.Preferences)
+	protectedMux.HandleFunc("/api/v1/users/alerts", alertHandler.Alerts)
 	protectedMux.HandleFunc("/api/v1/users/", userHandler.GetUser)
 
 	// Chat routes
@@ -73,11 +142,23 @@ func RegisterRoutes(mux *http.ServeMux, cfg *config.Config, db *database.Service
 	protectedMux.HandleFunc("/api/v1/files/", fileHandler.DeleteFile)
 
 	// Admin routes
-	adminHandler := handlers.NewAdminHandler(db, logger)
-	protectedMux.HandleFunc("/api/v1/admin/users", adminHandler.GetUsers)
-	protectedMux.HandleFunc("/api/v1/admin/users/", adminHandler.UpdateUserStatus)
-	protectedMux.HandleFunc("/api/v1/admin/stats", adminHandler.GetSystemStats)
-	protectedMux.HandleFunc("/api/v1/admin/audit-logs", adminHandler.GetAuditLogs)
+	adminHandler := handlers.NewAdminHandler(db, authService, logger)
+	requirePermission := func(permission string, handler http.HandlerFunc) http.Handler {
+		return middleware.RequirePermission(authService, permission)(handler)
+	}
+	protectedMux.Handle("/api/v1/admin/users", requirePermission(auth.PermUsersRead, adminHandler.GetUsers))
+	protectedMux.HandleFunc("/api/v1/admin/users/", adminHandler.UserActions)
+	protectedMux.Handle("/api/v1/admin/stats", requirePermission(auth.PermStatsRead, adminHandler.GetSystemStats))
+	protectedMux.Handle("/api/v1/admin/audit-logs", requirePermission(auth.PermAuditRead, adminHandler.GetAuditLogs))
+	protectedMux.Handle("/api/v1/admin/roles", requirePermission(auth.PermRolesManage, adminHandler.Roles))
+	protectedMux.Handle("/api/v1/admin/roles/", requirePermission(auth.PermRolesManage, adminHandler.UpdateRole))
+	serviceAccountHandler := handlers.NewServiceAccountHandler(authService, logger)
+	protectedMux.Handle("/api/v1/admin/service-accounts",
+		requirePermission(auth.PermServiceAccountsManage, serviceAccountHandler.ServiceAccounts))
+	protectedMux.Handle("/api/v1/admin/service-accounts/",
+		requirePermission(auth.PermServiceAccountsManage, serviceAccountHandler.ServiceAccount))
+	protectedMux.Handle("/api/v1/admin/groundwater/boundaries",
+		requirePermission(auth.PermDatasetsPublish, groundwaterHandler.ImportBoundaries))
 
 	// Apply authentication middleware to protected routes
 	authMiddleware := middleware.Authenticate(authService)
@@ -85,13 +166,13 @@ func RegisterRoutes(mux *http.ServeMux, cfg *config.Config, db *database.Service
 		"/api/v1/users/":     authMiddleware(protectedMux),
 		"/api/v1/chat/":      authMiddleware(protectedMux),
 		"/api/v1/files/":     authMiddleware(protectedMux),
-		"/api/v1/admin/":     authMiddleware(protectedMux),
+		"/api/v1/admin/":     authMiddleware(denyImpersonation(protectedMux)),
 	} {
 		mux.Handle(pattern, handler)
 	}
 
 	// WebSocket route (with optional auth)
-	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+	mux.Handle("/ws", middleware.OptionalAuth(authService)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Optional auth for WebSocket connections
 		ctx := r.Context()
 		if claims, ok := middleware.GetUserFromContext(ctx); ok {
@@ -101,11 +182,18 @@ func RegisterRoutes(mux *http.ServeMux, cfg *config.Config, db *database.Service
 			// Anonymous connection
 			chat.ServeWs(w, r)
 		}
-	})
+	})))
 
-	// Start chat hub
+	// Start chat hub; shared locations are answered with the groundwater status there
+	chat.GetHub().SetLocationResponder(groundwaterService.DescribeLocation, db.ConversationParticipants, db.SaveSystemMessage)
 	go chat.GetHub().Run()
 
+	// Anonymise and purge deleted accounts once their grace and retention periods pass
+	go accountService.Run(context.Background())
+
+	// Diff new assessment datasets against watchlists and send alerts and weekly digests
+	go alertService.Run(context.Background())
+
 	// API documentation
 	mux.Handle("/docs/", http.StripPrefix("/docs/", http.FileServer(http.Dir("./docs/"))))
 
@@ -197,7 +285,7 @@ func RegisterRoutes(mux *http.ServeMux, cfg *config.Config, db *database.Service
 
 	// Admin routes (require admin role)
 	adminRoutes := protected.PathPrefix("/admin").Subrouter()
-	adminRoutes.Use(middleware.RequireRole("admin"))
+	adminRoutes.Use(middleware.RequirePermission(authService, auth.PermUsersRead))
 
 	adminRoutes.HandleFunc("/users", handlers.NewAdminHandler(db, logger).GetUsers).Methods("GET")
 	adminRoutes.HandleFunc("/users/{id}/status", handlers.NewAdminHandler(db, logger).UpdateUserStatus).Methods("PUT")
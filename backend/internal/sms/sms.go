@@ -0,0 +1,127 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hxrshxz/ground-sense-bot/backend/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+type Message struct {
+	To   string
+	Body string
+}
+
+// Sender delivers text messages such as one-time codes.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewSender picks the SMS backend named by SMS_PROVIDER: "http" posts to a gateway,
+// "file" appends to a local file and "log" notes the message in the log.
+func NewSender(cfg config.SMSConfig, logger *logrus.Logger) Sender {
+	switch cfg.Provider {
+	case "http":
+		return NewHTTPSender(cfg)
+	case "file":
+		return &FileSender{path: cfg.FilePath}
+	default:
+		return &LogSender{logger: logger}
+	}
+}
+
+// HTTPSender posts messages as JSON to an SMS gateway.
+type HTTPSender struct {
+	client   *http.Client
+	url      string
+	apiKey   string
+	senderID string
+}
+
+func NewHTTPSender(cfg config.SMSConfig) *HTTPSender {
+	return &HTTPSender{
+		client:   &http.Client{Timeout: 10 * time.Second},
+		url:      cfg.GatewayURL,
+		apiKey:   cfg.APIKey,
+		senderID: cfg.SenderID,
+	}
+}
+
+func (s *HTTPSender) Send(ctx context.Context, msg Message) error {
+	payload, err := json.Marshal(map[string]string{
+		"to":        msg.To,
+		"message":   msg.Body,
+		"sender_id": s.senderID,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("sms gateway returned %s", resp.Status)
+	}
+	return nil
+}
+
+// FileSender appends messages to a file, one JSON object per line, so tests and
+// local tooling can read the codes that were sent.
+type FileSender struct {
+	mu   sync.Mutex
+	path string
+}
+
+func (s *FileSender) Send(ctx context.Context, msg Message) error {
+	line, err := json.Marshal(map[string]string{
+		"to":      msg.To,
+		"body":    msg.Body,
+		"sent_at": time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// LogSender notes messages in the log instead of sending them. The body is left out, as
+// it carries one-time codes; read them with the file provider instead.
+type LogSender struct {
+	logger *logrus.Logger
+}
+
+func (s *LogSender) Send(ctx context.Context, msg Message) error {
+	s.logger.WithField("to", msg.To).Info("SMS not sent: SMS_PROVIDER is log")
+	return nil
+}